@@ -1,26 +1,203 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
+	"github.com/spf13/cobra"
 	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/indexer/actions/bank"
+	"github.com/strangelove-ventures/valis/indexer/actions/cw721"
 	"github.com/strangelove-ventures/valis/indexer/actions/daodao"
+	"github.com/strangelove-ventures/valis/indexer/actions/gov"
 	"github.com/strangelove-ventures/valis/indexer/actions/ibc"
+	"github.com/strangelove-ventures/valis/indexer/actions/ibcchannels"
+	"github.com/strangelove-ventures/valis/indexer/actions/jsonmsgs"
+	"github.com/strangelove-ventures/valis/indexer/actions/msgsigners"
+	"github.com/strangelove-ventures/valis/indexer/actions/staking"
+	"github.com/strangelove-ventures/valis/indexer/actions/validators"
+	"github.com/strangelove-ventures/valis/indexer/actions/vesting"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
 )
 
+// actionInfo describes a block action that can be configured in the actions section of the config.
+type actionInfo struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+// availableActions lists every block action that can be returned by GetBlockActionByName.
+//
+// NOTE: New indexer.BlockAction's should also be listed here so they show up in `actions list`.
+var availableActions = []actionInfo{
+	{Name: ibc.BlockActionName, Description: "ICS-20 fungible token transfers along with their packet acks, timeouts and client updates"},
+	{Name: daodao.BlockActionName, Description: "DAODAO smart contracts, proposals and votes along with CW20 transfers and running balances"},
+	{Name: cw721.BlockActionName, Description: "CW721 (NFT) mints, transfers and burns along with the current owner of each token"},
+	{Name: validators.BlockActionName, Description: "Which validators signed each block, for tracking validator uptime"},
+	{Name: jsonmsgs.BlockActionName, Description: "Msgs of the types listed in the json-msgs section of the config, stored as JSON in the configured tables"},
+	{Name: msgsigners.BlockActionName, Description: "The signers of every msg regardless of its type, for querying the activity of an account"},
+	{Name: vesting.BlockActionName, Description: "Vesting accounts created with MsgCreateVestingAccount, along with their vesting schedule"},
+	{Name: bank.BlockActionName, Description: "Tokens sent with MsgSend and MsgMultiSend, with a row per sender, recipient and denom"},
+	{Name: staking.BlockActionName, Description: "Delegations, undelegations and redelegations along with the creation of validators"},
+	{Name: gov.BlockActionName, Description: "Governance proposals along with their votes, weighted votes and deposits"},
+	{Name: ibcchannels.BlockActionName, Description: "IBC client creations and updates along with the connection and channel handshakes"},
+}
+
+func actionsCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "actions",
+		Aliases: []string{"act"},
+		Short:   "Inspect the available block actions",
+	}
+
+	cmd.AddCommand(
+		actionsListCmd(a),
+	)
+
+	return cmd
+}
+
+// actionsListCmd lists the block actions that can be configured.
+func actionsListCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"l"},
+		Short:   "List the block actions available for configuration",
+		Args:    cobra.NoArgs,
+		Example: strings.TrimSpace(fmt.Sprintf(`
+$ %s actions list
+$ %s actions list --json
+$ %s actions list --config-snippet >> ~/.valis/config/config.yaml`, appName, appName, appName)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jsn, err := cmd.Flags().GetBool(flagJSON)
+			if err != nil {
+				return err
+			}
+
+			snippet, err := cmd.Flags().GetBool(flagConfigSnippet)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case jsn && snippet:
+				return fmt.Errorf("can't pass both --json and --config-snippet, must pick one")
+			case jsn:
+				out, err := json.Marshal(availableActions)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			case snippet:
+				out, err := actionsConfigSnippet(availableActions)
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(cmd.OutOrStdout(), string(out))
+			default:
+				for _, action := range availableActions {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s - %s\n", action.Name, action.Description)
+				}
+			}
+			return nil
+		},
+	}
+
+	return configSnippetFlag(a.Viper, jsonFlag(a.Viper, cmd))
+}
+
+// actionsConfigSnippet returns a ready to paste yaml actions section, with each action's description as a comment.
+func actionsConfigSnippet(actions []actionInfo) ([]byte, error) {
+	seq := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, action := range actions {
+		seq.Content = append(seq.Content, &yaml.Node{
+			Kind:        yaml.ScalarNode,
+			Value:       action.Name,
+			LineComment: action.Description,
+		})
+	}
+
+	return yaml.Marshal(&yaml.Node{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "actions"},
+			seq,
+		},
+	})
+}
+
 // GetBlockActionByName returns an indexer.BlockAction if there is a configured action matching
 // the specified name.
 //
 // NOTE: New indexer.BlockAction's should be registered here in a case that returns a new struct if
 //       the name parameter matches the value returned by BlockAction.Name()
 func (c *Config) GetBlockActionByName(log *zap.Logger, name string) (indexer.BlockAction, error) {
+	log, err := c.actionLogger(log, name)
+	if err != nil {
+		return nil, err
+	}
+
 	switch name {
 	case ibc.BlockActionName:
 		return ibc.NewIBCTransfer(log.With(zap.String("block_action", ibc.BlockActionName))), nil
 	case daodao.BlockActionName:
-		return daodao.NewDAODAOAction(log.With(zap.String("block_action", daodao.BlockActionName))), nil
+		return daodao.NewDAODAOAction(log.With(zap.String("block_action", daodao.BlockActionName)), c.DAODAO.SequentialBlocks), nil
+	case cw721.BlockActionName:
+		return cw721.NewCW721Action(log.With(zap.String("block_action", cw721.BlockActionName))), nil
+	case validators.BlockActionName:
+		return validators.NewValidatorSignaturesAction(log.With(zap.String("block_action", validators.BlockActionName))), nil
+	case jsonmsgs.BlockActionName:
+		return jsonmsgs.NewJSONMsgsAction(log.With(zap.String("block_action", jsonmsgs.BlockActionName)), c.JSONMsgHandlers())
+	case msgsigners.BlockActionName:
+		return msgsigners.NewMsgSignersAction(log.With(zap.String("block_action", msgsigners.BlockActionName))), nil
+	case vesting.BlockActionName:
+		return vesting.NewVestingAction(log.With(zap.String("block_action", vesting.BlockActionName))), nil
+	case bank.BlockActionName:
+		return bank.NewBankTransfersAction(log.With(zap.String("block_action", bank.BlockActionName)), c.Bank.FeeShares), nil
+	case staking.BlockActionName:
+		return staking.NewStakingAction(log.With(zap.String("block_action", staking.BlockActionName))), nil
+	case gov.BlockActionName:
+		return gov.NewGovAction(log.With(zap.String("block_action", gov.BlockActionName))), nil
+	case ibcchannels.BlockActionName:
+		return ibcchannels.NewIBCChannelsAction(log.With(zap.String("block_action", ibcchannels.BlockActionName))), nil
 	default:
 		return nil, fmt.Errorf("there is no block action configured with the name %s", name)
 	}
 }
+
+// actionLogger returns the logger for the named block action, at the level configured in the log-levels section
+// of the config if there is one.
+func (c *Config) actionLogger(log *zap.Logger, name string) (*zap.Logger, error) {
+	levelStr, ok := c.LogLevels[name]
+	if !ok {
+		return log, nil
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(levelStr)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q for block action %s: %w", levelStr, name, err)
+	}
+	return withLevel(log, level), nil
+}
+
+// configuredBlockActions returns the block actions listed in the actions section of the config,
+// actions that can't be found are logged and skipped.
+func configuredBlockActions(a *appState) []indexer.BlockAction {
+	var actions []indexer.BlockAction
+	for _, name := range a.Config.Actions {
+		action, err := a.Config.GetBlockActionByName(a.Log, name)
+		if err != nil {
+			a.Log.Info(
+				"Failed to get block action",
+				zap.String("block_action_name", name),
+				zap.Error(err),
+			)
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
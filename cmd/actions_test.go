@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/indexer/actions/ibc"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gopkg.in/yaml.v3"
+)
+
+func TestActionsConfigSnippet(t *testing.T) {
+	a := &appState{Log: zap.NewNop(), Viper: viper.New()}
+
+	var out bytes.Buffer
+	cmd := actionsListCmd(a)
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--config-snippet"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("actions list returned unexpected error: %v", err)
+	}
+
+	var c Config
+	if err := yaml.Unmarshal(out.Bytes(), &c); err != nil {
+		t.Fatalf("failed to parse config snippet %q: %v", out.String(), err)
+	}
+	// The json_msgs action additionally needs the msg types it stores, which the snippet can't know
+	c.JSONMsgs = []JSONMsgConfig{{TypeURL: "/cosmos.bank.v1beta1.MsgSend", Table: "bank_sends"}}
+
+	if len(c.Actions) != len(availableActions) {
+		t.Fatalf("snippet configures actions %v, want every available action", c.Actions)
+	}
+	for j, name := range c.Actions {
+		if name != availableActions[j].Name {
+			t.Errorf("action %d = %s, want %s", j, name, availableActions[j].Name)
+		}
+		if _, err := c.GetBlockActionByName(zap.NewNop(), name); err != nil {
+			t.Errorf("configured action %s is invalid: %v", name, err)
+		}
+		if !strings.Contains(out.String(), "# "+availableActions[j].Description) {
+			t.Errorf("snippet is missing the description of %s as a comment", name)
+		}
+	}
+}
+
+func TestGetBlockActionByName(t *testing.T) {
+	c := &Config{JSONMsgs: []JSONMsgConfig{{TypeURL: "/cosmos.bank.v1beta1.MsgSend", Table: "bank_sends"}}}
+	for _, available := range availableActions {
+		action, err := c.GetBlockActionByName(zap.NewNop(), available.Name)
+		if err != nil {
+			t.Errorf("GetBlockActionByName(%s) returned unexpected error: %v", available.Name, err)
+			continue
+		}
+		if action.Name() != available.Name {
+			t.Errorf("GetBlockActionByName(%s) returned action %s", available.Name, action.Name())
+		}
+	}
+
+	action, err := c.GetBlockActionByName(zap.NewNop(), ibc.BlockActionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := action.(*ibc.IBCTransferAction); !ok || ibc.BlockActionName != "ics20_transfers" {
+		t.Errorf("ics20_transfers is implemented by %T, want *ibc.IBCTransferAction", action)
+	}
+
+	if _, err := c.GetBlockActionByName(zap.NewNop(), "ics20_transfer"); err == nil {
+		t.Error("GetBlockActionByName returned no error for an unknown action")
+	}
+}
+
+func TestAvailableActionsSharedTables(t *testing.T) {
+	configuredActions := func(c *Config, names ...string) []indexer.BlockAction {
+		var actions []indexer.BlockAction
+		for _, name := range names {
+			action, err := c.GetBlockActionByName(zap.NewNop(), name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actions = append(actions, action)
+		}
+		return actions
+	}
+
+	c := &Config{JSONMsgs: []JSONMsgConfig{{TypeURL: "/cosmos.bank.v1beta1.MsgSend", Table: "bank_sends"}}}
+	var names []string
+	for _, available := range availableActions {
+		names = append(names, available.Name)
+	}
+	if err := indexer.CheckSharedTables(zap.NewNop(), configuredActions(c, names...)); err != nil {
+		t.Errorf("CheckSharedTables returned %v for every available action", err)
+	}
+
+	// A json_msgs handler storing MsgTransfers in the table of the typed ics20_transfers action
+	c.JSONMsgs = []JSONMsgConfig{{TypeURL: "/ibc.applications.transfer.v1.MsgTransfer", Table: "msg_transfers"}}
+	if err := indexer.CheckSharedTables(zap.NewNop(), configuredActions(c, ibc.BlockActionName, "json_msgs")); err == nil {
+		t.Error("CheckSharedTables returned no error for json_msgs writing to msg_transfers")
+	}
+}
+
+func TestActionLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	log := zap.New(core)
+	c := &Config{LogLevels: map[string]string{"daodao": "debug", "ics20_transfers": "warn"}}
+
+	for _, name := range []string{"daodao", "ics20_transfers", "msg_signers"} {
+		actionLog, err := c.actionLogger(log, name)
+		if err != nil {
+			t.Fatalf("actionLogger(%s) returned unexpected error: %v", name, err)
+		}
+		actionLog = actionLog.With(zap.String("block_action", name))
+		actionLog.Debug("debug")
+		actionLog.Info("info")
+		actionLog.Warn("warn")
+	}
+
+	got := make(map[string][]string)
+	for _, entry := range logs.All() {
+		name := entry.ContextMap()["block_action"].(string)
+		got[name] = append(got[name], entry.Message)
+	}
+	expected := map[string][]string{
+		"daodao":          {"debug", "info", "warn"},
+		"ics20_transfers": {"warn"},
+		"msg_signers":     {"info", "warn"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got logged messages %v, expected %v", got, expected)
+	}
+
+	c.LogLevels["daodao"] = "verbose"
+	if _, err := c.GetBlockActionByName(log, "daodao"); err == nil {
+		t.Error("expected an error for an invalid log level")
+	}
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/tendermint/tendermint/libs/bytes"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"gopkg.in/yaml.v3"
+)
+
+// benchReport is the result of a benchmark run.
+type benchReport struct {
+	ChainID         string         `json:"chain-id" yaml:"chain-id"`
+	Blocks          int64          `json:"blocks" yaml:"blocks"`
+	Txs             int64          `json:"txs" yaml:"txs"`
+	Duration        string         `json:"duration" yaml:"duration"`
+	BlocksPerSecond float64        `json:"blocks-per-second" yaml:"blocks-per-second"`
+	AvgTxsPerBlock  float64        `json:"avg-txs-per-block" yaml:"avg-txs-per-block"`
+	RPCCalls        map[string]int `json:"rpc-calls" yaml:"rpc-calls"`
+}
+
+// benchCmd measures how fast the configured actions can index recent blocks of a chain, without persisting anything.
+func benchCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench [chain-id]",
+		Short: "Benchmark indexing throughput against a chain's RPC endpoint without writing to the database",
+		Args:  cobra.ExactArgs(1),
+		Example: strings.TrimSpace(fmt.Sprintf(`
+$ %s bench cosmoshub-4
+$ %s bench osmosis-1 --blocks 500 --concurrent-blocks 20`, appName, appName)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			numBlocks, err := cmd.Flags().GetInt64(flagBlocks)
+			if err != nil {
+				return err
+			}
+			if numBlocks < 1 {
+				return fmt.Errorf("invalid flag value %d, value of --blocks must be greater than or equal to 1", numBlocks)
+			}
+
+			concurrentBlocks, err := cmd.Flags().GetUint(flagConcurrentBlocks)
+			if err != nil {
+				return err
+			}
+			if concurrentBlocks < 1 {
+				return fmt.Errorf("invalid flag value %d, value of --concurrent-blocks must be greater than or equal to 1", concurrentBlocks)
+			}
+
+			jsn, err := cmd.Flags().GetBool(flagJSON)
+			if err != nil {
+				return err
+			}
+
+			chainConfig, err := a.Config.GetChainConfig(args[0])
+			if err != nil {
+				return err
+			}
+
+			chainClient, err := newChainClient(cmd, a, chainConfig)
+			if err != nil {
+				return err
+			}
+
+			// Count the RPC calls made while indexing
+			rpc := newCountingRPCClient(chainClient.RPCClient)
+			chainClient.RPCClient = rpc
+
+			// Statements are built but never executed against a database
+			db, err := indexer.NewDryRunDatabase()
+			if err != nil {
+				return err
+			}
+
+			timeouts, err := a.Config.Timeouts.Parse()
+			if err != nil {
+				return err
+			}
+
+			i := indexer.NewIndexer(a.Log, chainClient, db)
+			i.Timeouts = timeouts
+
+			stats := &benchStatsAction{}
+			actions := append([]indexer.BlockAction{stats}, configuredBlockActions(a)...)
+			if err = i.ValidateActions(actions); err != nil {
+				return err
+			}
+
+			latestHeight, err := i.QueryLatestHeight(ctx)
+			if err != nil {
+				return err
+			}
+
+			beginBlock := latestHeight - numBlocks
+			if beginBlock < 1 {
+				beginBlock = 1
+			}
+
+			var blocks []int64
+			for h := beginBlock; h < latestHeight; h++ {
+				blocks = append(blocks, h)
+			}
+
+			start := time.Now()
+			if err := i.ForEachBlock(ctx, blocks, actions, concurrentBlocks); err != nil {
+				return err
+			}
+			elapsed := time.Since(start)
+
+			report := benchReport{
+				ChainID:  chainConfig.ChainID,
+				Blocks:   atomic.LoadInt64(&stats.blocks),
+				Txs:      atomic.LoadInt64(&stats.txs),
+				Duration: elapsed.String(),
+				RPCCalls: rpc.Calls(),
+			}
+			if elapsed > 0 {
+				report.BlocksPerSecond = float64(report.Blocks) / elapsed.Seconds()
+			}
+			if report.Blocks > 0 {
+				report.AvgTxsPerBlock = float64(report.Txs) / float64(report.Blocks)
+			}
+
+			var out []byte
+			if jsn {
+				out, err = json.Marshal(report)
+			} else {
+				out, err = yaml.Marshal(report)
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			return nil
+		},
+	}
+	return jsonFlag(a.Viper, blocksFlag(a.Viper, concurrentBlocksFlag(a.Viper, cmd)))
+}
+
+// benchStatsAction is an indexer.BlockAction that counts the blocks and txs processed during a benchmark.
+type benchStatsAction struct {
+	blocks int64
+	txs    int64
+}
+
+func (b *benchStatsAction) Name() string {
+	return "bench_stats"
+}
+
+func (b *benchStatsAction) MigrateSchema(*indexer.Indexer) error {
+	return indexer.ErrNoMigrations
+}
+
+// MsgTypes returns no msg types, the stats action only counts txs so it shouldn't disable the msg type filtering
+// of the configured actions.
+func (b *benchStatsAction) MsgTypes() []string {
+	return nil
+}
+
+func (b *benchStatsAction) Execute(_ context.Context, _ *indexer.Indexer, block *coretypes.ResultBlock) error {
+	atomic.AddInt64(&b.blocks, 1)
+	atomic.AddInt64(&b.txs, int64(len(block.Block.Data.Txs)))
+	return nil
+}
+
+// countingRPCClient wraps a rpcclient.Client and counts the calls made to the RPC methods used while indexing.
+type countingRPCClient struct {
+	rpcclient.Client
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func newCountingRPCClient(client rpcclient.Client) *countingRPCClient {
+	return &countingRPCClient{
+		Client: client,
+		calls:  make(map[string]int),
+	}
+}
+
+// Calls returns a copy of the number of calls made per RPC method.
+func (c *countingRPCClient) Calls() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	calls := make(map[string]int, len(c.calls))
+	for method, n := range c.calls {
+		calls[method] = n
+	}
+	return calls
+}
+
+func (c *countingRPCClient) count(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[method]++
+}
+
+func (c *countingRPCClient) Block(ctx context.Context, height *int64) (*coretypes.ResultBlock, error) {
+	c.count("block")
+	return c.Client.Block(ctx, height)
+}
+
+func (c *countingRPCClient) BlockResults(ctx context.Context, height *int64) (*coretypes.ResultBlockResults, error) {
+	c.count("block_results")
+	return c.Client.BlockResults(ctx, height)
+}
+
+func (c *countingRPCClient) Tx(ctx context.Context, hash []byte, prove bool) (*coretypes.ResultTx, error) {
+	c.count("tx")
+	return c.Client.Tx(ctx, hash, prove)
+}
+
+func (c *countingRPCClient) Status(ctx context.Context) (*coretypes.ResultStatus, error) {
+	c.count("status")
+	return c.Client.Status(ctx)
+}
+
+func (c *countingRPCClient) ABCIQueryWithOptions(ctx context.Context, path string, data bytes.HexBytes, opts rpcclient.ABCIQueryOptions) (*coretypes.ResultABCIQuery, error) {
+	c.count("abci_query")
+	return c.Client.ABCIQueryWithOptions(ctx, path, data, opts)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"go.uber.org/zap"
+)
+
+func TestBenchCmd(t *testing.T) {
+	node := rpctest.New("testchain-1")
+	for h := int64(1); h <= 10; h++ {
+		txs := [][]byte{[]byte("tx-a"), []byte("tx-b")}
+		node.AddBlock(h, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{}, {}})
+	}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	t.Setenv("HOME", t.TempDir())
+	a := &appState{Log: zap.NewNop(), Viper: viper.New(), Config: &Config{ChainConfigs: ChainConfigs{{
+		ChainID:        "testchain-1",
+		RPCAddr:        srv.URL,
+		KeyringBackend: "test",
+		Timeout:        "10s",
+	}}}}
+
+	var out bytes.Buffer
+	cmd := benchCmd(a)
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"testchain-1", "--blocks", "3", "--json"})
+	if err := cmd.ExecuteContext(context.Background()); err != nil {
+		t.Fatalf("bench returned unexpected error: %v", err)
+	}
+
+	var report benchReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode bench report %q: %v", out.String(), err)
+	}
+	if report.Blocks != 3 || report.Txs != 6 || report.AvgTxsPerBlock != 2 {
+		t.Errorf("report = %+v, want 3 blocks of 2 txs", report)
+	}
+	if report.BlocksPerSecond <= 0 {
+		t.Errorf("report has throughput %f, want a non-zero throughput", report.BlocksPerSecond)
+	}
+	// The head is queried by bench and the earliest height by the indexer, for its genesis heights
+	if report.RPCCalls["status"] != 2 || report.RPCCalls["block"] != 3 {
+		t.Errorf("report counted rpc calls %v, want 2 status and 3 block calls", report.RPCCalls)
+	}
+}
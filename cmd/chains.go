@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
 	"github.com/spf13/cobra"
 	lens "github.com/strangelove-ventures/lens/client"
 	registry "github.com/strangelove-ventures/lens/client/chain_registry"
@@ -24,6 +29,7 @@ func chainsCmd(a *appState) *cobra.Command {
 	cmd.AddCommand(
 		chainsAddCmd(a),
 		chainsRegistryList(a),
+		chainsDiffCmd(a),
 	)
 
 	return cmd
@@ -37,24 +43,36 @@ func chainsAddCmd(a *appState) *cobra.Command {
 		Use:     "add [[chain-name]]",
 		Aliases: []string{"a"},
 		Short: "Add a new chain config to the configuration file by fetching chain metadata from \n" +
-			"                the chain-registry or passing a file (-f)",
+			"                the chain-registry or passing a file (-f) or directory (--dir)",
 		Args: cobra.MinimumNArgs(0),
 		Example: fmt.Sprintf(strings.TrimSpace(
 			` $ %s chains add cosmoshub
 $ %s chains add cosmoshub osmosis
-$ %s chains add --file chain-configs/ibc0.json`), appName, appName, appName),
+$ %s chains add --file chain-configs/ibc0.json
+$ %s chains add --dir chain-configs`), appName, appName, appName, appName),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			file, err := cmd.Flags().GetString(flagFile)
 			if err != nil {
 				return err
 			}
 
-			// add chain config from a file or the cosmos chain registry
+			dir, err := cmd.Flags().GetString(flagDir)
+			if err != nil {
+				return err
+			}
+
+			// add chain config from a file, a directory of files or the cosmos chain registry
 			switch {
+			case file != "" && dir != "":
+				return fmt.Errorf("can't pass both --file and --dir, must pick one")
 			case file != "":
 				if err := addChainConfigFromFile(a, file); err != nil {
 					return err
 				}
+			case dir != "":
+				if err := addChainConfigsFromDir(a, dir); err != nil {
+					return err
+				}
 			default:
 				if err := addChainConfigsFromRegistry(cmd.Context(), a, args); err != nil {
 					return err
@@ -65,7 +83,7 @@ $ %s chains add --file chain-configs/ibc0.json`), appName, appName, appName),
 		},
 	}
 
-	return fileFlag(a.Viper, cmd)
+	return dirFlag(a.Viper, fileFlag(a.Viper, cmd))
 }
 
 // chainsRegistryList queries for the list of all available chains in the cosmos chain registry.
@@ -121,6 +139,136 @@ func chainsRegistryList(a *appState) *cobra.Command {
 	return yamlFlag(a.Viper, jsonFlag(a.Viper, cmd))
 }
 
+// chainsDiffCmd prints the differences between the configs of two chains, along with the reachability
+// and software versions of their nodes, e.g. to check both ends of an IBC connection are set up alike.
+func chainsDiffCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "diff [chain-a] [chain-b]",
+		Aliases: []string{"d"},
+		Short:   "Print the differences between the configs of two chains and the nodes they point at",
+		Args:    cobra.ExactArgs(2),
+		Example: fmt.Sprintf("$ %s chains diff cosmoshub-4 osmosis-1", appName),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			offline, err := cmd.Flags().GetBool(flagOffline)
+			if err != nil {
+				return err
+			}
+
+			var fields [2][]chainField
+			for j, chainID := range args {
+				chainConfig, err := a.Config.GetChainConfig(chainID)
+				if err != nil {
+					return err
+				}
+				fields[j] = chainConfigFields(chainConfig)
+				if !offline {
+					fields[j] = append(fields[j], chainNodeFields(cmd, a, chainConfig)...)
+				}
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "\tFIELD\t%s\t%s\n", args[0], args[1])
+			for _, d := range diffChainFields(fields[0], fields[1]) {
+				marker := ""
+				if d.differs() {
+					marker = "*"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", marker, d.name, d.a, d.b)
+			}
+			return w.Flush()
+		},
+	}
+	return offlineFlag(a.Viper, cmd)
+}
+
+// chainField is a named value of a chain compared by chains diff.
+type chainField struct {
+	name  string
+	value string
+}
+
+// chainConfigFields returns the fields of the chain config relevant to indexing and relaying, the key and
+// the local keyring settings are left out since they are expected to differ.
+func chainConfigFields(c *lens.ChainClientConfig) []chainField {
+	return []chainField{
+		{"account-prefix", c.AccountPrefix},
+		{"rpc-addr", c.RPCAddr},
+		{"grpc-addr", c.GRPCAddr},
+		{"gas-prices", c.GasPrices},
+		{"gas-adjustment", strconv.FormatFloat(c.GasAdjustment, 'f', -1, 64)},
+		{"timeout", c.Timeout},
+		{"sign-mode", c.SignModeStr},
+		{"output-format", c.OutputFormat},
+	}
+}
+
+// chainNodeFields returns whether the node of the chain is reachable along with the software it runs.
+// Errors are reported as field values rather than returned, an unreachable node is a difference like any other.
+func chainNodeFields(cmd *cobra.Command, a *appState, c *lens.ChainClientConfig) []chainField {
+	// Don't modify the configured chain, the modules are set when the client is created
+	chainConfig := *c
+	client, err := newChainClient(cmd, a, &chainConfig)
+	if err != nil {
+		return []chainField{{"rpc-reachable", fmt.Sprintf("no (%s)", err)}}
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Second)
+	defer cancel()
+
+	status, err := client.RPCClient.Status(ctx)
+	if err != nil {
+		return []chainField{{"rpc-reachable", fmt.Sprintf("no (%s)", err)}}
+	}
+	fields := []chainField{
+		{"rpc-reachable", "yes"},
+		{"network", status.NodeInfo.Network},
+		{"tendermint-version", status.NodeInfo.Version},
+	}
+
+	nodeInfo, err := tmservice.NewServiceClient(client).GetNodeInfo(ctx, &tmservice.GetNodeInfoRequest{})
+	if err != nil || nodeInfo.ApplicationVersion == nil {
+		return append(fields, chainField{"grpc-reachable", fmt.Sprintf("no (%v)", err)})
+	}
+	return append(fields,
+		chainField{"grpc-reachable", "yes"},
+		chainField{"app-name", nodeInfo.ApplicationVersion.AppName},
+		chainField{"app-version", nodeInfo.ApplicationVersion.Version},
+		chainField{"cosmos-sdk-version", nodeInfo.ApplicationVersion.CosmosSdkVersion},
+	)
+}
+
+// chainFieldDiff holds the values of a field for two chains, a missing value is empty.
+type chainFieldDiff struct {
+	name string
+	a, b string
+}
+
+func (d chainFieldDiff) differs() bool {
+	return d.a != d.b
+}
+
+// diffChainFields pairs up the fields of two chains by name, in the order they first appear.
+func diffChainFields(a, b []chainField) []chainFieldDiff {
+	var (
+		diffs []chainFieldDiff
+		index = make(map[string]int)
+	)
+	for _, f := range a {
+		index[f.name] = len(diffs)
+		diffs = append(diffs, chainFieldDiff{name: f.name, a: f.value})
+	}
+	for _, f := range b {
+		j, ok := index[f.name]
+		if !ok {
+			index[f.name] = len(diffs)
+			diffs = append(diffs, chainFieldDiff{name: f.name, b: f.value})
+			continue
+		}
+		diffs[j].b = f.value
+	}
+	return diffs
+}
+
 // addChainConfigFromFile reads a JSON-formatted chain client config from the named file
 // and adds it to global application config.
 func addChainConfigFromFile(a *appState, file string) error {
@@ -145,6 +293,45 @@ func addChainConfigFromFile(a *appState, file string) error {
 	return nil
 }
 
+// addChainConfigsFromDir reads every JSON-formatted chain client config in the named directory
+// and adds them to the global application config. Chains that are already configured are skipped.
+func addChainConfigsFromDir(a *appState, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no *.json chain configs found in directory %s", dir)
+	}
+
+	for _, file := range files {
+		byt, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var config *lens.ChainClientConfig
+		if err = json.Unmarshal(byt, &config); err != nil {
+			return fmt.Errorf("failed to unmarshal chain config %s: %w", file, err)
+		}
+
+		if _, err := a.Config.GetChainConfig(config.ChainID); err == nil {
+			a.Log.Warn(
+				"Skipping chain config that already exists",
+				zap.String("chain", config.ChainID),
+				zap.String("file", file),
+			)
+			continue
+		}
+
+		if err = a.Config.AddChainConfig(config); err != nil {
+			return fmt.Errorf("failed to add chain config %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
 // addChainConfigsFromRegistry attempts to fetch chain config metadata for the specified chains
 // from the cosmos chain registry, and if successful adds it to the global application config.
 func addChainConfigsFromRegistry(ctx context.Context, a *appState, chains []string) error {
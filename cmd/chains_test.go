@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+func TestAddChainConfigsFromDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"juno.json":      `{"chain-id": "juno-1", "rpc-addr": "https://rpc.juno.example:443"}`,
+		"osmosis.json":   `{"chain-id": "osmosis-1", "rpc-addr": "https://rpc.osmosis.example:443"}`,
+		"cosmoshub.json": `{"chain-id": "cosmoshub-4", "rpc-addr": "https://rpc.new.example:443"}`,
+		"notes.txt":      `not a chain config`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &appState{Log: zap.NewNop(), Config: &Config{ChainConfigs: ChainConfigs{
+		{ChainID: "cosmoshub-4", RPCAddr: "https://rpc.cosmoshub.example:443"},
+	}}}
+	if err := addChainConfigsFromDir(a, dir); err != nil {
+		t.Fatalf("addChainConfigsFromDir returned unexpected error: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, chain := range a.Config.ChainConfigs {
+		got[chain.ChainID] = chain.RPCAddr
+	}
+	want := map[string]string{
+		// The existing config isn't replaced by the duplicate in the directory
+		"cosmoshub-4": "https://rpc.cosmoshub.example:443",
+		"juno-1":      "https://rpc.juno.example:443",
+		"osmosis-1":   "https://rpc.osmosis.example:443",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chain configs = %v, want %v", got, want)
+	}
+}
+
+func TestAddChainConfigsFromDirErrors(t *testing.T) {
+	empty := t.TempDir()
+
+	invalid := t.TempDir()
+	if err := os.WriteFile(filepath.Join(invalid, "bad.json"), []byte(`{"chain-id": `), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, dir := range map[string]string{"no configs": empty, "invalid config": invalid} {
+		a := &appState{Log: zap.NewNop(), Config: &Config{ChainConfigs: ChainConfigs{}}}
+		if err := addChainConfigsFromDir(a, dir); err == nil {
+			t.Errorf("%s: addChainConfigsFromDir returned no error", name)
+		}
+		if len(a.Config.ChainConfigs) != 0 {
+			t.Errorf("%s: chain configs = %v, want none", name, a.Config.ChainConfigs)
+		}
+	}
+}
+
+func TestChainsDiff(t *testing.T) {
+	a := &appState{Log: zap.NewNop(), Viper: viper.New(), Config: &Config{ChainConfigs: ChainConfigs{
+		{ChainID: "cosmoshub-4", AccountPrefix: "cosmos", RPCAddr: "https://rpc.cosmoshub.example:443", GasAdjustment: 1.2, Timeout: "20s"},
+		{ChainID: "osmosis-1", AccountPrefix: "osmo", RPCAddr: "https://rpc.osmosis.example:443", GasAdjustment: 1.2, Timeout: "20s"},
+	}}}
+
+	var out bytes.Buffer
+	cmd := chainsDiffCmd(a)
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"cosmoshub-4", "osmosis-1", "--offline"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("chains diff returned unexpected error: %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		fields := strings.Fields(line)
+		if fields[0] == "*" {
+			got[fields[1]] = fields
+		} else {
+			got[fields[0]] = fields
+		}
+	}
+	expected := map[string][]string{
+		"account-prefix": {"*", "account-prefix", "cosmos", "osmo"},
+		"rpc-addr":       {"*", "rpc-addr", "https://rpc.cosmoshub.example:443", "https://rpc.osmosis.example:443"},
+		"gas-adjustment": {"gas-adjustment", "1.2", "1.2"},
+		"timeout":        {"timeout", "20s", "20s"},
+	}
+	for name, fields := range expected {
+		if !reflect.DeepEqual(got[name], fields) {
+			t.Errorf("got %s line %v, expected %v", name, got[name], fields)
+		}
+	}
+	if _, ok := got["rpc-reachable"]; ok {
+		t.Error("nodes were queried with --offline")
+	}
+
+	cmd = chainsDiffCmd(a)
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"cosmoshub-4", "juno-1", "--offline"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("chains diff of an unknown chain returned no error")
+	}
+}
+
+func TestDiffChainFields(t *testing.T) {
+	a := []chainField{{"rpc-reachable", "yes"}, {"app-name", "gaiad"}}
+	b := []chainField{{"rpc-reachable", "no (connection refused)"}, {"network", "osmosis-1"}}
+
+	expected := []chainFieldDiff{
+		{name: "rpc-reachable", a: "yes", b: "no (connection refused)"},
+		{name: "app-name", a: "gaiad"},
+		{name: "network", b: "osmosis-1"},
+	}
+	got := diffChainFields(a, b)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+	for _, d := range got {
+		if !d.differs() {
+			t.Errorf("%s doesn't differ", d.name)
+		}
+	}
+	if d := diffChainFields(a, a); d[0].differs() || d[1].differs() {
+		t.Errorf("fields of the same chain differ: %+v", d)
+	}
+}
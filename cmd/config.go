@@ -3,13 +3,17 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/cosmos/cosmos-sdk/client/flags"
 	"github.com/spf13/cobra"
 	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/indexer/actions/jsonmsgs"
 	"gopkg.in/yaml.v3"
 )
 
@@ -35,6 +39,219 @@ type Config struct {
 	DB           DatabaseConfig `yaml:"database" json:"database"`
 	ChainConfigs ChainConfigs   `yaml:"chains" json:"chains"`
 	Actions      []string       `yaml:"actions" json:"actions"`
+	Timeouts     TimeoutsConfig `yaml:"timeouts,omitempty" json:"timeouts,omitempty"`
+	Transformers []string       `yaml:"transformers,omitempty" json:"transformers,omitempty"`
+	Sinks        SinksConfig    `yaml:"sinks,omitempty" json:"sinks,omitempty"`
+	FailedRawLog RawLogConfig   `yaml:"failed-raw-log,omitempty" json:"failed-raw-log,omitempty"`
+
+	// TxRateLimit is the number of txs per second each chain hands to the block actions, zero is unlimited.
+	TxRateLimit float64 `yaml:"tx-rate-limit,omitempty" json:"tx-rate-limit,omitempty"`
+
+	JSONMsgs []JSONMsgConfig `yaml:"json-msgs,omitempty" json:"json-msgs,omitempty"`
+
+	// Batching is keyed by the name of the block action whose rows should be written in batches.
+	Batching map[string]BatchingConfig `yaml:"batching,omitempty" json:"batching,omitempty"`
+
+	// LogLevels is keyed by block action name, overriding the level of the root logger (debug, info, warn or error).
+	LogLevels map[string]string `yaml:"log-levels,omitempty" json:"log-levels,omitempty"`
+
+	DAODAO DAODAOConfig `yaml:"daodao,omitempty" json:"daodao,omitempty"`
+
+	Bank BankConfig `yaml:"bank,omitempty" json:"bank,omitempty"`
+}
+
+// DAODAOConfig configures the daodao block action.
+type DAODAOConfig struct {
+	// SequentialBlocks processes a single block at a time while the action is configured, so the CW20 balances
+	// reflect the chain's state at the latest indexed height as blocks are applied in order. The balances are only
+	// reconciled, see --reconcile-interval, when it's enabled.
+	SequentialBlocks bool `yaml:"sequential-blocks,omitempty" json:"sequential-blocks,omitempty"`
+}
+
+// BankConfig configures the bank_transfers block action.
+type BankConfig struct {
+	// FeeShares attributes the fee of each tx across the outputs of its MsgMultiSends, see bank.SetFeeShares.
+	FeeShares bool `yaml:"fee-shares,omitempty" json:"fee-shares,omitempty"`
+}
+
+// JSONMsgConfig maps a msg type URL to the table its msgs are stored in as JSON by the json_msgs block action.
+type JSONMsgConfig struct {
+	TypeURL string `yaml:"type-url" json:"type-url"`
+	Table   string `yaml:"table" json:"table"`
+}
+
+// JSONMsgHandlers returns the jsonmsgs.Handler for each configured JSON msg type.
+func (c *Config) JSONMsgHandlers() []jsonmsgs.Handler {
+	handlers := make([]jsonmsgs.Handler, len(c.JSONMsgs))
+	for j, m := range c.JSONMsgs {
+		handlers[j] = jsonmsgs.Handler{TypeURL: m.TypeURL, Table: m.Table}
+	}
+	return handlers
+}
+
+// RawLogConfig represents how the raw logs of failed txs larger than MaxSize bytes are stored,
+// Mode is either truncate (the default) or omit. A zero MaxSize stores every raw log in full.
+type RawLogConfig struct {
+	MaxSize int    `yaml:"max-size,omitempty" json:"max-size,omitempty"`
+	Mode    string `yaml:"mode,omitempty" json:"mode,omitempty"`
+}
+
+// Parse returns the indexer.RawLogPolicy represented by the RawLogConfig.
+func (r RawLogConfig) Parse() (indexer.RawLogPolicy, error) {
+	if r.MaxSize < 0 {
+		return indexer.RawLogPolicy{}, fmt.Errorf("invalid failed raw log max-size %d, must be greater than or equal to 0", r.MaxSize)
+	}
+	switch r.Mode {
+	case "", "truncate":
+		return indexer.RawLogPolicy{MaxSize: r.MaxSize}, nil
+	case "omit":
+		return indexer.RawLogPolicy{MaxSize: r.MaxSize, Omit: true}, nil
+	default:
+		return indexer.RawLogPolicy{}, fmt.Errorf("invalid failed raw log mode %q, expected truncate or omit", r.Mode)
+	}
+}
+
+// BatchingConfig represents when the batched rows of a block action are flushed, on Size rows or once the oldest
+// row was held for MaxHold (parsed with time.ParseDuration), whichever comes first.
+type BatchingConfig struct {
+	Size    int    `yaml:"size" json:"size"`
+	MaxHold string `yaml:"max-hold,omitempty" json:"max-hold,omitempty"`
+}
+
+// defaultBatchMaxHold is used when a batching config doesn't specify a max hold,
+// so a low volume action doesn't hold its rows indefinitely.
+const defaultBatchMaxHold = 5 * time.Second
+
+// ParseBatching returns the indexer.BatchConfig for each block action with a batching config.
+func (c *Config) ParseBatching() (map[string]indexer.BatchConfig, error) {
+	batching := make(map[string]indexer.BatchConfig, len(c.Batching))
+	for name, b := range c.Batching {
+		if b.Size < 1 {
+			return nil, fmt.Errorf("invalid batch size %d for block action %s, must be greater than or equal to 1", b.Size, name)
+		}
+
+		maxHold := defaultBatchMaxHold
+		if b.MaxHold != "" {
+			var err error
+			if maxHold, err = time.ParseDuration(b.MaxHold); err != nil {
+				return nil, fmt.Errorf("invalid batch max-hold %q for block action %s: %w", b.MaxHold, name, err)
+			}
+		}
+
+		batching[name] = indexer.BatchConfig{Size: b.Size, MaxHold: maxHold}
+	}
+	return batching, nil
+}
+
+// SinksConfig represents the additional outputs that indexed rows are written to, alongside the database.
+// Policy is either fail-fast or best-effort (the default), see indexer.SinkPolicy.
+type SinksConfig struct {
+	Policy  string       `yaml:"policy,omitempty" json:"policy,omitempty"`
+	Outputs []SinkConfig `yaml:"outputs,omitempty" json:"outputs,omitempty"`
+}
+
+// SinkConfig represents a single sink, currently only the jsonl type is supported.
+type SinkConfig struct {
+	Type string `yaml:"type" json:"type"`
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+}
+
+// Open creates the sinks represented by the SinksConfig, any sinks already opened are closed if one fails to open.
+func (s SinksConfig) Open() ([]indexer.Sink, error) {
+	var sinks []indexer.Sink
+	for _, output := range s.Outputs {
+		var (
+			sink indexer.Sink
+			err  error
+		)
+		switch output.Type {
+		case "jsonl":
+			if output.Path == "" {
+				err = fmt.Errorf("the jsonl sink requires a path")
+			} else {
+				sink, err = indexer.NewJSONLSink(output.Path)
+			}
+		default:
+			err = fmt.Errorf("there is no sink type named %s", output.Type)
+		}
+		if err != nil {
+			for _, opened := range sinks {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// TimeoutsConfig represents the timeouts used for the different RPC queries made while indexing.
+// Values are parsed with time.ParseDuration (e.g. 30s), an empty value means no timeout.
+type TimeoutsConfig struct {
+	Block        string `yaml:"block,omitempty" json:"block,omitempty"`
+	BlockResults string `yaml:"block-results,omitempty" json:"block-results,omitempty"`
+	Query        string `yaml:"query,omitempty" json:"query,omitempty"`
+}
+
+// Parse returns the indexer.Timeouts represented by the TimeoutsConfig.
+func (t TimeoutsConfig) Parse() (indexer.Timeouts, error) {
+	var (
+		timeouts indexer.Timeouts
+		err      error
+	)
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"block", t.Block, &timeouts.Block},
+		{"block-results", t.BlockResults, &timeouts.BlockResults},
+		{"query", t.Query, &timeouts.Query},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if *d.dst, err = time.ParseDuration(d.value); err != nil {
+			return indexer.Timeouts{}, fmt.Errorf("invalid %s timeout %q: %w", d.name, d.value, err)
+		}
+	}
+	return timeouts, nil
+}
+
+// redacted is the placeholder used in place of secrets by Config.Redacted.
+const redacted = "REDACTED"
+
+// Redacted returns a copy of the Config that is safe to expose, e.g. on the debug server.
+// The database password and any credentials embedded in the chain endpoints are replaced.
+func (c Config) Redacted() Config {
+	if c.DB.Password != "" {
+		c.DB.Password = redacted
+	}
+
+	chains := make(ChainConfigs, len(c.ChainConfigs))
+	for j, chain := range c.ChainConfigs {
+		chainCopy := *chain
+		chainCopy.RPCAddr = redactURL(chain.RPCAddr)
+		chainCopy.GRPCAddr = redactURL(chain.GRPCAddr)
+		chains[j] = &chainCopy
+	}
+	c.ChainConfigs = chains
+	return c
+}
+
+// redactURL replaces the user info and query of a URL, which may hold API keys, leaving other values untouched.
+func redactURL(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || (u.User == nil && u.RawQuery == "") {
+		return addr
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	return u.String()
 }
 
 // DatabaseConfig represents the connection details for the database.
@@ -45,6 +262,43 @@ type DatabaseConfig struct {
 	Password string `yaml:"password" json:"password"`
 	Name     string `yaml:"db-name" json:"db-name"`
 	SSLMode  string `yaml:"ssl-mode" json:"ssl-mode"`
+
+	// PreferSimpleProtocol defaults to true when unset, PrepareStmt should stay off behind poolers such as pgbouncer.
+	PreferSimpleProtocol *bool `yaml:"prefer-simple-protocol,omitempty" json:"prefer-simple-protocol,omitempty"`
+	PrepareStmt          bool  `yaml:"prepare-stmt,omitempty" json:"prepare-stmt,omitempty"`
+
+	// The connection pool settings, when unset start derives them from --concurrent-blocks.
+	// ConnMaxLifetime is parsed with time.ParseDuration (e.g. 30m).
+	MaxOpenConns    int    `yaml:"max-open-conns,omitempty" json:"max-open-conns,omitempty"`
+	MaxIdleConns    int    `yaml:"max-idle-conns,omitempty" json:"max-idle-conns,omitempty"`
+	ConnMaxLifetime string `yaml:"conn-max-lifetime,omitempty" json:"conn-max-lifetime,omitempty"`
+}
+
+// Options returns the indexer.DatabaseOptions represented by the DatabaseConfig.
+func (d DatabaseConfig) Options() (indexer.DatabaseOptions, error) {
+	opts := indexer.DefaultDatabaseOptions()
+	if d.PreferSimpleProtocol != nil {
+		opts.PreferSimpleProtocol = *d.PreferSimpleProtocol
+	}
+	opts.PrepareStmt = d.PrepareStmt
+
+	if d.MaxOpenConns < 0 {
+		return indexer.DatabaseOptions{}, fmt.Errorf("invalid database max-open-conns %d, must be greater than or equal to 0", d.MaxOpenConns)
+	}
+	if d.MaxIdleConns < 0 {
+		return indexer.DatabaseOptions{}, fmt.Errorf("invalid database max-idle-conns %d, must be greater than or equal to 0", d.MaxIdleConns)
+	}
+	opts.MaxOpenConns = d.MaxOpenConns
+	opts.MaxIdleConns = d.MaxIdleConns
+
+	if d.ConnMaxLifetime != "" {
+		lifetime, err := time.ParseDuration(d.ConnMaxLifetime)
+		if err != nil {
+			return indexer.DatabaseOptions{}, fmt.Errorf("invalid database conn-max-lifetime %q: %w", d.ConnMaxLifetime, err)
+		}
+		opts.ConnMaxLifetime = lifetime
+	}
+	return opts, nil
 }
 
 // configInitCmd initializes an empty config at the location specified via the --home flag.
@@ -240,6 +494,46 @@ func (c *Config) GetChainConfig(chainID string) (*lens.ChainClientConfig, error)
 	return nil, fmt.Errorf("chain with ID %s is not configured", chainID)
 }
 
+// Filter returns the chain configs whose chain-id is in only (or all of them if only is empty),
+// minus any whose chain-id is in exclude. An error is returned if a named chain is not configured.
+func (cc ChainConfigs) Filter(only, exclude []string) (ChainConfigs, error) {
+	configured := make(map[string]bool, len(cc))
+	for _, chain := range cc {
+		configured[chain.ChainID] = true
+	}
+
+	for _, chainID := range append(append([]string{}, only...), exclude...) {
+		if !configured[chainID] {
+			return nil, fmt.Errorf("chain with ID %s is not configured", chainID)
+		}
+	}
+
+	onlySet := make(map[string]bool, len(only))
+	for _, chainID := range only {
+		onlySet[chainID] = true
+	}
+	excludeSet := make(map[string]bool, len(exclude))
+	for _, chainID := range exclude {
+		excludeSet[chainID] = true
+	}
+
+	var filtered ChainConfigs
+	for _, chain := range cc {
+		if len(onlySet) > 0 && !onlySet[chain.ChainID] {
+			continue
+		}
+		if excludeSet[chain.ChainID] {
+			continue
+		}
+		filtered = append(filtered, chain)
+	}
+
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no chains left to index after applying chain filters")
+	}
+	return filtered, nil
+}
+
 // defaultConfig returns the yaml string representation of the default configuration settings.
 func defaultConfig() []byte {
 	return Config{
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"gopkg.in/yaml.v3"
+)
+
+func TestChainConfigsFilter(t *testing.T) {
+	configs := ChainConfigs{
+		{ChainID: "cosmoshub-4"},
+		{ChainID: "osmosis-1"},
+		{ChainID: "juno-1"},
+	}
+	chainIDs := func(cc ChainConfigs) []string {
+		var ids []string
+		for _, chain := range cc {
+			ids = append(ids, chain.ChainID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name    string
+		only    []string
+		exclude []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no filters", want: []string{"cosmoshub-4", "osmosis-1", "juno-1"}},
+		{name: "only", only: []string{"juno-1", "cosmoshub-4"}, want: []string{"cosmoshub-4", "juno-1"}},
+		{name: "exclude", exclude: []string{"osmosis-1"}, want: []string{"cosmoshub-4", "juno-1"}},
+		{name: "only and exclude", only: []string{"osmosis-1", "juno-1"}, exclude: []string{"juno-1"}, want: []string{"osmosis-1"}},
+		{name: "unknown only chain", only: []string{"stargaze-1"}, wantErr: true},
+		{name: "unknown excluded chain", exclude: []string{"stargaze-1"}, wantErr: true},
+		{name: "nothing left", exclude: []string{"cosmoshub-4", "osmosis-1", "juno-1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := configs.Filter(tt.only, tt.exclude)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: Filter returned %v, want an error", tt.name, chainIDs(got))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Filter returned unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(chainIDs(got), tt.want) {
+			t.Errorf("%s: Filter = %v, want %v", tt.name, chainIDs(got), tt.want)
+		}
+	}
+}
+
+// Filter must not modify the configs it filters, they're shared with the rest of the config.
+func TestChainConfigsFilterKeepsConfigs(t *testing.T) {
+	chain := &lens.ChainClientConfig{ChainID: "osmosis-1"}
+	configs := ChainConfigs{chain, {ChainID: "juno-1"}}
+
+	got, err := configs.Filter([]string{"osmosis-1"}, nil)
+	if err != nil {
+		t.Fatalf("Filter returned unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0] != chain || len(configs) != 2 {
+		t.Errorf("Filter = %v, want the configured osmosis-1 config with the configs left untouched", got)
+	}
+}
+
+func TestRawLogConfigParse(t *testing.T) {
+	tests := []struct {
+		config  RawLogConfig
+		want    indexer.RawLogPolicy
+		wantErr bool
+	}{
+		{config: RawLogConfig{}, want: indexer.RawLogPolicy{}},
+		{config: RawLogConfig{MaxSize: 1024}, want: indexer.RawLogPolicy{MaxSize: 1024}},
+		{config: RawLogConfig{MaxSize: 1024, Mode: "truncate"}, want: indexer.RawLogPolicy{MaxSize: 1024}},
+		{config: RawLogConfig{MaxSize: 1024, Mode: "omit"}, want: indexer.RawLogPolicy{MaxSize: 1024, Omit: true}},
+		{config: RawLogConfig{MaxSize: -1}, wantErr: true},
+		{config: RawLogConfig{MaxSize: 1024, Mode: "drop"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.config.Parse()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%+v.Parse() = %+v, want an error", tt.config, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%+v.Parse() = %+v, %v, want %+v", tt.config, got, err, tt.want)
+		}
+	}
+}
+
+func TestConnectionString(t *testing.T) {
+	c := &Config{DB: DatabaseConfig{Host: "db.example", Port: 6432, User: "valis", Password: "secret", Name: "indexer", SSLMode: "require"}}
+
+	config, err := pgconn.ParseConfig(c.ConnectionString())
+	if err != nil {
+		t.Fatalf("connection string %q isn't a valid DSN: %v", c.ConnectionString(), err)
+	}
+	if config.Host != "db.example" || config.Port != 6432 || config.User != "valis" || config.Password != "secret" || config.Database != "indexer" {
+		t.Errorf("connection string parsed as %+v, want the configured database", config)
+	}
+	if config.TLSConfig == nil {
+		t.Error("connection string doesn't require TLS with sslmode require")
+	}
+}
+
+func TestConnectToDatabaseWiring(t *testing.T) {
+	// Reserve a local port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	c := &Config{DB: DatabaseConfig{Host: "127.0.0.1", Port: port, User: "valis", Name: "valis", SSLMode: "disable"}}
+	logLevel, err := gormLogLevel("silent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := c.DB.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = indexer.ConnectToDatabase(c.ConnectionString(), logLevel, opts)
+	if err == nil {
+		t.Fatal("ConnectToDatabase connected to a closed port")
+	}
+	// The connection string is used as the DSN, so the configured host and port are dialed
+	if addr := "127.0.0.1:" + strconv.Itoa(port); !strings.Contains(err.Error(), addr) && !strings.Contains(err.Error(), "port="+strconv.Itoa(port)) {
+		t.Errorf("got error %v, want a failure to connect to %s", err, addr)
+	}
+}
+
+func TestDatabaseConfigOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected indexer.DatabaseOptions
+		wantErr  bool
+	}{
+		{name: "defaults", yaml: "host: localhost", expected: indexer.DatabaseOptions{PreferSimpleProtocol: true}},
+		{name: "prepared statements", yaml: "prefer-simple-protocol: false\nprepare-stmt: true", expected: indexer.DatabaseOptions{PrepareStmt: true}},
+		{name: "explicit simple protocol", yaml: "prefer-simple-protocol: true", expected: indexer.DatabaseOptions{PreferSimpleProtocol: true}},
+		{
+			name:     "connection pool",
+			yaml:     "max-open-conns: 20\nmax-idle-conns: 5\nconn-max-lifetime: 30m",
+			expected: indexer.DatabaseOptions{PreferSimpleProtocol: true, MaxOpenConns: 20, MaxIdleConns: 5, ConnMaxLifetime: 30 * time.Minute},
+		},
+		{name: "negative max open conns", yaml: "max-open-conns: -1", wantErr: true},
+		{name: "negative max idle conns", yaml: "max-idle-conns: -1", wantErr: true},
+		{name: "invalid conn max lifetime", yaml: "conn-max-lifetime: 30", wantErr: true},
+	}
+	for _, tt := range tests {
+		var c DatabaseConfig
+		if err := yaml.Unmarshal([]byte(tt.yaml), &c); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := c.Options()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s: got options %+v, expected %+v", tt.name, got, tt.expected)
+		}
+	}
+}
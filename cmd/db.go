@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/strangelove-ventures/valis/indexer"
+)
+
+func dbCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the database",
+	}
+
+	cmd.AddCommand(
+		dbMigrateCmd(a),
+		dbSchemaCmd(a),
+	)
+
+	return cmd
+}
+
+// dbMigrateCmd runs the schema migrations for the indexer and the configured actions,
+// or only for a single action when --action is specified.
+func dbMigrateCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "migrate",
+		Aliases: []string{"m"},
+		Short:   "Run the schema migrations for the configured actions, or only for the action specified with --action",
+		Args:    cobra.NoArgs,
+		Example: strings.TrimSpace(fmt.Sprintf(`
+$ %s db migrate
+$ %s db migrate --action ics20_transfers`, appName, appName)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			actionName, err := cmd.Flags().GetString(flagAction)
+			if err != nil {
+				return err
+			}
+
+			logLevelStr, err := cmd.Flags().GetString(flagGormLogLevel)
+			if err != nil {
+				return err
+			}
+			logLevel, err := gormLogLevel(logLevelStr)
+			if err != nil {
+				return err
+			}
+
+			dbOpts, err := a.Config.DB.Options()
+			if err != nil {
+				return err
+			}
+			db, err := indexer.ConnectToDatabase(a.Config.ConnectionString(), logLevel, dbOpts)
+			if err != nil {
+				return err
+			}
+			i := indexer.NewMigrationIndexer(a.Log, db)
+
+			// Only touch the tables of the named action, it doesn't need to be listed in the config
+			if actionName != "" {
+				action, err := a.Config.GetBlockActionByName(a.Log, actionName)
+				if err != nil {
+					return err
+				}
+				return i.MigrateActionSchema(action)
+			}
+
+			actions := configuredBlockActions(a)
+			if len(actions) == 0 {
+				return fmt.Errorf("no block actions configured, check the actions section of your config")
+			}
+			return i.MigrateSchemas(actions)
+		},
+	}
+	return gormLogFlag(a.Viper, actionFlag(a.Viper, cmd))
+}
+
+// dbSchemaCmd prints the DDL the schema migrations would execute against an empty database, without connecting to it.
+func dbSchemaCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "schema",
+		Aliases: []string{"s"},
+		Short:   "Print the CREATE TABLE statements for the configured actions, or only for the action specified with --action",
+		Args:    cobra.NoArgs,
+		Example: strings.TrimSpace(fmt.Sprintf(`
+$ %s db schema
+$ %s db schema --action ics20_transfers > ics20_transfers.sql`, appName, appName)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			actionName, err := cmd.Flags().GetString(flagAction)
+			if err != nil {
+				return err
+			}
+
+			var statements []string
+			if actionName != "" {
+				action, err := a.Config.GetBlockActionByName(a.Log, actionName)
+				if err != nil {
+					return err
+				}
+				statements, err = indexer.SchemaDDL(a.Log, []indexer.BlockAction{action}, false)
+				if err != nil {
+					return err
+				}
+			} else {
+				actions := configuredBlockActions(a)
+				if len(actions) == 0 {
+					return fmt.Errorf("no block actions configured, check the actions section of your config")
+				}
+				statements, err = indexer.SchemaDDL(a.Log, actions, true)
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, stmt := range statements {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s;\n", stmt)
+			}
+			return nil
+		},
+	}
+	return actionFlag(a.Viper, cmd)
+}
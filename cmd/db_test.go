@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+func TestDBSchemaIBCModels(t *testing.T) {
+	a := &appState{Log: zap.NewNop(), Viper: viper.New(), Config: &Config{}}
+
+	var out bytes.Buffer
+	cmd := dbSchemaCmd(a)
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--action", "ics20_transfers"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("db schema returned unexpected error: %v", err)
+	}
+
+	tables := make(map[string]string)
+	for _, statement := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		fields := strings.Fields(statement)
+		switch {
+		case len(fields) >= 3 && fields[0] == "CREATE" && fields[1] == "TABLE":
+			tables[strings.Trim(fields[2], `"`)] = statement
+		case strings.HasPrefix(statement, "CREATE INDEX ") || strings.HasPrefix(statement, "CREATE UNIQUE INDEX "):
+		default:
+			t.Fatalf("unexpected statement %q", statement)
+		}
+	}
+
+	expected := map[string][]string{
+		"txes":                 {"chain_id", "hash", "block_height", "raw_log", "memo"},
+		"msg_transfers":        {"chain_id", "tx_hash", "msg_index", "sender", "receiver", "amount", "denom", "src_channel", "dst_chain_id", "timeout_height"},
+		"msg_recv_packets":     {"src_channel", "dst_channel", "src_port", "dst_port"},
+		"msg_acknowledgements": {"acknowledgement", "success", "error"},
+		"msg_timeouts":         {"src_channel", "dst_channel"},
+		"msg_update_clients":   {"client_id", "header_type", "revision_height", "trusted_revision_height"},
+	}
+	for table, columns := range expected {
+		statement, ok := tables[table]
+		if !ok {
+			t.Errorf("no CREATE TABLE statement for %s", table)
+			continue
+		}
+		for _, column := range columns {
+			if !strings.Contains(statement, `"`+column+`"`) {
+				t.Errorf("%s is missing column %s: %s", table, column, statement)
+			}
+		}
+	}
+
+	// Only the action's tables are printed with --action
+	for _, table := range []string{"blocks", "checkpoints", "failed_blocks"} {
+		if _, ok := tables[table]; ok {
+			t.Errorf("got indexer table %s in the schema of a single action", table)
+		}
+	}
+}
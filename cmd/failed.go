@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/strangelove-ventures/valis/indexer"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm/logger"
+)
+
+func failedCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "failed",
+		Aliases: []string{"f"},
+		Short:   "Manage the blocks that failed to be indexed",
+	}
+
+	cmd.AddCommand(
+		failedListCmd(a),
+		failedRetryCmd(a),
+	)
+
+	return cmd
+}
+
+// failedListCmd lists the failed blocks recorded in the database.
+func failedListCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list [chain-id]",
+		Aliases: []string{"l", "ls"},
+		Short:   "List the recorded failed blocks, for every chain if no chain-id is specified",
+		Args:    cobra.MaximumNArgs(1),
+		Example: strings.TrimSpace(fmt.Sprintf(`
+$ %s failed list
+$ %s failed list cosmoshub-4 --json`, appName, appName)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jsn, err := cmd.Flags().GetBool(flagJSON)
+			if err != nil {
+				return err
+			}
+
+			var chainID string
+			if len(args) == 1 {
+				chainID = args[0]
+			}
+
+			dbOpts, err := a.Config.DB.Options()
+			if err != nil {
+				return err
+			}
+			db, err := indexer.ConnectToDatabase(a.Config.ConnectionString(), logger.Silent, dbOpts)
+			if err != nil {
+				return err
+			}
+
+			failed, err := indexer.LoadFailedBlocks(db, chainID)
+			if err != nil {
+				return err
+			}
+
+			var out []byte
+			if jsn {
+				out, err = json.Marshal(failed)
+			} else {
+				out, err = yaml.Marshal(failed)
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			return nil
+		},
+	}
+	return jsonFlag(a.Viper, cmd)
+}
+
+// failedRetryCmd re-attempts indexing the recorded failed blocks of a chain, removing the ones that succeed.
+func failedRetryCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "retry [chain-id]",
+		Aliases: []string{"r"},
+		Short:   "Retry indexing the recorded failed blocks of a chain",
+		Args:    cobra.ExactArgs(1),
+		Example: strings.TrimSpace(fmt.Sprintf(`
+$ %s failed retry cosmoshub-4`, appName)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			concurrentBlocks, err := cmd.Flags().GetUint(flagConcurrentBlocks)
+			if err != nil {
+				return err
+			}
+			if concurrentBlocks < 1 {
+				return fmt.Errorf("invalid flag value %d, value of --concurrent-blocks must be greater than or equal to 1", concurrentBlocks)
+			}
+
+			retryDeadline, err := cmd.Flags().GetDuration(flagRetryDeadline)
+			if err != nil {
+				return err
+			}
+
+			timeouts, err := a.Config.Timeouts.Parse()
+			if err != nil {
+				return err
+			}
+
+			chainConfig, err := a.Config.GetChainConfig(args[0])
+			if err != nil {
+				return err
+			}
+
+			chainClient, err := newChainClient(cmd, a, chainConfig)
+			if err != nil {
+				return err
+			}
+
+			dbOpts, err := a.Config.DB.Options()
+			if err != nil {
+				return err
+			}
+			db, err := indexer.ConnectToDatabase(a.Config.ConnectionString(), logger.Silent, dbOpts.WithConcurrencyDefaults(concurrentBlocks))
+			if err != nil {
+				return err
+			}
+
+			i := indexer.NewIndexer(a.Log, chainClient, db)
+			i.RetryDeadline = retryDeadline
+			i.Timeouts = timeouts
+
+			actions := configuredBlockActions(a)
+			if len(actions) == 0 {
+				return fmt.Errorf("no block actions configured, check the actions section of your config")
+			}
+
+			if err = i.MigrateSchemas(actions); err != nil {
+				return err
+			}
+
+			recovered, err := i.RetryFailedBlocks(cmd.Context(), actions, concurrentBlocks)
+			fmt.Fprintf(cmd.OutOrStdout(), "Recovered %d failed block(s) for %s\n", len(recovered), chainConfig.ChainID)
+			return err
+		},
+	}
+	return retryDeadlineFlag(a.Viper, concurrentBlocksFlag(a.Viper, cmd))
+}
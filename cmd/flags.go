@@ -1,29 +1,77 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/strangelove-ventures/valis/indexer"
 )
 
 const (
 	flagJSON             = "json"
 	flagYAML             = "yaml"
 	flagConcurrentBlocks = "concurrent-blocks"
+	flagConcurrentTxs    = "concurrent-txs"
 	flagDebugAddr        = "debug-addr"
 	flagBeginBlock       = "begin-block"
 	flagEndBlock         = "end-block"
 	flagFile             = "file"
+	flagResultsFile      = "results-file"
+	flagDir              = "dir"
 	flagGormLogLevel     = "gorm-log-level"
+	flagAll              = "all"
+	flagBlocks           = "blocks"
+	flagConfigSnippet    = "config-snippet"
+	flagRetryDeadline    = "retry-deadline"
+	flagMaxRetryPasses   = "max-retry-passes"
+	flagResultsFallback  = "block-results-fallback"
+	flagOnlyChains       = "only-chains"
+	flagExcludeChains    = "exclude-chains"
+	flagTrackMsgProgress = "track-msg-progress"
+	flagEventsSummary    = "events-summary"
+	flagAction           = "action"
+	flagBlockTxs         = "block-transactions"
+	flagRetryActions     = "retry-failed-actions"
+	flagRPC              = "rpc"
+	flagSample           = "sample"
+	flagTxResultsCache   = "tx-results-cache-size"
+	flagStoreSuccessLog  = "store-success-log"
+	flagMaxChains        = "max-chains-concurrent"
+	flagDenomMetadata    = "denom-metadata"
+	flagAddressFile      = "address-file"
+	flagOTelEndpoint     = "otel-endpoint"
+	flagNormTransfers    = "normalized-transfers"
+	flagGenesisHeights   = "genesis-heights"
+	flagReconcile        = "reconcile-interval"
+	flagStampRunID       = "stamp-run-id"
+	flagOffline          = "offline"
+	flagSkipMigrate      = "skip-migrate"
+	flagRawBlockWindow   = "raw-block-window"
+	flagForceBegin       = "force-begin"
+	flagForce            = "force"
+	flagDumpRawTx        = "dump-raw-tx"
+	flagFollow           = "follow"
+	flagPollInterval     = "poll-interval"
+	flagSweepInterval    = "sweep-interval"
+	flagLagThreshold     = "lag-threshold"
+	flagLagWebhook       = "lag-webhook"
 )
 
 const (
 	defaultDebugAddr        = "localhost:49666"
 	defaultConcurrentBlocks = 100
+	defaultConcurrentTxs    = 1
 	defaultBeginBlock       = 1
-	defaultEndBlock         = 0 // This will enable default behavior of using the latest block height
+	defaultEndBlock         = "" // This will enable default behavior of using the latest block height
 	defaultJSON             = false
 	defaultYAML             = false
 	defaultGormLogLevel     = "silent"
+	defaultBenchBlocks      = 100
+	defaultRetryDeadline    = time.Duration(0) // This will enable default behavior of retrying failed blocks indefinitely
+	defaultPollInterval     = 5 * time.Second
+	defaultSweepInterval    = 10 * time.Minute
+	defaultMaxRetryPasses   = 5
 )
 
 func yamlFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
@@ -50,6 +98,14 @@ func concurrentBlocksFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
 	return cmd
 }
 
+func concurrentTxsFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Uint(flagConcurrentTxs, defaultConcurrentTxs, "specifies how many txs within a single block a block action may process concurrently")
+	if err := v.BindPFlag(flagConcurrentTxs, cmd.Flags().Lookup(flagConcurrentTxs)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
 func debugServerFlags(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
 	cmd.Flags().String(flagDebugAddr, defaultDebugAddr, "address to use for debug server. Set empty to disable debug server.")
 	if err := v.BindPFlag(flagDebugAddr, cmd.Flags().Lookup(flagDebugAddr)); err != nil {
@@ -59,7 +115,7 @@ func debugServerFlags(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
 }
 
 func beginBlockFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
-	cmd.Flags().Int64P(flagBeginBlock, "s", defaultBeginBlock, "block height to start indexing from")
+	cmd.Flags().Int64P(flagBeginBlock, "s", defaultBeginBlock, "block height to start indexing from. Default behavior is to resume after the checkpoints of the configured actions, or to start from 1 without any.")
 	if err := v.BindPFlag(flagBeginBlock, cmd.Flags().Lookup(flagBeginBlock)); err != nil {
 		panic(err)
 	}
@@ -67,7 +123,7 @@ func beginBlockFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
 }
 
 func endBlockFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
-	cmd.Flags().Int64P(flagEndBlock, "e", defaultEndBlock, "block height to end indexing at. Default behavior is to use most recent height.")
+	cmd.Flags().StringP(flagEndBlock, "e", defaultEndBlock, "block height to end indexing at, or head-N to stay N blocks behind the most recent height. Default behavior is to use most recent height.")
 	if err := v.BindPFlag(flagEndBlock, cmd.Flags().Lookup(flagEndBlock)); err != nil {
 		panic(err)
 	}
@@ -82,6 +138,22 @@ func fileFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
 	return cmd
 }
 
+func resultsFileFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().String(flagResultsFile, "", "fetch the block results json data from specified file, rather than querying them")
+	if err := v.BindPFlag(flagResultsFile, cmd.Flags().Lookup(flagResultsFile)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func dirFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().String(flagDir, "", "fetch json data from every *.json file in the specified directory")
+	if err := v.BindPFlag(flagDir, cmd.Flags().Lookup(flagDir)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
 func gormLogFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
 	cmd.Flags().StringP(flagGormLogLevel, "l", defaultGormLogLevel, "gorm log level. Valid values are silent, error, warn, and info.")
 	if err := v.BindPFlag(flagGormLogLevel, cmd.Flags().Lookup(flagGormLogLevel)); err != nil {
@@ -89,3 +161,271 @@ func gormLogFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
 	}
 	return cmd
 }
+
+func chainFilterFlags(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().BoolP(flagAll, "a", false, "index every configured chain")
+	cmd.Flags().StringSlice(flagOnlyChains, nil, "comma separated list of chain-ids to index when using --all")
+	cmd.Flags().StringSlice(flagExcludeChains, nil, "comma separated list of chain-ids to skip when using --all")
+	if err := v.BindPFlag(flagAll, cmd.Flags().Lookup(flagAll)); err != nil {
+		panic(err)
+	}
+	if err := v.BindPFlag(flagOnlyChains, cmd.Flags().Lookup(flagOnlyChains)); err != nil {
+		panic(err)
+	}
+	if err := v.BindPFlag(flagExcludeChains, cmd.Flags().Lookup(flagExcludeChains)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func retryDeadlineFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Duration(flagRetryDeadline, defaultRetryDeadline, "max duration to keep retrying failed blocks before giving up (e.g. 30m). Default behavior is to retry indefinitely.")
+	if err := v.BindPFlag(flagRetryDeadline, cmd.Flags().Lookup(flagRetryDeadline)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func maxRetryPassesFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Int(flagMaxRetryPasses, defaultMaxRetryPasses, "max number of passes over the failed blocks before giving up and reporting them as failed, 0 retries until --retry-deadline is reached")
+	if err := v.BindPFlag(flagMaxRetryPasses, cmd.Flags().Lookup(flagMaxRetryPasses)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func blockResultsFallbackFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagResultsFallback, true, "query txs individually when block results are unavailable for a height")
+	if err := v.BindPFlag(flagResultsFallback, cmd.Flags().Lookup(flagResultsFallback)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func blocksFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Int64(flagBlocks, defaultBenchBlocks, "number of recent blocks to index")
+	if err := v.BindPFlag(flagBlocks, cmd.Flags().Lookup(flagBlocks)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func configSnippetFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagConfigSnippet, false, "returns the response as a ready to paste actions section of the config file")
+	if err := v.BindPFlag(flagConfigSnippet, cmd.Flags().Lookup(flagConfigSnippet)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func trackMsgProgressFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagTrackMsgProgress, false, "record the last msg written within each block so interrupted blocks resume at the exact msg, requires --concurrent-txs=1")
+	if err := v.BindPFlag(flagTrackMsgProgress, cmd.Flags().Lookup(flagTrackMsgProgress)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func eventsSummaryFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagEventsSummary, false, "store a map of event type -> count along with each tx for cheap event presence queries")
+	if err := v.BindPFlag(flagEventsSummary, cmd.Flags().Lookup(flagEventsSummary)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func actionFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().String(flagAction, "", "name of the single block action to use, rather than every configured action")
+	if err := v.BindPFlag(flagAction, cmd.Flags().Lookup(flagAction)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func blockTransactionsFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagBlockTxs, false, "write each action's rows and checkpoint for a block in a single database transaction, so the block either fully commits or rolls back")
+	if err := v.BindPFlag(flagBlockTxs, cmd.Flags().Lookup(flagBlockTxs)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func retryFailedActionsFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagRetryActions, false, "retry a block when any of its actions fails, until every action succeeds or --retry-deadline is reached, rather than only recording it as failed")
+	if err := v.BindPFlag(flagRetryActions, cmd.Flags().Lookup(flagRetryActions)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func rpcFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().String(flagRPC, "", "RPC address to use for this run instead of the one in the chain config, only valid when indexing a single chain")
+	if err := v.BindPFlag(flagRPC, cmd.Flags().Lookup(flagRPC)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func sampleFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Int64(flagSample, 1, "only index every Nth block of the range, runs with a value greater than 1 are recorded as sampled")
+	if err := v.BindPFlag(flagSample, cmd.Flags().Lookup(flagSample)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func txResultsCacheFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Int(flagTxResultsCache, indexer.DefaultTxResultsCacheSize, "max number of blocks whose tx results are cached for reuse by actions and retries, 0 disables the cache")
+	if err := v.BindPFlag(flagTxResultsCache, cmd.Flags().Lookup(flagTxResultsCache)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func storeSuccessLogFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagStoreSuccessLog, true, "store the raw logs of successful txs, set to false to only keep the code and the error logs of failed txs")
+	if err := v.BindPFlag(flagStoreSuccessLog, cmd.Flags().Lookup(flagStoreSuccessLog)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func maxChainsConcurrentFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Uint(flagMaxChains, 0, "max number of chains indexed at once when using --all, the rest are queued. Default behavior is to index every chain at once.")
+	if err := v.BindPFlag(flagMaxChains, cmd.Flags().Lookup(flagMaxChains)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func denomMetadataFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagDenomMetadata, false, "store the bank module metadata (display denom, exponent, symbol) of indexed denoms in the denom_metadata table")
+	if err := v.BindPFlag(flagDenomMetadata, cmd.Flags().Lookup(flagDenomMetadata)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func addressFileFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().String(flagAddressFile, "", "file of watched addresses, one per line, only txs involving any of them are indexed")
+	if err := v.BindPFlag(flagAddressFile, cmd.Flags().Lookup(flagAddressFile)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func normalizedTransfersFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagNormTransfers, false, "also store incoming and outgoing ics-20 transfers in a single normalized transfers table")
+	if err := v.BindPFlag(flagNormTransfers, cmd.Flags().Lookup(flagNormTransfers)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func genesisHeightsFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Int64(flagGenesisHeights, indexer.DefaultGenesisHeights, "number of heights from the chain's initial height whose failures are logged rather than retried, 0 disables this")
+	if err := v.BindPFlag(flagGenesisHeights, cmd.Flags().Lookup(flagGenesisHeights)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func reconcileIntervalFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Duration(flagReconcile, 0, "how often the state derived by the block actions, e.g. CW20 balances (requires daodao.sequential-blocks), is reconciled against the chain (e.g. 1h). Default behavior is to never reconcile.")
+	if err := v.BindPFlag(flagReconcile, cmd.Flags().Lookup(flagReconcile)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func stampRunIDFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagStampRunID, false, "stamp the id of this run on the written rows of the models that have a run_id column, e.g. txs")
+	if err := v.BindPFlag(flagStampRunID, cmd.Flags().Lookup(flagStampRunID)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func offlineFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagOffline, false, "only compare the configs, without querying the chains' nodes")
+	if err := v.BindPFlag(flagOffline, cmd.Flags().Lookup(flagOffline)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func skipMigrateFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagSkipMigrate, false, "don't run the schema migrations before indexing, for databases whose schema is managed externally (see db schema)")
+	if err := v.BindPFlag(flagSkipMigrate, cmd.Flags().Lookup(flagSkipMigrate)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func rawBlockWindowFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Int64(flagRawBlockWindow, 0, "number of most recent blocks whose raw JSON is stored, so they can be reprocessed without being queried again. Default behavior is to store none.")
+	if err := v.BindPFlag(flagRawBlockWindow, cmd.Flags().Lookup(flagRawBlockWindow)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func forceBeginFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagForceBegin, false, "start indexing from --begin-block even if the configured actions have checkpoints to resume from")
+	if err := v.BindPFlag(flagForceBegin, cmd.Flags().Lookup(flagForceBegin)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func forceFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagForce, false, "index every block in the range, including the blocks every configured action already indexed")
+	if err := v.BindPFlag(flagForce, cmd.Flags().Lookup(flagForce)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func dumpRawTxFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().String(flagDumpRawTx, "", "directory to write the raw bytes of txs that fail to decode to, named by chain id, height and tx index. Default behavior is to not write them.")
+	if err := v.BindPFlag(flagDumpRawTx, cmd.Flags().Lookup(flagDumpRawTx)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func followFlags(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Bool(flagFollow, false, "keep indexing new blocks as they are produced once the end block is reached. Ignored when --end-block is an absolute height.")
+	cmd.Flags().Duration(flagPollInterval, defaultPollInterval, "how often the latest height is polled for new blocks with --follow")
+	cmd.Flags().Duration(flagSweepInterval, defaultSweepInterval, "with --follow, how often the followed blocks that weren't indexed by every action, along with the recorded failed blocks, are indexed again. 0 disables the sweep.")
+	if err := v.BindPFlag(flagFollow, cmd.Flags().Lookup(flagFollow)); err != nil {
+		panic(err)
+	}
+	if err := v.BindPFlag(flagPollInterval, cmd.Flags().Lookup(flagPollInterval)); err != nil {
+		panic(err)
+	}
+	if err := v.BindPFlag(flagSweepInterval, cmd.Flags().Lookup(flagSweepInterval)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func lagWatchdogFlags(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().Int64(flagLagThreshold, 0, "with --follow, alert when the indexed height falls more than this many blocks behind the chain head. Default behavior is to not watch the lag.")
+	cmd.Flags().String(flagLagWebhook, "", "URL the lag alerts are posted to as JSON, in addition to being logged")
+	if err := v.BindPFlag(flagLagThreshold, cmd.Flags().Lookup(flagLagThreshold)); err != nil {
+		panic(err)
+	}
+	if err := v.BindPFlag(flagLagWebhook, cmd.Flags().Lookup(flagLagWebhook)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func otelEndpointFlag(v *viper.Viper, cmd *cobra.Command) *cobra.Command {
+	cmd.Flags().String(flagOTelEndpoint, "", "OTLP/HTTP collector to export OpenTelemetry traces to, e.g. http://localhost:4318")
+	if err := v.BindPFlag(flagOTelEndpoint, cmd.Flags().Lookup(flagOTelEndpoint)); err != nil {
+		panic(err)
+	}
+	return cmd
+}
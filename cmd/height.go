@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/strangelove-ventures/valis/indexer"
+	"gorm.io/gorm/logger"
+)
+
+// heightCmd prints the highest indexed block height of each chain, according to the checkpoints of the actions.
+func heightCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "height [chain-id]",
+		Short: "Print the highest indexed block height, for every chain with checkpoints if no chain-id is specified",
+		Long: strings.TrimSpace(`
+Print the highest block height indexed by any of the actions, read from the checkpoints in the database.
+With a chain-id only the height is printed, and the command fails if the chain has no checkpoints yet,
+which makes it suitable for scripts and cron checks.`),
+		Args: cobra.MaximumNArgs(1),
+		Example: strings.TrimSpace(fmt.Sprintf(`
+$ %s height
+$ %s height cosmoshub-4
+$ %s height cosmoshub-4 --json`, appName, appName, appName)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jsn, err := cmd.Flags().GetBool(flagJSON)
+			if err != nil {
+				return err
+			}
+
+			var chainID string
+			if len(args) == 1 {
+				chainID = args[0]
+			}
+
+			dbOpts, err := a.Config.DB.Options()
+			if err != nil {
+				return err
+			}
+			db, err := indexer.ConnectToDatabase(a.Config.ConnectionString(), logger.Silent, dbOpts)
+			if err != nil {
+				return err
+			}
+
+			heights, err := indexer.LoadIndexedHeights(db, chainID)
+			if err != nil {
+				return err
+			}
+
+			return writeIndexedHeights(cmd.OutOrStdout(), heights, chainID, jsn)
+		},
+	}
+	return jsonFlag(a.Viper, cmd)
+}
+
+// writeIndexedHeights writes the heights to out, one chain per line or as JSON. With a chainID only the height of that
+// chain is written, which fails if the chain has no checkpoints.
+func writeIndexedHeights(out io.Writer, heights []indexer.IndexedHeight, chainID string, jsn bool) error {
+	if chainID != "" {
+		if len(heights) == 0 {
+			return fmt.Errorf("no checkpoints recorded for chain %s", chainID)
+		}
+		if jsn {
+			bz, err := json.Marshal(heights[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, string(bz))
+			return nil
+		}
+		fmt.Fprintln(out, heights[0].Height)
+		return nil
+	}
+
+	if jsn {
+		bz, err := json.Marshal(heights)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(bz))
+		return nil
+	}
+	for _, h := range heights {
+		fmt.Fprintf(out, "%s %d\n", h.ChainID, h.Height)
+	}
+	return nil
+}
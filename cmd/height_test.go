@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/strangelove-ventures/valis/indexer"
+)
+
+func TestWriteIndexedHeights(t *testing.T) {
+	heights := []indexer.IndexedHeight{{ChainID: "cosmoshub-4", Height: 15}, {ChainID: "osmosis-1", Height: 30}}
+	tests := []struct {
+		name     string
+		heights  []indexer.IndexedHeight
+		chainID  string
+		jsn      bool
+		expected string
+		wantErr  bool
+	}{
+		{name: "all chains", heights: heights, expected: "cosmoshub-4 15\nosmosis-1 30\n"},
+		{name: "all chains json", heights: heights, jsn: true, expected: `[{"chain_id":"cosmoshub-4","height":15},{"chain_id":"osmosis-1","height":30}]` + "\n"},
+		{name: "no chains json", heights: []indexer.IndexedHeight{}, jsn: true, expected: "[]\n"},
+		{name: "chain", heights: heights[:1], chainID: "cosmoshub-4", expected: "15\n"},
+		{name: "chain json", heights: heights[:1], chainID: "cosmoshub-4", jsn: true, expected: `{"chain_id":"cosmoshub-4","height":15}` + "\n"},
+		{name: "chain without checkpoints", heights: []indexer.IndexedHeight{}, chainID: "juno-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := writeIndexedHeights(&out, tt.heights, tt.chainID, tt.jsn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeIndexedHeights returned error %v, want error %t", err, tt.wantErr)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("got output %q, expected %q", out.String(), tt.expected)
+			}
+		})
+	}
+}
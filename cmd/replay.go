@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"gorm.io/gorm/logger"
+)
+
+// replayCmd runs the block actions against a block saved as JSON, so a block that fails to be indexed can be
+// attached to a bug report and reproduced without access to a node that still serves it.
+func replayCmd(a *appState) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "replay",
+		Aliases: []string{"rp"},
+		Short:   "Replay a block saved as JSON through the block actions, writing to the database",
+		Args:    cobra.NoArgs,
+		Example: strings.TrimSpace(fmt.Sprintf(`
+$ %s replay --file block.json
+$ %s replay --file block.json --results-file block_results.json --action daodao`, appName, appName)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := cmd.Flags().GetString(flagFile)
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				return fmt.Errorf("--%s is required, the path of the block to replay", flagFile)
+			}
+
+			resultsFile, err := cmd.Flags().GetString(flagResultsFile)
+			if err != nil {
+				return err
+			}
+
+			block, err := indexer.LoadBlockFile(file)
+			if err != nil {
+				return err
+			}
+
+			// The tx results are queried from the chain unless they were saved along with the block
+			var results *coretypes.ResultBlockResults
+			if resultsFile != "" {
+				if results, err = indexer.LoadBlockResultsFile(resultsFile); err != nil {
+					return err
+				}
+			}
+
+			timeouts, err := a.Config.Timeouts.Parse()
+			if err != nil {
+				return err
+			}
+
+			// The chain of the block is needed for the codec its txs are decoded with
+			chainConfig, err := a.Config.GetChainConfig(block.Block.ChainID)
+			if err != nil {
+				return err
+			}
+
+			chainClient, err := newChainClient(cmd, a, chainConfig)
+			if err != nil {
+				return err
+			}
+
+			dbOpts, err := a.Config.DB.Options()
+			if err != nil {
+				return err
+			}
+			db, err := indexer.ConnectToDatabase(a.Config.ConnectionString(), logger.Silent, dbOpts)
+			if err != nil {
+				return err
+			}
+
+			i := indexer.NewIndexer(a.Log, chainClient, db)
+			i.Timeouts = timeouts
+
+			// Replay through the configured block actions, or only through the action named with --action
+			actionName, err := cmd.Flags().GetString(flagAction)
+			if err != nil {
+				return err
+			}
+			actions, err := startBlockActions(a, actionName)
+			if err != nil {
+				return err
+			}
+
+			if len(actions) == 0 {
+				return fmt.Errorf("no block actions configured, check the actions section of your config")
+			}
+
+			if err = i.ValidateActions(actions); err != nil {
+				return err
+			}
+
+			if err = i.MigrateSchemas(actions); err != nil {
+				return err
+			}
+
+			if err = i.ReplayBlock(cmd.Context(), block, results, actions); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Replayed block %d of %s\n", block.Block.Height, block.Block.ChainID)
+			return nil
+		},
+	}
+	return actionFlag(a.Viper, resultsFileFlag(a.Viper, fileFlag(a.Viper, cmd)))
+}
@@ -88,6 +88,12 @@ func NewRootCmd(log *zap.Logger) *cobra.Command {
 		configCmd(a),
 		chainsCmd(a),
 		startCmd(a),
+		benchCmd(a),
+		actionsCmd(a),
+		failedCmd(a),
+		heightCmd(a),
+		replayCmd(a),
+		dbCmd(a),
 		getVersionCmd(a),
 	)
 
@@ -176,3 +182,32 @@ func newRootLogger(format string, debug bool) (*zap.Logger, error) {
 		level,
 	)), nil
 }
+
+// levelCore replaces the level of the wrapped core, unlike zap.IncreaseLevel it can also lower it.
+// This relies on the wrapped core only checking the level in Check and not in Write, as the cores of zapcore.NewCore do.
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+// withLevel returns a logger that logs at the specified level regardless of the level of log.
+func withLevel(log *zap.Logger, level zapcore.Level) *zap.Logger {
+	return log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return levelCore{Core: core, level: level}
+	}))
+}
+
+func (c levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.level.Enabled(lvl)
+}
+
+func (c levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
@@ -1,14 +1,25 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cosmos/cosmos-sdk/types/module"
+	authvesting "github.com/cosmos/cosmos-sdk/x/auth/vesting"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/strangelove-ventures/valis/internal/indexdebug"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm/logger"
 
 	_ "github.com/lib/pq"
@@ -17,16 +28,19 @@ import (
 	"github.com/strangelove-ventures/valis/indexer"
 )
 
-// startCmd starts the indexer on the specified chain.
+// startCmd starts the indexer on the specified chain, or on every configured chain when --all is passed.
 func startCmd(a *appState) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "start [chain-id]",
 		Aliases: []string{"st"},
 		Short:   "Start the indexer",
-		Args:    cobra.ExactArgs(1),
+		Args:    cobra.MaximumNArgs(1),
 		Example: strings.TrimSpace(fmt.Sprintf(`
 $ %s start
-$ %s st`, appName, appName)),
+$ %s st
+$ %s start --all --exclude-chains osmosis-1
+$ %s start --end-block head-100
+$ %s start --action msg_signers`, appName, appName, appName, appName, appName)),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 
@@ -39,43 +53,416 @@ $ %s st`, appName, appName)),
 				return fmt.Errorf("invalid flag value %d, value of --concurrent-blocks must be greater than or equal to 1", concurrentBlocks)
 			}
 
+			// Determine how many goroutines each block action may use to process the txs of a block
+			concurrentTxs, err := cmd.Flags().GetUint(flagConcurrentTxs)
+			if err != nil {
+				return err
+			}
+			if concurrentTxs < 1 {
+				return fmt.Errorf("invalid flag value %d, value of --concurrent-txs must be greater than or equal to 1", concurrentTxs)
+			}
+
+			// Determine if the msg progress within a block should be recorded, this relies on txs being processed in order
+			trackMsgProgress, err := cmd.Flags().GetBool(flagTrackMsgProgress)
+			if err != nil {
+				return err
+			}
+			if trackMsgProgress && concurrentTxs > 1 {
+				return fmt.Errorf("--%s can't be used along with a --%s value greater than 1", flagTrackMsgProgress, flagConcurrentTxs)
+			}
+
+			// Get the batch flush triggers for the block actions with batching configured
+			batching, err := a.Config.ParseBatching()
+			if err != nil {
+				return err
+			}
+			if trackMsgProgress && len(batching) > 0 {
+				return fmt.Errorf("--%s can't be used along with batching, since batched rows are written after the progress is recorded", flagTrackMsgProgress)
+			}
+
+			// Determine if each action's writes for a block should be wrapped in a single transaction
+			blockTxs, err := cmd.Flags().GetBool(flagBlockTxs)
+			if err != nil {
+				return err
+			}
+
+			// Determine if blocks whose actions failed should be retried rather than only recorded as failed
+			retryActions, err := cmd.Flags().GetBool(flagRetryActions)
+			if err != nil {
+				return err
+			}
+
+			// Determine if a summary of the events emitted by each tx should be stored
+			eventsSummary, err := cmd.Flags().GetBool(flagEventsSummary)
+			if err != nil {
+				return err
+			}
+
+			// Determine how long failed blocks should be retried for
+			retryDeadline, err := cmd.Flags().GetDuration(flagRetryDeadline)
+			if err != nil {
+				return err
+			}
+
+			// Determine how many passes should be made over the failed blocks
+			maxRetryPasses, err := cmd.Flags().GetInt(flagMaxRetryPasses)
+			if err != nil {
+				return err
+			}
+			if maxRetryPasses < 0 {
+				return fmt.Errorf("invalid flag value %d, value of --max-retry-passes must be greater than or equal to 0", maxRetryPasses)
+			}
+
+			// Determine if txs should be queried individually when block results are unavailable
+			resultsFallback, err := cmd.Flags().GetBool(flagResultsFallback)
+			if err != nil {
+				return err
+			}
+
+			// Determine how many blocks worth of tx results may be cached
+			txResultsCacheSize, err := cmd.Flags().GetInt(flagTxResultsCache)
+			if err != nil {
+				return err
+			}
+			if txResultsCacheSize < 0 {
+				return fmt.Errorf("invalid flag value %d, value of --%s must be greater than or equal to 0", txResultsCacheSize, flagTxResultsCache)
+			}
+
+			// Determine how many chains may be indexed at once, 0 means every selected chain
+			maxChains, err := cmd.Flags().GetUint(flagMaxChains)
+			if err != nil {
+				return err
+			}
+
+			// Determine how often the state derived by the actions is reconciled against the chain, 0 means never
+			reconcileInterval, err := cmd.Flags().GetDuration(flagReconcile)
+			if err != nil {
+				return err
+			}
+			if reconcileInterval < 0 {
+				return fmt.Errorf("invalid flag value %s, value of --%s must be greater than or equal to 0", reconcileInterval, flagReconcile)
+			}
+
+			// Determine if the rows written by this run should be stamped with its run id
+			stampRunID, err := cmd.Flags().GetBool(flagStampRunID)
+			if err != nil {
+				return err
+			}
+
+			// Determine how many of the most recent blocks should be stored as raw JSON
+			rawBlockWindow, err := cmd.Flags().GetInt64(flagRawBlockWindow)
+			if err != nil {
+				return err
+			}
+			if rawBlockWindow < 0 {
+				return fmt.Errorf("invalid flag value %d, value of --%s must be greater than or equal to 0", rawBlockWindow, flagRawBlockWindow)
+			}
+
+			// Get the number of txs per second handed to the block actions of each chain
+			if a.Config.TxRateLimit < 0 {
+				return fmt.Errorf("invalid tx-rate-limit %v in config, must be greater than or equal to 0", a.Config.TxRateLimit)
+			}
+
+			// Get the directory the raw bytes of txs that fail to decode are written to
+			rawTxDumpDir, err := cmd.Flags().GetString(flagDumpRawTx)
+			if err != nil {
+				return err
+			}
+			if rawTxDumpDir != "" {
+				if err = os.MkdirAll(rawTxDumpDir, os.ModePerm); err != nil {
+					return fmt.Errorf("failed to create --%s directory: %w", flagDumpRawTx, err)
+				}
+			}
+
+			// Get the timeouts for the RPC queries made while indexing
+			timeouts, err := a.Config.Timeouts.Parse()
+			if err != nil {
+				return err
+			}
+
+			// Determine if the raw logs of successful txs should be stored
+			storeSuccessLog, err := cmd.Flags().GetBool(flagStoreSuccessLog)
+			if err != nil {
+				return err
+			}
+
+			// Determine if the metadata of indexed denoms should be stored
+			denomMetadata, err := cmd.Flags().GetBool(flagDenomMetadata)
+			if err != nil {
+				return err
+			}
+
+			// Determine if incoming and outgoing transfers should also be stored in the normalized transfers table
+			normalizedTransfers, err := cmd.Flags().GetBool(flagNormTransfers)
+			if err != nil {
+				return err
+			}
+
+			// Determine how many of the chain's first heights are special-cased
+			genesisHeights, err := cmd.Flags().GetInt64(flagGenesisHeights)
+			if err != nil {
+				return err
+			}
+			if genesisHeights < 0 {
+				return fmt.Errorf("invalid flag value %d, value of --%s must be greater than or equal to 0", genesisHeights, flagGenesisHeights)
+			}
+
+			// Load the watched addresses, if any, so only the txs involving them are indexed
+			addressFile, err := cmd.Flags().GetString(flagAddressFile)
+			if err != nil {
+				return err
+			}
+			var watchedAddresses map[string]struct{}
+			if addressFile != "" {
+				if watchedAddresses, err = indexer.LoadAddressFile(addressFile); err != nil {
+					return err
+				}
+			}
+
+			// Get the OTLP/HTTP endpoint the traces should be exported to, if any
+			otelEndpoint, err := cmd.Flags().GetString(flagOTelEndpoint)
+			if err != nil {
+				return err
+			}
+
+			// Get how the raw logs of failed txs should be stored
+			failedRawLog, err := a.Config.FailedRawLog.Parse()
+			if err != nil {
+				return err
+			}
+
 			// Get the log level for gorm logging
-			logLevel, err := cmd.Flags().GetString(flagGormLogLevel)
+			logLevelStr, err := cmd.Flags().GetString(flagGormLogLevel)
 			if err != nil {
-				return nil
+				return err
+			}
+			logLevel, err := gormLogLevel(logLevelStr)
+			if err != nil {
+				return err
 			}
 
-			// Get the chain's config for the chain we are indexing
-			chainConfig, err := a.Config.GetChainConfig(args[0])
+			// Get the configs for the chains we are indexing
+			chainConfigs, err := chainConfigsToIndex(cmd, a, args)
 			if err != nil {
 				return err
 			}
 
-			// Create client from chain config
-			chainConfig.Modules = append([]module.AppModuleBasic{}, lens.ModuleBasics...)
-			chainClient, err := lens.NewChainClient(
-				a.Log.With(zap.String("chain", chainConfig.ChainID)),
-				chainConfig,
-				os.Getenv("HOME"),
-				cmd.InOrStdin(),
-				cmd.OutOrStdout(),
-			)
+			// Override the configured RPC address for this run, without modifying the config itself
+			rpcAddr, err := cmd.Flags().GetString(flagRPC)
 			if err != nil {
 				return err
 			}
+			if chainConfigs, err = overrideRPCAddr(chainConfigs, rpcAddr); err != nil {
+				return err
+			}
 
-			// Create the database connection
-			db, err := indexer.ConnectToDatabase(a.Config.ConnectionString(), gormLogLevel(logLevel))
+			// Create the database connection, the pool is sized for the concurrent blocks unless configured
+			dbOpts, err := a.Config.DB.Options()
+			if err != nil {
+				return err
+			}
+			db, err := indexer.ConnectToDatabase(a.Config.ConnectionString(), logLevel, dbOpts.WithConcurrencyDefaults(concurrentBlocks))
 			if err != nil {
 				return err
 			}
 
-			// Create the indexer
-			i := indexer.NewIndexer(
-				a.Log,
-				chainClient,
-				db,
-			)
+			// Back off while the database is out of connections, the throttle is shared by every chain
+			dbThrottle := indexer.NewDBThrottle(a.Log)
+			if err = indexer.UseDBThrottle(db, dbThrottle); err != nil {
+				return err
+			}
+
+			// Count the rows written by each block action, they're summarized once each chain is indexed
+			if err = indexer.UseRowCounts(db); err != nil {
+				return err
+			}
+
+			// Identify this run, so the rows it writes can be told apart from those of other runs
+			runID, err := indexer.NewRunID()
+			if err != nil {
+				return fmt.Errorf("failed to generate run id: %w", err)
+			}
+			a.Log.Info("Starting indexer run", zap.String("run_id", runID))
+
+			// Invoke the configured row transformers on every row before it is written,
+			// the run id is stamped first so the configured transformers see it
+			var rowTransformers indexer.RowTransformers
+			if stampRunID {
+				rowTransformers = append(rowTransformers, indexer.RunIDTransformer(runID))
+			}
+			if len(a.Config.Transformers) > 0 {
+				rowTransformer, err := a.Config.RowTransformer()
+				if err != nil {
+					return err
+				}
+				rowTransformers = append(rowTransformers, rowTransformer)
+			}
+			if len(rowTransformers) > 0 {
+				if err = indexer.UseRowTransformer(db, rowTransformers); err != nil {
+					return err
+				}
+			}
+
+			// Fan the written rows out to the configured sinks
+			if len(a.Config.Sinks.Outputs) > 0 {
+				sinkPolicy, err := indexer.ParseSinkPolicy(a.Config.Sinks.Policy)
+				if err != nil {
+					return err
+				}
+				sinks, err := a.Config.Sinks.Open()
+				if err != nil {
+					return err
+				}
+				defer func() {
+					for _, s := range sinks {
+						if err := s.Close(); err != nil {
+							a.Log.Warn("Failed to close sink", zap.String("sink", s.Name()), zap.Error(err))
+						}
+					}
+				}()
+				if err = indexer.UseSinks(db, a.Log, sinkPolicy, sinks...); err != nil {
+					return err
+				}
+			}
+
+			// Trace the blocks, actions and DB writes, the remaining spans are flushed before exiting
+			if otelEndpoint != "" {
+				tp, err := indexer.NewOTLPTracerProvider(otelEndpoint)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+					if err := tp.Shutdown(shutdownCtx); err != nil {
+						a.Log.Warn("Failed to flush traces", zap.Error(err))
+					}
+				}()
+				otel.SetTracerProvider(tp)
+				if err = indexer.UseTracing(db); err != nil {
+					return err
+				}
+			}
+
+			// Create a client and an indexer for each chain
+			var indexers []*indexer.Indexer
+			for _, chainConfig := range chainConfigs {
+				chainClient, err := newChainClient(cmd, a, chainConfig)
+				if err != nil {
+					return err
+				}
+
+				i := indexer.NewIndexer(
+					a.Log,
+					chainClient,
+					db,
+				)
+
+				// Fail early rather than retrying every block against an unreachable override
+				if rpcAddr != "" {
+					if _, err := i.QueryLatestHeight(ctx); err != nil {
+						return fmt.Errorf("rpc address %s is not reachable: %w", rpcAddr, err)
+					}
+				}
+				i.ConcurrentTxs = concurrentTxs
+				i.TrackMsgProgress = trackMsgProgress
+				i.EventsSummary = eventsSummary
+				i.UseBatching(batching)
+				i.BlockTransactions = blockTxs
+				i.FailedRawLog = failedRawLog
+				i.TxResultsCacheSize = txResultsCacheSize
+				i.StoreSuccessLog = storeSuccessLog
+				i.DenomMetadata = denomMetadata
+				i.WatchedAddresses = watchedAddresses
+				i.NormalizedTransfers = normalizedTransfers
+				i.GenesisHeights = genesisHeights
+				i.RunID = runID
+				i.DBThrottle = dbThrottle
+				i.RawBlockWindow = rawBlockWindow
+				i.RawTxDumpDir = rawTxDumpDir
+				i.TxRateLimit = indexer.NewTxRateLimit(a.Config.TxRateLimit)
+				i.RetryDeadline = retryDeadline
+				i.MaxRetryPasses = maxRetryPasses
+				i.RetryFailedActions = retryActions
+				i.BlockResultsFallback = resultsFallback
+				i.Timeouts = timeouts
+				indexers = append(indexers, i)
+			}
+
+			beginBlock, err := cmd.Flags().GetInt64(flagBeginBlock)
+			if err != nil {
+				return err
+			}
+
+			// Determine if the checkpoints of the actions should be ignored in favor of --begin-block
+			forceBegin, err := cmd.Flags().GetBool(flagForceBegin)
+			if err != nil {
+				return err
+			}
+
+			// Determine if the blocks that were already indexed by every action should be indexed again
+			force, err := cmd.Flags().GetBool(flagForce)
+			if err != nil {
+				return err
+			}
+
+			// if users don't specify an end block,
+			// use the latest block height.
+			endBlockFlag, err := cmd.Flags().GetString(flagEndBlock)
+			if err != nil {
+				return err
+			}
+			endBlock, err := parseEndBlock(endBlockFlag)
+			if err != nil {
+				return err
+			}
+
+			// Determine if new blocks should be indexed as they are produced, only an end block relative
+			// to the latest height can follow the chain
+			follow, err := cmd.Flags().GetBool(flagFollow)
+			if err != nil {
+				return err
+			}
+			pollInterval, err := cmd.Flags().GetDuration(flagPollInterval)
+			if err != nil {
+				return err
+			}
+			if follow && pollInterval <= 0 {
+				return fmt.Errorf("invalid flag value %s, value of --%s must be greater than 0", pollInterval, flagPollInterval)
+			}
+			sweepInterval, err := cmd.Flags().GetDuration(flagSweepInterval)
+			if err != nil {
+				return err
+			}
+			if sweepInterval < 0 {
+				return fmt.Errorf("invalid flag value %s, value of --%s must be greater than or equal to 0", sweepInterval, flagSweepInterval)
+			}
+			if follow && !endBlock.relative {
+				a.Log.Info("Ignoring --" + flagFollow + " since --" + flagEndBlock + " is an absolute height")
+				follow = false
+			}
+
+			// Watch how far behind the chain head indexing falls while following new blocks
+			lagThreshold, err := cmd.Flags().GetInt64(flagLagThreshold)
+			if err != nil {
+				return err
+			}
+			if lagThreshold < 0 {
+				return fmt.Errorf("invalid flag value %d, value of --%s must be greater than or equal to 0", lagThreshold, flagLagThreshold)
+			}
+			lagWebhook, err := cmd.Flags().GetString(flagLagWebhook)
+			if err != nil {
+				return err
+			}
+			if lagWebhook != "" {
+				if u, err := url.Parse(lagWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("invalid --%s %q, expected an http(s) URL", flagLagWebhook, lagWebhook)
+				}
+			}
+			var lagWatchdog *indexer.LagWatchdog
+			if follow && lagThreshold > 0 {
+				lagWatchdog = indexer.NewLagWatchdog(a.Log.With(zap.String("sys", "lag_watchdog")), lagThreshold, lagWebhook)
+			}
 
 			// Start the debug server if necessary
 			debugAddr, err := cmd.Flags().GetString(flagDebugAddr)
@@ -92,81 +479,543 @@ $ %s st`, appName, appName)),
 				}
 				log := a.Log.With(zap.String("sys", "debughttp"))
 				log.Info("Debug server listening", zap.String("addr", debugAddr))
-				indexdebug.StartDebugServer(cmd.Context(), log, ln)
+
+				// Record the indexing progress of every chain, served in the prometheus format on /metrics
+				registry := prometheus.NewRegistry()
+				metrics, err := indexer.NewMetrics(registry)
+				if err != nil {
+					return err
+				}
+				if err = indexer.UseMetrics(db, metrics); err != nil {
+					return err
+				}
+				for _, i := range indexers {
+					i.Metrics = metrics
+				}
+
+				indexdebug.StartDebugServer(cmd.Context(), log, ln,
+					indexdebug.Route{
+						Pattern: "/metrics",
+						Handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+					},
+					indexdebug.Route{
+						Pattern: "/failed-blocks",
+						Handler: indexdebug.JSONHandler(log, func() interface{} {
+							failed := make([]indexer.FailedBlock, 0)
+							for _, i := range indexers {
+								failed = append(failed, i.FailedBlocks()...)
+							}
+							return failed
+						}),
+					},
+					indexdebug.Route{
+						Pattern: "/debug/config",
+						Handler: indexdebug.JSONHandler(log, func() interface{} {
+							return newDebugConfigResponse(a.Config, indexers, lagWatchdog)
+						}),
+					},
+				)
 			}
 
-			beginBlock, err := cmd.Flags().GetInt64(flagBeginBlock)
+			// Determine if only every Nth block of the range should be indexed
+			sample, err := cmd.Flags().GetInt64(flagSample)
 			if err != nil {
 				return err
 			}
+			if sample < 1 {
+				return fmt.Errorf("invalid flag value %d, value of --%s must be greater than or equal to 1", sample, flagSample)
+			}
 
-			// if users don't specify an end block,
-			// use the latest block height.
-			endBlock, err := cmd.Flags().GetInt64(flagEndBlock)
+			// Build a slice of the configured block actions, or of the single action named with --action
+			actionName, err := cmd.Flags().GetString(flagAction)
 			if err != nil {
 				return err
 			}
-			if endBlock == 0 {
-				endBlock, err = i.Client.QueryLatestHeight(ctx)
-				if err != nil {
+			actions, err := startBlockActions(a, actionName)
+			if err != nil {
+				return err
+			}
+
+			if len(actions) == 0 {
+				return fmt.Errorf("no block actions configured, check the actions section of your config")
+			}
+
+			// Rows of different actions must not end up in the same table, where their keys would conflict
+			if err = indexer.CheckSharedTables(a.Log, actions); err != nil {
+				return err
+			}
+
+			// Check the actions against each chain before anything is indexed
+			for _, i := range indexers {
+				if err = i.ValidateActions(actions); err != nil {
 					return err
 				}
 			}
 
-			// Build the slice of block heights to be indexed
-			var blocks []int64
-			for i := beginBlock; i < endBlock; i++ {
-				blocks = append(blocks, i)
+			// Migrate the database schemas for the indexer and the configured actions,
+			// all chains share the same database so this only needs to happen once.
+			if err = migrateSchemas(cmd, a, indexers[0], actions); err != nil {
+				return err
 			}
 
-			// Build a slice of the configured block actions
-			var actions []indexer.BlockAction
-			for _, name := range a.Config.Actions {
-				action, err := a.Config.GetBlockActionByName(a.Log, name)
-				if err != nil {
-					a.Log.Info(
-						"Failed to get block action",
-						zap.String("block_action_name", name),
-					)
-					continue
+			// Refuse to index into tables that don't match the models, e.g. when the migrations are skipped
+			if err = indexers[0].CheckSchemaVersions(actions); err != nil {
+				var outdatedErr *indexer.OutdatedSchemaError
+				if errors.As(err, &outdatedErr) {
+					return fmt.Errorf("%w, run `%s db migrate` before starting the indexer", err, appName)
 				}
-				actions = append(actions, action)
+				return err
 			}
 
-			if len(actions) == 0 {
-				return fmt.Errorf("no block actions configured, check the actions section of your config")
-			}
+			// Run an indexer for each chain, chains beyond the --max-chains-concurrent limit wait for a free slot
+			return runChains(ctx, indexers, maxChains, func(ctx context.Context, i *indexer.Indexer) error {
+				chainEndBlock := endBlock.height
+				if endBlock.relative {
+					latestHeight, err := i.QueryLatestHeight(ctx)
+					if err != nil {
+						return err
+					}
+					chainEndBlock = endBlock.resolve(latestHeight)
+				}
+
+				// Resume after the blocks indexed by every action, unless told where to begin
+				chainBeginBlock := beginBlock
+				if !cmd.Flags().Changed(flagBeginBlock) && !forceBegin {
+					resumeHeight, ok, err := i.ResumeHeight(actions)
+					if err != nil {
+						return fmt.Errorf("failed to load checkpoints for chain %s: %w", i.Client.Config.ChainID, err)
+					}
+					if ok && resumeHeight > chainBeginBlock {
+						a.Log.Info(
+							"Resuming after the blocks indexed by the block actions",
+							zap.String("chain_id", i.Client.Config.ChainID),
+							zap.Int64("begin_block", resumeHeight),
+						)
+						chainBeginBlock = resumeHeight
+					}
+				}
+
+				// Keep an operational record of the run along with the node's software versions
+				if _, err := i.RecordChainRun(ctx, chainBeginBlock, chainEndBlock, sample); err != nil {
+					a.Log.Warn(
+						"Failed to record chain run",
+						zap.String("chain_id", i.Client.Config.ChainID),
+						zap.Error(err),
+					)
+				}
+
+				// Reconcile the actions' state periodically while the chain is being indexed
+				if reconcileInterval > 0 {
+					reconcileCtx, stopReconciling := context.WithCancel(ctx)
+					reconciled := make(chan struct{})
+					go func() {
+						defer close(reconciled)
+						i.ReconcileEvery(reconcileCtx, actions, reconcileInterval)
+					}()
+					defer func() {
+						stopReconciling()
+						<-reconciled
+					}()
+				}
+
+				blocks := sampleHeights(chainBeginBlock, chainEndBlock, sample)
+
+				// Skip the blocks that every action already indexed, unless told to index them again
+				if !force {
+					remaining, err := i.SkipIndexedBlocks(actions, blocks)
+					if err != nil {
+						return fmt.Errorf("failed to load indexed blocks for chain %s: %w", i.Client.Config.ChainID, err)
+					}
+					if skipped := len(blocks) - len(remaining); skipped > 0 {
+						a.Log.Info(
+							"Skipping blocks already indexed by every block action",
+							zap.String("chain_id", i.Client.Config.ChainID),
+							zap.Int("skipped_blocks", skipped),
+						)
+					}
+					blocks = remaining
+				}
 
-			// Migrate the database schemas for configured actions
-			for _, action := range actions {
-				if err = action.MigrateSchema(i); err != nil {
+				if err := i.ForEachBlock(ctx, blocks, actions, concurrentBlocks); err != nil {
 					return err
 				}
+				if !follow {
+					return nil
+				}
+				next := chainBeginBlock
+				if len(blocks) > 0 {
+					next = blocks[len(blocks)-1] + sample
+				}
+				if lagWatchdog != nil {
+					watchCtx, stopWatching := context.WithCancel(ctx)
+					defer stopWatching()
+					go lagWatchdog.Watch(watchCtx, i)
+				}
+				return followBlocks(ctx, a.Log, i, next, endBlock, sample, pollInterval, sweepInterval, actions, concurrentBlocks)
+			})
+		},
+	}
+	return maxRetryPassesFlag(a.Viper, retryFailedActionsFlag(a.Viper, forceFlag(a.Viper, actionFlag(a.Viper, lagWatchdogFlags(a.Viper, followFlags(a.Viper, dumpRawTxFlag(a.Viper, forceBeginFlag(a.Viper, rawBlockWindowFlag(a.Viper, skipMigrateFlag(a.Viper, stampRunIDFlag(a.Viper, reconcileIntervalFlag(a.Viper, genesisHeightsFlag(a.Viper, normalizedTransfersFlag(a.Viper, otelEndpointFlag(a.Viper, addressFileFlag(a.Viper, denomMetadataFlag(a.Viper, maxChainsConcurrentFlag(a.Viper, storeSuccessLogFlag(a.Viper, txResultsCacheFlag(a.Viper, sampleFlag(a.Viper, rpcFlag(a.Viper, blockTransactionsFlag(a.Viper, eventsSummaryFlag(a.Viper, trackMsgProgressFlag(a.Viper, blockResultsFallbackFlag(a.Viper, retryDeadlineFlag(a.Viper, chainFilterFlags(a.Viper, gormLogFlag(a.Viper, debugServerFlags(a.Viper, beginBlockFlag(a.Viper, endBlockFlag(a.Viper, concurrentTxsFlag(a.Viper, concurrentBlocksFlag(a.Viper, cmd))))))))))))))))))))))))))))))))))
+}
+
+// startBlockActions returns the block actions configured in the actions section of the config, or only the action
+// named actionName if it isn't empty. A range can then be re-indexed for a newly added action without the other
+// actions writing their rows again.
+func startBlockActions(a *appState, actionName string) ([]indexer.BlockAction, error) {
+	if actionName == "" {
+		return configuredBlockActions(a), nil
+	}
+	action, err := a.Config.GetBlockActionByName(a.Log, actionName)
+	if err != nil {
+		return nil, err
+	}
+	return []indexer.BlockAction{action}, nil
+}
+
+// migrateSchemas runs the schema migrations for the indexer and actions before anything is indexed,
+// unless --skip-migrate is set because the schema is managed externally.
+func migrateSchemas(cmd *cobra.Command, a *appState, i *indexer.Indexer, actions []indexer.BlockAction) error {
+	skipMigrate, err := cmd.Flags().GetBool(flagSkipMigrate)
+	if err != nil {
+		return err
+	}
+	if skipMigrate {
+		a.Log.Info("Skipping schema migrations, the schema is expected to be managed externally")
+		return nil
+	}
+	return i.MigrateSchemas(actions)
+}
+
+// startTime is used to report the uptime of the process on the debug server.
+var startTime = time.Now()
+
+// debugConfigResponse is served on the /debug/config endpoint of the debug server.
+type debugConfigResponse struct {
+	Config     Config             `json:"config"`
+	Uptime     string             `json:"uptime"`
+	Goroutines int                `json:"goroutines"`
+	Chains     []debugChainStatus `json:"chains"`
+}
+
+// debugChainStatus reports the progress of the indexer for a single chain.
+type debugChainStatus struct {
+	ChainID       string `json:"chain_id"`
+	CurrentHeight int64  `json:"current_height"`
+	LagAlerts     int64  `json:"lag_alerts,omitempty"`
+}
+
+// newDebugConfigResponse returns the effective config, with secrets redacted, along with runtime stats.
+func newDebugConfigResponse(cfg *Config, indexers []*indexer.Indexer, lagWatchdog *indexer.LagWatchdog) debugConfigResponse {
+	resp := debugConfigResponse{
+		Config:     cfg.Redacted(),
+		Uptime:     time.Since(startTime).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Chains:     make([]debugChainStatus, 0, len(indexers)),
+	}
+	for _, i := range indexers {
+		status := debugChainStatus{
+			ChainID:       i.Client.Config.ChainID,
+			CurrentHeight: i.LastHeight(),
+		}
+		if lagWatchdog != nil {
+			status.LagAlerts = lagWatchdog.Alerts(i.Client.Config.ChainID)
+		}
+		resp.Chains = append(resp.Chains, status)
+	}
+	return resp
+}
+
+// chainConfigsToIndex returns the chain configs that should be indexed by the start command.
+// Without --all the single chain-id argument is used, otherwise every configured chain is returned
+// after applying the --only-chains and --exclude-chains filters.
+func chainConfigsToIndex(cmd *cobra.Command, a *appState, args []string) (ChainConfigs, error) {
+	all, err := cmd.Flags().GetBool(flagAll)
+	if err != nil {
+		return nil, err
+	}
+	onlyChains, err := cmd.Flags().GetStringSlice(flagOnlyChains)
+	if err != nil {
+		return nil, err
+	}
+	excludeChains, err := cmd.Flags().GetStringSlice(flagExcludeChains)
+	if err != nil {
+		return nil, err
+	}
+
+	if !all {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected a single chain-id argument, or use --all to index every configured chain")
+		}
+		if len(onlyChains) > 0 || len(excludeChains) > 0 {
+			return nil, fmt.Errorf("--%s and --%s can only be used along with --%s", flagOnlyChains, flagExcludeChains, flagAll)
+		}
+
+		chainConfig, err := a.Config.GetChainConfig(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return ChainConfigs{chainConfig}, nil
+	}
+
+	if len(args) != 0 {
+		return nil, fmt.Errorf("can't pass a chain-id argument along with --%s", flagAll)
+	}
+
+	return a.Config.ChainConfigs.Filter(onlyChains, excludeChains)
+}
+
+// followBlocks keeps indexing the blocks produced from the height next onwards, polling the latest height of the chain
+// every pollInterval, until the context is cancelled. Each height is only handed to ForEachBlock once, blocks that
+// still fail are left to the gap sweep run every sweepInterval, see sweepGaps. Without a sweep they stop following.
+func followBlocks(ctx context.Context, log *zap.Logger, i *indexer.Indexer, next int64, endBlock endBlockSpec, sample int64, pollInterval, sweepInterval time.Duration, actions []indexer.BlockAction, concurrentBlocks uint) error {
+	log = log.With(zap.String("chain_id", i.Client.Config.ChainID))
+	log.Info(
+		"Following new blocks",
+		zap.Int64("next_block", next),
+		zap.Duration("poll_interval", pollInterval),
+		zap.Duration("sweep_interval", sweepInterval),
+	)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	// A nil channel never receives, so without a sweep interval the sweep never runs
+	var sweep <-chan time.Time
+	if sweepInterval > 0 {
+		sweepTicker := time.NewTicker(sweepInterval)
+		defer sweepTicker.Stop()
+		sweep = sweepTicker.C
+	}
+
+	followedFrom := next
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sweep:
+			// Sweeps run in between the polls, so the same block is never processed twice at once
+			if err := sweepGaps(ctx, log, i, followedFrom, next, sample, actions, concurrentBlocks); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Warn("Failed to sweep gaps in the followed blocks", zap.Error(err))
 			}
+			continue
+		case <-ticker.C:
+		}
+
+		latestHeight, err := i.QueryLatestHeight(ctx)
+		if err != nil {
+			log.Warn("Failed to query latest height while following new blocks", zap.Error(err))
+			continue
+		}
+
+		var blocks []int64
+		for end := endBlock.resolve(latestHeight); next < end; next += sample {
+			blocks = append(blocks, next)
+		}
+		if len(blocks) == 0 {
+			continue
+		}
 
-			// Run the indexer
-			if err := i.ForEachBlock(ctx, blocks, actions, concurrentBlocks); err != nil {
+		if err := i.ForEachBlock(ctx, blocks, actions, concurrentBlocks); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var failedBlocksErr *indexer.FailedBlocksError
+			if sweep == nil || !errors.As(err, &failedBlocksErr) {
 				return err
 			}
-			return nil
-		},
+			log.Warn(
+				"Leaving failed blocks to the next gap sweep",
+				zap.Int64s("failed_blocks", failedBlocksErr.Heights),
+			)
+		}
+	}
+}
+
+// sweepGaps retries the failed blocks recorded for the chain, then indexes again the blocks of the followed range
+// [begin, end) that weren't indexed by every action, e.g. blocks whose actions failed while following. Blocks still
+// failing are left to the next sweep.
+func sweepGaps(ctx context.Context, log *zap.Logger, i *indexer.Indexer, begin, end, sample int64, actions []indexer.BlockAction, concurrentBlocks uint) error {
+	var failedBlocksErr *indexer.FailedBlocksError
+
+	recovered, err := i.RetryFailedBlocks(ctx, actions, concurrentBlocks)
+	if err != nil && !errors.As(err, &failedBlocksErr) {
+		return fmt.Errorf("failed to retry failed blocks: %w", err)
+	}
+	if len(recovered) > 0 {
+		log.Info("Recovered failed blocks", zap.Int64s("recovered_blocks", recovered))
 	}
-	return gormLogFlag(a.Viper, debugServerFlags(a.Viper, beginBlockFlag(a.Viper, endBlockFlag(a.Viper, concurrentBlocksFlag(a.Viper, cmd)))))
+
+	gaps, err := i.SkipIndexedBlocks(actions, sampleHeights(begin, end, sample))
+	if err != nil {
+		return fmt.Errorf("failed to load indexed blocks: %w", err)
+	}
+	if len(gaps) == 0 {
+		return nil
+	}
+
+	log.Info(
+		"Indexing gaps in the followed blocks",
+		zap.Int("gap_blocks", len(gaps)),
+		zap.Int64("lowest_gap_block", gaps[0]),
+	)
+	if err := i.ForEachBlock(ctx, gaps, actions, concurrentBlocks); err != nil && !errors.As(err, &failedBlocksErr) {
+		return err
+	}
+	return nil
 }
 
-// gormLogLevel returns a logger.LogLevel used to indicate the log level that gorm should use.
-// The default log level is silent in the case that the user passes in an invalid string.
-func gormLogLevel(logLevel string) logger.LogLevel {
+// endBlockSpec represents the value of the --end-block flag, which is either an absolute height
+// or relative to the latest height of the chain at the time indexing starts.
+type endBlockSpec struct {
+	height   int64
+	relative bool
+}
+
+// parseEndBlock parses the value of the --end-block flag. An empty value, 0 or head resolve to the latest height,
+// head-N resolves to the latest height minus N, any other value must be an absolute height.
+func parseEndBlock(value string) (endBlockSpec, error) {
+	value = strings.TrimSpace(value)
 	switch {
-	case logLevel == "warn":
-		return logger.Warn
-	case logLevel == "info":
-		return logger.Info
-	case logLevel == "error":
-		return logger.Error
-	case logLevel == "silent":
-		return logger.Silent
+	case value == "" || value == "0" || value == "head":
+		return endBlockSpec{relative: true}, nil
+	case strings.HasPrefix(value, "head-"):
+		lag, err := strconv.ParseInt(strings.TrimPrefix(value, "head-"), 10, 64)
+		if err != nil || lag < 0 {
+			return endBlockSpec{}, fmt.Errorf("invalid --%s value %q, expected head-N where N is a non-negative integer", flagEndBlock, value)
+		}
+		return endBlockSpec{height: lag, relative: true}, nil
+	default:
+		height, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || height < 0 {
+			return endBlockSpec{}, fmt.Errorf("invalid --%s value %q, expected a block height or head-N", flagEndBlock, value)
+		}
+		return endBlockSpec{height: height}, nil
+	}
+}
+
+// resolve returns the end block height given the latest height of the chain.
+// Relative specs never resolve below 0, in which case there is nothing to index yet.
+func (s endBlockSpec) resolve(latestHeight int64) int64 {
+	if !s.relative {
+		return s.height
+	}
+	if s.height > latestHeight {
+		return 0
+	}
+	return latestHeight - s.height
+}
+
+// runChains calls run for each of the indexers in its own goroutine, with at most maxChains running at once
+// (0 means no limit), and returns the first error. The context passed to run is cancelled once any run fails.
+func runChains(ctx context.Context, indexers []*indexer.Indexer, maxChains uint, run func(ctx context.Context, i *indexer.Indexer) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	chainSem := make(chan struct{}, len(indexers))
+	if maxChains > 0 && int(maxChains) < len(indexers) {
+		chainSem = make(chan struct{}, maxChains)
+	}
+	for _, i := range indexers {
+		i := i
+		eg.Go(func() error {
+			select {
+			case chainSem <- struct{}{}:
+			case <-egCtx.Done():
+				return egCtx.Err()
+			}
+
+			// A waiting chain may get the slot of a chain that just failed, it must not start then
+			if err := egCtx.Err(); err != nil {
+				<-chainSem
+				return err
+			}
+
+			// Cancel the waiting chains before the slot is released when the chain fails
+			err := run(egCtx, i)
+			if err != nil {
+				cancel()
+			}
+			<-chainSem
+			return err
+		})
+	}
+	return eg.Wait()
+}
+
+// sampleHeights returns every sample-th block height from begin up to, but excluding, end.
+func sampleHeights(begin, end, sample int64) []int64 {
+	var heights []int64
+	for h := begin; h < end; h += sample {
+		heights = append(heights, h)
+	}
+	return heights
+}
+
+// overrideRPCAddr returns a copy of the single chain config in chainConfigs using rpcAddr as its RPC address,
+// chainConfigs is returned unchanged if rpcAddr is empty.
+func overrideRPCAddr(chainConfigs ChainConfigs, rpcAddr string) (ChainConfigs, error) {
+	if rpcAddr == "" {
+		return chainConfigs, nil
+	}
+	if len(chainConfigs) != 1 {
+		return nil, fmt.Errorf("--%s can only be used when indexing a single chain, %d chains were selected", flagRPC, len(chainConfigs))
+	}
+	if err := validateRPCAddr(rpcAddr); err != nil {
+		return nil, err
+	}
+	chainConfig := *chainConfigs[0]
+	chainConfig.RPCAddr = rpcAddr
+	return ChainConfigs{&chainConfig}, nil
+}
+
+// validateRPCAddr returns an error if addr isn't an absolute http(s) or tcp URL.
+func validateRPCAddr(addr string) error {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return fmt.Errorf("invalid rpc address %q: %w", addr, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "tcp":
+	default:
+		return fmt.Errorf("invalid rpc address %q, the scheme must be one of http, https or tcp", addr)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid rpc address %q, missing host", addr)
+	}
+	return nil
+}
+
+// newChainClient creates a chain client for the specified chain config, registering the module basics used to decode txs.
+func newChainClient(cmd *cobra.Command, a *appState, chainConfig *lens.ChainClientConfig) (*lens.ChainClient, error) {
+	chainConfig.Modules = append([]module.AppModuleBasic{}, lens.ModuleBasics...)
+	// Vesting accounts aren't part of the lens module basics, they're needed to decode the msgs creating them
+	chainConfig.Modules = append(chainConfig.Modules, authvesting.AppModuleBasic{})
+	return lens.NewChainClient(
+		a.Log.With(zap.String("chain", chainConfig.ChainID)),
+		chainConfig,
+		os.Getenv("HOME"),
+		cmd.InOrStdin(),
+		cmd.OutOrStdout(),
+	)
+}
+
+// gormLogLevel returns the logger.LogLevel gorm should use for the specified --gorm-log-level value,
+// or an error if the value isn't one of silent, error, warn or info.
+func gormLogLevel(logLevel string) (logger.LogLevel, error) {
+	switch logLevel {
+	case "warn":
+		return logger.Warn, nil
+	case "info":
+		return logger.Info, nil
+	case "error":
+		return logger.Error, nil
+	case "silent":
+		return logger.Silent, nil
 	default:
-		return logger.Silent
+		return logger.Silent, fmt.Errorf("invalid --%s %q, valid values are silent, error, warn and info", flagGormLogLevel, logLevel)
 	}
 }
@@ -0,0 +1,500 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	transfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/indexer/actions/ibc"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestParseEndBlock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    endBlockSpec
+		wantErr bool
+	}{
+		{value: "", want: endBlockSpec{relative: true}},
+		{value: "0", want: endBlockSpec{relative: true}},
+		{value: "head", want: endBlockSpec{relative: true}},
+		{value: " head ", want: endBlockSpec{relative: true}},
+		{value: "head-0", want: endBlockSpec{relative: true}},
+		{value: "head-10", want: endBlockSpec{height: 10, relative: true}},
+		{value: "1234", want: endBlockSpec{height: 1234}},
+		{value: "head-", wantErr: true},
+		{value: "head--1", wantErr: true},
+		{value: "head-abc", wantErr: true},
+		{value: "head+10", wantErr: true},
+		{value: "-5", wantErr: true},
+		{value: "12.5", wantErr: true},
+		{value: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseEndBlock(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseEndBlock(%q) = %+v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseEndBlock(%q) returned unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseEndBlock(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEndBlockSpecResolve(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         endBlockSpec
+		latestHeight int64
+		want         int64
+	}{
+		{name: "absolute", spec: endBlockSpec{height: 100}, latestHeight: 500, want: 100},
+		{name: "absolute above latest", spec: endBlockSpec{height: 900}, latestHeight: 500, want: 900},
+		{name: "head", spec: endBlockSpec{relative: true}, latestHeight: 500, want: 500},
+		{name: "head-N", spec: endBlockSpec{height: 10, relative: true}, latestHeight: 500, want: 490},
+		{name: "head-N equal to latest", spec: endBlockSpec{height: 500, relative: true}, latestHeight: 500, want: 0},
+		{name: "head-N above latest", spec: endBlockSpec{height: 600, relative: true}, latestHeight: 500, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.spec.resolve(tt.latestHeight); got != tt.want {
+			t.Errorf("%s: resolve(%d) = %d, want %d", tt.name, tt.latestHeight, got, tt.want)
+		}
+	}
+}
+
+func TestOverrideRPCAddr(t *testing.T) {
+	configured := &lens.ChainClientConfig{ChainID: "cosmoshub-4", RPCAddr: "https://rpc.cosmos.network:443", KeyringBackend: "test"}
+
+	for _, addr := range []string{"rpc.archive.internal:26657", "ftp://rpc.archive.internal", "http://", "http://[::1"} {
+		if _, err := overrideRPCAddr(ChainConfigs{configured}, addr); err == nil {
+			t.Errorf("overrideRPCAddr(%q) returned no error", addr)
+		}
+	}
+	if _, err := overrideRPCAddr(ChainConfigs{configured, configured}, "http://localhost:26657"); err == nil {
+		t.Error("overrideRPCAddr returned no error for multiple chains")
+	}
+	if got, err := overrideRPCAddr(ChainConfigs{configured}, ""); err != nil || got[0] != configured {
+		t.Errorf("overrideRPCAddr without an address = %v, %v, want the configured chain", got, err)
+	}
+
+	chainConfigs, err := overrideRPCAddr(ChainConfigs{configured}, "http://archive.internal:26657")
+	if err != nil {
+		t.Fatalf("overrideRPCAddr returned unexpected error: %v", err)
+	}
+	if configured.RPCAddr != "https://rpc.cosmos.network:443" {
+		t.Errorf("configured rpc address = %s, want it unchanged", configured.RPCAddr)
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	client, err := newChainClient(&cobra.Command{}, &appState{Log: zap.NewNop()}, chainConfigs[0])
+	if err != nil {
+		t.Fatalf("newChainClient returned unexpected error: %v", err)
+	}
+	if remote := client.RPCClient.(*rpchttp.HTTP).Remote(); remote != "http://archive.internal:26657" {
+		t.Errorf("client rpc address = %s, want the override", remote)
+	}
+}
+
+func TestSampleHeights(t *testing.T) {
+	tests := []struct {
+		begin, end, sample int64
+		want               []int64
+	}{
+		{begin: 1, end: 6, sample: 1, want: []int64{1, 2, 3, 4, 5}},
+		{begin: 100, end: 131, sample: 10, want: []int64{100, 110, 120, 130}},
+		{begin: 100, end: 130, sample: 10, want: []int64{100, 110, 120}},
+		{begin: 5, end: 7, sample: 100, want: []int64{5}},
+		{begin: 5, end: 5, sample: 2, want: nil},
+	}
+	for _, tt := range tests {
+		if got := sampleHeights(tt.begin, tt.end, tt.sample); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sampleHeights(%d, %d, %d) = %v, want %v", tt.begin, tt.end, tt.sample, got, tt.want)
+		}
+	}
+}
+
+func TestRunChainsMaxConcurrent(t *testing.T) {
+	indexers := make([]*indexer.Indexer, 5)
+	for j := range indexers {
+		indexers[j] = &indexer.Indexer{}
+	}
+
+	for _, tt := range []struct {
+		maxChains uint
+		want      int
+	}{
+		{maxChains: 0, want: 5},
+		{maxChains: 2, want: 2},
+		{maxChains: 1, want: 1},
+		{maxChains: 10, want: 5},
+	} {
+		var (
+			mu            sync.Mutex
+			running, peak int
+			ran           = make(map[*indexer.Indexer]bool)
+		)
+		err := runChains(context.Background(), indexers, tt.maxChains, func(ctx context.Context, i *indexer.Indexer) error {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			ran[i] = true
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("runChains returned unexpected error: %v", err)
+		}
+		if peak != tt.want {
+			t.Errorf("max chains %d: %d chains ran at once, want %d", tt.maxChains, peak, tt.want)
+		}
+		if len(ran) != len(indexers) {
+			t.Errorf("max chains %d: %d chains ran, want every chain", tt.maxChains, len(ran))
+		}
+	}
+}
+
+func TestRunChainsError(t *testing.T) {
+	indexers := []*indexer.Indexer{{}, {}, {}}
+	failed := errors.New("failed")
+
+	// The first chain fails while the others wait for a slot, they must not be started once it failed
+	var started int
+	err := runChains(context.Background(), indexers, 1, func(ctx context.Context, i *indexer.Indexer) error {
+		started++
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("runChains returned %v, want %v", err, failed)
+	}
+	if started != 1 {
+		t.Errorf("%d chains started, want only the first one that failed", started)
+	}
+}
+
+func TestMigrateSchemas(t *testing.T) {
+	a := &appState{Log: zap.NewNop(), Viper: viper.New(), Config: &Config{}}
+	action, err := a.Config.GetBlockActionByName(a.Log, "ics20_transfers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, skip := range []bool{false, true} {
+		db, _ := dbtest.New(t)
+		createTable := regexp.MustCompile(`^CREATE TABLE "(\w+)"`)
+		tables := make(map[string]bool)
+		err := db.Callback().Raw().After("gorm:raw").Register("test:created_tables", func(db *gorm.DB) {
+			if m := createTable.FindStringSubmatch(db.Statement.SQL.String()); m != nil {
+				tables[m[1]] = true
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := skipMigrateFlag(a.Viper, &cobra.Command{})
+		if skip {
+			if err := cmd.Flags().Set(flagSkipMigrate, "true"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := migrateSchemas(cmd, a, indexer.NewMigrationIndexer(a.Log, db), []indexer.BlockAction{action}); err != nil {
+			t.Fatalf("migrateSchemas returned unexpected error: %v", err)
+		}
+
+		if skip {
+			if len(tables) != 0 {
+				t.Errorf("created tables %v with --%s", tables, flagSkipMigrate)
+			}
+			continue
+		}
+		for _, table := range []string{"failed_blocks", "txes", "msg_transfers", "msg_recv_packets", "msg_acknowledgements", "msg_timeouts"} {
+			if !tables[table] {
+				t.Errorf("table %s wasn't created, created %v", table, tables)
+			}
+		}
+	}
+}
+
+func TestGormLogLevel(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected logger.LogLevel
+		wantErr  bool
+	}{
+		{value: "silent", expected: logger.Silent},
+		{value: "error", expected: logger.Error},
+		{value: "warn", expected: logger.Warn},
+		{value: "info", expected: logger.Info},
+		{value: "", wantErr: true},
+		{value: "debug", wantErr: true},
+		{value: "INFO", wantErr: true},
+	}
+	for _, tt := range tests {
+		level, err := gormLogLevel(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("gormLogLevel(%q) returned error %v, want error %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && level != tt.expected {
+			t.Errorf("gormLogLevel(%q) = %v, expected %v", tt.value, level, tt.expected)
+		}
+	}
+}
+
+// heightsAction records the heights of the blocks it's executed for.
+type heightsAction struct {
+	mu      sync.Mutex
+	heights []int64
+}
+
+func (a *heightsAction) Name() string { return "heights" }
+
+func (a *heightsAction) MigrateSchema(i *indexer.Indexer) error { return nil }
+
+func (a *heightsAction) Execute(ctx context.Context, i *indexer.Indexer, block *coretypes.ResultBlock) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.heights = append(a.heights, block.Block.Height)
+	return nil
+}
+
+func (a *heightsAction) executed() []int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]int64(nil), a.heights...)
+}
+
+func TestFollowBlocks(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	for h := int64(1); h <= 4; h++ {
+		node.AddBlock(h, time.Now(), nil, nil)
+	}
+	db, _ := dbtest.New(t)
+	client := &lens.ChainClient{Config: &lens.ChainClientConfig{ChainID: "cosmoshub-4"}, RPCClient: node}
+	i := indexer.NewIndexer(zap.NewNop(), client, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	action := &heightsAction{}
+	done := make(chan error, 1)
+	go func() {
+		done <- followBlocks(ctx, zap.NewNop(), i, 3, endBlockSpec{relative: true}, 1, 5*time.Millisecond, 0, []indexer.BlockAction{action}, 1)
+	}()
+
+	// New blocks are indexed once they're produced, up to the end block relative to the latest height
+	waitFor := func(heights []int64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !reflect.DeepEqual(action.executed(), heights) {
+			if time.Now().After(deadline) {
+				t.Fatalf("executed heights = %v, want %v", action.executed(), heights)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor([]int64{3})
+	node.AddBlock(5, time.Now(), nil, nil)
+	node.AddBlock(6, time.Now(), nil, nil)
+	waitFor([]int64{3, 4, 5})
+
+	// Heights already indexed aren't handed to ForEachBlock again
+	time.Sleep(20 * time.Millisecond)
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{3, 4, 5}) {
+		t.Errorf("executed heights = %v, want each height once", got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("followBlocks returned %v once cancelled, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("followBlocks didn't return once cancelled")
+	}
+}
+
+// gapAction records the heights of the blocks it's executed for, failing the block at failHeight while fail is set.
+type gapAction struct {
+	heightsAction
+	failHeight int64
+	fail       int32
+}
+
+func (a *gapAction) Execute(ctx context.Context, i *indexer.Indexer, block *coretypes.ResultBlock) error {
+	if block.Block.Height == a.failHeight && atomic.LoadInt32(&a.fail) == 1 {
+		return errors.New("failed")
+	}
+	return a.heightsAction.Execute(ctx, i, block)
+}
+
+func TestFollowBlocksSweepGaps(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	for h := int64(1); h <= 6; h++ {
+		node.AddBlock(h, time.Now(), nil, nil)
+	}
+	db, _ := dbtest.New(t)
+	client := &lens.ChainClient{Config: &lens.ChainClientConfig{ChainID: "cosmoshub-4"}, RPCClient: node}
+	i := indexer.NewIndexer(zap.NewNop(), client, db)
+	i.GenesisHeights = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	action := &gapAction{failHeight: 4, fail: 1}
+	done := make(chan error, 1)
+	go func() {
+		done <- followBlocks(ctx, zap.NewNop(), i, 3, endBlockSpec{relative: true}, 1, 5*time.Millisecond, 50*time.Millisecond, []indexer.BlockAction{action}, 1)
+	}()
+
+	waitFor := func(heights []int64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !reflect.DeepEqual(action.executed(), heights) {
+			if time.Now().After(deadline) {
+				t.Fatalf("executed heights = %v, want %v", action.executed(), heights)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// The failed block leaves a gap in the followed blocks, following carries on past it
+	waitFor([]int64{3, 5})
+
+	// Once the block can be indexed the next sweep fills the gap, without indexing the other blocks again
+	atomic.StoreInt32(&action.fail, 0)
+	waitFor([]int64{3, 5, 4})
+	time.Sleep(150 * time.Millisecond)
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{3, 5, 4}) {
+		t.Errorf("executed heights = %v, want the gap indexed once", got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("followBlocks returned %v once cancelled, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("followBlocks didn't return once cancelled")
+	}
+}
+
+func TestStartBlockActionsReindex(t *testing.T) {
+	a := &appState{Log: zap.NewNop(), Viper: viper.New(), Config: &Config{Actions: []string{"ics20_transfers"}}}
+	node := rpctest.New("cosmoshub-4")
+	db, rec := dbtest.New(t)
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: "cosmoshub-4", AccountPrefix: "cosmos"},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(lens.ModuleBasics),
+	}
+	i := indexer.NewIndexer(zap.NewNop(), client, db)
+
+	sender := sdk.AccAddress("sender").String()
+	builder := client.Codec.TxConfig.NewTxBuilder()
+	msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uatom", 5), sender, "osmo1receiver", clienttypes.NewHeight(1, 2000), 0)
+	if err := builder.SetMsgs(msg); err != nil {
+		t.Fatal(err)
+	}
+	bz, err := client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.AddBlock(10, time.Now(), [][]byte{bz}, []*abcitypes.ResponseDeliverTx{{Log: "[]"}})
+
+	index := func(actionName string) {
+		t.Helper()
+		actions, err := startBlockActions(a, actionName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := i.ForEachBlock(context.Background(), []int64{10}, actions, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts := func() map[string]int {
+		counts := make(map[string]int)
+		for _, row := range rec.All() {
+			counts[row.Table]++
+		}
+		return counts
+	}
+
+	index("")
+	base := counts()
+	if base["txes"] != 1 || base["msg_transfers"] != 1 || base["transfer_volume_daily"] != 1 || base["msg_signers"] != 0 {
+		t.Fatalf("got row counts %v after indexing with the configured actions", base)
+	}
+
+	// Re-indexing the range with the same actions leaves the rows as they were, the transfer isn't rolled up twice
+	// and none of the rows fails to be written as a duplicate
+	var failedWrites int32
+	if err := db.Callback().Create().After("gorm:create").Register("test:failed_writes", func(tx *gorm.DB) {
+		if tx.Error != nil {
+			atomic.AddInt32(&failedWrites, 1)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	index("")
+	if n := atomic.LoadInt32(&failedWrites); n != 0 {
+		t.Errorf("got %d failed writes while re-indexing, want none", n)
+	}
+	if got := counts(); !reflect.DeepEqual(got, base) {
+		t.Errorf("got row counts %v after re-indexing, expected %v", got, base)
+	}
+	for _, row := range rec.Rows("transfer_volume_daily") {
+		if v := row.(*ibc.TransferVolumeDaily); v.Count != 1 || v.TotalAmount != "5" {
+			t.Errorf("got daily transfer volume %+v after re-indexing, expected the single transfer of 5uatom", v)
+		}
+	}
+
+	// Re-indexing the range for a newly added action only adds the rows of that action
+	a.Config.Actions = append(a.Config.Actions, "msg_signers")
+	index("msg_signers")
+	got := counts()
+	for _, table := range []string{"txes", "msg_transfers", "transfer_volume_daily"} {
+		if count := base[table]; got[table] != count {
+			t.Errorf("got %d rows in %s after re-indexing, expected %d", got[table], table, count)
+		}
+	}
+	if got["msg_signers"] != 1 {
+		t.Errorf("got %d msg_signers rows, expected 1", got["msg_signers"])
+	}
+
+	if _, err := startBlockActions(a, "unknown"); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/strangelove-ventures/valis/indexer"
+)
+
+const nopRowTransformerName = "nop"
+
+// GetRowTransformerByName returns an indexer.RowTransformer if there is a transformer matching the specified name.
+//
+// NOTE: New indexer.RowTransformer's should be registered here in a case that returns a new transformer
+// if the name parameter matches the name used in the transformers section of the config.
+func (c *Config) GetRowTransformerByName(name string) (indexer.RowTransformer, error) {
+	switch name {
+	case nopRowTransformerName:
+		return indexer.NopRowTransformer{}, nil
+	default:
+		return nil, fmt.Errorf("there is no row transformer configured with the name %s", name)
+	}
+}
+
+// RowTransformer returns the chain of configured row transformers, in the order they are listed in the config.
+func (c *Config) RowTransformer() (indexer.RowTransformer, error) {
+	var transformers indexer.RowTransformers
+	for _, name := range c.Transformers {
+		t, err := c.GetRowTransformerByName(name)
+		if err != nil {
+			return nil, err
+		}
+		transformers = append(transformers, t)
+	}
+	return transformers, nil
+}
@@ -0,0 +1,219 @@
+package bank
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "bank_transfers"
+
+// BankTransfersAction implements the indexer.BlockAction interface, it indexes the tokens sent with the bank module.
+type BankTransfersAction struct {
+	actionName string
+	log        *zap.Logger
+	feeShares  bool
+}
+
+// NewBankTransfersAction returns a new BankTransfersAction block action to be used by the indexer. If feeShares is
+// true the fee of each tx is attributed across the outputs of its MsgMultiSends, see SetFeeShares.
+func NewBankTransfersAction(log *zap.Logger, feeShares bool) *BankTransfersAction {
+	return &BankTransfersAction{
+		actionName: BlockActionName,
+		log:        log,
+		feeShares:  feeShares,
+	}
+}
+
+// Name returns the block action name for identifying this action.
+func (a *BankTransfersAction) Name() string {
+	return a.actionName
+}
+
+// SchemaVersion implements indexer.SchemaVersioner, version 2 added the fee share columns.
+func (a *BankTransfersAction) SchemaVersion() int {
+	return 2
+}
+
+// MigrateSchema runs schema migrations for the specified models.
+func (a *BankTransfersAction) MigrateSchema(indexer *indexer.Indexer) error {
+	return indexer.DB.AutoMigrate(&BankTransfer{})
+}
+
+// MsgTypes returns the type URLs of the msgs handled by this action, txs without any of them are skipped.
+func (a *BankTransfersAction) MsgTypes() []string {
+	return []string{
+		sdk.MsgTypeURL(&banktypes.MsgSend{}),
+		sdk.MsgTypeURL(&banktypes.MsgMultiSend{}),
+	}
+}
+
+// Execute indexes the bank transfers of the successful txs of the specified block.
+func (a *BankTransfersAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	return indexer.ForEachSuccessfulTx(ctx, a.log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx, logs sdk.ABCIMessageLogs) error {
+		var transfers, outputs []*BankTransfer
+		for msgIndex, msg := range sdkTx.GetMsgs() {
+			var (
+				msgTransfers []*BankTransfer
+				err          error
+			)
+			switch m := msg.(type) {
+			case *banktypes.MsgSend:
+				msgTransfers, err = NewSendTransfers(indexer.Client.Config.ChainID, m, msgIndex, block.Block.Height, tx.Hash())
+			case *banktypes.MsgMultiSend:
+				msgTransfers, err = NewMultiSendTransfers(indexer.Client.Config.ChainID, m, msgIndex, block.Block.Height, tx.Hash())
+				if err == nil {
+					outputs = append(outputs, multiSendOutputs(msgTransfers)...)
+				}
+			default:
+				continue
+			}
+			if err != nil {
+				a.log.Warn(
+					"Failed to build BankTransfer",
+					zap.Int64("height", block.Block.Height),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+				continue
+			}
+			transfers = append(transfers, msgTransfers...)
+		}
+
+		// The fee is paid once for the whole tx, so it's split across the outputs of every MsgMultiSend of the tx
+		if a.feeShares && len(outputs) > 0 {
+			if feeTx, ok := sdkTx.(sdk.FeeTx); ok && len(feeTx.GetFee()) > 0 {
+				if err := SetFeeShares(outputs, feeTx.GetFee()[0]); err != nil {
+					a.log.Warn(
+						"Failed to attribute fee across MsgMultiSend outputs",
+						zap.Int64("height", block.Block.Height),
+						zap.Int("tx_index", index+1),
+						zap.Error(err),
+					)
+				}
+			}
+		}
+
+		for _, transfer := range transfers {
+			transfer := transfer
+			indexer.Write(a.Name(), transfer, func(err error) {
+				if err != nil {
+					a.log.Warn(
+						"Failed to insert BankTransfer into DB",
+						zap.Int64("height", transfer.Height),
+						zap.Int("msg_index", transfer.MsgIndex),
+						zap.Int("sub_index", transfer.SubIndex),
+						zap.Error(err),
+					)
+				}
+			})
+		}
+		return nil
+	})
+}
+
+// NewSendTransfers returns a BankTransfer for each denom sent by msg.
+func NewSendTransfers(chainID string, msg *banktypes.MsgSend, msgIndex int, height int64, hash []byte) ([]*BankTransfer, error) {
+	sender, recipient := msg.FromAddress, msg.ToAddress
+	return newTransfers(chainID, msgIndex, 0, &sender, &recipient, msg.Amount, height, hash)
+}
+
+// NewMultiSendTransfers returns the BankTransfers of msg, see BankTransfer for how the inputs and outputs are stored.
+func NewMultiSendTransfers(chainID string, msg *banktypes.MsgMultiSend, msgIndex int, height int64, hash []byte) ([]*BankTransfer, error) {
+	var transfers []*BankTransfer
+
+	// With a single input every output is a transfer from its address
+	if len(msg.Inputs) == 1 {
+		sender := msg.Inputs[0].Address
+		for subIndex, output := range msg.Outputs {
+			recipient := output.Address
+			outputTransfers, err := newTransfers(chainID, msgIndex, subIndex, &sender, &recipient, output.Coins, height, hash)
+			if err != nil {
+				return nil, err
+			}
+			transfers = append(transfers, outputTransfers...)
+		}
+		return transfers, nil
+	}
+
+	for subIndex, input := range msg.Inputs {
+		sender := input.Address
+		inputTransfers, err := newTransfers(chainID, msgIndex, subIndex, &sender, nil, input.Coins, height, hash)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, inputTransfers...)
+	}
+	for j, output := range msg.Outputs {
+		recipient := output.Address
+		outputTransfers, err := newTransfers(chainID, msgIndex, len(msg.Inputs)+j, nil, &recipient, output.Coins, height, hash)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, outputTransfers...)
+	}
+	return transfers, nil
+}
+
+// multiSendOutputs returns the output rows of the BankTransfers of a MsgMultiSend, the rows with a Recipient.
+func multiSendOutputs(transfers []*BankTransfer) []*BankTransfer {
+	var outputs []*BankTransfer
+	for _, transfer := range transfers {
+		if transfer.Recipient != nil {
+			outputs = append(outputs, transfer)
+		}
+	}
+	return outputs
+}
+
+// SetFeeShares attributes fee across the specified transfers, each weighted by its amount. The shares are rounded
+// down and the units left over are handed out to the largest remainders, so they always sum to the fee amount, see
+// indexer.ProportionalShares. Only a single fee coin is attributed, for txs paying their fee in several denoms it's
+// the first one. Amounts of different denoms are weighted alike, since there is no price to convert them with.
+func SetFeeShares(transfers []*BankTransfer, fee sdk.Coin) error {
+	weights := make([]sdk.Int, len(transfers))
+	for j, transfer := range transfers {
+		amount, ok := sdk.NewIntFromString(transfer.Amount)
+		if !ok {
+			return fmt.Errorf("invalid %s amount %q", transfer.Denom, transfer.Amount)
+		}
+		weights[j] = amount
+	}
+
+	for j, share := range indexer.ProportionalShares(fee.Amount, weights) {
+		feeShare, feeDenom := share.String(), fee.Denom
+		transfers[j].FeeShare = &feeShare
+		transfers[j].FeeDenom = &feeDenom
+	}
+	return nil
+}
+
+// newTransfers returns a BankTransfer for each of the coins.
+func newTransfers(chainID string, msgIndex, subIndex int, sender, recipient *string, coins sdk.Coins, height int64, hash []byte) ([]*BankTransfer, error) {
+	transfers := make([]*BankTransfer, 0, len(coins))
+	for _, coin := range coins {
+		transfer := &BankTransfer{
+			ChainID:   chainID,
+			MsgIndex:  msgIndex,
+			SubIndex:  subIndex,
+			Denom:     coin.Denom,
+			Amount:    coin.Amount.String(),
+			Sender:    sender,
+			Recipient: recipient,
+			Height:    height,
+		}
+		if err := transfer.TxHash.Set(hash); err != nil {
+			return nil, fmt.Errorf("failed to set tx hash: %w", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,28 @@
+package bank
+
+import (
+	"github.com/jackc/pgtype"
+)
+
+// BankTransfer is a coin moved by a MsgSend or a MsgMultiSend, with a row per denom. SubIndex tells apart the
+// rows of a single msg: it's always 0 for a MsgSend, for a MsgMultiSend it's the index of the input or output.
+//
+// A MsgMultiSend with a single input has a row per output carrying both the sender and the recipient. With several
+// inputs the coins can't be paired between senders and recipients, so the inputs come first as rows without a
+// Recipient, followed by the outputs as rows without a Sender.
+//
+// FeeShare is the part of the tx fee, in FeeDenom, attributed to an output row of a MsgMultiSend when fee shares are
+// enabled, see SetFeeShares. It's null for every other row.
+type BankTransfer struct {
+	ChainID   string       `gorm:"primaryKey"`
+	TxHash    pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex  int          `gorm:"primaryKey;autoIncrement:false"`
+	SubIndex  int          `gorm:"primaryKey;autoIncrement:false"`
+	Denom     string       `gorm:"primaryKey"`
+	Amount    string       `gorm:"not null"`
+	Sender    *string      `gorm:"index"`
+	Recipient *string      `gorm:"index"`
+	FeeShare  *string
+	FeeDenom  *string
+	Height    int64 `gorm:"not null"`
+}
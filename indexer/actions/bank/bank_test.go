@@ -0,0 +1,235 @@
+package bank
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+func TestNewMultiSendTransfers(t *testing.T) {
+	coins := func(amounts ...int64) sdk.Coins {
+		var c sdk.Coins
+		for j, amount := range amounts {
+			c = c.Add(sdk.NewInt64Coin([]string{"uatom", "ujuno"}[j], amount))
+		}
+		return c
+	}
+
+	// row is the expected sub index, denom, amount, sender and recipient of a BankTransfer, "" for a nil address
+	type row struct {
+		subIndex          int
+		denom, amount     string
+		sender, recipient string
+	}
+	tests := []struct {
+		name        string
+		msg         *banktypes.MsgMultiSend
+		want        []row
+		wantOutputs int
+	}{
+		{
+			name: "single input",
+			msg: &banktypes.MsgMultiSend{
+				Inputs:  []banktypes.Input{{Address: "alice", Coins: coins(30, 5)}},
+				Outputs: []banktypes.Output{{Address: "bob", Coins: coins(10)}, {Address: "carol", Coins: coins(20, 5)}},
+			},
+			want: []row{
+				{0, "uatom", "10", "alice", "bob"},
+				{1, "uatom", "20", "alice", "carol"},
+				{1, "ujuno", "5", "alice", "carol"},
+			},
+			wantOutputs: 3,
+		},
+		{
+			name: "several inputs",
+			msg: &banktypes.MsgMultiSend{
+				Inputs:  []banktypes.Input{{Address: "alice", Coins: coins(10)}, {Address: "bob", Coins: coins(20)}},
+				Outputs: []banktypes.Output{{Address: "carol", Coins: coins(30)}},
+			},
+			want: []row{
+				{0, "uatom", "10", "alice", ""},
+				{1, "uatom", "20", "bob", ""},
+				{2, "uatom", "30", "", "carol"},
+			},
+			wantOutputs: 1,
+		},
+	}
+	for _, tt := range tests {
+		transfers, err := NewMultiSendTransfers("cosmoshub-4", tt.msg, 2, 100, []byte{0x01})
+		if err != nil {
+			t.Errorf("%s: NewMultiSendTransfers returned unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(transfers) != len(tt.want) {
+			t.Errorf("%s: got %d transfers, want %d", tt.name, len(transfers), len(tt.want))
+			continue
+		}
+
+		deref := func(s *string) string {
+			if s == nil {
+				return ""
+			}
+			return *s
+		}
+		for j, transfer := range transfers {
+			got := row{transfer.SubIndex, transfer.Denom, transfer.Amount, deref(transfer.Sender), deref(transfer.Recipient)}
+			if got != tt.want[j] {
+				t.Errorf("%s: transfer %d = %+v, want %+v", tt.name, j, got, tt.want[j])
+			}
+			if transfer.ChainID != "cosmoshub-4" || transfer.MsgIndex != 2 || transfer.Height != 100 {
+				t.Errorf("%s: transfer %d has chain id %s, msg index %d and height %d", tt.name, j, transfer.ChainID, transfer.MsgIndex, transfer.Height)
+			}
+		}
+		if outputs := multiSendOutputs(transfers); len(outputs) != tt.wantOutputs {
+			t.Errorf("%s: got %d outputs, want %d", tt.name, len(outputs), tt.wantOutputs)
+		}
+	}
+}
+
+func TestNewSendTransfers(t *testing.T) {
+	msg := &banktypes.MsgSend{
+		FromAddress: "alice",
+		ToAddress:   "bob",
+		Amount:      sdk.NewCoins(sdk.NewInt64Coin("uatom", 10), sdk.NewInt64Coin("ujuno", 7)),
+	}
+	transfers, err := NewSendTransfers("cosmoshub-4", msg, 0, 100, []byte{0x01})
+	if err != nil {
+		t.Fatalf("NewSendTransfers returned unexpected error: %v", err)
+	}
+	if len(transfers) != 2 {
+		t.Fatalf("got %d transfers, want a row per denom", len(transfers))
+	}
+	for j, denom := range []string{"uatom", "ujuno"} {
+		transfer := transfers[j]
+		if transfer.Denom != denom || transfer.SubIndex != 0 || *transfer.Sender != "alice" || *transfer.Recipient != "bob" || transfer.FeeShare != nil {
+			t.Errorf("transfer %d = %+v, want a %s transfer from alice to bob", j, transfer, denom)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: node.ChainID(), AccountPrefix: "cosmos"},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(lens.ModuleBasics),
+	}
+	db, rec := dbtest.New(t)
+	i := indexer.NewIndexer(zap.NewNop(), client, db)
+
+	encode := func(msgs ...sdk.Msg) []byte {
+		builder := client.Codec.TxConfig.NewTxBuilder()
+		if err := builder.SetMsgs(msgs...); err != nil {
+			t.Fatal(err)
+		}
+		builder.SetFeeAmount(sdk.NewCoins(sdk.NewInt64Coin("uatom", 30)))
+		bz, err := client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bz
+	}
+	alice, bob, carol := sdk.AccAddress("alice"), sdk.AccAddress("bob"), sdk.AccAddress("carol")
+	send := banktypes.NewMsgSend(alice, bob, sdk.NewCoins(sdk.NewInt64Coin("uatom", 5)))
+	multiSend := &banktypes.MsgMultiSend{
+		Inputs:  []banktypes.Input{banktypes.NewInput(bob, sdk.NewCoins(sdk.NewInt64Coin("uatom", 3)))},
+		Outputs: []banktypes.Output{banktypes.NewOutput(alice, sdk.NewCoins(sdk.NewInt64Coin("uatom", 1))), banktypes.NewOutput(carol, sdk.NewCoins(sdk.NewInt64Coin("uatom", 2)))},
+	}
+	// The second tx failed, so its send didn't move any tokens
+	txs := [][]byte{encode(send, multiSend), encode(send)}
+	node.AddBlock(10, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{Code: 0}, {Code: 5}})
+
+	actions := []indexer.BlockAction{NewBankTransfersAction(zap.NewNop(), true)}
+	if err := i.ForEachBlock(context.Background(), []int64{10}, actions, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	type transfer struct {
+		msgIndex, subIndex int
+		amount             string
+		sender, recipient  string
+		feeShare           string
+	}
+	var got []transfer
+	for _, row := range rec.Rows("bank_transfers") {
+		r := row.(*BankTransfer)
+		if string(r.TxHash.Bytes) != string(tmtypes.Tx(txs[0]).Hash()) || r.Height != 10 || r.Denom != "uatom" {
+			t.Errorf("row = %+v, want a uatom transfer of the first tx at height 10", r)
+		}
+		var feeShare string
+		if r.FeeShare != nil {
+			feeShare = *r.FeeShare + *r.FeeDenom
+		}
+		got = append(got, transfer{r.MsgIndex, r.SubIndex, r.Amount, *r.Sender, *r.Recipient, feeShare})
+	}
+	want := []transfer{
+		// Only the outputs of the MsgMultiSend carry a share of the fee
+		{0, 0, "5", alice.String(), bob.String(), ""},
+		{1, 0, "1", bob.String(), alice.String(), "10uatom"},
+		{1, 1, "2", bob.String(), carol.String(), "20uatom"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transfers = %+v, want %+v", got, want)
+	}
+}
+
+func TestSetFeeShares(t *testing.T) {
+	tests := []struct {
+		name    string
+		amounts []string
+		fee     sdk.Coin
+		want    []string
+		wantErr bool
+	}{
+		{name: "proportional", amounts: []string{"100", "300"}, fee: sdk.NewInt64Coin("ujuno", 5000), want: []string{"1250", "3750"}},
+		{name: "rounded", amounts: []string{"1", "1", "1"}, fee: sdk.NewInt64Coin("ujuno", 100), want: []string{"34", "33", "33"}},
+		{name: "zero amounts", amounts: []string{"0", "0"}, fee: sdk.NewInt64Coin("ujuno", 10), want: []string{"10", "0"}},
+		{name: "invalid amount", amounts: []string{"100", "1.5"}, fee: sdk.NewInt64Coin("ujuno", 10), wantErr: true},
+	}
+	for _, tt := range tests {
+		transfers := make([]*BankTransfer, len(tt.amounts))
+		for j, amount := range tt.amounts {
+			transfers[j] = &BankTransfer{Denom: "uatom", Amount: amount}
+		}
+
+		err := SetFeeShares(transfers, tt.fee)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: SetFeeShares returned no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: SetFeeShares returned unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		sum := sdk.ZeroInt()
+		for j, transfer := range transfers {
+			if transfer.FeeShare == nil || transfer.FeeDenom == nil {
+				t.Errorf("%s: transfer %d has no fee share", tt.name, j)
+				continue
+			}
+			if *transfer.FeeShare != tt.want[j] || *transfer.FeeDenom != tt.fee.Denom {
+				t.Errorf("%s: transfer %d fee share = %s%s, want %s%s", tt.name, j, *transfer.FeeShare, *transfer.FeeDenom, tt.want[j], tt.fee.Denom)
+				continue
+			}
+			share, _ := sdk.NewIntFromString(*transfer.FeeShare)
+			sum = sum.Add(share)
+		}
+		if !sum.Equal(tt.fee.Amount) {
+			t.Errorf("%s: fee shares sum to %s, want %s", tt.name, sum, tt.fee.Amount)
+		}
+	}
+}
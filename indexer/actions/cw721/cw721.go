@@ -0,0 +1,216 @@
+package cw721
+
+import (
+	"context"
+
+	cosmwasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/jackc/pgtype"
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "cw721"
+
+// The actions emitted by cw721-base compatible contracts that change the owner of a token.
+const (
+	actionMint        = "mint"
+	actionTransferNFT = "transfer_nft"
+	actionSendNFT     = "send_nft"
+	actionBurn        = "burn"
+)
+
+// CW721Action implements the indexer.BlockAction interface, it describes the appropriate actions to take in order
+// to parse CW721 (NFT) mints and transfers from the wasm events on-chain and index them into a database instance.
+type CW721Action struct {
+	actionName string
+	log        *zap.Logger
+}
+
+// NewCW721Action returns a new CW721Action block action to be used by the indexer.
+func NewCW721Action(log *zap.Logger) *CW721Action {
+	return &CW721Action{
+		actionName: BlockActionName,
+		log:        log,
+	}
+}
+
+// Name returns the block action name for identifying this action.
+func (a *CW721Action) Name() string {
+	return a.actionName
+}
+
+// SchemaVersion implements indexer.SchemaVersioner, version 2 added the burned column of the ownership tombstones.
+func (a *CW721Action) SchemaVersion() int {
+	return 2
+}
+
+// MigrateSchema runs schema migrations for the specified models.
+func (a *CW721Action) MigrateSchema(indexer *indexer.Indexer) error {
+	return indexer.DB.AutoMigrate(
+		&CW721Transfer{},
+		&CW721Ownership{},
+	)
+}
+
+// MsgTypes returns the type URLs of the msgs handled by this action, txs without any of them are skipped.
+func (a *CW721Action) MsgTypes() []string {
+	return []string{
+		sdk.MsgTypeURL(&cosmwasmtypes.MsgExecuteContract{}),
+	}
+}
+
+// Execute calls the appropriate functions needed for properly parsing CW721 token transfers.
+func (a *CW721Action) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	return a.IndexCW721Transfers(ctx, indexer, block)
+}
+
+// IndexCW721Transfers parses the wasm events of the txs in the specified block and indexes
+// any CW721 mints, transfers and burns into a postgres database instance.
+func (a *CW721Action) IndexCW721Transfers(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	return indexer.ForEachSuccessfulTx(ctx, a.log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx, logs sdk.ABCIMessageLogs) error {
+		for _, log := range logs {
+			for eventIndex, transfer := range ParseTransfers(log) {
+				transfer.ChainID = indexer.Client.Config.ChainID
+				transfer.MsgIndex = int(log.MsgIndex)
+				transfer.EventIndex = eventIndex
+				transfer.Height = block.Block.Height
+				if err := transfer.TxHash.Set(tx.Hash()); err != nil {
+					a.log.Warn(
+						"Failed to set tx hash on CW721Transfer model",
+						zap.Int64("height", block.Block.Height),
+						zap.String("tx_hash", string(tx.Hash())),
+						zap.Int("msg_index", transfer.MsgIndex),
+						zap.Error(err),
+					)
+					continue
+				}
+				a.HandleTransfer(indexer, transfer)
+			}
+		}
+		return nil
+	})
+}
+
+// HandleTransfer writes the transfer and, once it's written, updates the current owner of the token.
+func (a *CW721Action) HandleTransfer(indexer *indexer.Indexer, transfer *CW721Transfer) {
+	indexer.Write(a.Name(), transfer, func(err error) {
+		if err != nil {
+			a.log.Warn(
+				"Failed to insert CW721Transfer into DB",
+				zap.Int64("height", transfer.Height),
+				zap.String("tx_hash", string(transfer.TxHash.Bytes)),
+				zap.Int("msg_index", transfer.MsgIndex),
+				zap.Error(err),
+			)
+			return
+		}
+
+		if err := a.UpdateOwnership(indexer, transfer); err != nil {
+			a.log.Warn(
+				"Failed to update CW721 ownership",
+				zap.Int64("height", transfer.Height),
+				zap.String("contract", transfer.Contract),
+				zap.String("token_id", transfer.TokenID),
+				zap.Error(err),
+			)
+		}
+	})
+}
+
+// UpdateOwnership applies the transfer to the current ownership of the token. Since blocks are processed
+// concurrently, ownership is only changed by transfers at or above the height it was last updated at. A burn leaves
+// a tombstone that only transfers above its height replace, e.g. a token minted again after it was burned, since the
+// txs of a block are processed concurrently too.
+func (a *CW721Action) UpdateOwnership(indexer *indexer.Indexer, transfer *CW721Transfer) error {
+	ownership := &CW721Ownership{
+		ChainID:           transfer.ChainID,
+		Contract:          transfer.Contract,
+		TokenID:           transfer.TokenID,
+		Owner:             transfer.To,
+		LastUpdatedHeight: transfer.Height,
+	}
+	if transfer.Action == actionBurn {
+		ownership.Owner = ""
+		ownership.Burned = true
+	}
+
+	return indexer.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "contract"}, {Name: "token_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"owner", "burned", "last_updated_height"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			gorm.Expr("cw721_ownership.last_updated_height <= excluded.last_updated_height"),
+			gorm.Expr("(cw721_ownership.burned = ? OR excluded.burned = ? OR "+
+				"cw721_ownership.last_updated_height < excluded.last_updated_height)", false, true),
+		}},
+	}).Create(ownership).Error
+}
+
+// ParseTransfers returns the CW721 mints, transfers and burns found in the wasm events of the specified msg log.
+// Attributes of merged wasm events are grouped by the contract address that precedes them, each group emitted
+// by a cw721-base compatible contract holds at most one action. Only the fields derived from the events are set.
+func ParseTransfers(log sdk.ABCIMessageLog) []*CW721Transfer {
+	var transfers []*CW721Transfer
+	for _, event := range log.Events {
+		if event.Type != cosmwasmtypes.WasmModuleEventType {
+			continue
+		}
+
+		var (
+			contract string
+			attrs    map[string]string
+		)
+		flush := func() {
+			if transfer := transferFromAttributes(contract, attrs); transfer != nil {
+				transfers = append(transfers, transfer)
+			}
+		}
+		for _, attr := range event.Attributes {
+			if attr.Key == cosmwasmtypes.AttributeKeyContractAddr {
+				flush()
+				contract = attr.Value
+				attrs = make(map[string]string)
+				continue
+			}
+			if attrs != nil {
+				attrs[attr.Key] = attr.Value
+			}
+		}
+		flush()
+	}
+	return transfers
+}
+
+// transferFromAttributes returns the CW721Transfer described by the attributes emitted by contract,
+// or nil if they don't describe a CW721 mint, transfer or burn.
+func transferFromAttributes(contract string, attrs map[string]string) *CW721Transfer {
+	tokenID := attrs["token_id"]
+	if contract == "" || tokenID == "" {
+		return nil
+	}
+
+	transfer := &CW721Transfer{
+		Contract: contract,
+		TokenID:  tokenID,
+		Action:   attrs["action"],
+		TxHash:   pgtype.Bytea{},
+	}
+	switch transfer.Action {
+	case actionMint:
+		transfer.To = attrs["owner"]
+	case actionTransferNFT, actionSendNFT:
+		transfer.From = attrs["sender"]
+		transfer.To = attrs["recipient"]
+	case actionBurn:
+		transfer.From = attrs["sender"]
+	default:
+		return nil
+	}
+	return transfer
+}
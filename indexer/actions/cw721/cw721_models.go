@@ -0,0 +1,44 @@
+package cw721
+
+import (
+	"github.com/jackc/pgtype"
+)
+
+// CW721Transfer represents a single mint, transfer_nft, send_nft or burn of a CW721 token.
+// EventIndex is the position of the transfer within the wasm events emitted by the msg,
+// a single msg may move many tokens (e.g. a contract batch transferring NFTs).
+// From is empty for mints and To is empty for burns.
+type CW721Transfer struct {
+	ChainID    string       `gorm:"primaryKey"`
+	TxHash     pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex   int          `gorm:"primaryKey;autoIncrement:false"`
+	EventIndex int          `gorm:"primaryKey;autoIncrement:false"`
+	Contract   string       `gorm:"not null;index:idx_cw721_transfers_token"`
+	TokenID    string       `gorm:"not null;index:idx_cw721_transfers_token"`
+	Action     string       `gorm:"not null"`
+	From       string       `gorm:"not null;default:''"`
+	To         string       `gorm:"not null;default:''"`
+	Height     int64        `gorm:"not null"`
+}
+
+// TableName pins the table name rather than relying on how gorm splits the digits of the cw prefix.
+func (CW721Transfer) TableName() string {
+	return "cw721_transfers"
+}
+
+// CW721Ownership is the current owner of each CW721 token, as of LastUpdatedHeight.
+// Burned tokens are kept as tombstones with Burned set and no Owner, so the transfers of the token processed after
+// its burn don't make it owned again.
+type CW721Ownership struct {
+	ChainID           string `gorm:"primaryKey"`
+	Contract          string `gorm:"primaryKey"`
+	TokenID           string `gorm:"primaryKey"`
+	Owner             string `gorm:"not null;index"`
+	Burned            bool   `gorm:"not null;default:false"`
+	LastUpdatedHeight int64  `gorm:"not null"`
+}
+
+// TableName pins the table name rather than relying on how gorm splits the digits of the cw prefix.
+func (CW721Ownership) TableName() string {
+	return "cw721_ownership"
+}
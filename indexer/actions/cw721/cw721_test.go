@@ -0,0 +1,150 @@
+package cw721
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"go.uber.org/zap"
+)
+
+// event returns an event of type with the specified attribute key value pairs.
+func event(typ string, attrs ...string) sdk.StringEvent {
+	event := sdk.StringEvent{Type: typ}
+	for j := 0; j < len(attrs); j += 2 {
+		event.Attributes = append(event.Attributes, sdk.Attribute{Key: attrs[j], Value: attrs[j+1]})
+	}
+	return event
+}
+
+func TestTransferFromAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		contract string
+		attrs    map[string]string
+		want     *CW721Transfer
+	}{
+		{
+			name:     "mint",
+			contract: "stars1nft",
+			attrs:    map[string]string{"action": "mint", "minter": "stars1minter", "owner": "stars1alice", "token_id": "1"},
+			want:     &CW721Transfer{Contract: "stars1nft", TokenID: "1", Action: "mint", To: "stars1alice"},
+		},
+		{
+			name:     "transfer_nft",
+			contract: "stars1nft",
+			attrs:    map[string]string{"action": "transfer_nft", "sender": "stars1alice", "recipient": "stars1bob", "token_id": "1"},
+			want:     &CW721Transfer{Contract: "stars1nft", TokenID: "1", Action: "transfer_nft", From: "stars1alice", To: "stars1bob"},
+		},
+		{
+			name:     "send_nft",
+			contract: "stars1nft",
+			attrs:    map[string]string{"action": "send_nft", "sender": "stars1bob", "recipient": "stars1market", "token_id": "1"},
+			want:     &CW721Transfer{Contract: "stars1nft", TokenID: "1", Action: "send_nft", From: "stars1bob", To: "stars1market"},
+		},
+		{
+			name:     "burn",
+			contract: "stars1nft",
+			attrs:    map[string]string{"action": "burn", "sender": "stars1bob", "token_id": "1"},
+			want:     &CW721Transfer{Contract: "stars1nft", TokenID: "1", Action: "burn", From: "stars1bob"},
+		},
+		{
+			name:     "approve",
+			contract: "stars1nft",
+			attrs:    map[string]string{"action": "approve", "sender": "stars1bob", "spender": "stars1market", "token_id": "1"},
+		},
+		{
+			name:     "cw20 transfer",
+			contract: "stars1token",
+			attrs:    map[string]string{"action": "transfer", "from": "stars1alice", "to": "stars1bob", "amount": "10"},
+		},
+		{
+			name:  "no contract",
+			attrs: map[string]string{"action": "mint", "owner": "stars1alice", "token_id": "1"},
+		},
+	}
+	for _, tt := range tests {
+		got := transferFromAttributes(tt.contract, tt.attrs)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: transferFromAttributes() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTransfers(t *testing.T) {
+	log := sdk.ABCIMessageLog{Events: sdk.StringEvents{
+		event("message", "action", "/cosmwasm.wasm.v1.MsgExecuteContract", "sender", "stars1alice"),
+		// A marketplace sale emitting its own action before the NFT contract transfers the token and mints a receipt
+		event("wasm",
+			"_contract_address", "stars1market", "action", "buy", "token_id", "7",
+			"_contract_address", "stars1nft", "action", "transfer_nft", "sender", "stars1market", "recipient", "stars1alice", "token_id", "7",
+			"_contract_address", "stars1receipts", "action", "mint", "minter", "stars1market", "owner", "stars1alice", "token_id", "r7",
+		),
+		event("wasm", "_contract_address", "stars1nft", "action", "burn", "sender", "stars1bob", "token_id", "8"),
+	}}
+
+	var got []CW721Transfer
+	for _, transfer := range ParseTransfers(log) {
+		got = append(got, *transfer)
+	}
+	want := []CW721Transfer{
+		{Contract: "stars1nft", TokenID: "7", Action: "transfer_nft", From: "stars1market", To: "stars1alice"},
+		{Contract: "stars1receipts", TokenID: "r7", Action: "mint", To: "stars1alice"},
+		{Contract: "stars1nft", TokenID: "8", Action: "burn", From: "stars1bob"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTransfers() = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleTransfer(t *testing.T) {
+	client := &lens.ChainClient{Config: &lens.ChainClientConfig{ChainID: "stargaze-1"}}
+	db, rec := dbtest.New(t)
+	i := indexer.NewIndexer(zap.NewNop(), client, db)
+	a := NewCW721Action(zap.NewNop())
+
+	// Blocks are processed concurrently, so the transfer at height 12 is handled before the one at height 11, and
+	// token 3 is burned before it's minted and transferred in the same block and the one before
+	transfers := []*CW721Transfer{
+		{Contract: "stars1nft", TokenID: "1", Action: "mint", To: "stars1alice", Height: 10},
+		{Contract: "stars1nft", TokenID: "2", Action: "mint", To: "stars1alice", Height: 10},
+		{Contract: "stars1nft", TokenID: "1", Action: "send_nft", From: "stars1bob", To: "stars1carol", Height: 12},
+		{Contract: "stars1nft", TokenID: "1", Action: "transfer_nft", From: "stars1alice", To: "stars1bob", Height: 11},
+		{Contract: "stars1nft", TokenID: "2", Action: "burn", From: "stars1alice", Height: 13},
+		{Contract: "stars1nft", TokenID: "3", Action: "burn", From: "stars1bob", Height: 15},
+		{Contract: "stars1nft", TokenID: "3", Action: "transfer_nft", From: "stars1alice", To: "stars1bob", Height: 15},
+		{Contract: "stars1nft", TokenID: "3", Action: "mint", To: "stars1alice", Height: 14},
+		// Token 2 is minted again after its burn
+		{Contract: "stars1nft", TokenID: "2", Action: "mint", To: "stars1dave", Height: 16},
+	}
+	for j, transfer := range transfers {
+		transfer.ChainID = "stargaze-1"
+		transfer.EventIndex = j
+		if err := transfer.TxHash.Set([]byte{byte(transfer.Height)}); err != nil {
+			t.Fatal(err)
+		}
+		a.HandleTransfer(i, transfer)
+	}
+
+	if rows := rec.Rows("cw721_transfers"); len(rows) != len(transfers) {
+		t.Errorf("got %d CW721Transfer rows, want %d", len(rows), len(transfers))
+	}
+
+	var got []CW721Ownership
+	for _, row := range rec.Rows("cw721_ownership") {
+		got = append(got, *row.(*CW721Ownership))
+	}
+	sort.Slice(got, func(x, y int) bool { return got[x].TokenID < got[y].TokenID })
+	want := []CW721Ownership{
+		{ChainID: "stargaze-1", Contract: "stars1nft", TokenID: "1", Owner: "stars1carol", LastUpdatedHeight: 12},
+		{ChainID: "stargaze-1", Contract: "stars1nft", TokenID: "2", Owner: "stars1dave", LastUpdatedHeight: 16},
+		{ChainID: "stargaze-1", Contract: "stars1nft", TokenID: "3", Burned: true, LastUpdatedHeight: 15},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CW721Ownership rows = %+v, want %+v", got, want)
+	}
+}
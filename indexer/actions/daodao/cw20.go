@@ -0,0 +1,180 @@
+package daodao
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	cosmwasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/jackc/pgtype"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The Action of a CW20Transaction, the name of the cw20 execute msg it was moved by, except for actionStake.
+const (
+	actionTransfer     = "transfer"
+	actionTransferFrom = "transfer_from"
+	actionSend         = "send"
+	actionSendFrom     = "send_from"
+	actionMint         = "mint"
+	actionBurn         = "burn"
+	actionBurnFrom     = "burn_from"
+	// actionStake is a send to a DAODAO staking contract whose hook msg stakes the tokens.
+	actionStake = "stake"
+)
+
+// cw20Msg holds the fields of the cw20 execute msgs that move tokens, each msg only sets some of them.
+type cw20Msg struct {
+	Owner     string `json:"owner"`
+	Recipient string `json:"recipient"`
+	Contract  string `json:"contract"`
+	Amount    string `json:"amount"`
+	// Msg is the base64 encoded JSON msg a send passes on to the receiving contract
+	Msg []byte `json:"msg"`
+}
+
+// NewExecMsg returns the ExecMsg of msg. The payload is kept as is, if it isn't valid JSON Msg is null.
+func NewExecMsg(chainID string, msg *cosmwasmtypes.MsgExecuteContract, msgIndex int, height int64, hash []byte) (*ExecMsg, error) {
+	execMsg := &ExecMsg{
+		ChainID:  chainID,
+		MsgIndex: msgIndex,
+		Sender:   msg.Sender,
+		Address:  msg.Contract,
+		Height:   height,
+	}
+	if err := execMsg.TxHash.Set(hash); err != nil {
+		return nil, fmt.Errorf("failed to set tx hash: %w", err)
+	}
+
+	if !json.Valid(msg.Msg) {
+		execMsg.Msg = pgtype.JSONB{Status: pgtype.Null}
+		return execMsg, nil
+	}
+	execMsg.Msg = pgtype.JSONB{Bytes: msg.Msg, Status: pgtype.Present}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Msg, &payload); err == nil && len(payload) == 1 {
+		for action := range payload {
+			execMsg.Action = action
+		}
+	}
+	return execMsg, nil
+}
+
+// NewCW20Transaction returns the CW20Transaction of msg if its decoded payload is one of the cw20 msgs moving tokens,
+// otherwise nil is returned.
+func NewCW20Transaction(chainID string, msg *cosmwasmtypes.MsgExecuteContract, payload map[string]json.RawMessage, msgIndex int, height int64, hash []byte) (*CW20Transaction, error) {
+	action, m, err := cw20Action(payload)
+	if err != nil || action == "" {
+		return nil, err
+	}
+
+	amount, ok := sdk.NewIntFromString(m.Amount)
+	if !ok || amount.IsNegative() {
+		return nil, fmt.Errorf("invalid %s amount %q", action, m.Amount)
+	}
+
+	tx := &CW20Transaction{
+		ChainID:       chainID,
+		MsgIndex:      msgIndex,
+		Action:        action,
+		CW20Address:   msg.Contract,
+		SenderAddress: msg.Sender,
+		Amount:        amount.String(),
+		Height:        height,
+	}
+	if m.Owner != "" {
+		tx.SenderAddress = m.Owner
+	}
+	switch action {
+	case actionSend, actionSendFrom, actionStake:
+		tx.RecipientAddress = m.Contract
+	default:
+		tx.RecipientAddress = m.Recipient
+	}
+
+	if err := tx.TxHash.Set(hash); err != nil {
+		return nil, fmt.Errorf("failed to set tx hash: %w", err)
+	}
+	return tx, nil
+}
+
+// cw20Action returns the name and the fields of the cw20 msg moving tokens in payload, the name is empty if there is none.
+func cw20Action(payload map[string]json.RawMessage) (string, *cw20Msg, error) {
+	for _, action := range []string{actionTransfer, actionTransferFrom, actionSend, actionSendFrom, actionMint, actionBurn, actionBurnFrom} {
+		if payload[action] == nil {
+			continue
+		}
+
+		m := new(cw20Msg)
+		if err := json.Unmarshal(payload[action], m); err != nil {
+			return "", nil, fmt.Errorf("failed to decode %s msg: %w", action, err)
+		}
+
+		// Staking the gov token of a DAO is a send to its staking contract, e.g. {"send":{"contract":..,"msg":{"stake":{}}}}
+		if action == actionSend && len(m.Msg) > 0 {
+			var hook map[string]json.RawMessage
+			if err := json.Unmarshal(m.Msg, &hook); err == nil && hook[actionStake] != nil {
+				action = actionStake
+			}
+		}
+		return action, m, nil
+	}
+	return "", nil, nil
+}
+
+// ApplyCW20Transaction writes tx and adjusts the CW20Balance of the addresses it moved tokens between, within a single
+// database transaction (a savepoint when db is already the transaction of the block, see indexer.BlockTransactions).
+// The balances are only adjusted when tx is inserted, so indexing the same block again doesn't apply it twice.
+//
+// Balances are adjusted with an atomic increment rather than read and written back, so blocks processed concurrently
+// can't overwrite each other's adjustments. Addresses holding tokens from before the indexed range start from zero,
+// and may even go negative, until the balances are reconciled against the contracts, see ReconcileCW20Balances.
+func ApplyCW20Transaction(db *gorm.DB, tx *CW20Transaction) error {
+	return db.Transaction(func(dbTx *gorm.DB) error {
+		res := dbTx.Clauses(clause.OnConflict{DoNothing: true}).Create(tx)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		changes, err := CW20BalanceChanges(tx)
+		if err != nil {
+			return err
+		}
+		for _, b := range changes {
+			err := dbTx.Clauses(clause.OnConflict{
+				Columns:   cw20BalanceKey,
+				DoUpdates: clause.Set{{Column: clause.Column{Name: "balance"}, Value: gorm.Expr("cw20_balances.balance + excluded.balance")}},
+			}).Create(b).Error
+			if err != nil {
+				return fmt.Errorf("failed to adjust CW20 balance of %s: %w", b.Address, err)
+			}
+		}
+		return nil
+	})
+}
+
+// CW20BalanceChanges returns the changes tx makes to the balances of the addresses it moves tokens between, as
+// CW20Balance rows whose Balance is the amount to add, negative for the sender. The rows are sorted by address,
+// so concurrent database transactions lock the balances of a token in the same order.
+func CW20BalanceChanges(tx *CW20Transaction) ([]*CW20Balance, error) {
+	amount, ok := sdk.NewIntFromString(tx.Amount)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", tx.Amount)
+	}
+
+	var changes []*CW20Balance
+	if tx.Action != actionMint {
+		changes = append(changes, &CW20Balance{ChainID: tx.ChainID, Address: tx.SenderAddress, Token: tx.CW20Address, Balance: amount.Neg().String()})
+	}
+	if tx.Action != actionBurn && tx.Action != actionBurnFrom {
+		changes = append(changes, &CW20Balance{ChainID: tx.ChainID, Address: tx.RecipientAddress, Token: tx.CW20Address, Balance: amount.String()})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Address < changes[j].Address
+	})
+	return changes, nil
+}
@@ -2,7 +2,9 @@ package daodao
 
 import (
 	"context"
-	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
 	"time"
 
 	cosmwasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
@@ -10,6 +12,8 @@ import (
 	"github.com/strangelove-ventures/valis/indexer"
 	coretypes "github.com/tendermint/tendermint/rpc/core/types"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BlockActionName is used for configuring block actions via the config file,
@@ -20,13 +24,16 @@ const BlockActionName = "daodao"
 // to parse the DAODAO smart contract data on-chain and index it into a database instance.
 type DAODAOAction struct {
 	actionName string
+	sequential bool
 	log        *zap.Logger
 }
 
-// NewDAODAOAction returns a new DAODAOAction block action to be used by the indexer.
-func NewDAODAOAction(log *zap.Logger) *DAODAOAction {
+// NewDAODAOAction returns a new DAODAOAction block action to be used by the indexer. If sequential is true the
+// indexer processes a single block at a time while the action is executed, see Sequential.
+func NewDAODAOAction(log *zap.Logger, sequential bool) *DAODAOAction {
 	return &DAODAOAction{
 		actionName: BlockActionName,
+		sequential: sequential,
 		log:        log,
 	}
 }
@@ -36,12 +43,28 @@ func (a *DAODAOAction) Name() string {
 	return a.actionName
 }
 
+// Sequential implements indexer.SequentialAction. The CW20Balance rows are running balances, adjusted by each
+// CW20Transaction as it's indexed. Since the adjustments add up the same in any order the final balances don't
+// depend on it, but the balances only reflect the chain's state at a given height when blocks are applied in order,
+// which is what enabling this guarantees at the cost of processing blocks concurrently.
+func (a *DAODAOAction) Sequential() bool {
+	return a.sequential
+}
+
+// SchemaVersion implements indexer.SchemaVersioner, version 2 added the chain id to the keys of the proposals and votes,
+// version 3 keyed the marketing info, logos and gov tokens by chain id and contract, version 4 added the chain id
+// to the key of the CW20 balances and version 5 made the CW20 amounts and balances numeric.
+func (a *DAODAOAction) SchemaVersion() int {
+	return 5
+}
+
 // MigrateSchema runs schema migrations for the specified models.
 func (a *DAODAOAction) MigrateSchema(indexer *indexer.Indexer) error {
 	return indexer.DB.AutoMigrate(
 		&Code{},
 		&Contract{},
 		&ExecMsg{},
+		&ExecFunds{},
 		&CW20Balance{},
 		&CW20Transaction{},
 		&Coin{},
@@ -49,9 +72,22 @@ func (a *DAODAOAction) MigrateSchema(indexer *indexer.Indexer) error {
 		&Marketing{},
 		&GovToken{},
 		&Logo{},
+		&DAOProposal{},
+		&DAOVote{},
 	)
 }
 
+// MsgTypes returns the type URLs of the msgs handled by this action, txs without any of them are skipped.
+func (a *DAODAOAction) MsgTypes() []string {
+	return []string{
+		sdk.MsgTypeURL(&cosmwasmtypes.MsgExecuteContract{}),
+		sdk.MsgTypeURL(&cosmwasmtypes.MsgInstantiateContract{}),
+		sdk.MsgTypeURL(&cosmwasmtypes.MsgMigrateContract{}),
+		sdk.MsgTypeURL(&cosmwasmtypes.MsgStoreCode{}),
+		sdk.MsgTypeURL(&cosmwasmtypes.MsgUpdateAdmin{}),
+	}
+}
+
 // Execute calls the appropriate functions needed for properly parsing data related to the DAODAO smart contracts.
 func (a *DAODAOAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
 	return a.IndexDAODAOContracts(ctx, indexer, block)
@@ -60,16 +96,25 @@ func (a *DAODAOAction) Execute(ctx context.Context, indexer *indexer.Indexer, bl
 // IndexDAODAOContracts parses the tx data in the specified block and indexes the tx data along with
 // and DAODAO smart contract related data into a postgres database instance.
 func (a *DAODAOAction) IndexDAODAOContracts(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	txResults, err := indexer.TxResults(ctx, block)
+	if err != nil {
+		return err
+	}
+
 	for index, tx := range block.Block.Data.Txs {
 		// Check if the context has been cancelled on each iteration
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(time.Millisecond * 100):
+		default:
 			// continue
 		}
 
-		sdkTx, err := indexer.Client.Codec.TxConfig.TxDecoder()(tx)
+		if err := indexer.TxRateLimit.Wait(ctx); err != nil {
+			return err
+		}
+
+		sdkTx, err := indexer.DecodeTx(tx)
 		if err != nil {
 			a.log.Debug(
 				"Failed to decode tx",
@@ -83,47 +128,73 @@ func (a *DAODAOAction) IndexDAODAOContracts(ctx context.Context, indexer *indexe
 			continue
 		}
 
-		// TODO This can fail so results may not end up in db
-		// ex. Failed to query tx results. Err: failed to read response body: context deadline exceeded (Client.Timeout or context cancellation while reading body)
-		// ex. [Height 2301720] {8/9 txs} - Failed to query tx results. Err: post failed: Post "https://rpc-juno.ecostake.com:443": context deadline exceeded (Client.Timeout exceeded while awaiting headers)
-		txRes, err := indexer.Client.QueryTx(ctx, hex.EncodeToString(tx.Hash()), true)
-		if err != nil {
+		// Txs without any msgs handled by the configured actions are skipped before being decoded
+		if sdkTx == nil {
+			continue
+		}
+
+		// Results are missing for txs that failed to be queried, see (*Indexer).TxResults
+		txRes := txResults[index]
+		if txRes == nil {
 			a.log.Debug(
-				"Failed to query tx results",
+				"Missing tx results",
 				zap.Int64("height", block.Block.Height),
 				zap.Int("tx_index", index+1),
 				zap.Int("total_txs", len(block.Block.Data.Txs)),
-				zap.Error(err),
 			)
 
 			// TODO we may want to retry or keep track of txs that fail to be queried
 			continue
 		}
 
-		// TODO remove these, just here to kill compiler errors
-		_ = txRes
+		// Only txs involving the watched addresses are indexed, if any are configured
+		if !indexer.InvolvesWatchedAddress(txRes.TxResult.Events) {
+			continue
+		}
+
+		// Failed txs don't change any contract state so there is nothing to index
+		if txRes.TxResult.Code != 0 {
+			continue
+		}
+
+		// The msg logs are used for deriving data that isn't part of the msgs themselves,
+		// e.g. the address of an instantiated contract.
+		logs, err := sdk.ParseABCILogs(txRes.TxResult.Log)
+		if err != nil {
+			a.log.Debug(
+				"Failed to parse tx logs",
+				zap.Int64("height", block.Block.Height),
+				zap.Int("tx_index", index+1),
+				zap.Int("total_txs", len(block.Block.Data.Txs)),
+				zap.Error(err),
+			)
+		}
 
 		for msgIndex, msg := range sdkTx.GetMsgs() {
-			a.HandleMsgs(indexer, msg, msgIndex, block.Block.Height, tx.Hash())
+			err := a.HandleMsgs(ctx, indexer, msg, msgIndex, block.Block.Height, block.Block.Time, tx.Hash(), logs)
+
+			// The failed write aborted the block transaction, the block is rolled back and retried as a whole
+			if err != nil && indexer.InBlockTx() {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func (a *DAODAOAction) HandleMsgs(indexer *indexer.Indexer, msg sdk.Msg, msgIndex int, height int64, hash []byte) {
+// HandleMsgs checks if the specified sdk.Msg is one of the wasm msgs and if so it attempts to index
+// the msg data into the database instance. The errors are logged, the first error writing the msg data is returned.
+func (a *DAODAOAction) HandleMsgs(ctx context.Context, indexer *indexer.Indexer, msg sdk.Msg, msgIndex int, height int64, blockTime time.Time, hash []byte, logs sdk.ABCIMessageLogs) error {
 	switch m := msg.(type) {
 	case *cosmwasmtypes.MsgExecuteContract:
-		// do te thing
-		a.log.Info(
-			"RawMsg",
-			zap.String("msg", string(m.Msg.Bytes())),
-		)
+		return a.HandleExecute(ctx, indexer, m, msgIndex, height, blockTime, hash, logs)
 	case *cosmwasmtypes.MsgInstantiateContract:
-		// do te thing
-		a.log.Info(
-			"RawMsg",
-			zap.String("msg", string(m.Msg.Bytes())),
-		)
+		return a.HandleInstantiate(indexer, msgIndex, height, blockTime, hash, logs, m.Sender, m.Admin, m.Label, m.CodeID)
+
+	// TODO MsgInstantiateContract2 is not available in the wasmd version we currently depend on (it was added in v0.29),
+	// txs containing it fail to decode and aren't indexed. Bumping wasmd means moving to cosmos-sdk v0.45.11+ and
+	// ibc-go v4, which the ibc actions must be ported to first. Once wasmd is bumped add a case here that calls
+	// HandleInstantiate the same way, the contract address is derived from the instantiate event.
 	case *cosmwasmtypes.MsgMigrateContract:
 		// do te thing
 		a.log.Info(
@@ -143,4 +214,329 @@ func (a *DAODAOAction) HandleMsgs(indexer *indexer.Indexer, msg sdk.Msg, msgInde
 			zap.String("msg", m.Contract),
 		)
 	}
+	return nil
+}
+
+// HandleInstantiate indexes a newly instantiated contract. The contract address is not part of the instantiate msg,
+// so it is derived from the first instantiate event emitted for the msg with a matching code id.
+// The insert error of the contract is logged and returned.
+func (a *DAODAOAction) HandleInstantiate(indexer *indexer.Indexer, msgIndex int, height int64, blockTime time.Time, hash []byte, logs sdk.ABCIMessageLogs, creator, admin, label string, codeID uint64) error {
+	address := instantiatedContractAddress(logs, msgIndex, codeID)
+	if address == "" {
+		a.log.Warn(
+			"Failed to find contract address in instantiate event",
+			zap.Int64("height", height),
+			zap.String("tx_hash", string(hash)),
+			zap.Int("msg_index", msgIndex),
+		)
+		return nil
+	}
+
+	contract := &Contract{
+		Address:      address,
+		CodeID:       int64(codeID),
+		Creator:      creator,
+		Admin:        admin,
+		Label:        label,
+		CreationTime: blockTime,
+		Height:       height,
+	}
+
+	result := indexer.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(contract)
+	if result.Error != nil {
+		a.log.Warn(
+			"Failed to insert Contract into DB",
+			zap.Int64("height", height),
+			zap.String("tx_hash", string(hash)),
+			zap.Int("msg_index", msgIndex),
+			zap.Error(result.Error),
+		)
+	}
+	return result.Error
+}
+
+// instantiatedContractAddress returns the contract address from the instantiate event of the msg at msgIndex.
+// Same typed events are merged in the msg logs, so a contract instantiating other contracts results in
+// a single event with repeated (_contract_address, code_id) attribute pairs, the first pair belongs to the msg itself.
+func instantiatedContractAddress(logs sdk.ABCIMessageLogs, msgIndex int, codeID uint64) string {
+	for _, log := range logs {
+		if int(log.MsgIndex) != msgIndex {
+			continue
+		}
+
+		for _, event := range log.Events {
+			if event.Type != cosmwasmtypes.EventTypeInstantiate {
+				continue
+			}
+
+			var address string
+			for _, attr := range event.Attributes {
+				switch attr.Key {
+				case cosmwasmtypes.AttributeKeyContractAddr:
+					address = attr.Value
+				case cosmwasmtypes.AttributeKeyCodeID:
+					if attr.Value == strconv.FormatUint(codeID, 10) && address != "" {
+						return address
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Proposal statuses tracked in the DAOProposal model.
+const (
+	ProposalStatusOpen     = "open"
+	ProposalStatusExecuted = "executed"
+	ProposalStatusClosed   = "closed"
+)
+
+// proposeMsg, voteMsg and proposalIDMsg are the execute msgs of the DAODAO proposal module contracts.
+type proposeMsg struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type voteMsg struct {
+	ProposalID uint64 `json:"proposal_id"`
+	Vote       string `json:"vote"`
+}
+
+type proposalIDMsg struct {
+	ProposalID uint64 `json:"proposal_id"`
+}
+
+// HandleExecute records a MsgExecuteContract as an ExecMsg, then decodes its JSON payload and indexes the cw20 token
+// movements and the DAODAO proposal lifecycle (propose, vote, execute and close) that it describes, along with the
+// marketing info of CW20 gov tokens when it's updated. The errors are logged, the first error writing the rows of the
+// msg is returned while payloads that fail to be decoded are skipped.
+func (a *DAODAOAction) HandleExecute(ctx context.Context, indexer *indexer.Indexer, m *cosmwasmtypes.MsgExecuteContract, msgIndex int, height int64, blockTime time.Time, hash []byte, logs sdk.ABCIMessageLogs) error {
+	var writeErr error
+	failed := func(msg string, err error) {
+		a.log.Warn(
+			msg,
+			zap.Int64("height", height),
+			zap.String("tx_hash", string(hash)),
+			zap.Int("msg_index", msgIndex),
+			zap.String("contract", m.Contract),
+			zap.Error(err),
+		)
+		if writeErr == nil {
+			writeErr = err
+		}
+	}
+
+	// The funds are recorded for every execute, whether or not its payload is one of the DAODAO msgs
+	if err := a.indexExecFunds(indexer, m, msgIndex, height, hash); err != nil {
+		failed("Failed to insert ExecFunds into DB", err)
+	}
+
+	// Every execute is recorded with its raw payload, so msgs that aren't indexed below can still be looked up
+	if err := a.indexExecMsg(indexer, m, msgIndex, height, hash); err != nil {
+		failed("Failed to insert ExecMsg into DB", err)
+	}
+
+	// Execute msgs are JSON objects with a single key naming the msg, e.g. {"vote":{"proposal_id":1,"vote":"yes"}}
+	var execMsg map[string]json.RawMessage
+	if err := json.Unmarshal(m.Msg, &execMsg); err != nil {
+		a.log.Debug(
+			"Failed to decode MsgExecuteContract payload",
+			zap.Int64("height", height),
+			zap.String("tx_hash", string(hash)),
+			zap.Int("msg_index", msgIndex),
+			zap.Error(err),
+		)
+		return writeErr
+	}
+
+	tx, cw20Err := NewCW20Transaction(indexer.Client.Config.ChainID, m, execMsg, msgIndex, height, hash)
+	switch {
+	case cw20Err != nil:
+		a.log.Warn(
+			"Failed to decode CW20Transaction",
+			zap.Int64("height", height),
+			zap.String("tx_hash", string(hash)),
+			zap.Int("msg_index", msgIndex),
+			zap.String("contract", m.Contract),
+			zap.Error(cw20Err),
+		)
+	case tx != nil:
+		// The balances of the addresses involved are adjusted along with the transaction, see ApplyCW20Transaction
+		if err := ApplyCW20Transaction(indexer.DB, tx); err != nil {
+			failed("Failed to index CW20Transaction", err)
+		}
+	}
+
+	// Decoding errors are only logged, the errors of the writes are returned as well
+	var err, decodeErr error
+	switch {
+	case execMsg["propose"] != nil:
+		var propose proposeMsg
+		if decodeErr = json.Unmarshal(execMsg["propose"], &propose); decodeErr != nil {
+			break
+		}
+
+		// The proposal id is assigned by the contract, so it's only available in the emitted wasm event
+		id, parseErr := strconv.ParseUint(wasmEventAttribute(logs, msgIndex, m.Contract, "proposal_id"), 10, 64)
+		if parseErr != nil {
+			decodeErr = fmt.Errorf("failed to find proposal id in wasm event: %w", parseErr)
+			break
+		}
+
+		// The status may already have moved on if the block executing or closing the proposal was processed first,
+		// so only the fields known from the propose msg are filled in, see updateProposalStatus
+		err = indexer.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chain_id"}, {Name: "contract_address"}, {Name: "proposal_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"proposer", "title", "description", "height", "creation_time"}),
+		}).Create(&DAOProposal{
+			ChainID:           indexer.Client.Config.ChainID,
+			ContractAddress:   m.Contract,
+			ProposalID:        id,
+			Proposer:          m.Sender,
+			Title:             propose.Title,
+			Description:       propose.Description,
+			Status:            ProposalStatusOpen,
+			Height:            height,
+			CreationTime:      blockTime,
+			LastUpdatedHeight: height,
+		}).Error
+	case execMsg["vote"] != nil:
+		var vote voteMsg
+		if decodeErr = json.Unmarshal(execMsg["vote"], &vote); decodeErr != nil {
+			break
+		}
+
+		// Since blocks are processed concurrently, a vote only replaces a vote cast at or below its height
+		err = indexer.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chain_id"}, {Name: "contract_address"}, {Name: "proposal_id"}, {Name: "voter"}},
+			DoUpdates: clause.AssignmentColumns([]string{"vote", "height"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				gorm.Expr("dao_votes.height <= excluded.height"),
+			}},
+		}).Create(&DAOVote{
+			ChainID:         indexer.Client.Config.ChainID,
+			ContractAddress: m.Contract,
+			ProposalID:      vote.ProposalID,
+			Voter:           m.Sender,
+			Vote:            vote.Vote,
+			Height:          height,
+		}).Error
+	case execMsg["execute"] != nil:
+		var msg proposalIDMsg
+		if decodeErr = json.Unmarshal(execMsg["execute"], &msg); decodeErr != nil {
+			break
+		}
+		err = a.updateProposalStatus(indexer, m.Contract, msg.ProposalID, ProposalStatusExecuted, height)
+	case execMsg["close"] != nil:
+		var msg proposalIDMsg
+		if decodeErr = json.Unmarshal(execMsg["close"], &msg); decodeErr != nil {
+			break
+		}
+		err = a.updateProposalStatus(indexer, m.Contract, msg.ProposalID, ProposalStatusClosed, height)
+	case execMsg["update_marketing"] != nil, execMsg["upload_logo"] != nil:
+		err = a.IndexMarketingInfo(ctx, indexer.DB, QuerySmartContract(indexer), indexer.Client.Config.ChainID, m.Contract, height)
+	}
+
+	switch {
+	case decodeErr != nil:
+		a.log.Warn(
+			"Failed to decode DAODAO execute msg",
+			zap.Int64("height", height),
+			zap.String("tx_hash", string(hash)),
+			zap.Int("msg_index", msgIndex),
+			zap.String("contract", m.Contract),
+			zap.Error(decodeErr),
+		)
+	case err != nil:
+		failed("Failed to index DAODAO execute msg", err)
+	}
+	return writeErr
+}
+
+// indexExecMsg writes the ExecMsg of the execute msg.
+func (a *DAODAOAction) indexExecMsg(indexer *indexer.Indexer, m *cosmwasmtypes.MsgExecuteContract, msgIndex int, height int64, hash []byte) error {
+	execMsg, err := NewExecMsg(indexer.Client.Config.ChainID, m, msgIndex, height, hash)
+	if err != nil {
+		return err
+	}
+	return indexer.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(execMsg).Error
+}
+
+// indexExecFunds writes the funds attached to the execute msg, if any.
+func (a *DAODAOAction) indexExecFunds(indexer *indexer.Indexer, m *cosmwasmtypes.MsgExecuteContract, msgIndex int, height int64, hash []byte) error {
+	funds, err := NewExecFunds(indexer.Client.Config.ChainID, m, msgIndex, height, hash)
+	if err != nil || len(funds) == 0 {
+		return err
+	}
+	return indexer.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&funds).Error
+}
+
+// NewExecFunds returns an ExecFunds for each denom of the funds attached to msg.
+func NewExecFunds(chainID string, msg *cosmwasmtypes.MsgExecuteContract, msgIndex int, height int64, hash []byte) ([]*ExecFunds, error) {
+	funds := make([]*ExecFunds, 0, len(msg.Funds))
+	for _, coin := range msg.Funds {
+		f := &ExecFunds{
+			ChainID:  chainID,
+			MsgIndex: msgIndex,
+			Denom:    coin.Denom,
+			Amount:   coin.Amount.String(),
+			Sender:   msg.Sender,
+			Contract: msg.Contract,
+			Height:   height,
+		}
+		if err := f.TxHash.Set(hash); err != nil {
+			return nil, fmt.Errorf("failed to set tx hash: %w", err)
+		}
+		funds = append(funds, f)
+	}
+	return funds, nil
+}
+
+// updateProposalStatus transitions the proposal with the specified id, executed or closed, to status.
+// Since blocks are processed concurrently, the status is only changed by transitions at or above the height it was
+// last updated at. Proposals that aren't known yet are created with their status alone, see DAOProposal.
+func (a *DAODAOAction) updateProposalStatus(indexer *indexer.Indexer, contract string, proposalID uint64, status string, height int64) error {
+	return indexer.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "contract_address"}, {Name: "proposal_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "last_updated_height"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			gorm.Expr("dao_proposals.last_updated_height <= excluded.last_updated_height"),
+		}},
+	}).Create(&DAOProposal{
+		ChainID:           indexer.Client.Config.ChainID,
+		ContractAddress:   contract,
+		ProposalID:        proposalID,
+		Status:            status,
+		LastUpdatedHeight: height,
+	}).Error
+}
+
+// wasmEventAttribute returns the value of the first attribute with the specified key, emitted in the wasm event
+// by contract for the msg at msgIndex. An empty string is returned if no such attribute exists.
+func wasmEventAttribute(logs sdk.ABCIMessageLogs, msgIndex int, contract, key string) string {
+	for _, log := range logs {
+		if int(log.MsgIndex) != msgIndex {
+			continue
+		}
+
+		for _, event := range log.Events {
+			if event.Type != cosmwasmtypes.WasmModuleEventType {
+				continue
+			}
+
+			// Attributes of merged wasm events are grouped by the contract address that precedes them
+			var current string
+			for _, attr := range event.Attributes {
+				if attr.Key == cosmwasmtypes.AttributeKeyContractAddr {
+					current = attr.Value
+					continue
+				}
+				if current == contract && attr.Key == key {
+					return attr.Value
+				}
+			}
+		}
+	}
+	return ""
 }
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgtype"
+	"gorm.io/gorm/clause"
 )
 
 type Code struct {
@@ -12,7 +13,8 @@ type Code struct {
 	Creator      string    `gorm:"not null;default:''"`
 	CreationTime time.Time `gorm:"not null"`
 
-	Contract Contract `gorm:"foreignKey:CodeID;references:ID"`
+	// Contracts may be instantiated from codes stored before the indexed range, so no FK constraint is created
+	Contract Contract `gorm:"foreignKey:CodeID;references:ID;constraint:-"`
 }
 
 type Contract struct {
@@ -28,26 +30,68 @@ type Contract struct {
 	DAO DAO `gorm:"foreignKey:ContractAddress;references:Address"`
 }
 
+// ExecMsg is a MsgExecuteContract sent to Address, Action is the name of the execute msg (the single key of its
+// JSON payload, e.g. transfer) and Msg the payload itself, so msgs that aren't otherwise indexed are still stored.
+// Msg is null if the payload isn't valid JSON.
 type ExecMsg struct {
-	ID      int
-	Sender  string `gorm:"not null"`
-	Address string `gorm:"not null"`
+	ID       int
+	ChainID  string       `gorm:"not null;uniqueIndex:idx_exec_msgs_tx_msg"`
+	TxHash   pgtype.Bytea `gorm:"not null;uniqueIndex:idx_exec_msgs_tx_msg"`
+	MsgIndex int          `gorm:"not null;uniqueIndex:idx_exec_msgs_tx_msg"`
+	Sender   string       `gorm:"not null"`
+	Address  string       `gorm:"not null;index"`
+	Action   string       `gorm:"not null;default:''"`
+	Msg      pgtype.JSONB
+	Height   int64 `gorm:"not null"`
+}
+
+// ExecFunds is a coin attached to a MsgExecuteContract, with a row per denom of the funds.
+// Funded executes move value into the contract (e.g. buying or staking), which isn't visible from the msg payload.
+type ExecFunds struct {
+	ChainID  string       `gorm:"primaryKey"`
+	TxHash   pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex int          `gorm:"primaryKey;autoIncrement:false"`
+	Denom    string       `gorm:"primaryKey"`
+	Amount   string       `gorm:"not null"`
+	Sender   string       `gorm:"not null;index"`
+	Contract string       `gorm:"not null;index"`
+	Height   int64        `gorm:"not null"`
 }
 
+// CW20Balance is the balance of Address in the CW20 token contract at Token, there is a single row per chain,
+// address and token. CW20 amounts are Uint128, so balances are stored as numeric rather than as bigint.
 type CW20Balance struct {
 	ID      int
-	Address string `gorm:"not null"`
-	Token   string `gorm:"not null"`
-	Balance int64  `gorm:"not null"`
+	ChainID string `gorm:"not null;uniqueIndex:idx_cw20_balances_chain_address_token"`
+	Address string `gorm:"not null;uniqueIndex:idx_cw20_balances_chain_address_token"`
+	Token   string `gorm:"not null;uniqueIndex:idx_cw20_balances_chain_address_token"`
+	Balance string `gorm:"type:numeric;not null"`
+}
+
+// cw20BalanceKey is the unique key of a CW20Balance, the columns its writes conflict on.
+var cw20BalanceKey = []clause.Column{{Name: "chain_id"}, {Name: "address"}, {Name: "token"}}
+
+// OnConflict makes writing the balance of an address and token that is already known update its balance.
+func (CW20Balance) OnConflict() clause.OnConflict {
+	return clause.OnConflict{
+		Columns:   cw20BalanceKey,
+		DoUpdates: clause.AssignmentColumns([]string{"balance"}),
+	}
 }
 
+// CW20Transaction is an amount of the CW20 token at CW20Address moved by an execute msg, see cw20Action for the
+// msgs that are indexed. RecipientAddress is empty for burns, for a send it's the contract the tokens were sent to.
 type CW20Transaction struct {
 	ID               int
-	CW20Address      string `gorm:"not null"`
-	SenderAddress    string `gorm:"not null"`
-	RecipientAddress string `gorm:"not null"`
-	Amount           int64  `gorm:"not null"`
-	Height           int64  `gorm:"not null"`
+	ChainID          string       `gorm:"not null;uniqueIndex:idx_cw20_transactions_tx_msg"`
+	TxHash           pgtype.Bytea `gorm:"not null;uniqueIndex:idx_cw20_transactions_tx_msg"`
+	MsgIndex         int          `gorm:"not null;uniqueIndex:idx_cw20_transactions_tx_msg"`
+	Action           string       `gorm:"not null;default:''"`
+	CW20Address      string       `gorm:"not null"`
+	SenderAddress    string       `gorm:"not null"`
+	RecipientAddress string       `gorm:"not null"`
+	Amount           string       `gorm:"type:numeric;not null"`
+	Height           int64        `gorm:"not null"`
 }
 
 type Coin struct {
@@ -66,6 +110,8 @@ type DAO struct {
 
 type Marketing struct {
 	ID            int
+	ChainID       string `gorm:"not null;uniqueIndex:idx_marketings_contract"`
+	Contract      string `gorm:"not null;uniqueIndex:idx_marketings_contract"`
 	Project       string
 	Description   string
 	MarketingText string
@@ -76,7 +122,8 @@ type Marketing struct {
 
 type GovToken struct {
 	ID          int
-	Address     string `gorm:"not null"`
+	ChainID     string `gorm:"not null;uniqueIndex:idx_gov_tokens_address"`
+	Address     string `gorm:"not null;uniqueIndex:idx_gov_tokens_address"`
 	Name        string `gorm:"not null"`
 	Symbol      string `gorm:"not null"`
 	Decimals    int
@@ -84,8 +131,40 @@ type GovToken struct {
 }
 
 type Logo struct {
-	ID  int
-	URL string
-	SVG string
-	PNG pgtype.Bytea
+	ID       int
+	ChainID  string `gorm:"not null;uniqueIndex:idx_logos_contract"`
+	Contract string `gorm:"not null;uniqueIndex:idx_logos_contract"`
+	URL      string
+	SVG      string
+	PNG      pgtype.Bytea
+}
+
+// DAOProposal is a proposal made to a DAODAO proposal module contract, Status tracks the proposal lifecycle
+// (open, executed or closed) and LastUpdatedHeight the height of the latest status transition. A proposal whose
+// propose msg wasn't indexed yet, e.g. made before the indexed range or in a block processed later, only has its
+// status until the propose msg fills in the rest.
+type DAOProposal struct {
+	ChainID           string    `gorm:"primaryKey"`
+	ContractAddress   string    `gorm:"primaryKey"`
+	ProposalID        uint64    `gorm:"primaryKey;autoIncrement:false"`
+	Proposer          string    `gorm:"not null"`
+	Title             string    `gorm:"not null;default:''"`
+	Description       string    `gorm:"not null;default:''"`
+	Status            string    `gorm:"not null"`
+	Height            int64     `gorm:"not null"`
+	CreationTime      time.Time `gorm:"not null"`
+	LastUpdatedHeight int64     `gorm:"not null"`
+
+	// Votes can be cast on proposals created before the indexed range, so no FK constraint is created
+	Votes []DAOVote `gorm:"foreignKey:ChainID,ContractAddress,ProposalID;references:ChainID,ContractAddress,ProposalID;constraint:-"`
+}
+
+// DAOVote is the latest vote cast by Voter on a DAOProposal, as of Height.
+type DAOVote struct {
+	ChainID         string `gorm:"primaryKey"`
+	ContractAddress string `gorm:"primaryKey"`
+	ProposalID      uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Voter           string `gorm:"primaryKey"`
+	Vote            string `gorm:"not null"`
+	Height          int64  `gorm:"not null"`
 }
@@ -0,0 +1,498 @@
+package daodao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	cosmwasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/jackc/pgtype"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"go.uber.org/zap"
+)
+
+// newTestIndexer returns an Indexer for chainID decoding txs with the lens codec and writing to a dbtest DB.
+func newTestIndexer(t *testing.T, chainID string) (*indexer.Indexer, *dbtest.Recorder) {
+	t.Helper()
+	client := &lens.ChainClient{
+		Config: &lens.ChainClientConfig{ChainID: chainID},
+		Codec:  lens.MakeCodec(lens.ModuleBasics),
+	}
+	db, rec := dbtest.New(t)
+	return indexer.NewIndexer(zap.NewNop(), client, db), rec
+}
+
+// decodeMsgs encodes a tx containing msgs and decodes it again with the indexer's codec, like a tx of a block.
+func decodeMsgs(t *testing.T, i *indexer.Indexer, msgs ...sdk.Msg) []sdk.Msg {
+	t.Helper()
+	builder := i.Client.Codec.TxConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msgs...); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	bz, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+	sdkTx, err := i.Client.Codec.TxConfig.TxDecoder()(bz)
+	if err != nil {
+		t.Fatalf("failed to decode tx: %v", err)
+	}
+	return sdkTx.GetMsgs()
+}
+
+// instantiate returns an instantiate event with the specified attribute key value pairs.
+func instantiate(attrs ...string) sdk.StringEvent {
+	event := sdk.StringEvent{Type: "instantiate"}
+	for j := 0; j < len(attrs); j += 2 {
+		event.Attributes = append(event.Attributes, sdk.Attribute{Key: attrs[j], Value: attrs[j+1]})
+	}
+	return event
+}
+
+func TestHandleMsgInstantiateContract(t *testing.T) {
+	i, rec := newTestIndexer(t, "juno-1")
+	a := NewDAODAOAction(zap.NewNop(), false)
+
+	msgs := decodeMsgs(t, i,
+		&cosmwasmtypes.MsgInstantiateContract{Sender: "juno1creator", Admin: "juno1admin", CodeID: 10, Label: "dao", Msg: []byte(`{}`)},
+		&cosmwasmtypes.MsgInstantiateContract{Sender: "juno1creator", CodeID: 11, Label: "no event", Msg: []byte(`{}`)},
+	)
+	logs := sdk.ABCIMessageLogs{
+		{MsgIndex: 0, Events: sdk.StringEvents{instantiate("_contract_address", "juno1dao", "code_id", "10")}},
+	}
+	blockTime := time.Date(2022, 4, 20, 8, 0, 0, 0, time.UTC)
+	for msgIndex, msg := range msgs {
+		a.HandleMsgs(context.Background(), i, msg, msgIndex, 42, blockTime, []byte{0x01}, logs)
+	}
+
+	rows := rec.Rows("contracts")
+	if len(rows) != 1 {
+		t.Fatalf("got %d Contract rows, want 1, contracts without an instantiate event aren't indexed", len(rows))
+	}
+	got := *rows[0].(*Contract)
+	want := Contract{Address: "juno1dao", CodeID: 10, Creator: "juno1creator", Admin: "juno1admin", Label: "dao", CreationTime: blockTime, Height: 42}
+	if got != want {
+		t.Errorf("Contract row = %+v, want %+v", got, want)
+	}
+}
+
+func TestInstantiatedContractAddress(t *testing.T) {
+	logs := sdk.ABCIMessageLogs{
+		{MsgIndex: 0, Events: sdk.StringEvents{
+			{Type: "message", Attributes: []sdk.Attribute{{Key: "module", Value: "wasm"}}},
+			instantiate("_contract_address", "juno1dao", "code_id", "10"),
+		}},
+		// A DAO instantiating its voting and proposal modules, the first pair belongs to the msg itself
+		{MsgIndex: 1, Events: sdk.StringEvents{
+			instantiate(
+				"_contract_address", "juno1core", "code_id", "12",
+				"_contract_address", "juno1voting", "code_id", "13",
+				"_contract_address", "juno1proposal", "code_id", "14",
+			),
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		msgIndex int
+		codeID   uint64
+		want     string
+	}{
+		{name: "single contract", msgIndex: 0, codeID: 10, want: "juno1dao"},
+		{name: "first of merged event", msgIndex: 1, codeID: 12, want: "juno1core"},
+		{name: "code id of another msg", msgIndex: 0, codeID: 12, want: ""},
+		{name: "missing msg log", msgIndex: 2, codeID: 10, want: ""},
+	}
+	for _, tt := range tests {
+		if got := instantiatedContractAddress(logs, tt.msgIndex, tt.codeID); got != tt.want {
+			t.Errorf("%s: instantiatedContractAddress(%d, %d) = %q, want %q", tt.name, tt.msgIndex, tt.codeID, got, tt.want)
+		}
+	}
+}
+
+// wasm returns a wasm event emitted by contract with the specified attribute key value pairs.
+func wasm(contract string, attrs ...string) sdk.StringEvent {
+	event := sdk.StringEvent{Type: cosmwasmtypes.WasmModuleEventType, Attributes: []sdk.Attribute{{Key: cosmwasmtypes.AttributeKeyContractAddr, Value: contract}}}
+	for j := 0; j < len(attrs); j += 2 {
+		event.Attributes = append(event.Attributes, sdk.Attribute{Key: attrs[j], Value: attrs[j+1]})
+	}
+	return event
+}
+
+func TestProposalLifecycle(t *testing.T) {
+	blockTime := time.Date(2022, 4, 20, 8, 0, 0, 0, time.UTC)
+
+	// msg is an execute msg sent to the proposal module at height
+	type msg struct {
+		height int64
+		sender string
+		msg    string
+		events []sdk.StringEvent
+	}
+	propose := msg{10, "juno1proposer", `{"propose":{"title":"Fund","description":"Fund the DAO"}}`, []sdk.StringEvent{wasm("juno1proposal", "action", "propose", "proposal_id", "3")}}
+	votes := []msg{
+		{11, "juno1alice", `{"vote":{"proposal_id":3,"vote":"no"}}`, nil},
+		{12, "juno1bob", `{"vote":{"proposal_id":3,"vote":"yes"}}`, nil},
+		{13, "juno1alice", `{"vote":{"proposal_id":3,"vote":"yes"}}`, nil},
+	}
+	execute := msg{14, "juno1bob", `{"execute":{"proposal_id":3}}`, nil}
+
+	// Blocks are processed concurrently, so the msgs may be handled in any order
+	tests := []struct {
+		name string
+		msgs []msg
+	}{
+		{name: "in order", msgs: []msg{propose, votes[0], votes[1], votes[2], execute}},
+		{name: "reverse order", msgs: []msg{execute, votes[2], votes[1], votes[0], propose}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, rec := newTestIndexer(t, "juno-1")
+			a := NewDAODAOAction(zap.NewNop(), false)
+			for _, m := range tt.msgs {
+				msgs := decodeMsgs(t, i, &cosmwasmtypes.MsgExecuteContract{Sender: m.sender, Contract: "juno1proposal", Msg: []byte(m.msg)})
+				logs := sdk.ABCIMessageLogs{{MsgIndex: 0, Events: m.events}}
+				a.HandleMsgs(context.Background(), i, msgs[0], 0, m.height, blockTime, []byte{byte(m.height)}, logs)
+			}
+
+			rows := rec.Rows("dao_proposals")
+			if len(rows) != 1 {
+				t.Fatalf("got %d DAOProposal rows, want 1", len(rows))
+			}
+			want := DAOProposal{
+				ChainID:           "juno-1",
+				ContractAddress:   "juno1proposal",
+				ProposalID:        3,
+				Proposer:          "juno1proposer",
+				Title:             "Fund",
+				Description:       "Fund the DAO",
+				Status:            ProposalStatusExecuted,
+				Height:            10,
+				CreationTime:      blockTime,
+				LastUpdatedHeight: 14,
+			}
+			if got := *rows[0].(*DAOProposal); !reflect.DeepEqual(got, want) {
+				t.Errorf("proposal = %+v, want %+v", got, want)
+			}
+
+			got := make(map[string]DAOVote)
+			for _, row := range rec.Rows("dao_votes") {
+				v := row.(*DAOVote)
+				got[v.Voter] = *v
+			}
+			wantVotes := map[string]DAOVote{
+				"juno1alice": {ChainID: "juno-1", ContractAddress: "juno1proposal", ProposalID: 3, Voter: "juno1alice", Vote: "yes", Height: 13},
+				"juno1bob":   {ChainID: "juno-1", ContractAddress: "juno1proposal", ProposalID: 3, Voter: "juno1bob", Vote: "yes", Height: 12},
+			}
+			if !reflect.DeepEqual(got, wantVotes) {
+				t.Errorf("votes = %+v, want %+v", got, wantVotes)
+			}
+		})
+	}
+}
+
+func TestCW20BalanceOnConflict(t *testing.T) {
+	i, rec := newTestIndexer(t, "juno-1")
+
+	for _, balance := range []string{"5", "7"} {
+		i.Write(BlockActionName, &CW20Balance{Address: "juno1holder", Token: "juno1token", Balance: balance}, func(err error) {
+			if err != nil {
+				t.Errorf("write of balance %s failed: %v", balance, err)
+			}
+		})
+	}
+	i.Write(BlockActionName, &CW20Balance{Address: "juno1other", Token: "juno1token", Balance: "3"}, nil)
+
+	got := make(map[string]string)
+	for _, row := range rec.Rows("cw20_balances") {
+		balance := row.(*CW20Balance)
+		got[balance.Address] = balance.Balance
+	}
+	if expected := map[string]string{"juno1holder": "7", "juno1other": "3"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got balances %v, expected the latest balance of each holder %v", got, expected)
+	}
+}
+
+func TestExecFunds(t *testing.T) {
+	i, rec := newTestIndexer(t, "juno-1")
+	a := NewDAODAOAction(zap.NewNop(), false)
+
+	funds := sdk.NewCoins(sdk.NewInt64Coin("ujuno", 250), sdk.NewInt64Coin("uatom", 3))
+	msgs := decodeMsgs(t, i,
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1buyer", Contract: "juno1market", Msg: []byte(`{"buy":{"token_id":"7"}}`), Funds: funds},
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1alice", Contract: "juno1proposal", Msg: []byte(`{"vote":{"proposal_id":3,"vote":"no"}}`)},
+	)
+	for msgIndex, msg := range msgs {
+		a.HandleMsgs(context.Background(), i, msg, msgIndex, 20, time.Now(), []byte{0x20}, nil)
+	}
+
+	var got []ExecFunds
+	for _, row := range rec.Rows("exec_funds") {
+		got = append(got, *row.(*ExecFunds))
+	}
+	if len(got) != 2 {
+		t.Fatalf("got exec funds %+v, want a row per denom of the funded execute", got)
+	}
+	for j, coin := range funds {
+		f := got[j]
+		f.TxHash = pgtype.Bytea{}
+		want := ExecFunds{ChainID: "juno-1", MsgIndex: 0, Denom: coin.Denom, Amount: coin.Amount.String(), Sender: "juno1buyer", Contract: "juno1market", Height: 20}
+		if !reflect.DeepEqual(f, want) {
+			t.Errorf("exec funds %d = %+v, want %+v", j, f, want)
+		}
+		if string(got[j].TxHash.Bytes) != "\x20" {
+			t.Errorf("exec funds %d has tx hash %X, want 20", j, got[j].TxHash.Bytes)
+		}
+	}
+}
+
+func TestExecMsgsAndCW20Transactions(t *testing.T) {
+	i, rec := newTestIndexer(t, "juno-1")
+	a := NewDAODAOAction(zap.NewNop(), false)
+
+	// {"stake":{}} encoded in base64, the hook msg of a send staking the tokens
+	stake := "eyJzdGFrZSI6e319"
+	msgs := decodeMsgs(t, i,
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1alice", Contract: "juno1token", Msg: []byte(`{"transfer":{"recipient":"juno1bob","amount":"100"}}`)},
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1alice", Contract: "juno1token", Msg: []byte(`{"send":{"contract":"juno1staking","amount":"40","msg":"` + stake + `"}}`)},
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1spender", Contract: "juno1token", Msg: []byte(`{"transfer_from":{"owner":"juno1alice","recipient":"juno1carol","amount":"5"}}`)},
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1bob", Contract: "juno1proposal", Msg: []byte(`{"execute":{"proposal_id":3}}`)},
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1bob", Contract: "juno1market", Msg: []byte(`not json`)},
+	)
+	for msgIndex, msg := range msgs {
+		a.HandleMsgs(context.Background(), i, msg, msgIndex, 30, time.Now(), []byte{0x30}, nil)
+	}
+
+	var execMsgs []ExecMsg
+	for _, row := range rec.Rows("exec_msgs") {
+		m := *row.(*ExecMsg)
+		m.TxHash = pgtype.Bytea{}
+		execMsgs = append(execMsgs, m)
+	}
+	if len(execMsgs) != len(msgs) {
+		t.Fatalf("got exec msgs %+v, want a row per execute msg", execMsgs)
+	}
+	wantActions := []string{"transfer", "send", "transfer_from", "execute", ""}
+	for j, m := range execMsgs {
+		if m.MsgIndex != j || m.ChainID != "juno-1" || m.Height != 30 || m.Action != wantActions[j] {
+			t.Errorf("exec msg %d = %+v, want the %q msg at height 30", j, m, wantActions[j])
+		}
+	}
+	if m := execMsgs[3]; m.Sender != "juno1bob" || m.Address != "juno1proposal" || string(m.Msg.Bytes) != `{"execute":{"proposal_id":3}}` {
+		t.Errorf("proposal execution = %+v, want its raw payload", m)
+	}
+	if m := execMsgs[4]; m.Msg.Status != pgtype.Null {
+		t.Errorf("exec msg with an invalid payload = %+v, want a null msg", m)
+	}
+
+	var got []CW20Transaction
+	for _, row := range rec.Rows("cw20_transactions") {
+		tx := *row.(*CW20Transaction)
+		tx.ID, tx.TxHash = 0, pgtype.Bytea{}
+		got = append(got, tx)
+	}
+	want := []CW20Transaction{
+		{ChainID: "juno-1", MsgIndex: 0, Action: actionTransfer, CW20Address: "juno1token", SenderAddress: "juno1alice", RecipientAddress: "juno1bob", Amount: "100", Height: 30},
+		{ChainID: "juno-1", MsgIndex: 1, Action: actionStake, CW20Address: "juno1token", SenderAddress: "juno1alice", RecipientAddress: "juno1staking", Amount: "40", Height: 30},
+		{ChainID: "juno-1", MsgIndex: 2, Action: actionTransferFrom, CW20Address: "juno1token", SenderAddress: "juno1alice", RecipientAddress: "juno1carol", Amount: "5", Height: 30},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cw20 transactions = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleExecuteWriteError(t *testing.T) {
+	i, rec := newTestIndexer(t, "juno-1")
+	a := NewDAODAOAction(zap.NewNop(), false)
+
+	msgs := decodeMsgs(t, i,
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1alice", Contract: "juno1token", Msg: []byte(`{"transfer":{"recipient":"juno1bob","amount":"100"}}`)},
+		&cosmwasmtypes.MsgExecuteContract{Sender: "juno1bob", Contract: "juno1market", Msg: []byte(`{"vote":"not an object"}`)},
+	)
+
+	// A failed write is returned, so the block transaction is rolled back instead of keeping the rows written before it
+	failed := errors.New("insert failed")
+	rec.Fail("cw20_balances", failed)
+	if err := a.HandleMsgs(context.Background(), i, msgs[0], 0, 30, time.Now(), []byte{0x30}, nil); !errors.Is(err, failed) {
+		t.Errorf("HandleMsgs returned %v, want %v", err, failed)
+	}
+
+	// A payload that fails to be decoded is only logged
+	rec.Fail("cw20_balances", nil)
+	if err := a.HandleMsgs(context.Background(), i, msgs[1], 1, 30, time.Now(), []byte{0x30}, nil); err != nil {
+		t.Errorf("HandleMsgs returned unexpected error: %v", err)
+	}
+}
+
+func TestCW20BalanceChanges(t *testing.T) {
+	// change is the expected chain id, address and balance change of a CW20Balance
+	type change struct {
+		chainID, address, balance string
+	}
+	tests := []struct {
+		name    string
+		tx      *CW20Transaction
+		want    []change
+		wantErr bool
+	}{
+		{
+			name: "transfer",
+			tx:   &CW20Transaction{ChainID: "juno-1", Action: actionTransfer, SenderAddress: "juno1bob", RecipientAddress: "juno1alice", Amount: "10"},
+			want: []change{{"juno-1", "juno1alice", "10"}, {"juno-1", "juno1bob", "-10"}},
+		},
+		{
+			name: "mint",
+			tx:   &CW20Transaction{ChainID: "juno-1", Action: actionMint, SenderAddress: "juno1minter", RecipientAddress: "juno1alice", Amount: "5"},
+			want: []change{{"juno-1", "juno1alice", "5"}},
+		},
+		{
+			name: "burn",
+			tx:   &CW20Transaction{ChainID: "uni-3", Action: actionBurn, SenderAddress: "juno1alice", Amount: "7"},
+			want: []change{{"uni-3", "juno1alice", "-7"}},
+		},
+		{
+			name: "transfer_from",
+			tx:   &CW20Transaction{ChainID: "juno-1", Action: actionTransferFrom, SenderAddress: "juno1carol", RecipientAddress: "juno1bob", Amount: "3"},
+			want: []change{{"juno-1", "juno1bob", "3"}, {"juno-1", "juno1carol", "-3"}},
+		},
+		{
+			name: "send_from",
+			tx:   &CW20Transaction{ChainID: "juno-1", Action: actionSendFrom, SenderAddress: "juno1carol", RecipientAddress: "juno1dao", Amount: "4"},
+			want: []change{{"juno-1", "juno1carol", "-4"}, {"juno-1", "juno1dao", "4"}},
+		},
+		{
+			name: "burn_from",
+			tx:   &CW20Transaction{ChainID: "juno-1", Action: actionBurnFrom, SenderAddress: "juno1carol", Amount: "2"},
+			want: []change{{"juno-1", "juno1carol", "-2"}},
+		},
+		{
+			name: "max Uint128",
+			tx:   &CW20Transaction{ChainID: "juno-1", Action: actionSend, SenderAddress: "juno1alice", RecipientAddress: "juno1dao", Amount: maxUint128},
+			want: []change{{"juno-1", "juno1alice", "-" + maxUint128}, {"juno-1", "juno1dao", maxUint128}},
+		},
+		{
+			name:    "invalid amount",
+			tx:      &CW20Transaction{ChainID: "juno-1", Action: actionTransfer, SenderAddress: "juno1bob", RecipientAddress: "juno1alice", Amount: "1.5"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		changes, err := CW20BalanceChanges(tt.tx)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: CW20BalanceChanges returned no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: CW20BalanceChanges returned unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(changes) != len(tt.want) {
+			t.Errorf("%s: got %d changes, want %d", tt.name, len(changes), len(tt.want))
+			continue
+		}
+		for j, c := range changes {
+			got := change{c.ChainID, c.Address, c.Balance}
+			if got != tt.want[j] || c.Token != tt.tx.CW20Address {
+				t.Errorf("%s: change %d = %+v of token %q, want %+v", tt.name, j, got, c.Token, tt.want[j])
+			}
+		}
+	}
+}
+
+func TestCW20Balances(t *testing.T) {
+	i, rec := newTestIndexer(t, "juno-1")
+	a := NewDAODAOAction(zap.NewNop(), true)
+
+	execute := func(height int64, sender, msg string) {
+		msgs := decodeMsgs(t, i, &cosmwasmtypes.MsgExecuteContract{Sender: sender, Contract: "juno1token", Msg: []byte(msg)})
+		a.HandleMsgs(context.Background(), i, msgs[0], 0, height, time.Now(), []byte{byte(height)}, nil)
+	}
+	execute(10, "juno1minter", `{"mint":{"recipient":"juno1alice","amount":"100"}}`)
+	execute(11, "juno1alice", `{"transfer":{"recipient":"juno1bob","amount":"30"}}`)
+	execute(12, "juno1bob", `{"transfer":{"recipient":"juno1carol","amount":"10"}}`)
+	// Indexing a block again doesn't apply its transfer twice
+	execute(12, "juno1bob", `{"transfer":{"recipient":"juno1carol","amount":"10"}}`)
+
+	got := make(map[string]string)
+	for _, row := range rec.Rows("cw20_balances") {
+		balance := row.(*CW20Balance)
+		if balance.Token != "juno1token" {
+			t.Errorf("balance %+v of another token, want juno1token", balance)
+		}
+		got[balance.Address] = balance.Balance
+	}
+	if want := map[string]string{"juno1alice": "70", "juno1bob": "20", "juno1carol": "10"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got balances %v, want %v", got, want)
+	}
+	if !a.Sequential() {
+		t.Error("action created with sequential blocks isn't sequential")
+	}
+}
+
+// maxUint128 is the largest CW20 amount, which doesn't fit in an int64.
+const maxUint128 = "340282366920938463463374607431768211455"
+
+func TestNewCW20Transaction(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		wantAction    string
+		wantAmount    string
+		wantSender    string
+		wantRecipient string
+		wantErr       bool
+	}{
+		{name: "transfer", payload: `{"transfer":{"recipient":"juno1bob","amount":"42"}}`, wantAction: actionTransfer, wantAmount: "42", wantSender: "juno1alice", wantRecipient: "juno1bob"},
+		{name: "max Uint128", payload: `{"mint":{"recipient":"juno1bob","amount":"` + maxUint128 + `"}}`, wantAction: actionMint, wantAmount: maxUint128, wantSender: "juno1alice", wantRecipient: "juno1bob"},
+		// The allowance msgs move the tokens of the owner rather than the sender's
+		{name: "transfer_from", payload: `{"transfer_from":{"owner":"juno1carol","recipient":"juno1bob","amount":"3"}}`, wantAction: actionTransferFrom, wantAmount: "3", wantSender: "juno1carol", wantRecipient: "juno1bob"},
+		{name: "send_from", payload: `{"send_from":{"owner":"juno1carol","contract":"juno1dao","amount":"4","msg":""}}`, wantAction: actionSendFrom, wantAmount: "4", wantSender: "juno1carol", wantRecipient: "juno1dao"},
+		{name: "burn_from", payload: `{"burn_from":{"owner":"juno1carol","amount":"2"}}`, wantAction: actionBurnFrom, wantAmount: "2", wantSender: "juno1carol"},
+		{name: "not a cw20 msg", payload: `{"vote":{"proposal_id":1}}`},
+		{name: "negative amount", payload: `{"burn":{"amount":"-1"}}`, wantErr: true},
+		{name: "invalid amount", payload: `{"burn":{"amount":"many"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var payload map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.payload), &payload); err != nil {
+			t.Fatalf("%s: invalid payload: %v", tt.name, err)
+		}
+		msg := &cosmwasmtypes.MsgExecuteContract{Sender: "juno1alice", Contract: "juno1token", Msg: []byte(tt.payload)}
+
+		tx, err := NewCW20Transaction("juno-1", msg, payload, 0, 100, []byte{0x01})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: NewCW20Transaction returned no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: NewCW20Transaction returned unexpected error: %v", tt.name, err)
+			continue
+		}
+		if tt.wantAction == "" {
+			if tx != nil {
+				t.Errorf("%s: got %+v, want no transaction", tt.name, tx)
+			}
+			continue
+		}
+		if tx == nil || tx.Action != tt.wantAction || tx.Amount != tt.wantAmount || tx.SenderAddress != tt.wantSender || tx.RecipientAddress != tt.wantRecipient {
+			t.Errorf("%s: got %+v, want a %s of %s from %q to %q", tt.name, tx, tt.wantAction, tt.wantAmount, tt.wantSender, tt.wantRecipient)
+		}
+	}
+}
+
+func TestReconcileRequiresSequentialBlocks(t *testing.T) {
+	a := NewDAODAOAction(zap.NewNop(), false)
+	if err := a.Reconcile(context.Background(), nil); !errors.Is(err, errNotSequential) {
+		t.Errorf("Reconcile without sequential blocks returned %v, want %v", err, errNotSequential)
+	}
+}
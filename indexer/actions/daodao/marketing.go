@@ -0,0 +1,213 @@
+package daodao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	cosmwasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	"github.com/jackc/pgtype"
+	"github.com/strangelove-ventures/valis/indexer"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+)
+
+// maxLogoSize matches the size cap cw20-base enforces on embedded logos, larger logos aren't stored.
+const maxLogoSize = 5 * 1024
+
+// The mime types of the embedded logos supported by cw20-base.
+const (
+	logoMimeTypeSVG = "image/svg+xml"
+	logoMimeTypePNG = "image/png"
+)
+
+// The smart queries of cw20-base compatible contracts used for indexing the marketing info of gov tokens.
+var (
+	tokenInfoQuery     = []byte(`{"token_info":{}}`)
+	marketingInfoQuery = []byte(`{"marketing_info":{}}`)
+	downloadLogoQuery  = []byte(`{"download_logo":{}}`)
+)
+
+type tokenInfoResponse struct {
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+// marketingInfoResponse is the cw20 marketing info, Logo is either {"url":"..."}, "embedded" or null.
+type marketingInfoResponse struct {
+	Project     string          `json:"project"`
+	Description string          `json:"description"`
+	Logo        json.RawMessage `json:"logo"`
+	Marketing   string          `json:"marketing"`
+}
+
+type downloadLogoResponse struct {
+	MimeType string `json:"mime_type"`
+	Data     []byte `json:"data"`
+}
+
+// SmartQuerier runs a smart query against a contract at the specified height, it's satisfied by QuerySmartContract
+// and allows the marketing info to be indexed from mocked contract responses.
+type SmartQuerier func(ctx context.Context, contract string, height int64, query []byte) ([]byte, error)
+
+// QuerySmartContract returns a SmartQuerier running the smart queries against the indexer's chain,
+// each bounded by the Query timeout.
+func QuerySmartContract(indexer *indexer.Indexer) SmartQuerier {
+	return func(ctx context.Context, contract string, height int64, query []byte) ([]byte, error) {
+		if indexer.Timeouts.Query > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, indexer.Timeouts.Query)
+			defer cancel()
+		}
+
+		// Query the state as of the indexed block, rather than the latest state
+		ctx = metadata.AppendToOutgoingContext(ctx, grpctypes.GRPCBlockHeightHeader, strconv.FormatInt(height, 10))
+
+		res, err := cosmwasmtypes.NewQueryClient(indexer.Client).SmartContractState(ctx, &cosmwasmtypes.QuerySmartContractStateRequest{
+			Address:   contract,
+			QueryData: query,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res.Data, nil
+	}
+}
+
+// IndexMarketingInfo queries the token and marketing info of the CW20 gov token at contract, along with its logo,
+// and stores them. The Marketing, Logo and GovToken of the contract are created if they aren't known yet, otherwise
+// they're updated in place. Logos that can't be downloaded or are too large are logged and left out, or left as they
+// were indexed before.
+func (a *DAODAOAction) IndexMarketingInfo(ctx context.Context, db *gorm.DB, query SmartQuerier, chainID, contract string, height int64) error {
+	var tokenInfo tokenInfoResponse
+	if err := smartQueryJSON(ctx, query, contract, height, tokenInfoQuery, &tokenInfo); err != nil {
+		return fmt.Errorf("failed to query token info: %w", err)
+	}
+
+	var marketingInfo marketingInfoResponse
+	if err := smartQueryJSON(ctx, query, contract, height, marketingInfoQuery, &marketingInfo); err != nil {
+		return fmt.Errorf("failed to query marketing info: %w", err)
+	}
+
+	logo, logoErr := a.fetchLogo(ctx, query, contract, height, marketingInfo.Logo)
+	if logoErr != nil {
+		a.log.Info(
+			"Failed to fetch CW20 logo",
+			zap.String("contract", contract),
+			zap.Int64("height", height),
+			zap.Error(logoErr),
+		)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var marketing Marketing
+		err := tx.Where("chain_id = ? AND contract = ?", chainID, contract).Limit(1).Find(&marketing).Error
+		if err != nil {
+			return err
+		}
+
+		var existingLogo Logo
+		err = tx.Where("chain_id = ? AND contract = ?", chainID, contract).Limit(1).Find(&existingLogo).Error
+		if err != nil {
+			return err
+		}
+		switch {
+		case logo != nil:
+			logo.ID = existingLogo.ID
+			logo.ChainID = chainID
+			logo.Contract = contract
+			if err := tx.Save(logo).Error; err != nil {
+				return err
+			}
+			marketing.LogoID = logo.ID
+		case existingLogo.ID != 0 && logoErr == nil:
+			// The logo was unset, a logo failing to be fetched is kept as is
+			if err := tx.Delete(&existingLogo).Error; err != nil {
+				return err
+			}
+			marketing.LogoID = 0
+		}
+
+		marketing.ChainID = chainID
+		marketing.Contract = contract
+		marketing.Project = marketingInfo.Project
+		marketing.Description = marketingInfo.Description
+		marketing.MarketingText = marketingInfo.Marketing
+		if err := tx.Save(&marketing).Error; err != nil {
+			return err
+		}
+
+		var govToken GovToken
+		err = tx.Where("chain_id = ? AND address = ?", chainID, contract).Limit(1).Find(&govToken).Error
+		if err != nil {
+			return err
+		}
+		govToken.ChainID = chainID
+		govToken.Address = contract
+		govToken.Name = tokenInfo.Name
+		govToken.Symbol = tokenInfo.Symbol
+		govToken.Decimals = tokenInfo.Decimals
+		govToken.MarketingID = marketing.ID
+		return tx.Save(&govToken).Error
+	})
+}
+
+// fetchLogo returns the Logo described by the logo of the marketing info, downloading embedded logos.
+// A nil Logo without an error is returned when no logo is set.
+func (a *DAODAOAction) fetchLogo(ctx context.Context, query SmartQuerier, contract string, height int64, info json.RawMessage) (*Logo, error) {
+	if len(info) == 0 || string(info) == "null" {
+		return nil, nil
+	}
+
+	var embedded string
+	if err := json.Unmarshal(info, &embedded); err == nil {
+		if embedded != "embedded" {
+			return nil, fmt.Errorf("unknown logo kind %q", embedded)
+		}
+
+		var download downloadLogoResponse
+		if err := smartQueryJSON(ctx, query, contract, height, downloadLogoQuery, &download); err != nil {
+			return nil, fmt.Errorf("failed to download logo: %w", err)
+		}
+		if len(download.Data) > maxLogoSize {
+			return nil, fmt.Errorf("logo of %d bytes exceeds the %d bytes limit", len(download.Data), maxLogoSize)
+		}
+
+		switch download.MimeType {
+		case logoMimeTypeSVG:
+			return &Logo{SVG: string(download.Data), PNG: pgtype.Bytea{Status: pgtype.Null}}, nil
+		case logoMimeTypePNG:
+			logo := &Logo{}
+			if err := logo.PNG.Set(download.Data); err != nil {
+				return nil, err
+			}
+			return logo, nil
+		default:
+			return nil, fmt.Errorf("unsupported logo mime type %q", download.MimeType)
+		}
+	}
+
+	var url struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(info, &url); err != nil {
+		return nil, fmt.Errorf("failed to decode logo info: %w", err)
+	}
+	if url.URL == "" {
+		return nil, nil
+	}
+	return &Logo{URL: url.URL, PNG: pgtype.Bytea{Status: pgtype.Null}}, nil
+}
+
+// smartQueryJSON runs the smart query and decodes the JSON response into resp.
+func smartQueryJSON(ctx context.Context, query SmartQuerier, contract string, height int64, q []byte, resp interface{}) error {
+	data, err := query(ctx, contract, height, q)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, resp)
+}
@@ -0,0 +1,208 @@
+package daodao
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgtype"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"go.uber.org/zap"
+)
+
+const govTokenContract = "juno1govtoken"
+
+// mockContract returns a SmartQuerier answering the cw20 queries of govTokenContract with the marketing info logo
+// and the embedded logo, if any. Every query made is counted in queries.
+func mockContract(t *testing.T, logo string, download *downloadLogoResponse, queries map[string]int) SmartQuerier {
+	return func(ctx context.Context, contract string, height int64, query []byte) ([]byte, error) {
+		if contract != govTokenContract || height != 10 {
+			t.Errorf("got query of contract %s at height %d, want %s at height 10", contract, height, govTokenContract)
+		}
+		queries[string(query)]++
+
+		switch {
+		case bytes.Equal(query, tokenInfoQuery):
+			return []byte(`{"name":"DAO token","symbol":"DAO","decimals":6,"total_supply":"1000"}`), nil
+		case bytes.Equal(query, marketingInfoQuery):
+			return []byte(fmt.Sprintf(`{"project":"dao.zone","description":"Governance","marketing":"juno1marketing","logo":%s}`, logo)), nil
+		case bytes.Equal(query, downloadLogoQuery) && download != nil:
+			return json.Marshal(download)
+		}
+		return nil, fmt.Errorf("unsupported query %s", query)
+	}
+}
+
+func TestIndexMarketingInfo(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}
+	svg := `<svg xmlns="http://www.w3.org/2000/svg"/>`
+
+	tests := []struct {
+		name     string
+		logo     string
+		download *downloadLogoResponse
+		expected *Logo
+	}{
+		{
+			name:     "embedded png",
+			logo:     `"embedded"`,
+			download: &downloadLogoResponse{MimeType: logoMimeTypePNG, Data: png},
+			expected: &Logo{PNG: pgtype.Bytea{Bytes: png, Status: pgtype.Present}},
+		},
+		{
+			name:     "embedded svg",
+			logo:     `"embedded"`,
+			download: &downloadLogoResponse{MimeType: logoMimeTypeSVG, Data: []byte(svg)},
+			expected: &Logo{SVG: svg, PNG: pgtype.Bytea{Status: pgtype.Null}},
+		},
+		{
+			name:     "url",
+			logo:     `{"url":"https://dao.zone/logo.png"}`,
+			expected: &Logo{URL: "https://dao.zone/logo.png", PNG: pgtype.Bytea{Status: pgtype.Null}},
+		},
+		{
+			name: "no logo",
+			logo: `null`,
+		},
+		{
+			name:     "logo too large",
+			logo:     `"embedded"`,
+			download: &downloadLogoResponse{MimeType: logoMimeTypePNG, Data: make([]byte, maxLogoSize+1)},
+		},
+		{
+			name: "logo download failing",
+			logo: `"embedded"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := dbtest.New(t)
+			a := NewDAODAOAction(zap.NewNop(), false)
+			queries := make(map[string]int)
+
+			query := mockContract(t, tt.logo, tt.download, queries)
+			if err := a.IndexMarketingInfo(context.Background(), db, query, "juno-1", govTokenContract, 10); err != nil {
+				t.Fatalf("IndexMarketingInfo returned unexpected error: %v", err)
+			}
+
+			logos := rec.Rows("logos")
+			switch {
+			case tt.expected == nil && len(logos) != 0:
+				t.Errorf("got logos %+v, expected none", logos)
+			case tt.expected != nil && len(logos) != 1:
+				t.Fatalf("got %d logos, expected 1", len(logos))
+			case tt.expected != nil:
+				got := logos[0].(*Logo)
+				if got.URL != tt.expected.URL || got.SVG != tt.expected.SVG || got.PNG.Status != tt.expected.PNG.Status ||
+					!bytes.Equal(got.PNG.Bytes, tt.expected.PNG.Bytes) {
+					t.Errorf("got logo %+v, expected %+v", got, tt.expected)
+				}
+			}
+			if embedded := tt.logo == `"embedded"`; (queries[string(downloadLogoQuery)] == 1) != embedded {
+				t.Errorf("logo downloaded %d times, expected only embedded logos to be downloaded", queries[string(downloadLogoQuery)])
+			}
+
+			marketing := rec.Rows("marketings")
+			if len(marketing) != 1 {
+				t.Fatalf("got %d marketing rows, expected 1", len(marketing))
+			}
+			m := marketing[0].(*Marketing)
+			if m.Project != "dao.zone" || m.Description != "Governance" || m.MarketingText != "juno1marketing" {
+				t.Errorf("got marketing %+v, expected the marketing info of the contract", m)
+			}
+			if tt.expected != nil && m.LogoID != logos[0].(*Logo).ID {
+				t.Errorf("got marketing logo id %d, expected %d", m.LogoID, logos[0].(*Logo).ID)
+			}
+
+			govTokens := rec.Rows("gov_tokens")
+			if len(govTokens) != 1 {
+				t.Fatalf("got %d gov tokens, expected 1", len(govTokens))
+			}
+			g := govTokens[0].(*GovToken)
+			if g.ChainID != "juno-1" || g.Address != govTokenContract || g.Name != "DAO token" || g.Symbol != "DAO" || g.Decimals != 6 || g.MarketingID != m.ID {
+				t.Errorf("got gov token %+v, expected the token info pointing at marketing %d", g, m.ID)
+			}
+		})
+	}
+}
+
+func TestIndexMarketingInfoUpdatesInPlace(t *testing.T) {
+	db, rec := dbtest.New(t)
+	a := NewDAODAOAction(zap.NewNop(), false)
+	svg := `<svg xmlns="http://www.w3.org/2000/svg"/>`
+
+	// Each update_marketing or upload_logo msg indexes the marketing info again, the rows of the contract are updated
+	// rather than added, and only a logo that was unset is removed
+	steps := []struct {
+		name     string
+		chainID  string
+		logo     string
+		download *downloadLogoResponse
+		expected *Logo
+	}{
+		{name: "url", chainID: "juno-1", logo: `{"url":"https://dao.zone/logo.png"}`, expected: &Logo{URL: "https://dao.zone/logo.png"}},
+		{name: "uploaded logo", chainID: "juno-1", logo: `"embedded"`, download: &downloadLogoResponse{MimeType: logoMimeTypeSVG, Data: []byte(svg)}, expected: &Logo{SVG: svg}},
+		{name: "logo download failing", chainID: "juno-1", logo: `"embedded"`, expected: &Logo{SVG: svg}},
+		{name: "logo unset", chainID: "juno-1", logo: `null`},
+		{name: "same contract on another chain", chainID: "juno-2", logo: `{"url":"https://dao.zone/logo.png"}`, expected: &Logo{URL: "https://dao.zone/logo.png"}},
+	}
+	for _, step := range steps {
+		query := mockContract(t, step.logo, step.download, make(map[string]int))
+		if err := a.IndexMarketingInfo(context.Background(), db, query, step.chainID, govTokenContract, 10); err != nil {
+			t.Fatalf("%s: IndexMarketingInfo returned unexpected error: %v", step.name, err)
+		}
+
+		marketing := marketingOf(rec, step.chainID)
+		if len(marketing) != 1 {
+			t.Fatalf("%s: got %d marketing rows of %s, expected 1", step.name, len(marketing), step.chainID)
+		}
+		if govTokens := govTokensOf(rec, step.chainID); len(govTokens) != 1 || govTokens[0].MarketingID != marketing[0].ID {
+			t.Errorf("%s: got gov tokens %+v of %s, expected one pointing at marketing %d", step.name, govTokens, step.chainID, marketing[0].ID)
+		}
+
+		var logos []*Logo
+		for _, row := range rec.Rows("logos") {
+			if logo := row.(*Logo); logo.ChainID == step.chainID {
+				logos = append(logos, logo)
+			}
+		}
+		switch {
+		case step.expected == nil:
+			if len(logos) != 0 || marketing[0].LogoID != 0 {
+				t.Errorf("%s: got logos %+v and marketing logo id %d, expected no logo", step.name, logos, marketing[0].LogoID)
+			}
+		case len(logos) != 1:
+			t.Errorf("%s: got %d logos of %s, expected 1", step.name, len(logos), step.chainID)
+		case logos[0].URL != step.expected.URL || logos[0].SVG != step.expected.SVG || marketing[0].LogoID != logos[0].ID:
+			t.Errorf("%s: got logo %+v with marketing logo id %d, expected %+v", step.name, logos[0], marketing[0].LogoID, step.expected)
+		}
+	}
+
+	if marketing := rec.Rows("marketings"); len(marketing) != 2 {
+		t.Errorf("got %d marketing rows, expected one per chain", len(marketing))
+	}
+}
+
+// marketingOf returns the Marketing rows of govTokenContract on chainID.
+func marketingOf(rec *dbtest.Recorder, chainID string) []*Marketing {
+	var marketing []*Marketing
+	for _, row := range rec.Rows("marketings") {
+		if m := row.(*Marketing); m.ChainID == chainID && m.Contract == govTokenContract {
+			marketing = append(marketing, m)
+		}
+	}
+	return marketing
+}
+
+// govTokensOf returns the GovToken rows of govTokenContract on chainID.
+func govTokensOf(rec *dbtest.Recorder, chainID string) []*GovToken {
+	var govTokens []*GovToken
+	for _, row := range rec.Rows("gov_tokens") {
+		if g := row.(*GovToken); g.ChainID == chainID && g.Address == govTokenContract {
+			govTokens = append(govTokens, g)
+		}
+	}
+	return govTokens
+}
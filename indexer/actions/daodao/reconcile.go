@@ -0,0 +1,183 @@
+package daodao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/strangelove-ventures/valis/indexer"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reconcileBatchSize is the number of CW20Balance rows loaded at once while reconciling.
+const reconcileBatchSize = 100
+
+type balanceQueryMsg struct {
+	Balance struct {
+		Address string `json:"address"`
+	} `json:"balance"`
+}
+
+type balanceResponse struct {
+	Balance string `json:"balance"`
+}
+
+// errNotSequential is returned by Reconcile when blocks may be applied out of order.
+var errNotSequential = errors.New("CW20 balances can only be reconciled with daodao.sequential-blocks enabled")
+
+// Reconcile corrects the CW20 balances of the tokens on the indexer's chain against the contracts' state at the
+// highest height up to which every block was indexed. The balances only reflect the state at that height when blocks
+// are applied in order and none above it were indexed yet, so reconciling is refused unless the action is Sequential
+// and skipped while blocks below the checkpoint are missing, e.g. while failed blocks are being retried.
+func (a *DAODAOAction) Reconcile(ctx context.Context, indexer *indexer.Indexer) error {
+	if !a.sequential {
+		return errNotSequential
+	}
+
+	height, ok, err := indexer.ContiguousIndexedHeight(a.Name())
+	if err != nil {
+		return fmt.Errorf("failed to load contiguous indexed height: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+	checkpoint, _, err := indexer.Checkpoint(a.Name())
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	if checkpoint != height {
+		a.log.Info(
+			"Skipping CW20 balance reconciliation while blocks below the checkpoint are missing",
+			zap.String("chain_id", indexer.Client.Config.ChainID),
+			zap.Int64("contiguous_height", height),
+			zap.Int64("checkpoint", checkpoint),
+		)
+		return nil
+	}
+
+	corrected, err := a.ReconcileCW20Balances(ctx, indexer.DB, QuerySmartContract(indexer), indexer.Client.Config.ChainID, height)
+	if err != nil {
+		return err
+	}
+
+	a.log.Info(
+		"Reconciled CW20 balances",
+		zap.String("chain_id", indexer.Client.Config.ChainID),
+		zap.Int64("height", height),
+		zap.Int("corrected", corrected),
+	)
+	return nil
+}
+
+// ReconcileCW20Balances queries the balance of every tracked CW20Balance on the specified chain from the token
+// contract at height and corrects the rows that differ. Each discrepancy is logged since it means events affecting
+// the balance were missed. The number of corrected rows is returned.
+//
+// height must be the action's checkpoint, a row is only corrected while the checkpoint is still at height, so the
+// blocks indexed meanwhile aren't overwritten. Without indexer.BlockTransactions a block's balances are adjusted
+// before its checkpoint is saved, so a balance loaded in between may still be corrected to the earlier state.
+func (a *DAODAOAction) ReconcileCW20Balances(ctx context.Context, db *gorm.DB, query SmartQuerier, chainID string, height int64) (int, error) {
+	var (
+		corrected int
+		balances  []CW20Balance
+	)
+	result := db.Where("chain_id = ?", chainID).FindInBatches(&balances, reconcileBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, b := range balances {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			actual, err := queryCW20Balance(ctx, query, b.Token, b.Address, height)
+			if err != nil {
+				a.log.Debug(
+					"Failed to query CW20 balance",
+					zap.String("token", b.Token),
+					zap.String("address", b.Address),
+					zap.Int64("height", height),
+					zap.Error(err),
+				)
+				continue
+			}
+			indexed, ok := sdk.NewIntFromString(b.Balance)
+			if ok && actual.Equal(indexed) {
+				continue
+			}
+
+			a.log.Warn(
+				"CW20 balance drifted from contract state, events affecting it were missed",
+				zap.String("token", b.Token),
+				zap.String("address", b.Address),
+				zap.Int64("height", height),
+				zap.String("indexed_balance", b.Balance),
+				zap.String("actual_balance", actual.String()),
+			)
+
+			ok, err = a.correctCW20Balance(db, chainID, height, b, actual)
+			if err != nil {
+				return err
+			}
+			if ok {
+				corrected++
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return corrected, fmt.Errorf("failed to reconcile CW20 balances: %w", result.Error)
+	}
+	return corrected, nil
+}
+
+// correctCW20Balance sets the balance b to actual, the balance at height, unless it was updated since it was loaded
+// or the action's checkpoint moved past height meanwhile. The checkpoint is locked until the balance is corrected.
+func (a *DAODAOAction) correctCW20Balance(db *gorm.DB, chainID string, height int64, b CW20Balance, actual sdk.Int) (bool, error) {
+	var corrected bool
+	err := db.Transaction(func(dbTx *gorm.DB) error {
+		var checkpoints []int64
+		if err := dbTx.Model(&indexer.IndexProgress{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("chain_id = ? AND action_name = ?", chainID, a.Name()).
+			Pluck("last_indexed_height", &checkpoints).Error; err != nil {
+			return err
+		}
+		if len(checkpoints) == 0 || checkpoints[0] != height {
+			return nil
+		}
+
+		res := dbTx.Model(&CW20Balance{}).Where("id = ? AND balance = ?", b.ID, b.Balance).Update("balance", actual.String())
+		corrected = res.RowsAffected > 0
+		return res.Error
+	})
+	return corrected, err
+}
+
+// queryCW20Balance queries the balance of address from the CW20 token contract at height.
+func queryCW20Balance(ctx context.Context, query SmartQuerier, token, address string, height int64) (sdk.Int, error) {
+	var msg balanceQueryMsg
+	msg.Balance.Address = address
+	queryData, err := json.Marshal(msg)
+	if err != nil {
+		return sdk.Int{}, err
+	}
+
+	data, err := query(ctx, token, height, queryData)
+	if err != nil {
+		return sdk.Int{}, err
+	}
+
+	var res balanceResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return sdk.Int{}, fmt.Errorf("failed to decode balance response: %w", err)
+	}
+
+	// CW20 balances are Uint128 strings
+	balance, ok := sdk.NewIntFromString(res.Balance)
+	if !ok || balance.IsNegative() {
+		return sdk.Int{}, fmt.Errorf("invalid balance %q", res.Balance)
+	}
+	return balance, nil
+}
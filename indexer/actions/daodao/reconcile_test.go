@@ -0,0 +1,81 @@
+package daodao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"go.uber.org/zap"
+)
+
+func TestReconcileCW20Balances(t *testing.T) {
+	db, rec := dbtest.New(t)
+	a := NewDAODAOAction(zap.NewNop(), false)
+
+	seeded := []CW20Balance{
+		{ChainID: "juno-1", Address: "juno1alice", Token: "juno1token", Balance: "100"},
+		// Drifted from the contract state, e.g. a missed transfer
+		{ChainID: "juno-1", Address: "juno1bob", Token: "juno1token", Balance: "50"},
+		// The balance query of carol fails
+		{ChainID: "juno-1", Address: "juno1carol", Token: "juno1token", Balance: "5"},
+		// A token of another chain
+		{ChainID: "uni-3", Address: "juno1bob", Token: "juno1token", Balance: "1"},
+	}
+	if err := db.Create(&seeded).Error; err != nil {
+		t.Fatalf("failed to seed CW20 balances: %v", err)
+	}
+	checkpoint := &indexer.IndexProgress{ChainID: "juno-1", ActionName: BlockActionName, LastIndexedHeight: 10}
+	if err := db.Create(checkpoint).Error; err != nil {
+		t.Fatalf("failed to seed checkpoint: %v", err)
+	}
+
+	// The contract balance of bob doesn't fit in an int64
+	actual := map[string]string{"juno1alice": "100", "juno1bob": maxUint128}
+	query := func(ctx context.Context, contract string, height int64, query []byte) ([]byte, error) {
+		if contract != "juno1token" || height != 10 {
+			t.Errorf("got balance query of contract %s at height %d, want juno1token at height 10", contract, height)
+		}
+		var msg balanceQueryMsg
+		if err := json.Unmarshal(query, &msg); err != nil {
+			return nil, err
+		}
+		balance, ok := actual[msg.Balance.Address]
+		if !ok {
+			return nil, fmt.Errorf("query failed for %s", msg.Balance.Address)
+		}
+		return json.Marshal(balanceResponse{Balance: balance})
+	}
+
+	corrected, err := a.ReconcileCW20Balances(context.Background(), db, query, "juno-1", 10)
+	if err != nil {
+		t.Fatalf("ReconcileCW20Balances returned unexpected error: %v", err)
+	}
+	if corrected != 1 {
+		t.Errorf("corrected %d balances, want only the drifted balance", corrected)
+	}
+
+	var got []string
+	for _, row := range rec.Rows("cw20_balances") {
+		got = append(got, row.(*CW20Balance).Balance)
+	}
+	if expected := []string{"100", maxUint128, "5", "1"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got balances %v, expected %v", got, expected)
+	}
+
+	// Once blocks above height were indexed the balances no longer reflect the state at height
+	actual["juno1alice"] = "90"
+	if err := db.Model(checkpoint).Update("last_indexed_height", 11).Error; err != nil {
+		t.Fatalf("failed to move checkpoint: %v", err)
+	}
+	corrected, err = a.ReconcileCW20Balances(context.Background(), db, query, "juno-1", 10)
+	if err != nil {
+		t.Fatalf("ReconcileCW20Balances returned unexpected error: %v", err)
+	}
+	if corrected != 0 {
+		t.Errorf("corrected %d balances after the checkpoint moved past the height, want none", corrected)
+	}
+}
@@ -0,0 +1,354 @@
+package gov
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	distrtypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	paramsproposal "github.com/cosmos/cosmos-sdk/x/params/types/proposal"
+	upgradetypes "github.com/cosmos/cosmos-sdk/x/upgrade/types"
+	"github.com/jackc/pgtype"
+	"github.com/strangelove-ventures/valis/indexer"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "governance"
+
+// GovAction implements the indexer.BlockAction interface, it indexes the proposals, votes and deposits
+// of the gov module.
+type GovAction struct {
+	actionName string
+	log        *zap.Logger
+}
+
+// NewGovAction returns a new GovAction block action to be used by the indexer.
+func NewGovAction(log *zap.Logger) *GovAction {
+	return &GovAction{
+		actionName: BlockActionName,
+		log:        log,
+	}
+}
+
+// Name returns the block action name for identifying this action.
+func (a *GovAction) Name() string {
+	return a.actionName
+}
+
+// MigrateSchema runs schema migrations for the specified models.
+func (a *GovAction) MigrateSchema(indexer *indexer.Indexer) error {
+	return indexer.DB.AutoMigrate(
+		&GovProposal{},
+		&GovVote{},
+		&GovDeposit{},
+		&GovDepositSettlement{},
+	)
+}
+
+// SchemaVersion implements indexer.SchemaVersioner, version 2 added the deposit settlements.
+func (a *GovAction) SchemaVersion() int {
+	return 2
+}
+
+// MsgTypes returns the type URLs of the msgs handled by this action, txs without any of them are skipped.
+func (a *GovAction) MsgTypes() []string {
+	return []string{
+		sdk.MsgTypeURL(&govtypes.MsgSubmitProposal{}),
+		sdk.MsgTypeURL(&govtypes.MsgVote{}),
+		sdk.MsgTypeURL(&govtypes.MsgVoteWeighted{}),
+		sdk.MsgTypeURL(&govtypes.MsgDeposit{}),
+	}
+}
+
+// Execute indexes the gov msgs of the successful txs of the specified block,
+// then the deposits refunded or burned for the proposals whose periods ended with the block.
+func (a *GovAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	err := indexer.ForEachSuccessfulTx(ctx, a.log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx, logs sdk.ABCIMessageLogs) error {
+		for msgIndex, msg := range sdkTx.GetMsgs() {
+			rows, err := NewGovRows(indexer.Client.Config.ChainID, msg, msgIndex, block.Block.Height, tx.Hash(), logs)
+			if err != nil {
+				a.log.Warn(
+					"Failed to build gov rows",
+					zap.Int64("height", block.Block.Height),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+				continue
+			}
+
+			msgIndex, msgType := msgIndex, sdk.MsgTypeURL(msg)
+			for _, row := range rows {
+				indexer.Write(a.Name(), row, func(err error) {
+					if err != nil {
+						a.log.Warn(
+							"Failed to insert gov row into DB",
+							zap.Int64("height", block.Block.Height),
+							zap.Int("msg_index", msgIndex),
+							zap.String("msg_type", msgType),
+							zap.Error(err),
+						)
+					}
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	events, err := indexer.EndBlockEvents(ctx, block)
+	if err != nil {
+		return err
+	}
+	settlements, err := NewDepositSettlements(indexer.Client.Config.ChainID, block.Block.Height, events)
+	if err != nil {
+		a.log.Warn(
+			"Failed to build gov deposit settlements",
+			zap.Int64("height", block.Block.Height),
+			zap.Error(err),
+		)
+		return nil
+	}
+	for _, settlement := range settlements {
+		eventIndex := settlement.EventIndex
+		indexer.Write(a.Name(), settlement, func(err error) {
+			if err != nil {
+				a.log.Warn(
+					"Failed to insert gov deposit settlement into DB",
+					zap.Int64("height", block.Block.Height),
+					zap.Int("event_index", eventIndex),
+					zap.Error(err),
+				)
+			}
+		})
+	}
+	return nil
+}
+
+// NewGovRows returns the rows indexing msg, i.e. *GovProposal, *GovVote and *GovDeposit rows, or nil if msg isn't
+// one of the gov msgs. The id of a submitted proposal is read from the submit_proposal event of the msg in logs.
+func NewGovRows(chainID string, msg sdk.Msg, msgIndex int, height int64, hash []byte, logs sdk.ABCIMessageLogs) ([]interface{}, error) {
+	var rows []interface{}
+	switch m := msg.(type) {
+	case *govtypes.MsgSubmitProposal:
+		proposalID, err := submittedProposalID(logs, msgIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		proposal := &GovProposal{
+			ChainID:     chainID,
+			MsgIndex:    msgIndex,
+			ProposalID:  proposalID,
+			Proposer:    m.Proposer,
+			ContentType: m.Content.GetTypeUrl(),
+			Height:      height,
+		}
+		if err := setProposalContent(proposal, m.GetContent()); err != nil {
+			return nil, err
+		}
+		if err := proposal.TxHash.Set(hash); err != nil {
+			return nil, fmt.Errorf("failed to set tx hash: %w", err)
+		}
+		rows = append(rows, proposal)
+
+		deposits, err := newDeposits(chainID, proposalID, m.Proposer, m.InitialDeposit, msgIndex, height, hash)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, deposits...)
+	case *govtypes.MsgVote:
+		vote, err := newVote(chainID, m.ProposalId, m.Voter, govtypes.WeightedVoteOption{Option: m.Option, Weight: sdk.OneDec()}, msgIndex, height, hash)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, vote)
+	case *govtypes.MsgVoteWeighted:
+		for _, option := range m.Options {
+			vote, err := newVote(chainID, m.ProposalId, m.Voter, option, msgIndex, height, hash)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, vote)
+		}
+	case *govtypes.MsgDeposit:
+		deposits, err := newDeposits(chainID, m.ProposalId, m.Depositor, m.Amount, msgIndex, height, hash)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, deposits...)
+	}
+	return rows, nil
+}
+
+// newVote returns the GovVote of a single option of a vote.
+func newVote(chainID string, proposalID uint64, voter string, option govtypes.WeightedVoteOption, msgIndex int, height int64, hash []byte) (*GovVote, error) {
+	vote := &GovVote{
+		ChainID:    chainID,
+		MsgIndex:   msgIndex,
+		Option:     option.Option.String(),
+		Weight:     option.Weight.String(),
+		ProposalID: proposalID,
+		Voter:      voter,
+		Height:     height,
+	}
+	if err := vote.TxHash.Set(hash); err != nil {
+		return nil, fmt.Errorf("failed to set tx hash: %w", err)
+	}
+	return vote, nil
+}
+
+// newDeposits returns a GovDeposit for each of the coins deposited.
+func newDeposits(chainID string, proposalID uint64, depositor string, coins sdk.Coins, msgIndex int, height int64, hash []byte) ([]interface{}, error) {
+	deposits := make([]interface{}, 0, len(coins))
+	for _, coin := range coins {
+		deposit := &GovDeposit{
+			ChainID:    chainID,
+			MsgIndex:   msgIndex,
+			Denom:      coin.Denom,
+			Amount:     coin.Amount.String(),
+			ProposalID: proposalID,
+			Depositor:  depositor,
+			Height:     height,
+		}
+		if err := deposit.TxHash.Set(hash); err != nil {
+			return nil, fmt.Errorf("failed to set tx hash: %w", err)
+		}
+		deposits = append(deposits, deposit)
+	}
+	return deposits, nil
+}
+
+// setProposalContent sets the title, the proposal type and the type-specific columns of proposal from its content,
+// which is nil if the content couldn't be unpacked when the tx was decoded (e.g. a type unknown to the codec).
+func setProposalContent(proposal *GovProposal, content govtypes.Content) error {
+	proposal.ParamChanges = pgtype.JSONB{Status: pgtype.Null}
+	if content == nil {
+		return nil
+	}
+
+	proposal.Title = content.GetTitle()
+	proposal.ProposalType = content.ProposalType()
+	switch c := content.(type) {
+	case *upgradetypes.SoftwareUpgradeProposal:
+		name, height := c.Plan.Name, c.Plan.Height
+		proposal.UpgradeName, proposal.UpgradeHeight = &name, &height
+	case *distrtypes.CommunityPoolSpendProposal:
+		recipient, amount := c.Recipient, c.Amount.String()
+		proposal.SpendRecipient, proposal.SpendAmount = &recipient, &amount
+	case *paramsproposal.ParameterChangeProposal:
+		changes, err := json.Marshal(c.Changes)
+		if err != nil {
+			return fmt.Errorf("failed to encode param changes: %w", err)
+		}
+		proposal.ParamChanges = pgtype.JSONB{Bytes: changes, Status: pgtype.Present}
+	}
+	return nil
+}
+
+// submittedProposalID returns the proposal id from the submit_proposal event of the msg at msgIndex.
+func submittedProposalID(logs sdk.ABCIMessageLogs, msgIndex int) (uint64, error) {
+	for _, log := range logs {
+		if int(log.MsgIndex) != msgIndex {
+			continue
+		}
+
+		for _, event := range log.Events {
+			if event.Type != govtypes.EventTypeSubmitProposal {
+				continue
+			}
+
+			for _, attr := range event.Attributes {
+				if attr.Key == govtypes.AttributeKeyProposalID {
+					return strconv.ParseUint(attr.Value, 10, 64)
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("failed to find proposal id in %s event", govtypes.EventTypeSubmitProposal)
+}
+
+// govModuleAddress is the address of the gov module account, which holds the deposits.
+var govModuleAddress = authtypes.NewModuleAddress(govtypes.ModuleName)
+
+// NewDepositSettlements returns the deposits refunded or burned by the gov module according to the end block events
+// of a block. The gov module settles the deposits of a proposal, then emits its active_proposal or inactive_proposal
+// event, so the refunds (transfer events) and burns (burn events) of the gov module account are attributed to the
+// proposal event following them.
+func NewDepositSettlements(chainID string, height int64, events []abcitypes.Event) ([]*GovDepositSettlement, error) {
+	var settlements, pending []*GovDepositSettlement
+	for eventIndex, event := range events {
+		attrs := make(map[string]string, len(event.Attributes))
+		for _, attr := range event.Attributes {
+			attrs[string(attr.Key)] = string(attr.Value)
+		}
+
+		var (
+			direction string
+			depositor *string
+		)
+		switch event.Type {
+		case banktypes.EventTypeTransfer:
+			if !isGovModuleAddress(attrs[banktypes.AttributeKeySender]) {
+				continue
+			}
+			recipient := attrs[banktypes.AttributeKeyRecipient]
+			direction, depositor = DepositRefunded, &recipient
+		case banktypes.EventTypeCoinBurn:
+			if !isGovModuleAddress(attrs[banktypes.AttributeKeyBurner]) {
+				continue
+			}
+			direction = DepositBurned
+		case govtypes.EventTypeActiveProposal, govtypes.EventTypeInactiveProposal:
+			proposalID, err := strconv.ParseUint(attrs[govtypes.AttributeKeyProposalID], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse proposal id of %s event %d: %w", event.Type, eventIndex, err)
+			}
+			for _, settlement := range pending {
+				settlement.ProposalID = proposalID
+				settlement.Result = attrs[govtypes.AttributeKeyProposalResult]
+			}
+			settlements = append(settlements, pending...)
+			pending = nil
+			continue
+		default:
+			continue
+		}
+
+		coins, err := sdk.ParseCoinsNormalized(attrs[sdk.AttributeKeyAmount])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse amount of %s event %d: %w", event.Type, eventIndex, err)
+		}
+		for _, coin := range coins {
+			pending = append(pending, &GovDepositSettlement{
+				ChainID:    chainID,
+				Height:     height,
+				EventIndex: eventIndex,
+				Denom:      coin.Denom,
+				Amount:     coin.Amount.String(),
+				Direction:  direction,
+				Depositor:  depositor,
+			})
+		}
+	}
+	return settlements, nil
+}
+
+// isGovModuleAddress reports whether the bech32 address is the gov module account, whatever the chain's prefix.
+func isGovModuleAddress(address string) bool {
+	_, bz, err := bech32.DecodeAndConvert(address)
+	return err == nil && bytes.Equal(bz, govModuleAddress)
+}
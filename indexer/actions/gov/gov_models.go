@@ -0,0 +1,77 @@
+package gov
+
+import (
+	"github.com/jackc/pgtype"
+)
+
+// GovProposal is a proposal submitted with a MsgSubmitProposal. The proposal id is assigned by the gov module,
+// so it's taken from the submit_proposal event of the msg. ContentType is the type URL of the proposal content and
+// ProposalType its gov proposal type (e.g. Text or SoftwareUpgrade), which is empty if the content couldn't be unpacked.
+//
+// The type-specific columns are null for the other proposal types: UpgradeName and UpgradeHeight are the plan of
+// software upgrades, SpendRecipient and SpendAmount (coins, e.g. 100uatom) the transfer of community pool spends
+// and ParamChanges the JSON array of the changes of parameter change proposals.
+type GovProposal struct {
+	ChainID        string       `gorm:"primaryKey"`
+	TxHash         pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex       int          `gorm:"primaryKey;autoIncrement:false"`
+	ProposalID     uint64       `gorm:"not null;index"`
+	Proposer       string       `gorm:"not null;index"`
+	ContentType    string       `gorm:"not null"`
+	ProposalType   string       `gorm:"not null;default:''"`
+	Title          string       `gorm:"not null;default:''"`
+	UpgradeName    *string
+	UpgradeHeight  *int64
+	SpendRecipient *string
+	SpendAmount    *string
+	ParamChanges   pgtype.JSONB
+	Height         int64 `gorm:"not null"`
+}
+
+// GovVote is a vote cast with a MsgVote or a MsgVoteWeighted, with a row per option of the vote.
+// Weight is the decimal weight of the option, a MsgVote has a single option with a weight of 1.
+type GovVote struct {
+	ChainID    string       `gorm:"primaryKey"`
+	TxHash     pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex   int          `gorm:"primaryKey;autoIncrement:false"`
+	Option     string       `gorm:"primaryKey"`
+	Weight     string       `gorm:"not null"`
+	ProposalID uint64       `gorm:"not null;index"`
+	Voter      string       `gorm:"not null;index"`
+	Height     int64        `gorm:"not null"`
+}
+
+// GovDeposit is a deposit made with a MsgDeposit, or the initial deposit of a MsgSubmitProposal, with a row per denom.
+type GovDeposit struct {
+	ChainID    string       `gorm:"primaryKey"`
+	TxHash     pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex   int          `gorm:"primaryKey;autoIncrement:false"`
+	Denom      string       `gorm:"primaryKey"`
+	Amount     string       `gorm:"not null"`
+	ProposalID uint64       `gorm:"not null;index"`
+	Depositor  string       `gorm:"not null;index"`
+	Height     int64        `gorm:"not null"`
+}
+
+// The directions of a GovDepositSettlement.
+const (
+	DepositRefunded = "refund"
+	DepositBurned   = "burn"
+)
+
+// GovDepositSettlement is the refund or burn of deposits by the gov module once the period of a proposal ended,
+// taken from the end block events, with a row per denom of each refund or burn event. Deposits are refunded to their
+// depositor unless the proposal didn't reach the min deposit, was vetoed or didn't reach quorum, in which case
+// they're burned and Depositor is null since the burn events don't name the depositor.
+// Result is the proposal_result of the proposal (e.g. proposal_passed or proposal_dropped).
+type GovDepositSettlement struct {
+	ChainID    string  `gorm:"primaryKey"`
+	Height     int64   `gorm:"primaryKey;autoIncrement:false"`
+	EventIndex int     `gorm:"primaryKey;autoIncrement:false"`
+	Denom      string  `gorm:"primaryKey"`
+	Amount     string  `gorm:"not null"`
+	ProposalID uint64  `gorm:"not null;index"`
+	Direction  string  `gorm:"not null"`
+	Depositor  *string `gorm:"index"`
+	Result     string  `gorm:"not null"`
+}
@@ -0,0 +1,362 @@
+package gov
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	distrtypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	paramsproposal "github.com/cosmos/cosmos-sdk/x/params/types/proposal"
+	upgradetypes "github.com/cosmos/cosmos-sdk/x/upgrade/types"
+	"github.com/jackc/pgtype"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+var (
+	proposer = sdk.AccAddress("proposer")
+	voter    = sdk.AccAddress("voter")
+)
+
+// newTestIndexer returns an Indexer for the chain of node decoding txs with the lens codec and writing to a dbtest DB.
+func newTestIndexer(t *testing.T, node *rpctest.Node) (*indexer.Indexer, *dbtest.Recorder) {
+	t.Helper()
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: node.ChainID(), AccountPrefix: "cosmos"},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(lens.ModuleBasics),
+	}
+	db, rec := dbtest.New(t)
+	return indexer.NewIndexer(zap.NewNop(), client, db), rec
+}
+
+// encodeTx returns the bytes of a tx containing msgs, encoded with the indexer's codec.
+func encodeTx(t *testing.T, i *indexer.Indexer, msgs ...sdk.Msg) []byte {
+	t.Helper()
+	builder := i.Client.Codec.TxConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msgs...); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	bz, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+	return bz
+}
+
+// rows returns the values of the rows written to table.
+func rows(rec *dbtest.Recorder, table string) []interface{} {
+	var values []interface{}
+	for _, row := range rec.Rows(table) {
+		values = append(values, reflect.ValueOf(row).Elem().Interface())
+	}
+	return values
+}
+
+func TestExecute(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+
+	submit, err := govtypes.NewMsgSubmitProposal(govtypes.NewTextProposal("Signal", "Do the thing"),
+		sdk.NewCoins(sdk.NewInt64Coin("uatom", 100), sdk.NewInt64Coin("uosmo", 5)), proposer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []sdk.Msg{
+		submit,
+		govtypes.NewMsgVote(voter, 7, govtypes.OptionYes),
+		govtypes.NewMsgVoteWeighted(voter, 7, govtypes.WeightedVoteOptions{
+			{Option: govtypes.OptionYes, Weight: sdk.NewDecWithPrec(7, 1)},
+			{Option: govtypes.OptionAbstain, Weight: sdk.NewDecWithPrec(3, 1)},
+		}),
+		govtypes.NewMsgDeposit(voter, 7, sdk.NewCoins(sdk.NewInt64Coin("uatom", 50))),
+	}
+	logs, err := json.Marshal(sdk.ABCIMessageLogs{{MsgIndex: 0, Events: sdk.StringEvents{{
+		Type:       govtypes.EventTypeSubmitProposal,
+		Attributes: []sdk.Attribute{{Key: govtypes.AttributeKeyProposalID, Value: "7"}},
+	}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := [][]byte{encodeTx(t, i, msgs...), encodeTx(t, i, msgs[1])}
+	// The second tx failed, so its vote wasn't cast
+	node.AddBlock(10, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{Code: 0, Log: string(logs)}, {Code: 5}})
+
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{NewGovAction(zap.NewNop())}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	var hash pgtype.Bytea
+	if err := hash.Set(tmtypes.Tx(txs[0]).Hash()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		table    string
+		expected []interface{}
+	}{
+		{"gov_proposals", []interface{}{GovProposal{
+			ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 0, ProposalID: 7, Proposer: proposer.String(),
+			ContentType: "/cosmos.gov.v1beta1.TextProposal", ProposalType: govtypes.ProposalTypeText, Title: "Signal",
+			ParamChanges: pgtype.JSONB{Status: pgtype.Null}, Height: 10,
+		}}},
+		{"gov_votes", []interface{}{
+			GovVote{
+				ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 1, Option: "VOTE_OPTION_YES", Weight: sdk.OneDec().String(),
+				ProposalID: 7, Voter: voter.String(), Height: 10,
+			},
+			GovVote{
+				ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 2, Option: "VOTE_OPTION_YES", Weight: "0.700000000000000000",
+				ProposalID: 7, Voter: voter.String(), Height: 10,
+			},
+			GovVote{
+				ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 2, Option: "VOTE_OPTION_ABSTAIN", Weight: "0.300000000000000000",
+				ProposalID: 7, Voter: voter.String(), Height: 10,
+			},
+		}},
+		{"gov_deposits", []interface{}{
+			GovDeposit{
+				ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 0, Denom: "uatom", Amount: "100",
+				ProposalID: 7, Depositor: proposer.String(), Height: 10,
+			},
+			GovDeposit{
+				ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 0, Denom: "uosmo", Amount: "5",
+				ProposalID: 7, Depositor: proposer.String(), Height: 10,
+			},
+			GovDeposit{
+				ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 3, Denom: "uatom", Amount: "50",
+				ProposalID: 7, Depositor: voter.String(), Height: 10,
+			},
+		}},
+	}
+	for _, tt := range tests {
+		if got := rows(rec, tt.table); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("got %s %+v, expected %+v", tt.table, got, tt.expected)
+		}
+	}
+}
+
+func TestNewGovRowsMissingProposalID(t *testing.T) {
+	submit, err := govtypes.NewMsgSubmitProposal(govtypes.NewTextProposal("Signal", "Do the thing"), nil, proposer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The submit_proposal event is for another msg of the tx
+	logs := sdk.ABCIMessageLogs{{MsgIndex: 1, Events: sdk.StringEvents{{
+		Type:       govtypes.EventTypeSubmitProposal,
+		Attributes: []sdk.Attribute{{Key: govtypes.AttributeKeyProposalID, Value: "7"}},
+	}}}}
+	if _, err := NewGovRows("cosmoshub-4", submit, 0, 10, []byte{1}, logs); err == nil {
+		t.Error("expected an error for a proposal without its submit_proposal event")
+	}
+
+	rows, err := NewGovRows("cosmoshub-4", &govtypes.MsgDeposit{}, 0, 10, []byte{1}, nil)
+	if err != nil || len(rows) != 0 {
+		t.Errorf("got rows %v and error %v for an empty deposit, expected none", rows, err)
+	}
+}
+
+func TestProposalContent(t *testing.T) {
+	i, _ := newTestIndexer(t, rpctest.New("cosmoshub-4"))
+
+	contents := []govtypes.Content{
+		upgradetypes.NewSoftwareUpgradeProposal("v7", "Upgrade to v7", upgradetypes.Plan{Name: "v7-theta", Height: 9283650}),
+		distrtypes.NewCommunityPoolSpendProposal("Fund", "Fund the team", proposer, sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000))),
+		paramsproposal.NewParameterChangeProposal("Params", "Raise the limit", []paramsproposal.ParamChange{
+			paramsproposal.NewParamChange("staking", "MaxValidators", "175"),
+		}),
+	}
+	var msgs []sdk.Msg
+	for _, content := range contents {
+		msg, err := govtypes.NewMsgSubmitProposal(content, nil, proposer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	sdkTx, err := i.Client.Codec.TxConfig.TxDecoder()(encodeTx(t, i, msgs...))
+	if err != nil {
+		t.Fatalf("failed to decode tx: %v", err)
+	}
+
+	var logs sdk.ABCIMessageLogs
+	for msgIndex := range msgs {
+		logs = append(logs, sdk.ABCIMessageLog{MsgIndex: uint32(msgIndex), Events: sdk.StringEvents{{
+			Type:       govtypes.EventTypeSubmitProposal,
+			Attributes: []sdk.Attribute{{Key: govtypes.AttributeKeyProposalID, Value: "7"}},
+		}}})
+	}
+
+	upgradeName, upgradeHeight := "v7-theta", int64(9283650)
+	spendRecipient, spendAmount := proposer.String(), "1000uatom"
+	tests := []struct {
+		name     string
+		expected GovProposal
+	}{
+		{"software upgrade", GovProposal{
+			ProposalType: upgradetypes.ProposalTypeSoftwareUpgrade, Title: "v7",
+			UpgradeName: &upgradeName, UpgradeHeight: &upgradeHeight, ParamChanges: pgtype.JSONB{Status: pgtype.Null},
+		}},
+		{"community pool spend", GovProposal{
+			ProposalType: distrtypes.ProposalTypeCommunityPoolSpend, Title: "Fund",
+			SpendRecipient: &spendRecipient, SpendAmount: &spendAmount, ParamChanges: pgtype.JSONB{Status: pgtype.Null},
+		}},
+		{"parameter change", GovProposal{
+			ProposalType: paramsproposal.ProposalTypeChange, Title: "Params",
+			ParamChanges: pgtype.JSONB{Bytes: []byte(`[{"subspace":"staking","key":"MaxValidators","value":"175"}]`), Status: pgtype.Present},
+		}},
+	}
+	for msgIndex, tt := range tests {
+		rows, err := NewGovRows("cosmoshub-4", sdkTx.GetMsgs()[msgIndex], msgIndex, 10, []byte{1}, logs)
+		if err != nil {
+			t.Fatalf("%s: NewGovRows returned unexpected error: %v", tt.name, err)
+		}
+		got := *rows[0].(*GovProposal)
+		// Only the columns set from the content are compared
+		got.ChainID, got.TxHash, got.MsgIndex, got.ProposalID, got.Proposer, got.ContentType, got.Height = "", pgtype.Bytea{}, 0, 0, "", "", 0
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: got proposal %+v, expected %+v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestNewDepositSettlements(t *testing.T) {
+	address := func(bz []byte) string {
+		s, err := bech32.ConvertAndEncode("juno", bz)
+		if err != nil {
+			t.Fatalf("failed to encode address: %v", err)
+		}
+		return s
+	}
+	gov := address(govModuleAddress)
+	distr := address(authtypes.NewModuleAddress("distribution"))
+
+	event := func(typ string, kvs ...string) abcitypes.Event {
+		e := abcitypes.Event{Type: typ}
+		for j := 0; j < len(kvs); j += 2 {
+			e.Attributes = append(e.Attributes, abcitypes.EventAttribute{Key: []byte(kvs[j]), Value: []byte(kvs[j+1])})
+		}
+		return e
+	}
+	transfer := func(sender, recipient, amount string) abcitypes.Event {
+		return event("transfer", "recipient", recipient, "sender", sender, "amount", amount)
+	}
+	burn := func(burner, amount string) abcitypes.Event {
+		return event("burn", "burner", burner, "amount", amount)
+	}
+	proposal := func(typ, id, result string) abcitypes.Event {
+		return event(typ, "proposal_id", id, "proposal_result", result)
+	}
+
+	// row is the expected event index, proposal id, direction, depositor ("" for null), amount, denom and result
+	type row struct {
+		eventIndex int
+		proposalID uint64
+		direction  string
+		depositor  string
+		amount     string
+		denom      string
+		result     string
+	}
+	tests := []struct {
+		name    string
+		events  []abcitypes.Event
+		want    []row
+		wantErr bool
+	}{
+		{
+			name: "refunds of a passed proposal",
+			events: []abcitypes.Event{
+				transfer(gov, "alice", "10ujuno"),
+				transfer(gov, "bob", "5ujuno,2uatom"),
+				proposal("active_proposal", "3", "proposal_passed"),
+			},
+			want: []row{
+				{0, 3, DepositRefunded, "alice", "10", "ujuno", "proposal_passed"},
+				{1, 3, DepositRefunded, "bob", "2", "uatom", "proposal_passed"},
+				{1, 3, DepositRefunded, "bob", "5", "ujuno", "proposal_passed"},
+			},
+		},
+		{
+			name: "burns of dropped and vetoed proposals",
+			events: []abcitypes.Event{
+				burn(gov, "7ujuno"),
+				proposal("inactive_proposal", "4", "proposal_dropped"),
+				burn(gov, "20ujuno"),
+				burn(gov, "30ujuno"),
+				proposal("active_proposal", "2", "proposal_rejected"),
+			},
+			want: []row{
+				{0, 4, DepositBurned, "", "7", "ujuno", "proposal_dropped"},
+				{2, 2, DepositBurned, "", "20", "ujuno", "proposal_rejected"},
+				{3, 2, DepositBurned, "", "30", "ujuno", "proposal_rejected"},
+			},
+		},
+		{
+			name: "other modules' events are ignored",
+			events: []abcitypes.Event{
+				transfer(distr, "alice", "100ujuno"),
+				burn(distr, "1ujuno"),
+				transfer(gov, "alice", "10ujuno"),
+				transfer(distr, "carol", "50ujuno"),
+				proposal("active_proposal", "5", "proposal_passed"),
+			},
+			want: []row{
+				{2, 5, DepositRefunded, "alice", "10", "ujuno", "proposal_passed"},
+			},
+		},
+		{
+			name:   "proposal without deposits",
+			events: []abcitypes.Event{proposal("active_proposal", "6", "proposal_rejected")},
+		},
+		{
+			name: "invalid proposal id",
+			events: []abcitypes.Event{
+				transfer(gov, "alice", "10ujuno"),
+				proposal("active_proposal", "six", "proposal_passed"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		settlements, err := NewDepositSettlements("juno-1", 100, tt.events)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: NewDepositSettlements returned no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: NewDepositSettlements returned unexpected error: %v", tt.name, err)
+			continue
+		}
+		if len(settlements) != len(tt.want) {
+			t.Errorf("%s: got %d settlements, want %d", tt.name, len(settlements), len(tt.want))
+			continue
+		}
+
+		for j, s := range settlements {
+			depositor := ""
+			if s.Depositor != nil {
+				depositor = *s.Depositor
+			}
+			got := row{s.EventIndex, s.ProposalID, s.Direction, depositor, s.Amount, s.Denom, s.Result}
+			if got != tt.want[j] {
+				t.Errorf("%s: settlement %d = %+v, want %+v", tt.name, j, got, tt.want[j])
+			}
+			if s.ChainID != "juno-1" || s.Height != 100 {
+				t.Errorf("%s: settlement %d has chain id %s and height %d", tt.name, j, s.ChainID, s.Height)
+			}
+		}
+	}
+}
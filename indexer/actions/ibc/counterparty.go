@@ -0,0 +1,101 @@
+package ibc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	channeltypes "github.com/cosmos/ibc-go/v2/modules/core/04-channel/types"
+	ibctmtypes "github.com/cosmos/ibc-go/v2/modules/light-clients/07-tendermint/types"
+	"github.com/strangelove-ventures/valis/indexer"
+)
+
+// tendermintClientStateTypeURL is the type URL of the 07-tendermint client state, the only client type
+// the counterparty chain id can be read from.
+const tendermintClientStateTypeURL = "/ibc.lightclients.tendermint.v1.ClientState"
+
+// counterpartyFailureTTL is how long a failed lookup is cached for, so a channel whose lookup keeps failing isn't
+// queried again for every transfer while still being retried eventually.
+const counterpartyFailureTTL = time.Minute
+
+// counterpartyChainResolver resolves the chain id on the other end of a channel from the client state
+// of the channel's client. Resolved values are cached since a channel's client never changes, failed
+// lookups are cached for counterpartyFailureTTL.
+type counterpartyChainResolver struct {
+	mu       sync.Mutex
+	cache    map[string]string
+	failures map[string]counterpartyFailure
+}
+
+// counterpartyFailure is a cached failed lookup, its error is returned again until expiresAt.
+type counterpartyFailure struct {
+	err       error
+	expiresAt time.Time
+}
+
+func newCounterpartyChainResolver() *counterpartyChainResolver {
+	return &counterpartyChainResolver{
+		cache:    make(map[string]string),
+		failures: make(map[string]counterpartyFailure),
+	}
+}
+
+// Resolve returns the counterparty chain id of the specified channel on the indexer's chain. An empty string
+// without an error is returned when the channel's client isn't a tendermint client, so the chain id isn't derivable.
+func (r *counterpartyChainResolver) Resolve(ctx context.Context, indexer *indexer.Indexer, port, channel string) (string, error) {
+	key := fmt.Sprintf("%s/%s/%s", indexer.Client.Config.ChainID, port, channel)
+
+	r.mu.Lock()
+	chainID, ok := r.cache[key]
+	failure, failed := r.failures[key]
+	r.mu.Unlock()
+	if ok {
+		return chainID, nil
+	}
+	if failed && time.Now().Before(failure.expiresAt) {
+		return "", failure.err
+	}
+
+	chainID, err := r.query(ctx, indexer, port, channel)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		// Lookups interrupted by the indexer shutting down say nothing about the channel
+		if ctx.Err() != nil {
+			return "", err
+		}
+		r.failures[key] = counterpartyFailure{err: err, expiresAt: time.Now().Add(counterpartyFailureTTL)}
+		return "", err
+	}
+	delete(r.failures, key)
+	r.cache[key] = chainID
+	return chainID, nil
+}
+
+// query looks up the counterparty chain id of the specified channel from the client state of its client.
+func (r *counterpartyChainResolver) query(ctx context.Context, indexer *indexer.Indexer, port, channel string) (string, error) {
+	if indexer.Timeouts.Query > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, indexer.Timeouts.Query)
+		defer cancel()
+	}
+
+	res, err := channeltypes.NewQueryClient(indexer.Client).ChannelClientState(ctx, &channeltypes.QueryChannelClientStateRequest{
+		PortId:    port,
+		ChannelId: channel,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if res.IdentifiedClientState != nil && res.IdentifiedClientState.ClientState != nil &&
+		res.IdentifiedClientState.ClientState.TypeUrl == tendermintClientStateTypeURL {
+		var clientState ibctmtypes.ClientState
+		if err := clientState.Unmarshal(res.IdentifiedClientState.ClientState.Value); err != nil {
+			return "", err
+		}
+		return clientState.ChainId, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,147 @@
+package ibc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	transfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
+	channeltypes "github.com/cosmos/ibc-go/v2/modules/core/04-channel/types"
+	ibctmtypes "github.com/cosmos/ibc-go/v2/modules/light-clients/07-tendermint/types"
+	localhosttypes "github.com/cosmos/ibc-go/v2/modules/light-clients/09-localhost/types"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	"go.uber.org/zap"
+)
+
+const channelClientStatePath = "/ibc.core.channel.v1.Query/ChannelClientState"
+
+// handleChannelClientState answers the channel client state queries of node with the client states of clients,
+// keyed by channel id.
+func handleChannelClientState(t *testing.T, node *rpctest.Node, clients map[string]*codectypes.Any) {
+	node.HandleQuery(channelClientStatePath, func(data []byte) (codec.ProtoMarshaler, error) {
+		var req channeltypes.QueryChannelClientStateRequest
+		if err := req.Unmarshal(data); err != nil {
+			return nil, err
+		}
+		if req.PortId != "transfer" {
+			t.Errorf("got client state query for port %s, want transfer", req.PortId)
+		}
+		return &channeltypes.QueryChannelClientStateResponse{
+			IdentifiedClientState: &clienttypes.IdentifiedClientState{ClientId: "07-tendermint-0", ClientState: clients[req.ChannelId]},
+		}, nil
+	})
+}
+
+// tendermintClientState returns a packed tendermint client state of the chain with chainID.
+func tendermintClientState(t *testing.T, chainID string) *codectypes.Any {
+	t.Helper()
+	clientState, err := codectypes.NewAnyWithValue(&ibctmtypes.ClientState{ChainId: chainID})
+	if err != nil {
+		t.Fatalf("failed to pack client state: %v", err)
+	}
+	return clientState
+}
+
+// localhostClientState returns a packed localhost client state, the counterparty chain of its channels isn't derivable.
+func localhostClientState(t *testing.T) *codectypes.Any {
+	t.Helper()
+	clientState, err := codectypes.NewAnyWithValue(localhosttypes.NewClientState("osmosis-1", clienttypes.NewHeight(1, 10)))
+	if err != nil {
+		t.Fatalf("failed to pack client state: %v", err)
+	}
+	return clientState
+}
+
+func TestResolveCounterpartyChain(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, _ := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	handleChannelClientState(t, node, map[string]*codectypes.Any{
+		"channel-0": tendermintClientState(t, "cosmoshub-4"),
+		"channel-1": localhostClientState(t),
+	})
+
+	r := newCounterpartyChainResolver()
+	for j := 0; j < 2; j++ {
+		chainID, err := r.Resolve(context.Background(), i, "transfer", "channel-0")
+		if err != nil {
+			t.Fatalf("Resolve returned unexpected error: %v", err)
+		}
+		if chainID != "cosmoshub-4" {
+			t.Errorf("counterparty chain of channel-0 = %q, want cosmoshub-4", chainID)
+		}
+	}
+	if queried := node.Queried(channelClientStatePath); queried != 1 {
+		t.Errorf("client state queried %d times, want 1, the counterparty chain should be cached", queried)
+	}
+
+	chainID, err := r.Resolve(context.Background(), i, "transfer", "channel-1")
+	if err != nil || chainID != "" {
+		t.Errorf("counterparty chain of a localhost client = %q, %v, want an empty chain id", chainID, err)
+	}
+}
+
+func TestResolveCounterpartyChainFailures(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, _ := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	node.HandleQuery(channelClientStatePath, func(data []byte) (codec.ProtoMarshaler, error) {
+		return nil, errors.New("channel not found")
+	})
+	r := newCounterpartyChainResolver()
+
+	// The failed lookup is cached until it expires
+	for j := 0; j < 2; j++ {
+		if _, err := r.Resolve(context.Background(), i, "transfer", "channel-9"); err == nil {
+			t.Fatal("Resolve returned no error for a channel that can't be found")
+		}
+	}
+	if queried := node.Queried(channelClientStatePath); queried != 1 {
+		t.Errorf("client state queried %d times, want 1, the failed lookup should be cached", queried)
+	}
+
+	for key, failure := range r.failures {
+		failure.expiresAt = time.Now().Add(-time.Second)
+		r.failures[key] = failure
+	}
+	if _, err := r.Resolve(context.Background(), i, "transfer", "channel-9"); err == nil {
+		t.Fatal("Resolve returned no error for a channel that can't be found")
+	}
+	if queried := node.Queried(channelClientStatePath); queried != 2 {
+		t.Errorf("client state queried %d times, want 2, an expired failure should be looked up again", queried)
+	}
+}
+
+func TestHandleMsgTransferDstChainID(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	handleChannelClientState(t, node, map[string]*codectypes.Any{
+		"channel-0": tendermintClientState(t, "cosmoshub-4"),
+	})
+	a := NewIBCTransfer(zap.NewNop())
+
+	// channel-9 has no client state, the destination chain of its transfers is left null
+	for j, channel := range []string{"channel-0", "channel-9"} {
+		msg := transfertypes.NewMsgTransfer("transfer", channel, sdk.NewInt64Coin("uosmo", 10), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 100), 0)
+		sdkTx := decodeTx(t, i, encodeTx(t, i, msg))
+		a.HandleIBCMsg(context.Background(), i, sdkTx.GetMsgs()[0], sdk.ABCIMessageLog{}, 0, 0, 10, time.Now(), []byte{byte(j)}, nil)
+	}
+
+	rows := rec.Rows("msg_transfers")
+	if len(rows) != 2 {
+		t.Fatalf("got %d MsgTransfer rows, want 2", len(rows))
+	}
+	if dst := rows[0].(*MsgTransfer).DstChainID; dst == nil || *dst != "cosmoshub-4" {
+		t.Errorf("DstChainID of the channel-0 transfer = %v, want cosmoshub-4", dst)
+	}
+	if dst := rows[1].(*MsgTransfer).DstChainID; dst != nil {
+		t.Errorf("DstChainID of the channel-9 transfer = %s, want null", *dst)
+	}
+}
@@ -2,28 +2,50 @@ package ibc
 
 import (
 	"context"
-	"encoding/hex"
-	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
+	cryptotypes "github.com/cosmos/cosmos-sdk/crypto/types"
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
 	transfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
 	channeltypes "github.com/cosmos/ibc-go/v2/modules/core/04-channel/types"
+	ibctmtypes "github.com/cosmos/ibc-go/v2/modules/light-clients/07-tendermint/types"
 	"github.com/jackc/pgtype"
 	"github.com/strangelove-ventures/valis/indexer"
 	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // BlockActionName is used for configuring block actions via the config file,
 // these names are read when starting the indexer for building the list of actions to take at runtime.
 const BlockActionName = "ics20_transfers"
 
+// unorderedTx is implemented by txs of sdk versions supporting unordered txs (v0.50+),
+// it's declared here since the sdk version this is built against doesn't define it.
+type unorderedTx interface {
+	GetUnordered() bool
+}
+
+// protoTx is implemented by the txs decoded by the sdk's TxDecoder. The fee payer and granter are read from the
+// proto tx rather than sdk.FeeTx, which parses them with the global bech32 prefix and panics for other chains.
+type protoTx interface {
+	GetProtoTx() *txtypes.Tx
+}
+
 // IBCTransferAction implements the indexer.BlockAction interface, it describes the appropriate actions to take in order
 // to parse the ics-20 transfer data on-chain and index it into a database instance.
 type IBCTransferAction struct {
 	actionName string
 	log        *zap.Logger
+
+	// dstChains resolves the destination chain id of transfers, it's shared by every chain being indexed.
+	dstChains *counterpartyChainResolver
 }
 
 // NewIBCTransfer returns a new IBCTransferAction block action to be used by the indexer.
@@ -31,6 +53,7 @@ func NewIBCTransfer(log *zap.Logger) *IBCTransferAction {
 	return &IBCTransferAction{
 		actionName: BlockActionName,
 		log:        log,
+		dstChains:  newCounterpartyChainResolver(),
 	}
 }
 
@@ -39,6 +62,11 @@ func (a *IBCTransferAction) Name() string {
 	return a.actionName
 }
 
+// SchemaVersion implements indexer.SchemaVersioner, version 2 added the packet sequence and timeout columns.
+func (a *IBCTransferAction) SchemaVersion() int {
+	return 2
+}
+
 // MigrateSchema runs schema migrations for the specified models.
 func (a *IBCTransferAction) MigrateSchema(indexer *indexer.Indexer) error {
 	return indexer.DB.AutoMigrate(
@@ -47,28 +75,58 @@ func (a *IBCTransferAction) MigrateSchema(indexer *indexer.Indexer) error {
 		&MsgRecvPacket{},
 		&MsgAcknowledgement{},
 		&MsgTimeout{},
+		&MsgUpdateClient{},
+		&TransferVolumeDaily{},
+		&Transfer{},
 	)
 }
 
+// MsgTypes returns the type URLs of the msgs handled by this action, txs without any of them are skipped.
+func (a *IBCTransferAction) MsgTypes() []string {
+	return []string{
+		sdk.MsgTypeURL(&transfertypes.MsgTransfer{}),
+		sdk.MsgTypeURL(&channeltypes.MsgRecvPacket{}),
+		sdk.MsgTypeURL(&channeltypes.MsgAcknowledgement{}),
+		sdk.MsgTypeURL(&channeltypes.MsgTimeout{}),
+		sdk.MsgTypeURL(&clienttypes.MsgUpdateClient{}),
+	}
+}
+
 // Execute calls the appropriate functions needed for properly parsing data related to IBC fungible token transfers.
 func (a *IBCTransferAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
 	return a.IndexIBCTransfers(ctx, indexer, block)
 }
 
 // IndexIBCTransfers parses the tx data in the specified block and indexes the tx data along with
-// any ics-20 Msg related data into a postgres database instance.
+// any ics-20 Msg related data into a postgres database instance. Txs are processed concurrently
+// according to the indexer's ConcurrentTxs setting, each worker performs its own DB writes.
 func (a *IBCTransferAction) IndexIBCTransfers(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
-	for index, tx := range block.Block.Data.Txs {
+	txResults, err := indexer.TxResults(ctx, block)
+	if err != nil {
+		return err
+	}
+
+	// If this block was interrupted on a previous run, skip the msgs that were already written
+	progress, err := indexer.LoadMsgProgress(a.Name(), block.Block.Height)
+	if err != nil {
+		return err
+	}
+	tracker := &progressTracker{a: a, indexer: indexer, height: block.Block.Height}
 
+	err = indexer.ForEachTx(ctx, block, func(ctx context.Context, index int, tx tmtypes.Tx) error {
 		// Check if the context has been cancelled on each iteration
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(time.Millisecond * 100):
+		default:
 			// continue
 		}
 
-		sdkTx, err := indexer.Client.Codec.TxConfig.TxDecoder()(tx)
+		if progress.TxWritten(index) {
+			return nil
+		}
+
+		sdkTx, err := indexer.DecodeTx(tx)
 		if err != nil {
 			// TODO application specific txs fail here (e.g. Osmosis Msgs, GDEX swaps, Akash deployments, etc.)
 			// We need to use lens to load all the correct AppModuleBasics when initializing the (*ChainClient).Codec
@@ -81,48 +139,70 @@ func (a *IBCTransferAction) IndexIBCTransfers(ctx context.Context, indexer *inde
 			)
 
 			// TODO we may want to keep track of txs that fail to be decoded or do something besides log the error
-			continue
+			return nil
 		}
 
-		// TODO This can fail so results may not end up in db
-		// ex. Failed to query tx results. Err: failed to read response body: context deadline exceeded (Client.Timeout or context cancellation while reading body)
-		// ex. [Height 2301720] {8/9 txs} - Failed to query tx results. Err: post failed: Post "https://rpc-juno.ecostake.com:443": context deadline exceeded (Client.Timeout exceeded while awaiting headers)
-		txRes, err := indexer.Client.QueryTx(ctx, hex.EncodeToString(tx.Hash()), true)
-		if err != nil {
+		// Txs without any msgs handled by the configured actions are skipped before being decoded
+		if sdkTx == nil {
+			return nil
+		}
+
+		// Results are missing for txs that failed to be queried, see (*Indexer).TxResults
+		txRes := txResults[index]
+		if txRes == nil {
 			a.log.Debug(
-				"Failed to query tx results",
+				"Missing tx results",
 				zap.Int64("height", block.Block.Height),
 				zap.Int("tx_index", index+1),
 				zap.Int("total_txs", len(block.Block.Data.Txs)),
-				zap.Error(err),
 			)
 
 			// TODO we may want to retry or keep track of txs that fail to be queried
-			continue
+			return nil
 		}
 
-		// Set the appropriate fee values if they exist
-		fee := sdkTx.(sdk.FeeTx)
-		var feeAmount, feeDenom string
-		if len(fee.GetFee()) == 0 {
-			feeAmount = "0"
-			feeDenom = ""
-		} else {
+		// Only txs involving the watched addresses are indexed, if any are configured
+		if !indexer.InvolvesWatchedAddress(txRes.TxResult.Events) {
+			return nil
+		}
+
+		// Set the appropriate fee values if they exist, txs that don't implement FeeTx are stored without a fee
+		feeAmount, feeDenom := "0", ""
+		if fee, ok := sdkTx.(sdk.FeeTx); ok && len(fee.GetFee()) > 0 {
 			feeAmount = fee.GetFee()[0].Amount.String()
 			feeDenom = fee.GetFee()[0].Denom
+			indexer.EnrichDenom(ctx, feeDenom)
 		}
 
 		dbTx := &Tx{
-			Hash:        pgtype.Bytea{},
-			Timestamp:   pgtype.Timestamp{},
-			ChainID:     indexer.Client.Config.ChainID,
-			BlockHeight: block.Block.Height,
-			RawLog:      pgtype.JSONB{},
-			Code:        int(txRes.TxResult.Code),
-			FeeAmount:   feeAmount,
-			FeeDenom:    feeDenom,
-			GasUsed:     txRes.TxResult.GasUsed,
-			GasWanted:   txRes.TxResult.GasWanted,
+			Hash:          pgtype.Bytea{},
+			Timestamp:     pgtype.Timestamp{},
+			ChainID:       indexer.Client.Config.ChainID,
+			BlockHeight:   block.Block.Height,
+			RawLog:        pgtype.JSONB{},
+			Code:          int(txRes.TxResult.Code),
+			FeeAmount:     feeAmount,
+			FeeDenom:      feeDenom,
+			GasUsed:       txRes.TxResult.GasUsed,
+			GasWanted:     txRes.TxResult.GasWanted,
+			MsgCount:      len(sdkTx.GetMsgs()),
+			EventsSummary: pgtype.JSONB{Status: pgtype.Null},
+		}
+
+		// The optional tx fields are only stored when the tx implements the interface exposing them
+		if memoTx, ok := sdkTx.(sdk.TxWithMemo); ok {
+			dbTx.Memo = memoTx.GetMemo()
+		}
+		if timeoutTx, ok := sdkTx.(sdk.TxWithTimeoutHeight); ok && timeoutTx.GetTimeoutHeight() > 0 {
+			timeoutHeight := timeoutTx.GetTimeoutHeight()
+			dbTx.TimeoutHeight = &timeoutHeight
+		}
+		if unorderedTx, ok := sdkTx.(unorderedTx); ok {
+			unordered := unorderedTx.GetUnordered()
+			dbTx.Unordered = &unordered
+		}
+		if protoTx, ok := sdkTx.(protoTx); ok {
+			dbTx.FeePayer, dbTx.FeeGranter = a.FeePayerAndGranter(indexer, protoTx.GetProtoTx())
 		}
 		if err = dbTx.Hash.Set(tx.Hash()); err != nil {
 			a.log.Warn(
@@ -133,7 +213,7 @@ func (a *IBCTransferAction) IndexIBCTransfers(ctx context.Context, indexer *inde
 				zap.Int("total_txs", len(block.Block.Data.Txs)),
 				zap.Error(err),
 			)
-			continue
+			return nil
 		}
 		if err = dbTx.Timestamp.Set(block.Block.Time); err != nil {
 			a.log.Warn(
@@ -145,13 +225,28 @@ func (a *IBCTransferAction) IndexIBCTransfers(ctx context.Context, indexer *inde
 				zap.Int("total_txs", len(block.Block.Data.Txs)),
 				zap.Error(err),
 			)
-			continue
+			return nil
 		}
 
 		// If the TxResult contains errors build a valid JSON string with the error message
 		rawLog := txRes.TxResult.Log
+		if txRes.TxResult.Code == 0 && !indexer.StoreSuccessLog {
+			// Successful tx logs are a JSON array of msg logs, so an empty array is stored in their place
+			rawLog = "[]"
+		}
 		if txRes.TxResult.Code > 0 {
-			rawLog = fmt.Sprintf("{\"error\":\"%s\"}", txRes.TxResult.Log)
+			rawLog, err = indexer.FailedTxRawLog(txRes.TxResult.Code, txRes.TxResult.Log)
+			if err != nil {
+				a.log.Warn(
+					"Failed to build raw log for failed tx",
+					zap.Int64("height", block.Block.Height),
+					zap.String("tx_hash", string(tx.Hash())),
+					zap.Int("tx_index", index+1),
+					zap.Int("total_txs", len(block.Block.Data.Txs)),
+					zap.Error(err),
+				)
+				return nil
+			}
 		}
 
 		if err = dbTx.RawLog.Set(rawLog); err != nil {
@@ -164,18 +259,119 @@ func (a *IBCTransferAction) IndexIBCTransfers(ctx context.Context, indexer *inde
 				zap.Int("total_txs", len(block.Block.Data.Txs)),
 				zap.Error(err),
 			)
-			continue
+			return nil
+		}
+
+		if indexer.EventsSummary {
+			if err = dbTx.EventsSummary.Set(indexer.SummarizeEvents(txRes.TxResult.Events)); err != nil {
+				a.log.Warn(
+					"Failed to set events summary on Tx model",
+					zap.Int64("height", block.Block.Height),
+					zap.String("tx_hash", string(tx.Hash())),
+					zap.Int("tx_index", index+1),
+					zap.Int("total_txs", len(block.Block.Data.Txs)),
+					zap.Error(err),
+				)
+				return nil
+			}
 		}
 
-		result := indexer.DB.Create(dbTx)
-		a.LogTxInsertion(result.Error, index, len(sdkTx.GetMsgs()), len(block.Block.Data.Txs), block.Block.Height)
+		if !progress.Written(index, -1) {
+			indexer.Write(a.Name(), dbTx, func(err error) {
+				a.LogTxInsertion(err, index, len(sdkTx.GetMsgs()), len(block.Block.Data.Txs), block.Block.Height)
+				tracker.written(index, -1, err)
+			})
+		}
+
+		// The msg logs hold the sequences of the sent packets and tell which received packets credited tokens
+		var msgLogs sdk.ABCIMessageLogs
+		if txRes.TxResult.Code == 0 {
+			if msgLogs, err = sdk.ParseABCILogs(txRes.TxResult.Log); err != nil {
+				a.log.Debug(
+					"Failed to parse tx logs",
+					zap.Int64("height", block.Block.Height),
+					zap.Int("tx_index", index+1),
+					zap.Int("total_txs", len(block.Block.Data.Txs)),
+					zap.Error(err),
+				)
+			}
+		}
 
 		// Parse the msgs in the tx
 		for msgIndex, msg := range sdkTx.GetMsgs() {
-			a.HandleIBCMsg(indexer, msg, msgIndex, block.Block.Height, tx.Hash())
+			if progress.Written(index, msgIndex) {
+				continue
+			}
+			// Failed txs have no msg logs, nor do txs whose log failed to be parsed
+			var msgLog sdk.ABCIMessageLog
+			if msgIndex < len(msgLogs) {
+				msgLog = msgLogs[msgIndex]
+			}
+
+			// The msg only counts as written once each of its rows was written
+			var writeErr error
+			onWritten := func(err error) {
+				if err != nil && writeErr == nil {
+					writeErr = err
+				}
+			}
+			a.HandleIBCMsg(ctx, indexer, msg, msgLog, txRes.TxResult.Code, msgIndex, block.Block.Height, block.Block.Time, tx.Hash(), onWritten)
+			if indexer.NormalizedTransfers && msgIndex < len(msgLogs) {
+				a.HandleNormalizedTransfer(indexer, msg, msgLog, msgIndex, block.Block.Height, tx.Hash(), onWritten)
+			}
+			tracker.written(index, msgIndex, writeErr)
+
+			// The failed write aborted the block transaction, the block is rolled back and retried as a whole
+			if writeErr != nil && indexer.InBlockTx() {
+				return writeErr
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return indexer.ClearMsgProgress(a.Name(), block.Block.Height)
+}
+
+// progressTracker records the msg progress of a block as its writes succeed. Once a write failed the progress stops
+// advancing for the rest of the block, so a resumed run never skips a msg that wasn't written. Msg progress requires
+// the txs to be processed one at a time without batching, so the writes are reported in order.
+type progressTracker struct {
+	a       *IBCTransferAction
+	indexer *indexer.Indexer
+	height  int64
+
+	mu     sync.Mutex
+	failed bool
+}
+
+// written records the outcome of writing the msg at msgIndex of the tx at txIndex, -1 for the tx itself.
+func (t *progressTracker) written(txIndex, msgIndex int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.failed = true
+	}
+	if t.failed {
+		return
+	}
+	t.a.saveMsgProgress(t.indexer, t.height, txIndex, msgIndex)
+}
+
+// saveMsgProgress records the msg progress for the block, failures only cost re-attempting writes on resume
+// so they are logged rather than failing the block.
+func (a *IBCTransferAction) saveMsgProgress(indexer *indexer.Indexer, height int64, txIndex, msgIndex int) {
+	if err := indexer.SaveMsgProgress(a.Name(), height, txIndex, msgIndex); err != nil {
+		a.log.Warn(
+			"Failed to save msg progress",
+			zap.Int64("height", height),
+			zap.Int("tx_index", txIndex+1),
+			zap.Int("msg_index", msgIndex),
+			zap.Error(err),
+		)
 	}
-	return nil
 }
 
 // LogTxInsertion appropriately logs a successful or failed attempt to write a tx to the database instance.
@@ -201,12 +397,74 @@ func (a *IBCTransferAction) LogTxInsertion(err error, msgIndex, msgCount, txCoun
 	)
 }
 
-// HandleIBCMsg checks if the specified sdk.Msg is a MsgTransfer, MsgRecvPacket, MsgTimeout or MsgAcknowledgement
-// and if so it attempts to index the msg data into the database instance.
-func (a *IBCTransferAction) HandleIBCMsg(indexer *indexer.Indexer, msg sdk.Msg, msgIndex int, height int64, hash []byte) {
+// UpdateTransferVolume adds the amount of the specified transfer to the daily volume rollup
+// for the transfer's chain and denom, creating the rollup row if it doesn't exist yet.
+func (a *IBCTransferAction) UpdateTransferVolume(indexer *indexer.Indexer, transfer *MsgTransfer, blockTime time.Time) error {
+	volume := &TransferVolumeDaily{
+		ChainID:     indexer.Client.Config.ChainID,
+		Denom:       transfer.Denom,
+		Day:         blockTime.UTC().Truncate(24 * time.Hour),
+		TotalAmount: transfer.Amount,
+		Count:       1,
+	}
+
+	return indexer.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chain_id"}, {Name: "denom"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"total_amount": gorm.Expr("transfer_volume_daily.total_amount + excluded.total_amount"),
+			"count":        gorm.Expr("transfer_volume_daily.count + excluded.count"),
+		}),
+	}).Create(volume).Error
+}
+
+// FeePayerAndGranter returns the fee payer and fee granter of the tx, each nil when it can't be determined or isn't set.
+// Without an explicit fee payer the fees are paid by the first signer, whose address is derived from its public key.
+func (a *IBCTransferAction) FeePayerAndGranter(indexer *indexer.Indexer, tx *txtypes.Tx) (payer, granter *string) {
+	if tx == nil || tx.AuthInfo == nil {
+		return nil, nil
+	}
+
+	if fee := tx.AuthInfo.Fee; fee != nil {
+		if fee.Payer != "" {
+			feePayer := fee.Payer
+			payer = &feePayer
+		}
+		if fee.Granter != "" {
+			feeGranter := fee.Granter
+			granter = &feeGranter
+		}
+	}
+
+	if payer == nil && len(tx.AuthInfo.SignerInfos) > 0 && tx.AuthInfo.SignerInfos[0].PublicKey != nil {
+		if pubKey, ok := tx.AuthInfo.SignerInfos[0].PublicKey.GetCachedValue().(cryptotypes.PubKey); ok {
+			feePayer, err := indexer.Client.EncodeBech32AccAddr(sdk.AccAddress(pubKey.Address()))
+			if err != nil {
+				a.log.Debug(
+					"Failed to encode fee payer address",
+					zap.Error(err),
+				)
+			} else {
+				payer = &feePayer
+			}
+		}
+	}
+	return payer, granter
+}
+
+// HandleIBCMsg checks if the specified sdk.Msg is a MsgTransfer, MsgRecvPacket, MsgTimeout, MsgAcknowledgement
+// or MsgUpdateClient and if so it attempts to index the msg data into the database instance. log is the msg log,
+// which is empty for failed txs, it's used for the sequence of the packet sent by a MsgTransfer. code is the result
+// code of the tx, the transfers of failed txs are indexed but left out of the daily volume rollup. onWritten, if not
+// nil, is called with the outcome of the write of the msg's row, it isn't called for msgs that aren't indexed.
+func (a *IBCTransferAction) HandleIBCMsg(ctx context.Context, indexer *indexer.Indexer, msg sdk.Msg, log sdk.ABCIMessageLog, code uint32, msgIndex int, height int64, blockTime time.Time, hash []byte, onWritten func(err error)) {
+	if onWritten == nil {
+		onWritten = func(error) {}
+	}
+
 	switch m := msg.(type) {
 	case *transfertypes.MsgTransfer:
 		transfer := &MsgTransfer{
+			ChainID:    indexer.Client.Config.ChainID,
 			TxHash:     pgtype.Bytea{},
 			MsgIndex:   msgIndex,
 			Signer:     m.Sender,
@@ -228,18 +486,60 @@ func (a *IBCTransferAction) HandleIBCMsg(indexer *indexer.Indexer, msg sdk.Msg,
 			)
 		}
 
-		result := indexer.DB.Create(transfer)
-		if result.Error != nil {
-			a.log.Warn(
-				"Failed to insert MsgTransfer into DB",
+		indexer.EnrichDenom(ctx, m.Token.Denom)
+
+		transfer.TimeoutRevisionNumber, transfer.TimeoutHeight, transfer.TimeoutTimestamp = timeoutColumns(m.TimeoutHeight, m.TimeoutTimestamp)
+		transfer.Sequence = sentPacketSequence(log)
+
+		// The destination chain isn't part of the msg, it's derived on a best effort basis from the channel's client
+		dstChainID, err := a.dstChains.Resolve(ctx, indexer, m.SourcePort, m.SourceChannel)
+		if err != nil {
+			a.log.Debug(
+				"Failed to resolve destination chain id of MsgTransfer",
 				zap.Int64("height", height),
-				zap.String("tx_hash", string(hash)),
-				zap.Int("msg_index", msgIndex),
-				zap.Error(result.Error),
+				zap.String("src_port", m.SourcePort),
+				zap.String("src_channel", m.SourceChannel),
+				zap.Error(err),
 			)
 		}
+		if dstChainID != "" {
+			transfer.DstChainID = &dstChainID
+		}
+
+		indexer.WriteInserted(a.Name(), transfer, func(inserted bool, err error) {
+			// The volume update is one of the msg's writes as well
+			defer func() { onWritten(err) }()
+
+			if err != nil {
+				a.log.Warn(
+					"Failed to insert MsgTransfer into DB",
+					zap.Int64("height", height),
+					zap.String("tx_hash", string(hash)),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+				return
+			}
+
+			// Transfers of failed txs never moved any tokens, and only transfers that were inserted are rolled up so
+			// re-indexing a block doesn't count a transfer twice
+			if code != 0 || !inserted {
+				return
+			}
+
+			if err = a.UpdateTransferVolume(indexer, transfer, blockTime); err != nil {
+				a.log.Warn(
+					"Failed to update daily transfer volume",
+					zap.Int64("height", height),
+					zap.String("tx_hash", string(hash)),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+			}
+		})
 	case *channeltypes.MsgRecvPacket:
 		recv := &MsgRecvPacket{
+			ChainID:    indexer.Client.Config.ChainID,
 			TxHash:     pgtype.Bytea{},
 			MsgIndex:   msgIndex,
 			Signer:     m.Signer,
@@ -247,7 +547,9 @@ func (a *IBCTransferAction) HandleIBCMsg(indexer *indexer.Indexer, msg sdk.Msg,
 			DstChannel: m.Packet.DestinationChannel,
 			SrcPort:    m.Packet.SourcePort,
 			DstPort:    m.Packet.DestinationPort,
+			Sequence:   m.Packet.Sequence,
 		}
+		recv.TimeoutRevisionNumber, recv.TimeoutHeight, recv.TimeoutTimestamp = timeoutColumns(m.Packet.TimeoutHeight, m.Packet.TimeoutTimestamp)
 		if err := recv.TxHash.Set(hash); err != nil {
 			a.log.Warn(
 				"Failed to set tx hash on MsgRecvPacket model",
@@ -258,18 +560,22 @@ func (a *IBCTransferAction) HandleIBCMsg(indexer *indexer.Indexer, msg sdk.Msg,
 			)
 		}
 
-		result := indexer.DB.Create(recv)
-		if result.Error != nil {
-			a.log.Warn(
-				"Failed to insert MsgRecvPacket into DB",
-				zap.Int64("height", height),
-				zap.String("tx_hash", string(hash)),
-				zap.Int("msg_index", msgIndex),
-				zap.Error(result.Error),
-			)
-		}
+		indexer.Write(a.Name(), recv, func(err error) {
+			defer onWritten(err)
+
+			if err != nil {
+				a.log.Warn(
+					"Failed to insert MsgRecvPacket into DB",
+					zap.Int64("height", height),
+					zap.String("tx_hash", string(hash)),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+			}
+		})
 	case *channeltypes.MsgTimeout:
 		timeout := &MsgTimeout{
+			ChainID:    indexer.Client.Config.ChainID,
 			TxHash:     pgtype.Bytea{},
 			MsgIndex:   msgIndex,
 			Signer:     m.Signer,
@@ -277,7 +583,9 @@ func (a *IBCTransferAction) HandleIBCMsg(indexer *indexer.Indexer, msg sdk.Msg,
 			DstChannel: m.Packet.DestinationChannel,
 			SrcPort:    m.Packet.SourcePort,
 			DstPort:    m.Packet.DestinationPort,
+			Sequence:   m.Packet.Sequence,
 		}
+		timeout.TimeoutRevisionNumber, timeout.TimeoutHeight, timeout.TimeoutTimestamp = timeoutColumns(m.Packet.TimeoutHeight, m.Packet.TimeoutTimestamp)
 		if err := timeout.TxHash.Set(hash); err != nil {
 			a.log.Warn(
 				"Failed to set tx hash on MsgTimeout model",
@@ -288,18 +596,22 @@ func (a *IBCTransferAction) HandleIBCMsg(indexer *indexer.Indexer, msg sdk.Msg,
 			)
 		}
 
-		result := indexer.DB.Create(timeout)
-		if result.Error != nil {
-			a.log.Warn(
-				"Failed to insert MsgTimeout into DB",
-				zap.Int64("height", height),
-				zap.String("hash", string(hash)),
-				zap.Int("msg_index", msgIndex),
-				zap.Error(result.Error),
-			)
-		}
+		indexer.Write(a.Name(), timeout, func(err error) {
+			defer onWritten(err)
+
+			if err != nil {
+				a.log.Warn(
+					"Failed to insert MsgTimeout into DB",
+					zap.Int64("height", height),
+					zap.String("hash", string(hash)),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+			}
+		})
 	case *channeltypes.MsgAcknowledgement:
 		ack := &MsgAcknowledgement{
+			ChainID:    indexer.Client.Config.ChainID,
 			TxHash:     pgtype.Bytea{},
 			MsgIndex:   msgIndex,
 			Signer:     m.Signer,
@@ -307,7 +619,9 @@ func (a *IBCTransferAction) HandleIBCMsg(indexer *indexer.Indexer, msg sdk.Msg,
 			DstChannel: m.Packet.DestinationChannel,
 			SrcPort:    m.Packet.SourcePort,
 			DstPort:    m.Packet.DestinationPort,
+			Sequence:   m.Packet.Sequence,
 		}
+		ack.TimeoutRevisionNumber, ack.TimeoutHeight, ack.TimeoutTimestamp = timeoutColumns(m.Packet.TimeoutHeight, m.Packet.TimeoutTimestamp)
 		if err := ack.TxHash.Set(hash); err != nil {
 			a.log.Warn(
 				"Failed to set tx hash on MsgAcknowledgement model",
@@ -317,18 +631,131 @@ func (a *IBCTransferAction) HandleIBCMsg(indexer *indexer.Indexer, msg sdk.Msg,
 				zap.Error(err),
 			)
 		}
+		if err := ack.Acknowledgement.Set(m.Acknowledgement); err != nil {
+			a.log.Warn(
+				"Failed to set acknowledgement bytes on MsgAcknowledgement model",
+				zap.Int64("height", height),
+				zap.String("tx_hash", string(hash)),
+				zap.Int("msg_index", msgIndex),
+				zap.Error(err),
+			)
+		}
 
-		result := indexer.DB.Create(ack)
-		if result.Error != nil {
+		// Acks are only parsed on a best effort basis, the raw bytes are always stored
+		var channelAck channeltypes.Acknowledgement
+		if err := transfertypes.ModuleCdc.UnmarshalJSON(m.Acknowledgement, &channelAck); err != nil {
+			a.log.Debug(
+				"Failed to parse acknowledgement on MsgAcknowledgement",
+				zap.Int64("height", height),
+				zap.String("tx_hash", string(hash)),
+				zap.Int("msg_index", msgIndex),
+				zap.Error(err),
+			)
+		} else {
+			ack.Success = channelAck.Success()
+			ack.Error = channelAck.GetError()
+		}
+
+		indexer.Write(a.Name(), ack, func(err error) {
+			defer onWritten(err)
+
+			if err != nil {
+				a.log.Warn(
+					"Failed to insert MsgAcknowledgement into DB",
+					zap.Int64("height", height),
+					zap.String("hash", string(hash)),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+			}
+		})
+	case *clienttypes.MsgUpdateClient:
+		update := &MsgUpdateClient{
+			ChainID:  indexer.Client.Config.ChainID,
+			TxHash:   pgtype.Bytea{},
+			MsgIndex: msgIndex,
+			Signer:   m.Signer,
+			ClientID: m.ClientId,
+		}
+		if err := update.TxHash.Set(hash); err != nil {
+			a.log.Warn(
+				"Failed to set tx hash on MsgUpdateClient model",
+				zap.Int64("height", height),
+				zap.String("tx_hash", string(hash)),
+				zap.Int("msg_index", msgIndex),
+				zap.Error(err),
+			)
+		}
+
+		// The header is packed as an Any, the cached value is populated when the tx is decoded
+		header, err := clienttypes.UnpackHeader(m.Header)
+		if err != nil {
 			a.log.Warn(
-				"Failed to insert MsgAcknowledgement into DB",
+				"Failed to unpack header on MsgUpdateClient",
 				zap.Int64("height", height),
-				zap.String("hash", string(hash)),
+				zap.String("tx_hash", string(hash)),
 				zap.Int("msg_index", msgIndex),
-				zap.Error(result.Error),
+				zap.Error(err),
 			)
+			return
+		}
+
+		update.HeaderType = m.Header.TypeUrl
+		update.RevisionNumber = header.GetHeight().GetRevisionNumber()
+		update.RevisionHeight = header.GetHeight().GetRevisionHeight()
+		if tmHeader, ok := header.(*ibctmtypes.Header); ok {
+			update.TrustedRevisionNumber = tmHeader.TrustedHeight.RevisionNumber
+			update.TrustedRevisionHeight = tmHeader.TrustedHeight.RevisionHeight
 		}
+
+		indexer.Write(a.Name(), update, func(err error) {
+			defer onWritten(err)
+
+			if err != nil {
+				a.log.Warn(
+					"Failed to insert MsgUpdateClient into DB",
+					zap.Int64("height", height),
+					zap.String("hash", string(hash)),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+			}
+		})
 	default:
 		// TODO: do we need to do anything here?
 	}
 }
+
+// timeoutColumns returns the values of the timeout columns of a packet, a zero timeout height or timestamp means
+// the timeout is disabled in which case its columns are null.
+func timeoutColumns(height clienttypes.Height, timestamp uint64) (revisionNumber, revisionHeight, timeoutTimestamp *uint64) {
+	if !height.IsZero() {
+		number, h := height.RevisionNumber, height.RevisionHeight
+		revisionNumber, revisionHeight = &number, &h
+	}
+	if timestamp != 0 {
+		timeoutTimestamp = &timestamp
+	}
+	return revisionNumber, revisionHeight, timeoutTimestamp
+}
+
+// sentPacketSequence returns the sequence of the packet sent by the msg of log, taken from its send_packet event,
+// or nil if there is no such event or its sequence can't be parsed.
+func sentPacketSequence(log sdk.ABCIMessageLog) *uint64 {
+	for _, event := range log.Events {
+		if event.Type != channeltypes.EventTypeSendPacket {
+			continue
+		}
+		for _, attr := range event.Attributes {
+			if attr.Key != channeltypes.AttributeKeySequence {
+				continue
+			}
+			sequence, err := strconv.ParseUint(attr.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			return &sequence
+		}
+	}
+	return nil
+}
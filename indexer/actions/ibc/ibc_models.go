@@ -4,32 +4,62 @@ import (
 	"time"
 
 	"github.com/jackc/pgtype"
+	"gorm.io/gorm/clause"
 )
 
 // Tx represents a single tx, which can contain many messages.
+// Tx hashes are only unique per chain, so the primary key is (chain_id, hash) and the msg models
+// reference their tx by both columns. MsgCount distinguishes txs that decode without any msgs
+// (e.g. some extension txs) from txs that simply contain no indexed msgs. EventsSummary is a map of
+// event type -> count for the tx, it is only populated when the indexer is run with --events-summary.
+// TimeoutHeight and Unordered are null for txs without a timeout height and for sdk versions without unordered txs.
+// FeePayer is the explicit fee payer or otherwise the first signer, FeeGranter is null unless the fees were paid by a feegrant.
+// RunID is the id of the indexer run that wrote the tx, it's only set when the indexer is run with --stamp-run-id.
+//
+// NOTE: AutoMigrate can't change the primary key of an existing table, databases created before
+// chain_id was part of the key need the txs and msg tables to be dropped (or re-keyed by hand) before migrating.
 type Tx struct {
-	Hash        pgtype.Bytea     `gorm:"primaryKey"`
-	Timestamp   pgtype.Timestamp `gorm:"not null"`
-	ChainID     string           `gorm:"not null"`
-	BlockHeight int64            `gorm:"not null"`
-	RawLog      pgtype.JSONB     `gorm:"not null"`
-	Code        int              `gorm:"not null"`
-	FeeAmount   string
-	FeeDenom    string
-	GasUsed     int64 `gorm:"not null"`
-	GasWanted   int64 `gorm:"not null"`
-
-	MsgTransfers        []MsgTransfer        `gorm:"foreignKey:TxHash;references:Hash"`
-	MsgRecvPackets      []MsgRecvPacket      `gorm:"foreignKey:TxHash;references:Hash"`
-	MsgAcknowledgements []MsgAcknowledgement `gorm:"foreignKey:TxHash;references:Hash"`
-	MsgTimeouts         []MsgTimeout         `gorm:"foreignKey:TxHash;references:Hash"`
+	ChainID       string           `gorm:"primaryKey"`
+	Hash          pgtype.Bytea     `gorm:"primaryKey"`
+	Timestamp     pgtype.Timestamp `gorm:"not null"`
+	BlockHeight   int64            `gorm:"not null"`
+	RawLog        pgtype.JSONB     `gorm:"not null"`
+	Code          int              `gorm:"not null"`
+	FeeAmount     string
+	FeeDenom      string
+	GasUsed       int64 `gorm:"not null"`
+	GasWanted     int64 `gorm:"not null"`
+	MsgCount      int   `gorm:"not null;default:0"`
+	EventsSummary pgtype.JSONB
+	Memo          string `gorm:"not null;default:''"`
+	TimeoutHeight *uint64
+	Unordered     *bool
+	FeePayer      *string
+	FeeGranter    *string
+	RunID         *string `gorm:"index"`
+
+	MsgTransfers        []MsgTransfer        `gorm:"foreignKey:ChainID,TxHash;references:ChainID,Hash"`
+	MsgRecvPackets      []MsgRecvPacket      `gorm:"foreignKey:ChainID,TxHash;references:ChainID,Hash"`
+	MsgAcknowledgements []MsgAcknowledgement `gorm:"foreignKey:ChainID,TxHash;references:ChainID,Hash"`
+	MsgTimeouts         []MsgTimeout         `gorm:"foreignKey:ChainID,TxHash;references:ChainID,Hash"`
+	MsgUpdateClients    []MsgUpdateClient    `gorm:"foreignKey:ChainID,TxHash;references:ChainID,Hash"`
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// OnConflict makes writing a tx that was already indexed, e.g. when re-indexing a block, a no-op.
+func (Tx) OnConflict() clause.OnConflict {
+	return clause.OnConflict{DoNothing: true}
+}
+
 // MsgTransfer represents an IBC MsgTransfer packet for fungible token transfers.
+// DstChainID is derived from the client of the source channel and is null when it can't be resolved.
+// The timeout columns are null when the transfer doesn't set them, TimeoutTimestamp is in nanoseconds since the unix epoch.
+// Sequence is the sequence of the packet sent on the source channel, it's taken from the send_packet event of the msg
+// and is null for failed txs or when the event couldn't be found.
 type MsgTransfer struct {
+	ChainID    string       `gorm:"primaryKey"`
 	TxHash     pgtype.Bytea `gorm:"primaryKey"`
 	MsgIndex   int          `gorm:"primaryKey;autoIncrement:false"`
 	Signer     string       `gorm:"not null"`
@@ -40,9 +70,24 @@ type MsgTransfer struct {
 	SrcChannel string       `gorm:"not null"`
 	SrcPort    string       `gorm:"not null"`
 	Route      string       `gorm:"not null"`
+	DstChainID *string
+
+	TimeoutRevisionNumber *uint64
+	TimeoutHeight         *uint64
+	TimeoutTimestamp      *uint64
+	Sequence              *uint64 `gorm:"index"`
 }
 
+// OnConflict makes writing a msg that was already indexed, e.g. when re-indexing a block, a no-op.
+func (MsgTransfer) OnConflict() clause.OnConflict {
+	return clause.OnConflict{DoNothing: true}
+}
+
+// MsgRecvPacket represents an IBC MsgRecvPacket. Sequence, along with the source port and channel, identifies the
+// packet so it can be correlated with the MsgTransfer that sent it and the MsgAcknowledgement or MsgTimeout of it.
+// Sequence is zero for rows written before it was added, the timeout columns are the same as those of MsgTransfer.
 type MsgRecvPacket struct {
+	ChainID    string       `gorm:"primaryKey"`
 	TxHash     pgtype.Bytea `gorm:"primaryKey"`
 	MsgIndex   int          `gorm:"primaryKey;autoIncrement:false"`
 	Signer     string       `gorm:"not null"`
@@ -50,19 +95,48 @@ type MsgRecvPacket struct {
 	DstChannel string       `gorm:"not null"`
 	SrcPort    string       `gorm:"not null"`
 	DstPort    string       `gorm:"not null"`
+	Sequence   uint64       `gorm:"not null;default:0;index"`
+
+	TimeoutRevisionNumber *uint64
+	TimeoutHeight         *uint64
+	TimeoutTimestamp      *uint64
+}
+
+// OnConflict makes writing a msg that was already indexed, e.g. when re-indexing a block, a no-op.
+func (MsgRecvPacket) OnConflict() clause.OnConflict {
+	return clause.OnConflict{DoNothing: true}
 }
 
+// MsgAcknowledgement represents an IBC MsgAcknowledgement. Acknowledgement holds the raw ack bytes,
+// so acks that can't be parsed as a standard channel acknowledgement (e.g. wasm hook callbacks) can still be inspected.
+// The packet columns are the same as those of MsgRecvPacket.
 type MsgAcknowledgement struct {
-	TxHash     pgtype.Bytea `gorm:"primaryKey"`
-	MsgIndex   int          `gorm:"primaryKey;autoIncrement:false"`
-	Signer     string       `gorm:"not null"`
-	SrcChannel string       `gorm:"not null"`
-	DstChannel string       `gorm:"not null"`
-	SrcPort    string       `gorm:"not null"`
-	DstPort    string       `gorm:"not null"`
+	ChainID         string       `gorm:"primaryKey"`
+	TxHash          pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex        int          `gorm:"primaryKey;autoIncrement:false"`
+	Signer          string       `gorm:"not null"`
+	SrcChannel      string       `gorm:"not null"`
+	DstChannel      string       `gorm:"not null"`
+	SrcPort         string       `gorm:"not null"`
+	DstPort         string       `gorm:"not null"`
+	Acknowledgement pgtype.Bytea
+	Success         bool `gorm:"not null"`
+	Error           string
+	Sequence        uint64 `gorm:"not null;default:0;index"`
+
+	TimeoutRevisionNumber *uint64
+	TimeoutHeight         *uint64
+	TimeoutTimestamp      *uint64
 }
 
+// OnConflict makes writing a msg that was already indexed, e.g. when re-indexing a block, a no-op.
+func (MsgAcknowledgement) OnConflict() clause.OnConflict {
+	return clause.OnConflict{DoNothing: true}
+}
+
+// MsgTimeout represents an IBC MsgTimeout, the packet columns are the same as those of MsgRecvPacket.
 type MsgTimeout struct {
+	ChainID    string       `gorm:"primaryKey"`
 	TxHash     pgtype.Bytea `gorm:"primaryKey"`
 	MsgIndex   int          `gorm:"primaryKey;autoIncrement:false"`
 	Signer     string       `gorm:"not null"`
@@ -70,6 +144,82 @@ type MsgTimeout struct {
 	DstChannel string       `gorm:"not null"`
 	SrcPort    string       `gorm:"not null"`
 	DstPort    string       `gorm:"not null"`
+	Sequence   uint64       `gorm:"not null;default:0;index"`
+
+	TimeoutRevisionNumber *uint64
+	TimeoutHeight         *uint64
+	TimeoutTimestamp      *uint64
+}
+
+// OnConflict makes writing a msg that was already indexed, e.g. when re-indexing a block, a no-op.
+func (MsgTimeout) OnConflict() clause.OnConflict {
+	return clause.OnConflict{DoNothing: true}
+}
+
+// MsgUpdateClient represents an IBC MsgUpdateClient, the height fields are used for tracking client staleness.
+// TrustedRevisionNumber and TrustedRevisionHeight are only populated for headers that carry a trusted height
+// (e.g. 07-tendermint headers), otherwise they are left as zero.
+type MsgUpdateClient struct {
+	ChainID               string       `gorm:"primaryKey"`
+	TxHash                pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex              int          `gorm:"primaryKey;autoIncrement:false"`
+	Signer                string       `gorm:"not null"`
+	ClientID              string       `gorm:"not null"`
+	HeaderType            string       `gorm:"not null"`
+	RevisionNumber        uint64       `gorm:"not null"`
+	RevisionHeight        uint64       `gorm:"not null"`
+	TrustedRevisionNumber uint64       `gorm:"not null"`
+	TrustedRevisionHeight uint64       `gorm:"not null"`
+}
+
+// OnConflict makes writing a msg that was already indexed, e.g. when re-indexing a block, a no-op.
+func (MsgUpdateClient) OnConflict() clause.OnConflict {
+	return clause.OnConflict{DoNothing: true}
+}
+
+// Transfer is a normalized ics-20 transfer, so transfers leaving and entering the chain can be queried from one table.
+// Outgoing transfers are written for MsgTransfers and incoming transfers for MsgRecvPackets that credited tokens,
+// only for successful txs and only when the indexer is run with --normalized-transfers. Port and Channel are the
+// local end of the channel. Denom is the denom on this chain, i.e. the voucher denom of incoming tokens.
+// The counterparty channel and the packet sequence aren't part of a MsgTransfer, so they are null for outgoing transfers.
+// SubmittedBy tells user activity apart from relayer activity: outgoing transfers are submitted by their sender,
+// incoming ones by the relayer that delivered the packet. It's empty for rows written before it was added.
+type Transfer struct {
+	ChainID             string       `gorm:"primaryKey"`
+	TxHash              pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex            int          `gorm:"primaryKey;autoIncrement:false"`
+	Height              int64        `gorm:"not null"`
+	Direction           string       `gorm:"not null"`
+	Sender              string       `gorm:"not null"`
+	Receiver            string       `gorm:"not null"`
+	Amount              string       `gorm:"not null"`
+	Denom               string       `gorm:"not null"`
+	Port                string       `gorm:"not null"`
+	Channel             string       `gorm:"not null"`
+	SubmittedBy         string       `gorm:"not null;default:''"`
+	CounterpartyPort    *string
+	CounterpartyChannel *string
+	Sequence            *uint64
+}
+
+// OnConflict makes writing a transfer that was already indexed, e.g. when re-indexing a block, a no-op.
+func (Transfer) OnConflict() clause.OnConflict {
+	return clause.OnConflict{DoNothing: true}
+}
+
+// TransferVolumeDaily is a rollup of the MsgTransfer volume per chain, denom and UTC day.
+// It is maintained as transfers are indexed to avoid expensive aggregation at read time.
+type TransferVolumeDaily struct {
+	ChainID     string    `gorm:"primaryKey"`
+	Denom       string    `gorm:"primaryKey"`
+	Day         time.Time `gorm:"primaryKey;type:date"`
+	TotalAmount string    `gorm:"type:numeric;not null"`
+	Count       int64     `gorm:"not null"`
+}
+
+// TableName overrides the pluralized table name gorm would use by default.
+func (TransferVolumeDaily) TableName() string {
+	return "transfer_volume_daily"
 }
 
 /*
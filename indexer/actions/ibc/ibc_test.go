@@ -0,0 +1,757 @@
+package ibc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx/signing"
+	transfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
+	channeltypes "github.com/cosmos/ibc-go/v2/modules/core/04-channel/types"
+	ibctmtypes "github.com/cosmos/ibc-go/v2/modules/light-clients/07-tendermint/types"
+	"github.com/jackc/pgtype"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// newTestIndexer returns an Indexer for chainID decoding txs with the lens codec and writing to a dbtest DB.
+func newTestIndexer(t *testing.T, chainID string) (*indexer.Indexer, *dbtest.Recorder) {
+	t.Helper()
+	db, rec := dbtest.New(t)
+	return newNodeIndexer(rpctest.New(chainID), db), rec
+}
+
+// newNodeIndexer returns an Indexer for the chain of node decoding txs with the lens codec and writing to db.
+func newNodeIndexer(node *rpctest.Node, db *gorm.DB) *indexer.Indexer {
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: node.ChainID()},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(lens.ModuleBasics),
+	}
+	return indexer.NewIndexer(zap.NewNop(), client, db)
+}
+
+// encodeTx returns the bytes of a tx containing msgs, encoded with the indexer's codec.
+func encodeTx(t *testing.T, i *indexer.Indexer, msgs ...sdk.Msg) []byte {
+	t.Helper()
+	builder := i.Client.Codec.TxConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msgs...); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	bz, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+	return bz
+}
+
+// decodeTx decodes a tx with the indexer's codec, so the Anys of its msgs are unpacked as when indexing.
+func decodeTx(t *testing.T, i *indexer.Indexer, bz []byte) sdk.Tx {
+	t.Helper()
+	sdkTx, err := i.Client.Codec.TxConfig.TxDecoder()(bz)
+	if err != nil {
+		t.Fatalf("failed to decode tx: %v", err)
+	}
+	return sdkTx
+}
+
+func TestHandleMsgUpdateClient(t *testing.T) {
+	i, rec := newTestIndexer(t, "osmosis-1")
+
+	header := &ibctmtypes.Header{
+		SignedHeader:  &tmproto.SignedHeader{Header: &tmproto.Header{ChainID: "cosmoshub-4", Height: 1500}},
+		TrustedHeight: clienttypes.NewHeight(4, 1400),
+	}
+	msg, err := clienttypes.NewMsgUpdateClient("07-tendermint-1", header, "osmo1relayer")
+	if err != nil {
+		t.Fatalf("failed to build MsgUpdateClient: %v", err)
+	}
+
+	sdkTx := decodeTx(t, i, encodeTx(t, i, msg))
+	a := NewIBCTransfer(zap.NewNop())
+	a.HandleIBCMsg(context.Background(), i, sdkTx.GetMsgs()[0], sdk.ABCIMessageLog{}, 0, 0, 10, time.Now(), []byte{0x01}, nil)
+
+	rows := rec.Rows("msg_update_clients")
+	if len(rows) != 1 {
+		t.Fatalf("got %d MsgUpdateClient rows, want 1", len(rows))
+	}
+	update := rows[0].(*MsgUpdateClient)
+	if string(update.TxHash.Bytes) != "\x01" || update.MsgIndex != 0 {
+		t.Errorf("MsgUpdateClient row has tx hash %X and msg index %d", update.TxHash.Bytes, update.MsgIndex)
+	}
+
+	// heights are the revision and trusted heights of the header, parsed from an Any
+	type heights struct {
+		signer, clientID, headerType                     string
+		revision, height, trustedRevision, trustedHeight uint64
+	}
+	got := heights{update.Signer, update.ClientID, update.HeaderType, update.RevisionNumber, update.RevisionHeight, update.TrustedRevisionNumber, update.TrustedRevisionHeight}
+	want := heights{"osmo1relayer", "07-tendermint-1", "/ibc.lightclients.tendermint.v1.Header", 4, 1500, 4, 1400}
+	if got != want {
+		t.Errorf("MsgUpdateClient row = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandleMsgAcknowledgement(t *testing.T) {
+	tests := []struct {
+		name        string
+		ack         []byte
+		wantSuccess bool
+		wantError   string
+	}{
+		{"result", channeltypes.NewResultAcknowledgement([]byte{0x01}).Acknowledgement(), true, ""},
+		{"error", channeltypes.NewErrorAcknowledgement("insufficient funds").Acknowledgement(), false, "insufficient funds"},
+		{"wasm hook callback", []byte(`{"contract_result":"eyJvayI6dHJ1ZX0="}`), false, ""},
+		{"binary", []byte{0xde, 0xad, 0xbe, 0xef}, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, rec := newTestIndexer(t, "osmosis-1")
+
+			packet := channeltypes.NewPacket([]byte("{}"), 7, "transfer", "channel-0", "transfer", "channel-141", clienttypes.NewHeight(4, 2000), 0)
+			msg := channeltypes.NewMsgAcknowledgement(packet, tt.ack, []byte{0x02}, clienttypes.NewHeight(1, 10), "osmo1relayer")
+			sdkTx := decodeTx(t, i, encodeTx(t, i, msg))
+
+			a := NewIBCTransfer(zap.NewNop())
+			a.HandleIBCMsg(context.Background(), i, sdkTx.GetMsgs()[0], sdk.ABCIMessageLog{}, 0, 1, 10, time.Now(), []byte{0x01}, nil)
+
+			rows := rec.Rows("msg_acknowledgements")
+			if len(rows) != 1 {
+				t.Fatalf("got %d MsgAcknowledgement rows, want 1", len(rows))
+			}
+			got := rows[0].(*MsgAcknowledgement)
+			if string(got.Acknowledgement.Bytes) != string(tt.ack) {
+				t.Errorf("stored ack %q, want the raw ack %q", got.Acknowledgement.Bytes, tt.ack)
+			}
+			if got.Success != tt.wantSuccess || got.Error != tt.wantError {
+				t.Errorf("parsed ack as success %t error %q, want success %t error %q", got.Success, got.Error, tt.wantSuccess, tt.wantError)
+			}
+			if got.SrcChannel != "channel-0" || got.DstChannel != "channel-141" || got.MsgIndex != 1 {
+				t.Errorf("MsgAcknowledgement row = %+v", got)
+			}
+		})
+	}
+}
+
+// rollup returns the transfer volume rows keyed by chain, denom and day.
+func rollup(rows []interface{}) map[string]TransferVolumeDaily {
+	volumes := make(map[string]TransferVolumeDaily)
+	for _, row := range rows {
+		v := row.(*TransferVolumeDaily)
+		volumes[v.ChainID+"/"+v.Denom+"/"+v.Day.Format("2006-01-02")] = *v
+	}
+	return volumes
+}
+
+func TestUpdateTransferVolume(t *testing.T) {
+	i, rec := newTestIndexer(t, "osmosis-1")
+	a := NewIBCTransfer(zap.NewNop())
+
+	morning := time.Date(2022, 4, 20, 8, 0, 0, 0, time.UTC)
+	transfers := []struct {
+		coin      sdk.Coin
+		blockTime time.Time
+	}{
+		{sdk.NewInt64Coin("uosmo", 100), morning},
+		{sdk.NewInt64Coin("uosmo", 250), morning.Add(2 * time.Hour)},
+		{sdk.NewInt64Coin("uosmo", 50), morning.Add(15 * time.Hour)}, // 23:00 UTC
+		{sdk.NewInt64Coin("uatom", 7), morning.Add(3 * time.Hour)},
+		{sdk.NewInt64Coin("uosmo", 1), morning.Add(16 * time.Hour)}, // the next day
+	}
+	for j, tr := range transfers {
+		msg := transfertypes.NewMsgTransfer("transfer", "channel-0", tr.coin, "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+		a.HandleIBCMsg(context.Background(), i, msg, sdk.ABCIMessageLog{}, 0, 0, int64(10+j), tr.blockTime, []byte{byte(j)}, nil)
+	}
+	// Re-indexing a transfer must not count it twice
+	msg := transfertypes.NewMsgTransfer("transfer", "channel-0", transfers[0].coin, "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+	a.HandleIBCMsg(context.Background(), i, msg, sdk.ABCIMessageLog{}, 0, 0, 10, transfers[0].blockTime, []byte{0}, nil)
+	// The transfer of a failed tx is indexed but never moved any tokens
+	msg = transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 1000), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+	a.HandleIBCMsg(context.Background(), i, msg, sdk.ABCIMessageLog{}, 5, 0, 20, morning, []byte{0xff}, nil)
+
+	if got := len(rec.Rows("msg_transfers")); got != len(transfers)+1 {
+		t.Errorf("got %d MsgTransfer rows, want %d", got, len(transfers)+1)
+	}
+	day := time.Date(2022, 4, 20, 0, 0, 0, 0, time.UTC)
+	want := map[string]TransferVolumeDaily{
+		"osmosis-1/uosmo/2022-04-20": {ChainID: "osmosis-1", Denom: "uosmo", Day: day, TotalAmount: "400", Count: 3},
+		"osmosis-1/uatom/2022-04-20": {ChainID: "osmosis-1", Denom: "uatom", Day: day, TotalAmount: "7", Count: 1},
+		"osmosis-1/uosmo/2022-04-21": {ChainID: "osmosis-1", Denom: "uosmo", Day: day.AddDate(0, 0, 1), TotalAmount: "1", Count: 1},
+	}
+	got := rollup(rec.Rows("transfer_volume_daily"))
+	if len(got) != len(want) {
+		t.Errorf("got %d rollup rows, want %d: %+v", len(got), len(want), got)
+	}
+	for key, w := range want {
+		if g := got[key]; g != w {
+			t.Errorf("rollup %s = %+v, want %+v", key, g, w)
+		}
+	}
+}
+
+func TestUpdateTransferVolumeError(t *testing.T) {
+	i, rec := newTestIndexer(t, "osmosis-1")
+	a := NewIBCTransfer(zap.NewNop())
+
+	// The msg isn't written until its transfer is rolled up, so the block fails rather than losing the volume
+	failed := errors.New("upsert failed")
+	rec.Fail("transfer_volume_daily", failed)
+	var writeErr error
+	msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 100), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+	a.HandleIBCMsg(context.Background(), i, msg, sdk.ABCIMessageLog{}, 0, 0, 10, time.Now(), []byte{0x01}, func(err error) { writeErr = err })
+	if !errors.Is(writeErr, failed) {
+		t.Errorf("msg written with %v, want %v", writeErr, failed)
+	}
+}
+
+func TestTxHashSharedAcrossChains(t *testing.T) {
+	db, rec := dbtest.New(t)
+	a := NewIBCTransfer(zap.NewNop())
+
+	// The same tx bytes on two chains have the same hash
+	var bz []byte
+	for _, chainID := range []string{"cosmoshub-4", "osmosis-1"} {
+		node := rpctest.New(chainID)
+		i := newNodeIndexer(node, db)
+		if bz == nil {
+			msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uatom", 1), "cosmos1sender", "osmo1receiver", clienttypes.NewHeight(1, 2000), 0)
+			bz = encodeTx(t, i, msg)
+		}
+		block := node.AddBlock(10, time.Now(), [][]byte{bz}, []*abcitypes.ResponseDeliverTx{{Log: "[]"}})
+		if err := a.Execute(context.Background(), i, block); err != nil {
+			t.Fatalf("%s: Execute returned unexpected error: %v", chainID, err)
+		}
+	}
+
+	for _, table := range []string{"txes", "msg_transfers"} {
+		rows := rec.Rows(table)
+		if len(rows) != 2 {
+			t.Fatalf("got %d %s rows, want one per chain", len(rows), table)
+		}
+	}
+	txs := rec.Rows("txes")
+	first, second := txs[0].(*Tx), txs[1].(*Tx)
+	if string(first.Hash.Bytes) != string(second.Hash.Bytes) || first.ChainID == second.ChainID {
+		t.Errorf("got txs %X on %s and %X on %s, want the same hash on both chains", first.Hash.Bytes, first.ChainID, second.Hash.Bytes, second.ChainID)
+	}
+	for j, row := range rec.Rows("msg_transfers") {
+		if transfer := row.(*MsgTransfer); transfer.ChainID != txs[j].(*Tx).ChainID {
+			t.Errorf("MsgTransfer %d is on %s, want the chain of its tx %s", j, transfer.ChainID, txs[j].(*Tx).ChainID)
+		}
+	}
+}
+
+func TestZeroMsgTx(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	a := NewIBCTransfer(zap.NewNop())
+
+	msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 1), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+	txs := [][]byte{encodeTx(t, i), encodeTx(t, i, msg)}
+	node.AddBlock(10, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{Log: "[]"}, {Log: "[]"}})
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := rec.Rows("txes")
+	if len(rows) != 2 {
+		t.Fatalf("got %d Tx rows, want the zero-message tx to be recorded too", len(rows))
+	}
+	counts := make(map[string]int)
+	for _, row := range rows {
+		tx := row.(*Tx)
+		counts[fmt.Sprintf("%X", tx.Hash.Bytes)] = tx.MsgCount
+	}
+	for j, bz := range txs {
+		hash := fmt.Sprintf("%X", tmtypes.Tx(bz).Hash())
+		if got, ok := counts[hash]; !ok || got != j {
+			t.Errorf("tx %d has msg count %d, want %d", j, got, j)
+		}
+	}
+}
+
+func TestResumeMsgProgress(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	i.TrackMsgProgress = true
+	i.ConcurrentTxs = 1
+	a := NewIBCTransfer(zap.NewNop())
+
+	transfer := func(amount int64) sdk.Msg {
+		return transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", amount), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+	}
+	var txs [][]byte
+	for j := int64(0); j < 3; j++ {
+		txs = append(txs, encodeTx(t, i, transfer(10*j), transfer(10*j+1)))
+	}
+	node.AddBlock(10, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{Log: "[]"}, {Log: "[]"}, {Log: "[]"}})
+
+	// A previous run was interrupted after writing the first msg of the second tx
+	if err := i.SaveMsgProgress(a.Name(), 10, 1, 0); err != nil {
+		t.Fatalf("SaveMsgProgress returned unexpected error: %v", err)
+	}
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	var amounts []string
+	for _, row := range rec.Rows("msg_transfers") {
+		amounts = append(amounts, row.(*MsgTransfer).Amount)
+	}
+	if want := []string{"11", "20", "21"}; !reflect.DeepEqual(amounts, want) {
+		t.Errorf("wrote transfers of %v, want only the msgs after the progress %v", amounts, want)
+	}
+	if rows := rec.Rows("txes"); len(rows) != 1 || string(rows[0].(*Tx).Hash.Bytes) != string(tmtypes.Tx(txs[2]).Hash()) {
+		t.Errorf("got %d Tx rows, want only the last tx to be written", len(rows))
+	}
+	if rows := rec.Rows("msg_progresses"); len(rows) != 0 {
+		t.Errorf("got msg progress %+v after the block was indexed, want it cleared", rows[0])
+	}
+}
+
+func TestResumeMsgProgressAfterFailedWrite(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	i.TrackMsgProgress = true
+	i.ConcurrentTxs = 1
+	a := NewIBCTransfer(zap.NewNop())
+
+	transfer := func(amount int64) sdk.Msg {
+		return transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", amount), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+	}
+	packet := channeltypes.NewPacket([]byte("{}"), 7, "transfer", "channel-0", "transfer", "channel-141", clienttypes.NewHeight(4, 2000), 0)
+	ack := channeltypes.NewMsgAcknowledgement(packet, channeltypes.NewResultAcknowledgement([]byte{0x01}).Acknowledgement(), []byte{0x02}, clienttypes.NewHeight(1, 10), "osmo1relayer")
+	txs := [][]byte{encodeTx(t, i, transfer(1)), encodeTx(t, i, ack, transfer(2)), encodeTx(t, i, transfer(3))}
+	block := node.AddBlock(10, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{Log: "[]"}, {Log: "[]"}, {Log: "[]"}})
+
+	// The first run fails to write the ack and is interrupted once the transfer following it was written
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := db.Callback().Create().After("gorm:create").Register("test:interrupt", func(db *gorm.DB) {
+		if row, ok := db.Statement.Dest.(*MsgTransfer); ok && row.Amount == "2" {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to register callback: %v", err)
+	}
+	rec.Fail("msg_acknowledgements", errors.New("insert failed"))
+	if err := a.Execute(ctx, i, block); err == nil {
+		t.Fatal("Execute returned no error once interrupted")
+	}
+
+	// The resumed run only skips the msgs written before the failed ack
+	rec.Fail("msg_acknowledgements", nil)
+	if err := a.Execute(context.Background(), i, block); err != nil {
+		t.Fatalf("Execute returned unexpected error: %v", err)
+	}
+	if rows := rec.Rows("msg_acknowledgements"); len(rows) != 1 {
+		t.Errorf("got %d MsgAcknowledgement rows, want the ack written on resume", len(rows))
+	}
+	var amounts []string
+	for _, row := range rec.Rows("msg_transfers") {
+		amounts = append(amounts, row.(*MsgTransfer).Amount)
+	}
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(amounts, want) {
+		t.Errorf("wrote transfers of %v, want %v", amounts, want)
+	}
+	if rows := rec.Rows("txes"); len(rows) != 3 {
+		t.Errorf("got %d Tx rows, want 3", len(rows))
+	}
+}
+
+func TestEventsSummary(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		node := rpctest.New("osmosis-1")
+		db, rec := dbtest.New(t)
+		i := newNodeIndexer(node, db)
+		i.EventsSummary = enabled
+		a := NewIBCTransfer(zap.NewNop())
+
+		msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 1), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+		events := []abcitypes.Event{{Type: "message"}, {Type: "transfer"}, {Type: "send_packet"}, {Type: "transfer"}}
+		node.AddBlock(10, time.Now(), [][]byte{encodeTx(t, i, msg)}, []*abcitypes.ResponseDeliverTx{{Log: "[]", Events: events}})
+		if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+			t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+		}
+
+		rows := rec.Rows("txes")
+		if len(rows) != 1 {
+			t.Fatalf("got %d Tx rows, want 1", len(rows))
+		}
+		summary := rows[0].(*Tx).EventsSummary
+		if !enabled {
+			if summary.Status != pgtype.Null {
+				t.Errorf("got events summary %s with the summary disabled, want NULL", summary.Bytes)
+			}
+			continue
+		}
+		var got map[string]int
+		if err := summary.AssignTo(&got); err != nil {
+			t.Fatalf("failed to decode events summary %s: %v", summary.Bytes, err)
+		}
+		if want := map[string]int{"message": 1, "transfer": 2, "send_packet": 1}; !reflect.DeepEqual(got, want) {
+			t.Errorf("events summary = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTxTimeoutHeight(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	a := NewIBCTransfer(zap.NewNop())
+
+	msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 1), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+	builder := i.Client.Codec.TxConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msg); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	builder.SetMemo("ibc memo")
+	builder.SetTimeoutHeight(25)
+	timeoutTx, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+
+	txs := [][]byte{timeoutTx, encodeTx(t, i, msg)}
+	node.AddBlock(10, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{Log: "[]"}, {Log: "[]"}})
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := make(map[string]*Tx)
+	for _, row := range rec.Rows("txes") {
+		tx := row.(*Tx)
+		rows[string(tx.Hash.Bytes)] = tx
+	}
+	got := rows[string(tmtypes.Tx(txs[0]).Hash())]
+	if got == nil || got.Memo != "ibc memo" || got.TimeoutHeight == nil || *got.TimeoutHeight != 25 {
+		t.Errorf("Tx row = %+v, want memo \"ibc memo\" and timeout height 25", got)
+	}
+	// The sdk version the indexer is built against doesn't support unordered txs
+	if got != nil && got.Unordered != nil {
+		t.Errorf("Tx row has unordered flag %t, want null", *got.Unordered)
+	}
+	if got := rows[string(tmtypes.Tx(txs[1]).Hash())]; got == nil || got.Memo != "" || got.TimeoutHeight != nil {
+		t.Errorf("Tx row = %+v, want no memo and a null timeout height", got)
+	}
+}
+
+func TestFailedTxRawLog(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	i.FailedRawLog = indexer.RawLogPolicy{MaxSize: 32}
+	a := NewIBCTransfer(zap.NewNop())
+
+	msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 1), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+	oversized := strings.Repeat("insufficient funds ", 1000)
+	node.AddBlock(10, time.Now(), [][]byte{encodeTx(t, i, msg)}, []*abcitypes.ResponseDeliverTx{{Code: 5, Log: oversized}})
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := rec.Rows("txes")
+	if len(rows) != 1 {
+		t.Fatalf("got %d Tx rows, want 1", len(rows))
+	}
+	var rawLog struct {
+		Code      uint32 `json:"code"`
+		Error     string `json:"error"`
+		Truncated bool   `json:"truncated"`
+	}
+	if err := rows[0].(*Tx).RawLog.AssignTo(&rawLog); err != nil {
+		t.Fatalf("failed to read raw log: %v", err)
+	}
+	if rawLog.Code != 5 || !rawLog.Truncated || rawLog.Error != oversized[:32] {
+		t.Errorf("raw log = %+v, want code 5 with the error truncated to 32 bytes", rawLog)
+	}
+}
+
+func TestStoreSuccessLog(t *testing.T) {
+	successLog := `[{"msg_index":0,"events":[{"type":"send_packet","attributes":[{"key":"packet_sequence","value":"1"}]}]}]`
+	for _, store := range []bool{true, false} {
+		node := rpctest.New("osmosis-1")
+		db, rec := dbtest.New(t)
+		i := newNodeIndexer(node, db)
+		i.StoreSuccessLog = store
+		a := NewIBCTransfer(zap.NewNop())
+
+		transfer := func(amount int64) []byte {
+			msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", amount), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 0)
+			return encodeTx(t, i, msg)
+		}
+		txs := [][]byte{transfer(1), transfer(2)}
+		node.AddBlock(10, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{Log: successLog}, {Code: 5, Log: "insufficient funds"}})
+		if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+			t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+		}
+
+		rawLogs := make(map[string]string)
+		for _, row := range rec.Rows("txes") {
+			tx := row.(*Tx)
+			rawLogs[string(tx.Hash.Bytes)] = string(tx.RawLog.Bytes)
+		}
+		wantSuccess := "[]"
+		if store {
+			wantSuccess = successLog
+		}
+		if got := rawLogs[string(tmtypes.Tx(txs[0]).Hash())]; got != wantSuccess {
+			t.Errorf("store success log %t: successful tx raw log = %s, want %s", store, got, wantSuccess)
+		}
+		if got, want := rawLogs[string(tmtypes.Tx(txs[1]).Hash())], `{"code":5,"error":"insufficient funds"}`; got != want {
+			t.Errorf("store success log %t: failed tx raw log = %s, want %s", store, got, want)
+		}
+	}
+}
+
+func TestHandleMsgTransferTimeouts(t *testing.T) {
+	i, rec := newTestIndexer(t, "osmosis-1")
+	a := NewIBCTransfer(zap.NewNop())
+
+	coin := sdk.NewInt64Coin("uosmo", 1)
+	msgs := []sdk.Msg{
+		transfertypes.NewMsgTransfer("transfer", "channel-0", coin, "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(4, 2000), 1650000000000000000),
+		transfertypes.NewMsgTransfer("transfer", "channel-0", coin, "osmo1sender", "cosmos1receiver", clienttypes.ZeroHeight(), 0),
+	}
+	for j, msg := range msgs {
+		sdkTx := decodeTx(t, i, encodeTx(t, i, msg))
+		a.HandleIBCMsg(context.Background(), i, sdkTx.GetMsgs()[0], sdk.ABCIMessageLog{}, 0, 0, 10, time.Now(), []byte{byte(j)}, nil)
+	}
+
+	rows := rec.Rows("msg_transfers")
+	if len(rows) != 2 {
+		t.Fatalf("got %d MsgTransfer rows, want 2", len(rows))
+	}
+	set := rows[0].(*MsgTransfer)
+	if set.TimeoutRevisionNumber == nil || *set.TimeoutRevisionNumber != 4 || set.TimeoutHeight == nil || *set.TimeoutHeight != 2000 ||
+		set.TimeoutTimestamp == nil || *set.TimeoutTimestamp != 1650000000000000000 {
+		t.Errorf("MsgTransfer timeouts = %v/%v at %v, want 4/2000 at 1650000000000000000",
+			set.TimeoutRevisionNumber, set.TimeoutHeight, set.TimeoutTimestamp)
+	}
+	unset := rows[1].(*MsgTransfer)
+	if unset.TimeoutRevisionNumber != nil || unset.TimeoutHeight != nil || unset.TimeoutTimestamp != nil {
+		t.Errorf("MsgTransfer timeouts = %v/%v at %v, want null for a transfer without timeouts",
+			unset.TimeoutRevisionNumber, unset.TimeoutHeight, unset.TimeoutTimestamp)
+	}
+}
+
+func TestPacketSequences(t *testing.T) {
+	i, rec := newTestIndexer(t, "osmosis-1")
+	a := NewIBCTransfer(zap.NewNop())
+
+	packet := channeltypes.NewPacket([]byte("{}"), 7, "transfer", "channel-141", "transfer", "channel-0", clienttypes.NewHeight(4, 2000), 1650000000000000000)
+	proofHeight := clienttypes.NewHeight(1, 10)
+	sendLog := sdk.ABCIMessageLog{Events: sdk.StringEvents{{
+		Type:       channeltypes.EventTypeSendPacket,
+		Attributes: []sdk.Attribute{{Key: channeltypes.AttributeKeySequence, Value: "42"}},
+	}}}
+	coin := sdk.NewInt64Coin("uosmo", 1)
+	msgs := []struct {
+		msg sdk.Msg
+		log sdk.ABCIMessageLog
+	}{
+		{transfertypes.NewMsgTransfer("transfer", "channel-0", coin, "osmo1sender", "cosmos1receiver", clienttypes.ZeroHeight(), 1), sendLog},
+		// The send_packet event is missing, e.g. the tx failed
+		{transfertypes.NewMsgTransfer("transfer", "channel-0", coin, "osmo1sender", "cosmos1receiver", clienttypes.ZeroHeight(), 1), sdk.ABCIMessageLog{}},
+		{channeltypes.NewMsgRecvPacket(packet, []byte("proof"), proofHeight, "osmo1relayer"), sdk.ABCIMessageLog{}},
+		{channeltypes.NewMsgAcknowledgement(packet, []byte("{}"), []byte("proof"), proofHeight, "osmo1relayer"), sdk.ABCIMessageLog{}},
+		{channeltypes.NewMsgTimeout(packet, 7, []byte("proof"), proofHeight, "osmo1relayer"), sdk.ABCIMessageLog{}},
+	}
+	for j, m := range msgs {
+		sdkTx := decodeTx(t, i, encodeTx(t, i, m.msg))
+		a.HandleIBCMsg(context.Background(), i, sdkTx.GetMsgs()[0], m.log, 0, 0, 10, time.Now(), []byte{byte(j)}, nil)
+	}
+
+	transfers := rec.Rows("msg_transfers")
+	if len(transfers) != 2 {
+		t.Fatalf("got %d MsgTransfer rows, want 2", len(transfers))
+	}
+	if seq := transfers[0].(*MsgTransfer).Sequence; seq == nil || *seq != 42 {
+		t.Errorf("MsgTransfer sequence = %v, want 42 from the send_packet event", seq)
+	}
+	if seq := transfers[1].(*MsgTransfer).Sequence; seq != nil {
+		t.Errorf("MsgTransfer sequence = %d, want null without a send_packet event", *seq)
+	}
+
+	// packetColumns are the packet sequence and timeout columns of a row
+	type packetColumns struct {
+		sequence, revisionNumber, revisionHeight, timestamp uint64
+	}
+	columns := func(sequence uint64, revisionNumber, revisionHeight, timestamp *uint64) packetColumns {
+		c := packetColumns{sequence: sequence}
+		if revisionNumber != nil && revisionHeight != nil && timestamp != nil {
+			c.revisionNumber, c.revisionHeight, c.timestamp = *revisionNumber, *revisionHeight, *timestamp
+		}
+		return c
+	}
+	var got []packetColumns
+	for _, row := range rec.Rows("msg_recv_packets") {
+		r := row.(*MsgRecvPacket)
+		got = append(got, columns(r.Sequence, r.TimeoutRevisionNumber, r.TimeoutHeight, r.TimeoutTimestamp))
+	}
+	for _, row := range rec.Rows("msg_acknowledgements") {
+		r := row.(*MsgAcknowledgement)
+		got = append(got, columns(r.Sequence, r.TimeoutRevisionNumber, r.TimeoutHeight, r.TimeoutTimestamp))
+	}
+	for _, row := range rec.Rows("msg_timeouts") {
+		r := row.(*MsgTimeout)
+		got = append(got, columns(r.Sequence, r.TimeoutRevisionNumber, r.TimeoutHeight, r.TimeoutTimestamp))
+	}
+	want := packetColumns{sequence: 7, revisionNumber: 4, revisionHeight: 2000, timestamp: 1650000000000000000}
+	if !reflect.DeepEqual(got, []packetColumns{want, want, want}) {
+		t.Errorf("packet columns of the recv, ack and timeout = %+v, want %+v for each", got, want)
+	}
+}
+
+func TestTxFeePayerAndGranter(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	i.Client.Config.AccountPrefix = "osmo"
+	a := NewIBCTransfer(zap.NewNop())
+
+	signer := secp256k1.GenPrivKey().PubKey()
+	granter := sdk.AccAddress("granter")
+	payer := sdk.AccAddress("payer")
+	msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 1), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(0, 0), 1)
+
+	// encode returns a tx signed by signer, its fees paid by payer and granted by granter when set
+	encode := func(payer, granter sdk.AccAddress) []byte {
+		builder := i.Client.Codec.TxConfig.NewTxBuilder()
+		if err := builder.SetMsgs(msg); err != nil {
+			t.Fatalf("failed to set msgs: %v", err)
+		}
+		if err := builder.SetSignatures(signing.SignatureV2{
+			PubKey: signer,
+			Data:   &signing.SingleSignatureData{SignMode: signing.SignMode_SIGN_MODE_DIRECT},
+		}); err != nil {
+			t.Fatalf("failed to set signatures: %v", err)
+		}
+		builder.SetFeeGranter(granter)
+		builder.(interface{ SetFeePayer(sdk.AccAddress) }).SetFeePayer(payer)
+		bz, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+		if err != nil {
+			t.Fatalf("failed to encode tx: %v", err)
+		}
+		return bz
+	}
+
+	signerAddr, err := i.Client.EncodeBech32AccAddr(sdk.AccAddress(signer.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name           string
+		tx             []byte
+		payer, granter string
+	}{
+		{name: "fee granter", tx: encode(nil, granter), payer: signerAddr, granter: granter.String()},
+		{name: "fee payer", tx: encode(payer, nil), payer: payer.String()},
+		{name: "no signer", tx: encodeTx(t, i, msg)},
+	}
+
+	txs := make([][]byte, len(tests))
+	results := make([]*abcitypes.ResponseDeliverTx, len(tests))
+	for j, tt := range tests {
+		txs[j], results[j] = tt.tx, &abcitypes.ResponseDeliverTx{Log: "[]"}
+	}
+	node.AddBlock(10, time.Now(), txs, results)
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := make(map[string]*Tx)
+	for _, row := range rec.Rows("txes") {
+		tx := row.(*Tx)
+		rows[string(tx.Hash.Bytes)] = tx
+	}
+	// Unset values are stored as null
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rows[string(tmtypes.Tx(tt.tx).Hash())]
+			if got == nil {
+				t.Fatal("tx wasn't indexed")
+			}
+			if deref(got.FeePayer) != tt.payer || deref(got.FeeGranter) != tt.granter {
+				t.Errorf("got fee payer %v and granter %v, expected %q and %q", got.FeePayer, got.FeeGranter, tt.payer, tt.granter)
+			}
+			if (tt.payer == "") != (got.FeePayer == nil) || (tt.granter == "") != (got.FeeGranter == nil) {
+				t.Errorf("got fee payer %v and granter %v, expected null for unset values", got.FeePayer, got.FeeGranter)
+			}
+		})
+	}
+}
+
+func TestStampRunID(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	if err := indexer.UseRowTransformer(db, indexer.RunIDTransformer("5f0c6e1b")); err != nil {
+		t.Fatalf("UseRowTransformer returned unexpected error: %v", err)
+	}
+	i := newNodeIndexer(node, db)
+	a := NewIBCTransfer(zap.NewNop())
+
+	msg := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 1), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(0, 0), 1)
+	node.AddBlock(10, time.Now(), [][]byte{encodeTx(t, i, msg)}, []*abcitypes.ResponseDeliverTx{{Log: "[]"}})
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := rec.Rows("txes")
+	if len(rows) != 1 {
+		t.Fatalf("got %d txs, want 1", len(rows))
+	}
+	if got := rows[0].(*Tx); got.RunID == nil || *got.RunID != "5f0c6e1b" {
+		t.Errorf("Tx row = %+v, want it stamped with the run id", got)
+	}
+	if transfers := rec.Rows("msg_transfers"); len(transfers) != 1 {
+		t.Errorf("got %d MsgTransfer rows, want the transfer written along with the stamped tx", len(transfers))
+	}
+}
+
+func TestTxOnConflict(t *testing.T) {
+	i, rec := newTestIndexer(t, "osmosis-1")
+
+	// Writing a tx again, e.g. when re-indexing its block, leaves the indexed tx as it was
+	for _, height := range []int64{10, 11} {
+		tx := &Tx{ChainID: "osmosis-1", BlockHeight: height, RawLog: pgtype.JSONB{Bytes: []byte("[]"), Status: pgtype.Present}}
+		if err := tx.Hash.Set([]byte{0x01, 0x02}); err != nil {
+			t.Fatal(err)
+		}
+		i.Write(BlockActionName, tx, func(err error) {
+			if err != nil {
+				t.Errorf("write of the tx at height %d failed: %v", height, err)
+			}
+		})
+	}
+
+	rows := rec.Rows("txes")
+	if len(rows) != 1 || rows[0].(*Tx).BlockHeight != 10 {
+		t.Errorf("got txs %v, want only the tx first written at height 10", rows)
+	}
+}
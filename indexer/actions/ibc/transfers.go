@@ -0,0 +1,158 @@
+package ibc
+
+import (
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	transfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	channeltypes "github.com/cosmos/ibc-go/v2/modules/core/04-channel/types"
+	"github.com/jackc/pgtype"
+	"github.com/strangelove-ventures/valis/indexer"
+	"go.uber.org/zap"
+)
+
+// The directions of a Transfer, relative to the chain it was indexed on.
+const (
+	TransferDirectionOutgoing = "outgoing"
+	TransferDirectionIncoming = "incoming"
+)
+
+// Who submitted the msg of a Transfer, see Transfer.SubmittedBy.
+const (
+	TransferSubmittedByUser    = "user"
+	TransferSubmittedByRelayer = "relayer"
+)
+
+// NewOutgoingTransfer returns the normalized Transfer of a MsgTransfer sent from the chain.
+func NewOutgoingTransfer(chainID string, height int64, msg *transfertypes.MsgTransfer) *Transfer {
+	return &Transfer{
+		ChainID:     chainID,
+		TxHash:      pgtype.Bytea{},
+		Height:      height,
+		Direction:   TransferDirectionOutgoing,
+		Sender:      msg.Sender,
+		Receiver:    msg.Receiver,
+		Amount:      msg.Token.Amount.String(),
+		Denom:       msg.Token.Denom,
+		Port:        msg.SourcePort,
+		Channel:     msg.SourceChannel,
+		SubmittedBy: TransferSubmittedByUser,
+	}
+}
+
+// NewIncomingTransfer returns the normalized Transfer credited by a MsgRecvPacket on the receiving chain,
+// or an error if the packet data isn't ics-20 fungible token packet data. Denom is the denom of the
+// tokens on the receiving chain, i.e. either the voucher denom or, for tokens returning to their source,
+// the denom they had before being sent.
+func NewIncomingTransfer(chainID string, height int64, msg *channeltypes.MsgRecvPacket) (*Transfer, error) {
+	var data transfertypes.FungibleTokenPacketData
+	if err := transfertypes.ModuleCdc.UnmarshalJSON(msg.Packet.GetData(), &data); err != nil {
+		return nil, fmt.Errorf("packet data isn't ics-20 packet data: %w", err)
+	}
+	if err := data.ValidateBasic(); err != nil {
+		return nil, fmt.Errorf("invalid ics-20 packet data: %w", err)
+	}
+
+	packet := msg.Packet
+	sequence := packet.Sequence
+	return &Transfer{
+		ChainID:             chainID,
+		TxHash:              pgtype.Bytea{},
+		Height:              height,
+		Direction:           TransferDirectionIncoming,
+		Sender:              data.Sender,
+		Receiver:            data.Receiver,
+		Amount:              data.Amount,
+		Denom:               receivedDenom(packet.SourcePort, packet.SourceChannel, packet.DestinationPort, packet.DestinationChannel, data.Denom),
+		Port:                packet.DestinationPort,
+		Channel:             packet.DestinationChannel,
+		SubmittedBy:         TransferSubmittedByRelayer,
+		CounterpartyPort:    &packet.SourcePort,
+		CounterpartyChannel: &packet.SourceChannel,
+		Sequence:            &sequence,
+	}, nil
+}
+
+// receivedDenom returns the denom the receiving chain credits for a packet denom, the same way the transfer module does.
+func receivedDenom(srcPort, srcChannel, dstPort, dstChannel, denom string) string {
+	// Tokens returning to the chain they came from lose the prefix they gained when they were sent
+	if transfertypes.ReceiverChainIsSource(srcPort, srcChannel, denom) {
+		unprefixed := denom[len(transfertypes.GetDenomPrefix(srcPort, srcChannel)):]
+		return transfertypes.ParseDenomTrace(unprefixed).IBCDenom()
+	}
+	return transfertypes.ParseDenomTrace(transfertypes.GetPrefixedDenom(dstPort, dstChannel, denom)).IBCDenom()
+}
+
+// receiveSucceeded reports whether the msg log of a MsgRecvPacket shows the tokens were credited, the tx of a recv
+// succeeds even when the transfer fails with an error acknowledgement (e.g. for an invalid receiver address).
+func receiveSucceeded(log sdk.ABCIMessageLog) bool {
+	for _, event := range log.Events {
+		if event.Type != transfertypes.EventTypePacket {
+			continue
+		}
+		for _, attr := range event.Attributes {
+			if attr.Key == transfertypes.AttributeKeyAckSuccess {
+				return attr.Value == "true"
+			}
+		}
+	}
+	return false
+}
+
+// HandleNormalizedTransfer writes the normalized Transfer of the msg, if it's a MsgTransfer or a MsgRecvPacket
+// that credited tokens. log is the msg log of a successful tx, transfers of failed txs are never written. onWritten,
+// if not nil, is called with the outcome of the write, it isn't called if no transfer is written.
+func (a *IBCTransferAction) HandleNormalizedTransfer(indexer *indexer.Indexer, msg sdk.Msg, log sdk.ABCIMessageLog, msgIndex int, height int64, hash []byte, onWritten func(err error)) {
+	var transfer *Transfer
+	switch m := msg.(type) {
+	case *transfertypes.MsgTransfer:
+		transfer = NewOutgoingTransfer(indexer.Client.Config.ChainID, height, m)
+	case *channeltypes.MsgRecvPacket:
+		if !receiveSucceeded(log) {
+			return
+		}
+		var err error
+		if transfer, err = NewIncomingTransfer(indexer.Client.Config.ChainID, height, m); err != nil {
+			// Packets of other applications (e.g. ics-27 or ics-721) are received through the same msg
+			a.log.Debug(
+				"Skipping normalized transfer of MsgRecvPacket",
+				zap.Int64("height", height),
+				zap.String("dst_port", m.Packet.DestinationPort),
+				zap.String("dst_channel", m.Packet.DestinationChannel),
+				zap.Error(err),
+			)
+			return
+		}
+	default:
+		return
+	}
+
+	transfer.MsgIndex = msgIndex
+	if err := transfer.TxHash.Set(hash); err != nil {
+		a.log.Warn(
+			"Failed to set tx hash on Transfer model",
+			zap.Int64("height", height),
+			zap.String("tx_hash", string(hash)),
+			zap.Int("msg_index", msgIndex),
+			zap.Error(err),
+		)
+		return
+	}
+
+	indexer.Write(a.Name(), transfer, func(err error) {
+		if onWritten != nil {
+			defer onWritten(err)
+		}
+
+		if err != nil {
+			a.log.Warn(
+				"Failed to insert Transfer into DB",
+				zap.Int64("height", height),
+				zap.String("tx_hash", string(hash)),
+				zap.Int("msg_index", msgIndex),
+				zap.String("direction", transfer.Direction),
+				zap.Error(err),
+			)
+		}
+	})
+}
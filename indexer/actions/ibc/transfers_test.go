@@ -0,0 +1,136 @@
+package ibc
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	transfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
+	channeltypes "github.com/cosmos/ibc-go/v2/modules/core/04-channel/types"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"go.uber.org/zap"
+)
+
+func TestReceivedDenom(t *testing.T) {
+	ibcDenom := func(path string) string {
+		return fmt.Sprintf("ibc/%X", sha256.Sum256([]byte(path)))
+	}
+
+	tests := []struct {
+		name                                     string
+		srcPort, srcChannel, dstPort, dstChannel string
+		denom                                    string
+		want                                     string
+	}{
+		{
+			name:    "native denom sent to a sink chain",
+			srcPort: "transfer", srcChannel: "channel-141", dstPort: "transfer", dstChannel: "channel-0",
+			denom: "uatom",
+			want:  "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2",
+		},
+		{
+			name:    "voucher returning to its source chain",
+			srcPort: "transfer", srcChannel: "channel-0", dstPort: "transfer", dstChannel: "channel-141",
+			denom: "transfer/channel-0/uosmo",
+			want:  "uosmo",
+		},
+		{
+			name:    "multi hop voucher unwinding one hop",
+			srcPort: "transfer", srcChannel: "channel-0", dstPort: "transfer", dstChannel: "channel-141",
+			denom: "transfer/channel-0/transfer/channel-5/uatom",
+			want:  ibcDenom("transfer/channel-5/uatom"),
+		},
+		{
+			name:    "voucher forwarded to another sink chain",
+			srcPort: "transfer", srcChannel: "channel-3", dstPort: "transfer", dstChannel: "channel-7",
+			denom: "transfer/channel-0/uosmo",
+			want:  ibcDenom("transfer/channel-7/transfer/channel-0/uosmo"),
+		},
+	}
+	for _, tt := range tests {
+		if got := receivedDenom(tt.srcPort, tt.srcChannel, tt.dstPort, tt.dstChannel, tt.denom); got != tt.want {
+			t.Errorf("%s: receivedDenom(%q) = %q, want %q", tt.name, tt.denom, got, tt.want)
+		}
+	}
+}
+
+// recvLog returns the log of a tx with a single MsgRecvPacket, whose acknowledgement has the specified success.
+func recvLog(success bool) string {
+	return fmt.Sprintf(`[{"msg_index":0,"events":[{"type":"fungible_token_packet","attributes":[{"key":"success","value":"%t"}]}]}]`, success)
+}
+
+func TestNormalizedTransfers(t *testing.T) {
+	node := rpctest.New("osmosis-1")
+	db, rec := dbtest.New(t)
+	i := newNodeIndexer(node, db)
+	i.NormalizedTransfers = true
+	a := NewIBCTransfer(zap.NewNop())
+
+	recv := func(data []byte) []byte {
+		packet := channeltypes.NewPacket(data, 7, "transfer", "channel-141", "transfer", "channel-0", clienttypes.NewHeight(1, 100), 0)
+		return encodeTx(t, i, channeltypes.NewMsgRecvPacket(packet, []byte("proof"), clienttypes.NewHeight(1, 90), "osmo1relayer"))
+	}
+	packetData := transfertypes.NewFungibleTokenPacketData("uatom", "100", "cosmos1sender", "osmo1receiver").GetBytes()
+	send := transfertypes.NewMsgTransfer("transfer", "channel-0", sdk.NewInt64Coin("uosmo", 5), "osmo1sender", "cosmos1receiver", clienttypes.NewHeight(0, 0), 1)
+
+	txs := [][]byte{
+		recv(packetData),
+		// An error acknowledgement doesn't credit any tokens
+		recv(transfertypes.NewFungibleTokenPacketData("uatom", "200", "cosmos1sender", "invalid").GetBytes()),
+		// The packets of other applications aren't transfers
+		recv([]byte(`{"type":"TYPE_EXECUTE_TX"}`)),
+		encodeTx(t, i, send),
+	}
+	results := []*abcitypes.ResponseDeliverTx{
+		{Log: recvLog(true)},
+		{Log: recvLog(false)},
+		{Log: recvLog(true)},
+		{Log: `[{"msg_index":0,"events":[]}]`},
+	}
+	node.AddBlock(10, time.Now(), txs, results)
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := rec.Rows("transfers")
+	if len(rows) != 2 {
+		t.Fatalf("got %d transfers, want the incoming and the outgoing transfer", len(rows))
+	}
+	transfers := make(map[string]*Transfer)
+	for _, row := range rows {
+		transfer := row.(*Transfer)
+		transfers[transfer.Direction] = transfer
+	}
+
+	in := transfers[TransferDirectionIncoming]
+	if in == nil || in.ChainID != "osmosis-1" || in.Height != 10 || in.Sender != "cosmos1sender" || in.Receiver != "osmo1receiver" ||
+		in.Amount != "100" || in.Denom != "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2" ||
+		in.Port != "transfer" || in.Channel != "channel-0" {
+		t.Errorf("incoming transfer = %+v, want the uatom voucher credited to osmo1receiver over channel-0", in)
+	}
+	if in != nil && (in.CounterpartyPort == nil || *in.CounterpartyPort != "transfer" ||
+		in.CounterpartyChannel == nil || *in.CounterpartyChannel != "channel-141" || in.Sequence == nil || *in.Sequence != 7) {
+		t.Errorf("incoming transfer = %+v, want the counterparty channel-141 and sequence 7", in)
+	}
+
+	out := transfers[TransferDirectionOutgoing]
+	if out == nil || out.Sender != "osmo1sender" || out.Receiver != "cosmos1receiver" || out.Amount != "5" || out.Denom != "uosmo" ||
+		out.Channel != "channel-0" || out.CounterpartyChannel != nil || out.Sequence != nil {
+		t.Errorf("outgoing transfer = %+v, want the uosmo sent over channel-0", out)
+	}
+
+	// The recv is submitted by the relayer delivering the packet while the send is signed by the user
+	if in != nil && in.SubmittedBy != TransferSubmittedByRelayer {
+		t.Errorf("incoming transfer submitted by %q, want %q", in.SubmittedBy, TransferSubmittedByRelayer)
+	}
+	if out != nil && out.SubmittedBy != TransferSubmittedByUser {
+		t.Errorf("outgoing transfer submitted by %q, want %q", out.SubmittedBy, TransferSubmittedByUser)
+	}
+}
@@ -0,0 +1,275 @@
+package ibcchannels
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
+	connectiontypes "github.com/cosmos/ibc-go/v2/modules/core/03-connection/types"
+	channeltypes "github.com/cosmos/ibc-go/v2/modules/core/04-channel/types"
+	ibctmtypes "github.com/cosmos/ibc-go/v2/modules/light-clients/07-tendermint/types"
+	"github.com/jackc/pgtype"
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "ibc_channels"
+
+// The steps of a connection or channel handshake, see IBCConnectionHandshake and IBCChannelHandshake.
+const (
+	HandshakeStepInit    = "init"
+	HandshakeStepTry     = "try"
+	HandshakeStepAck     = "ack"
+	HandshakeStepConfirm = "confirm"
+)
+
+// IBCChannelsAction implements the indexer.BlockAction interface, it indexes the creation and updates of light clients
+// along with the connection and channel handshakes, so the topology of the IBC connections can be reconstructed over time.
+type IBCChannelsAction struct {
+	actionName string
+	log        *zap.Logger
+}
+
+// NewIBCChannelsAction returns a new IBCChannelsAction block action to be used by the indexer.
+func NewIBCChannelsAction(log *zap.Logger) *IBCChannelsAction {
+	return &IBCChannelsAction{
+		actionName: BlockActionName,
+		log:        log,
+	}
+}
+
+// Name returns the block action name for identifying this action.
+func (a *IBCChannelsAction) Name() string {
+	return a.actionName
+}
+
+// MigrateSchema runs schema migrations for the specified models.
+func (a *IBCChannelsAction) MigrateSchema(indexer *indexer.Indexer) error {
+	return indexer.DB.AutoMigrate(
+		&IBCClientCreation{},
+		&IBCClientUpdate{},
+		&IBCConnectionHandshake{},
+		&IBCChannelHandshake{},
+	)
+}
+
+// MsgTypes returns the type URLs of the msgs handled by this action, txs without any of them are skipped.
+func (a *IBCChannelsAction) MsgTypes() []string {
+	return []string{
+		sdk.MsgTypeURL(&clienttypes.MsgCreateClient{}),
+		sdk.MsgTypeURL(&clienttypes.MsgUpdateClient{}),
+		sdk.MsgTypeURL(&connectiontypes.MsgConnectionOpenInit{}),
+		sdk.MsgTypeURL(&connectiontypes.MsgConnectionOpenTry{}),
+		sdk.MsgTypeURL(&connectiontypes.MsgConnectionOpenAck{}),
+		sdk.MsgTypeURL(&connectiontypes.MsgConnectionOpenConfirm{}),
+		sdk.MsgTypeURL(&channeltypes.MsgChannelOpenInit{}),
+		sdk.MsgTypeURL(&channeltypes.MsgChannelOpenTry{}),
+		sdk.MsgTypeURL(&channeltypes.MsgChannelOpenAck{}),
+		sdk.MsgTypeURL(&channeltypes.MsgChannelOpenConfirm{}),
+	}
+}
+
+// Execute indexes the client, connection and channel msgs of the successful txs of the specified block.
+func (a *IBCChannelsAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	return indexer.ForEachSuccessfulTx(ctx, a.log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx, logs sdk.ABCIMessageLogs) error {
+		for msgIndex, msg := range sdkTx.GetMsgs() {
+			row, err := NewIBCChannelsRow(indexer.Client.Config.ChainID, msg, msgIndex, block.Block.Height, tx.Hash(), logs)
+			if err != nil {
+				a.log.Warn(
+					"Failed to build IBC client, connection or channel row",
+					zap.Int64("height", block.Block.Height),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+				continue
+			}
+			if row == nil {
+				continue
+			}
+
+			msgIndex, msgType := msgIndex, sdk.MsgTypeURL(msg)
+			indexer.Write(a.Name(), row, func(err error) {
+				if err != nil {
+					a.log.Warn(
+						"Failed to insert IBC client, connection or channel row into DB",
+						zap.Int64("height", block.Block.Height),
+						zap.Int("msg_index", msgIndex),
+						zap.String("msg_type", msgType),
+						zap.Error(err),
+					)
+				}
+			})
+		}
+		return nil
+	})
+}
+
+// NewIBCChannelsRow returns the row indexing msg, i.e. an *IBCClientCreation, *IBCClientUpdate, *IBCConnectionHandshake
+// or *IBCChannelHandshake, or nil if msg isn't one of the client, connection or channel msgs. The identifiers that
+// aren't part of msg are read from its events in logs.
+func NewIBCChannelsRow(chainID string, msg sdk.Msg, msgIndex int, height int64, hash []byte, logs sdk.ABCIMessageLogs) (interface{}, error) {
+	var row interface{}
+	switch m := msg.(type) {
+	case *clienttypes.MsgCreateClient:
+		r, err := newClientCreation(m, eventAttributes(logs, msgIndex, clienttypes.EventTypeCreateClient))
+		if err != nil {
+			return nil, err
+		}
+		row = r
+	case *clienttypes.MsgUpdateClient:
+		// The header is packed as an Any, the cached value is populated when the tx is decoded
+		header, err := clienttypes.UnpackHeader(m.Header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack header: %w", err)
+		}
+		row = &IBCClientUpdate{
+			ClientID:       m.ClientId,
+			RevisionNumber: header.GetHeight().GetRevisionNumber(),
+			RevisionHeight: header.GetHeight().GetRevisionHeight(),
+			Signer:         m.Signer,
+		}
+	case *connectiontypes.MsgConnectionOpenInit:
+		attrs := eventAttributes(logs, msgIndex, connectiontypes.EventTypeConnectionOpenInit)
+		row = newConnectionHandshake(HandshakeStepInit, attrs, "", m.ClientId, m.Counterparty.ConnectionId, m.Counterparty.ClientId, m.Signer)
+	case *connectiontypes.MsgConnectionOpenTry:
+		attrs := eventAttributes(logs, msgIndex, connectiontypes.EventTypeConnectionOpenTry)
+		row = newConnectionHandshake(HandshakeStepTry, attrs, m.PreviousConnectionId, m.ClientId, m.Counterparty.ConnectionId, m.Counterparty.ClientId, m.Signer)
+	case *connectiontypes.MsgConnectionOpenAck:
+		attrs := eventAttributes(logs, msgIndex, connectiontypes.EventTypeConnectionOpenAck)
+		row = newConnectionHandshake(HandshakeStepAck, attrs, m.ConnectionId, "", m.CounterpartyConnectionId, "", m.Signer)
+	case *connectiontypes.MsgConnectionOpenConfirm:
+		attrs := eventAttributes(logs, msgIndex, connectiontypes.EventTypeConnectionOpenConfirm)
+		row = newConnectionHandshake(HandshakeStepConfirm, attrs, m.ConnectionId, "", "", "", m.Signer)
+	case *channeltypes.MsgChannelOpenInit:
+		attrs := eventAttributes(logs, msgIndex, channeltypes.EventTypeChannelOpenInit)
+		r := newChannelHandshake(HandshakeStepInit, attrs, m.PortId, "", m.Channel, m.Signer)
+		r.Version = m.Channel.Version
+		row = r
+	case *channeltypes.MsgChannelOpenTry:
+		attrs := eventAttributes(logs, msgIndex, channeltypes.EventTypeChannelOpenTry)
+		r := newChannelHandshake(HandshakeStepTry, attrs, m.PortId, m.PreviousChannelId, m.Channel, m.Signer)
+		r.Version = m.Channel.Version
+		row = r
+	case *channeltypes.MsgChannelOpenAck:
+		attrs := eventAttributes(logs, msgIndex, channeltypes.EventTypeChannelOpenAck)
+		r := newChannelHandshake(HandshakeStepAck, attrs, m.PortId, m.ChannelId, channeltypes.Channel{
+			Counterparty: channeltypes.Counterparty{ChannelId: m.CounterpartyChannelId},
+		}, m.Signer)
+		r.Version = m.CounterpartyVersion
+		row = r
+	case *channeltypes.MsgChannelOpenConfirm:
+		attrs := eventAttributes(logs, msgIndex, channeltypes.EventTypeChannelOpenConfirm)
+		row = newChannelHandshake(HandshakeStepConfirm, attrs, m.PortId, m.ChannelId, channeltypes.Channel{}, m.Signer)
+	default:
+		return nil, nil
+	}
+
+	// Every model is keyed by the msg and records the height it was indexed at
+	var txHash *pgtype.Bytea
+	switch r := row.(type) {
+	case *IBCClientCreation:
+		r.ChainID, r.MsgIndex, r.Height, txHash = chainID, msgIndex, height, &r.TxHash
+	case *IBCClientUpdate:
+		r.ChainID, r.MsgIndex, r.Height, txHash = chainID, msgIndex, height, &r.TxHash
+	case *IBCConnectionHandshake:
+		r.ChainID, r.MsgIndex, r.Height, txHash = chainID, msgIndex, height, &r.TxHash
+	case *IBCChannelHandshake:
+		r.ChainID, r.MsgIndex, r.Height, txHash = chainID, msgIndex, height, &r.TxHash
+	}
+
+	if err := txHash.Set(hash); err != nil {
+		return nil, fmt.Errorf("failed to set tx hash: %w", err)
+	}
+	return row, nil
+}
+
+// newClientCreation returns the IBCClientCreation of msg, the client id is taken from attrs, the attributes of its event.
+func newClientCreation(msg *clienttypes.MsgCreateClient, attrs map[string]string) (*IBCClientCreation, error) {
+	// The client state is packed as an Any, the cached value is populated when the tx is decoded
+	clientState, err := clienttypes.UnpackClientState(msg.ClientState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack client state: %w", err)
+	}
+
+	clientID := attrs[clienttypes.AttributeKeyClientID]
+	if clientID == "" {
+		return nil, fmt.Errorf("failed to find client id in %s event", clienttypes.EventTypeCreateClient)
+	}
+
+	r := &IBCClientCreation{
+		ClientID:   clientID,
+		ClientType: clientState.ClientType(),
+		Signer:     msg.Signer,
+	}
+	if tmClientState, ok := clientState.(*ibctmtypes.ClientState); ok {
+		r.CounterpartyChainID = &tmClientState.ChainId
+	}
+	return r, nil
+}
+
+// newConnectionHandshake returns the IBCConnectionHandshake of a step, the identifiers that are set in attrs, the
+// attributes of the step's event, take precedence over the ones from the msg since they may be assigned by the chain.
+func newConnectionHandshake(step string, attrs map[string]string, connectionID, clientID, counterpartyConnectionID, counterpartyClientID, signer string) *IBCConnectionHandshake {
+	return &IBCConnectionHandshake{
+		Step:                     step,
+		ConnectionID:             attrOr(attrs, connectiontypes.AttributeKeyConnectionID, connectionID),
+		ClientID:                 attrOr(attrs, connectiontypes.AttributeKeyClientID, clientID),
+		CounterpartyConnectionID: attrOr(attrs, connectiontypes.AttributeKeyCounterpartyConnectionID, counterpartyConnectionID),
+		CounterpartyClientID:     attrOr(attrs, connectiontypes.AttributeKeyCounterpartyClientID, counterpartyClientID),
+		Signer:                   signer,
+	}
+}
+
+// newChannelHandshake returns the IBCChannelHandshake of a step, the identifiers that are set in attrs, the
+// attributes of the step's event, take precedence over the ones from the msg since they may be assigned by the chain.
+func newChannelHandshake(step string, attrs map[string]string, portID, channelID string, channel channeltypes.Channel, signer string) *IBCChannelHandshake {
+	var connectionID string
+	if len(channel.ConnectionHops) > 0 {
+		connectionID = channel.ConnectionHops[0]
+	}
+	return &IBCChannelHandshake{
+		Step:                  step,
+		PortID:                attrOr(attrs, channeltypes.AttributeKeyPortID, portID),
+		ChannelID:             attrOr(attrs, channeltypes.AttributeKeyChannelID, channelID),
+		ConnectionID:          attrOr(attrs, channeltypes.AttributeKeyConnectionID, connectionID),
+		CounterpartyPortID:    attrOr(attrs, channeltypes.AttributeCounterpartyPortID, channel.Counterparty.PortId),
+		CounterpartyChannelID: attrOr(attrs, channeltypes.AttributeCounterpartyChannelID, channel.Counterparty.ChannelId),
+		Signer:                signer,
+	}
+}
+
+// eventAttributes returns the attributes of the first event of eventType emitted for the msg at msgIndex,
+// or nil if there is no such event.
+func eventAttributes(logs sdk.ABCIMessageLogs, msgIndex int, eventType string) map[string]string {
+	for _, log := range logs {
+		if int(log.MsgIndex) != msgIndex {
+			continue
+		}
+
+		for _, event := range log.Events {
+			if event.Type != eventType {
+				continue
+			}
+
+			attrs := make(map[string]string, len(event.Attributes))
+			for _, attr := range event.Attributes {
+				attrs[attr.Key] = attr.Value
+			}
+			return attrs
+		}
+	}
+	return nil
+}
+
+// attrOr returns the value of key in attrs, or fallback if it isn't set.
+func attrOr(attrs map[string]string, key, fallback string) string {
+	if v := attrs[key]; v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,64 @@
+package ibcchannels
+
+import (
+	"github.com/jackc/pgtype"
+)
+
+// IBCClientCreation is a light client created by a MsgCreateClient. ClientID is assigned by the chain, it's taken from
+// the create_client event of the msg. CounterpartyChainID is the chain tracked by the client, it's null for client
+// types other than 07-tendermint.
+type IBCClientCreation struct {
+	ChainID             string       `gorm:"primaryKey"`
+	TxHash              pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex            int          `gorm:"primaryKey;autoIncrement:false"`
+	ClientID            string       `gorm:"not null;index"`
+	ClientType          string       `gorm:"not null"`
+	CounterpartyChainID *string
+	Signer              string `gorm:"not null"`
+	Height              int64  `gorm:"not null"`
+}
+
+// IBCClientUpdate is a light client updated by a MsgUpdateClient, RevisionHeight is the height of the header.
+type IBCClientUpdate struct {
+	ChainID        string       `gorm:"primaryKey"`
+	TxHash         pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex       int          `gorm:"primaryKey;autoIncrement:false"`
+	ClientID       string       `gorm:"not null;index"`
+	RevisionNumber uint64       `gorm:"not null"`
+	RevisionHeight uint64       `gorm:"not null"`
+	Signer         string       `gorm:"not null"`
+	Height         int64        `gorm:"not null"`
+}
+
+// IBCConnectionHandshake is a step (init, try, ack or confirm) of the handshake opening ConnectionID. The identifiers
+// that aren't part of the msg of the step are taken from its event, the counterparty connection id is empty for init.
+type IBCConnectionHandshake struct {
+	ChainID                  string       `gorm:"primaryKey"`
+	TxHash                   pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex                 int          `gorm:"primaryKey;autoIncrement:false"`
+	Step                     string       `gorm:"not null"`
+	ConnectionID             string       `gorm:"not null;index"`
+	ClientID                 string       `gorm:"not null"`
+	CounterpartyConnectionID string       `gorm:"not null"`
+	CounterpartyClientID     string       `gorm:"not null"`
+	Signer                   string       `gorm:"not null"`
+	Height                   int64        `gorm:"not null"`
+}
+
+// IBCChannelHandshake is a step (init, try, ack or confirm) of the handshake opening the channel ChannelID on PortID.
+// The identifiers that aren't part of the msg of the step are taken from its event, the counterparty channel id is
+// empty for init. Version is only known for init and try, the version agreed on by both ends is set by ack.
+type IBCChannelHandshake struct {
+	ChainID               string       `gorm:"primaryKey"`
+	TxHash                pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex              int          `gorm:"primaryKey;autoIncrement:false"`
+	Step                  string       `gorm:"not null"`
+	PortID                string       `gorm:"not null;index:idx_ibc_channel_handshakes_channel"`
+	ChannelID             string       `gorm:"not null;index:idx_ibc_channel_handshakes_channel"`
+	ConnectionID          string       `gorm:"not null"`
+	CounterpartyPortID    string       `gorm:"not null"`
+	CounterpartyChannelID string       `gorm:"not null"`
+	Version               string       `gorm:"not null;default:''"`
+	Signer                string       `gorm:"not null"`
+	Height                int64        `gorm:"not null"`
+}
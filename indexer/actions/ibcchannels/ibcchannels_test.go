@@ -0,0 +1,164 @@
+package ibcchannels
+
+import (
+	"reflect"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
+	connectiontypes "github.com/cosmos/ibc-go/v2/modules/core/03-connection/types"
+	channeltypes "github.com/cosmos/ibc-go/v2/modules/core/04-channel/types"
+	commitmenttypes "github.com/cosmos/ibc-go/v2/modules/core/23-commitment/types"
+	ibctmtypes "github.com/cosmos/ibc-go/v2/modules/light-clients/07-tendermint/types"
+	"github.com/jackc/pgtype"
+	lens "github.com/strangelove-ventures/lens/client"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+)
+
+// decodeMsgs encodes a tx containing msgs and decodes it again with the lens codec, like a tx of a block.
+func decodeMsgs(t *testing.T, msgs ...sdk.Msg) []sdk.Msg {
+	t.Helper()
+	txConfig := lens.MakeCodec(lens.ModuleBasics).TxConfig
+	builder := txConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msgs...); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	bz, err := txConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+	sdkTx, err := txConfig.TxDecoder()(bz)
+	if err != nil {
+		t.Fatalf("failed to decode tx: %v", err)
+	}
+	return sdkTx.GetMsgs()
+}
+
+// event returns an event of eventType with the specified attribute key value pairs.
+func event(eventType string, attrs ...string) sdk.StringEvent {
+	e := sdk.StringEvent{Type: eventType}
+	for j := 0; j < len(attrs); j += 2 {
+		e.Attributes = append(e.Attributes, sdk.Attribute{Key: attrs[j], Value: attrs[j+1]})
+	}
+	return e
+}
+
+// rows returns the rows of msgs, indexed at height 10 of osmosis-1 with their tx hash cleared.
+func rows(t *testing.T, msgs []sdk.Msg, logs sdk.ABCIMessageLogs) []interface{} {
+	t.Helper()
+	var values []interface{}
+	for msgIndex, msg := range msgs {
+		row, err := NewIBCChannelsRow("osmosis-1", msg, msgIndex, 10, []byte{0x01}, logs)
+		if err != nil {
+			t.Fatalf("NewIBCChannelsRow of msg %d returned unexpected error: %v", msgIndex, err)
+		}
+		if row == nil {
+			values = append(values, nil)
+			continue
+		}
+		v := reflect.ValueOf(row).Elem()
+		if hash := v.FieldByName("TxHash").Interface().(pgtype.Bytea); string(hash.Bytes) != "\x01" {
+			t.Errorf("row of msg %d has tx hash %X, want 01", msgIndex, hash.Bytes)
+		}
+		v.FieldByName("TxHash").Set(reflect.ValueOf(pgtype.Bytea{}))
+		values = append(values, v.Interface())
+	}
+	return values
+}
+
+func TestChannelHandshake(t *testing.T) {
+	hops := []string{"connection-0"}
+	proofHeight := clienttypes.NewHeight(1, 100)
+	// The channel handshake as seen by both ends, osmosis-1 opening channel-7 and its counterparty opening channel-3
+	msgs := decodeMsgs(t,
+		channeltypes.NewMsgChannelOpenInit("transfer", "ics20-1", channeltypes.UNORDERED, hops, "transfer", "osmo1relayer"),
+		channeltypes.NewMsgChannelOpenTry("transfer", "", "ics20-1", channeltypes.UNORDERED, hops, "transfer", "channel-3", "ics20-1", []byte("proof"), proofHeight, "osmo1relayer"),
+		channeltypes.NewMsgChannelOpenAck("transfer", "channel-7", "channel-3", "ics20-1", []byte("proof"), proofHeight, "osmo1relayer"),
+		channeltypes.NewMsgChannelOpenConfirm("transfer", "channel-7", []byte("proof"), proofHeight, "osmo1relayer"),
+		banktypes.NewMsgSend(sdk.AccAddress("sender"), sdk.AccAddress("receiver"), sdk.NewCoins(sdk.NewInt64Coin("uosmo", 1))),
+	)
+	logs := sdk.ABCIMessageLogs{
+		{MsgIndex: 0, Events: sdk.StringEvents{event(channeltypes.EventTypeChannelOpenInit,
+			channeltypes.AttributeKeyPortID, "transfer", channeltypes.AttributeKeyChannelID, "channel-7",
+			channeltypes.AttributeCounterpartyPortID, "transfer", channeltypes.AttributeKeyConnectionID, "connection-0",
+		)}},
+		{MsgIndex: 1, Events: sdk.StringEvents{event(channeltypes.EventTypeChannelOpenTry,
+			channeltypes.AttributeKeyPortID, "transfer", channeltypes.AttributeKeyChannelID, "channel-8",
+			channeltypes.AttributeCounterpartyPortID, "transfer", channeltypes.AttributeCounterpartyChannelID, "channel-3",
+			channeltypes.AttributeKeyConnectionID, "connection-0",
+		)}},
+		// The ack and confirm events are missing, so their ids come from the msgs
+	}
+
+	want := []interface{}{
+		IBCChannelHandshake{ChainID: "osmosis-1", MsgIndex: 0, Step: HandshakeStepInit, PortID: "transfer", ChannelID: "channel-7",
+			ConnectionID: "connection-0", CounterpartyPortID: "transfer", Version: "ics20-1", Signer: "osmo1relayer", Height: 10},
+		IBCChannelHandshake{ChainID: "osmosis-1", MsgIndex: 1, Step: HandshakeStepTry, PortID: "transfer", ChannelID: "channel-8",
+			ConnectionID: "connection-0", CounterpartyPortID: "transfer", CounterpartyChannelID: "channel-3", Version: "ics20-1",
+			Signer: "osmo1relayer", Height: 10},
+		IBCChannelHandshake{ChainID: "osmosis-1", MsgIndex: 2, Step: HandshakeStepAck, PortID: "transfer", ChannelID: "channel-7",
+			CounterpartyChannelID: "channel-3", Version: "ics20-1", Signer: "osmo1relayer", Height: 10},
+		IBCChannelHandshake{ChainID: "osmosis-1", MsgIndex: 3, Step: HandshakeStepConfirm, PortID: "transfer", ChannelID: "channel-7",
+			Signer: "osmo1relayer", Height: 10},
+		// Msgs other than the client, connection and channel msgs aren't indexed
+		nil,
+	}
+	got := rows(t, msgs, logs)
+	for j := range want {
+		if !reflect.DeepEqual(got[j], want[j]) {
+			t.Errorf("row of msg %d = %+v, want %+v", j, got[j], want[j])
+		}
+	}
+}
+
+func TestClientsAndConnections(t *testing.T) {
+	createClient, err := clienttypes.NewMsgCreateClient(&ibctmtypes.ClientState{ChainId: "cosmoshub-4"}, &ibctmtypes.ConsensusState{}, "osmo1relayer")
+	if err != nil {
+		t.Fatalf("failed to build MsgCreateClient: %v", err)
+	}
+	header := &ibctmtypes.Header{
+		SignedHeader:  &tmproto.SignedHeader{Header: &tmproto.Header{ChainID: "cosmoshub-4", Height: 1500}},
+		TrustedHeight: clienttypes.NewHeight(4, 1400),
+	}
+	updateClient, err := clienttypes.NewMsgUpdateClient("07-tendermint-1", header, "osmo1relayer")
+	if err != nil {
+		t.Fatalf("failed to build MsgUpdateClient: %v", err)
+	}
+	msgs := decodeMsgs(t,
+		createClient,
+		updateClient,
+		connectiontypes.NewMsgConnectionOpenInit("07-tendermint-1", "07-tendermint-9", commitmenttypes.NewMerklePrefix([]byte("ibc")), nil, 0, "osmo1relayer"),
+		&connectiontypes.MsgConnectionOpenAck{ConnectionId: "connection-4", CounterpartyConnectionId: "connection-2", Signer: "osmo1relayer"},
+	)
+	logs := sdk.ABCIMessageLogs{
+		{MsgIndex: 0, Events: sdk.StringEvents{event(clienttypes.EventTypeCreateClient, clienttypes.AttributeKeyClientID, "07-tendermint-1")}},
+		{MsgIndex: 2, Events: sdk.StringEvents{event(connectiontypes.EventTypeConnectionOpenInit,
+			connectiontypes.AttributeKeyConnectionID, "connection-4", connectiontypes.AttributeKeyClientID, "07-tendermint-1",
+			connectiontypes.AttributeKeyCounterpartyClientID, "07-tendermint-9",
+		)}},
+	}
+
+	counterparty := "cosmoshub-4"
+	want := []interface{}{
+		IBCClientCreation{ChainID: "osmosis-1", MsgIndex: 0, ClientID: "07-tendermint-1", ClientType: "07-tendermint",
+			CounterpartyChainID: &counterparty, Signer: "osmo1relayer", Height: 10},
+		IBCClientUpdate{ChainID: "osmosis-1", MsgIndex: 1, ClientID: "07-tendermint-1", RevisionNumber: 4, RevisionHeight: 1500,
+			Signer: "osmo1relayer", Height: 10},
+		IBCConnectionHandshake{ChainID: "osmosis-1", MsgIndex: 2, Step: HandshakeStepInit, ConnectionID: "connection-4",
+			ClientID: "07-tendermint-1", CounterpartyClientID: "07-tendermint-9", Signer: "osmo1relayer", Height: 10},
+		IBCConnectionHandshake{ChainID: "osmosis-1", MsgIndex: 3, Step: HandshakeStepAck, ConnectionID: "connection-4",
+			CounterpartyConnectionID: "connection-2", Signer: "osmo1relayer", Height: 10},
+	}
+	got := rows(t, msgs, logs)
+	for j := range want {
+		if !reflect.DeepEqual(got[j], want[j]) {
+			t.Errorf("row of msg %d = %+v, want %+v", j, got[j], want[j])
+		}
+	}
+
+	// The id of a new client is only known from its event
+	if _, err := NewIBCChannelsRow("osmosis-1", msgs[0], 0, 10, []byte{0x01}, nil); err == nil {
+		t.Error("expected an error for a MsgCreateClient without its create_client event")
+	}
+}
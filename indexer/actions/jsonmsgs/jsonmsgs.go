@@ -0,0 +1,164 @@
+package jsonmsgs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "json_msgs"
+
+// tableNameRegexp matches the table names a handler may write to, unquoted postgres identifiers.
+var tableNameRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// Handler maps a msg type URL (e.g. /cosmos.bank.v1beta1.MsgSend) to the table its msgs are stored in.
+type Handler struct {
+	TypeURL string
+	Table   string
+}
+
+// JSONMsgsAction implements the indexer.BlockAction interface, it stores the msgs of the configured types as JSON
+// in the table configured for each type. This allows indexing new msg types without writing a dedicated action.
+type JSONMsgsAction struct {
+	actionName string
+	log        *zap.Logger
+	tables     map[string]string
+}
+
+// NewJSONMsgsAction returns a new JSONMsgsAction block action to be used by the indexer, storing the msgs of
+// each handler's type URL in its table. Each type URL may only be handled once.
+func NewJSONMsgsAction(log *zap.Logger, handlers []Handler) (*JSONMsgsAction, error) {
+	if len(handlers) == 0 {
+		return nil, fmt.Errorf("the %s block action requires at least one msg type to be configured", BlockActionName)
+	}
+
+	tables := make(map[string]string, len(handlers))
+	for _, h := range handlers {
+		if h.TypeURL == "" {
+			return nil, fmt.Errorf("missing type URL for table %s", h.Table)
+		}
+		if !tableNameRegexp.MatchString(h.Table) {
+			return nil, fmt.Errorf("invalid table name %q for msg type %s, must be lowercase letters, digits and underscores", h.Table, h.TypeURL)
+		}
+		if _, ok := tables[h.TypeURL]; ok {
+			return nil, fmt.Errorf("msg type %s is configured more than once", h.TypeURL)
+		}
+		tables[h.TypeURL] = h.Table
+	}
+
+	return &JSONMsgsAction{
+		actionName: BlockActionName,
+		log:        log,
+		tables:     tables,
+	}, nil
+}
+
+// Name returns the block action name for identifying this action.
+func (a *JSONMsgsAction) Name() string {
+	return a.actionName
+}
+
+// MigrateSchema creates a JSONMsg table for every configured table.
+func (a *JSONMsgsAction) MigrateSchema(indexer *indexer.Indexer) error {
+	migrated := make(map[string]bool, len(a.tables))
+	for _, table := range a.tables {
+		if migrated[table] {
+			continue
+		}
+		if err := indexer.DB.Table(table).AutoMigrate(&JSONMsg{}); err != nil {
+			return fmt.Errorf("failed to migrate table %s: %w", table, err)
+		}
+		migrated[table] = true
+	}
+	return nil
+}
+
+// MsgTypes returns the configured msg type URLs, txs without any of them are skipped.
+func (a *JSONMsgsAction) MsgTypes() []string {
+	typeURLs := make([]string, 0, len(a.tables))
+	for typeURL := range a.tables {
+		typeURLs = append(typeURLs, typeURL)
+	}
+	return typeURLs
+}
+
+// Validate checks that every configured msg type is registered in the codec of the chain being indexed,
+// otherwise its msgs could never be decoded and the handler would silently never store anything.
+func (a *JSONMsgsAction) Validate(indexer *indexer.Indexer) error {
+	for typeURL := range a.tables {
+		if _, err := indexer.Client.Codec.InterfaceRegistry.Resolve(typeURL); err != nil {
+			return fmt.Errorf("msg type %s is not registered in the codec for chain %s: %w", typeURL, indexer.Client.Config.ChainID, err)
+		}
+	}
+	return nil
+}
+
+// Execute stores the msgs of the configured types found in the txs of the specified block.
+func (a *JSONMsgsAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	return indexer.ForEachDecodedTx(ctx, a.log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx) error {
+		for msgIndex, msg := range sdkTx.GetMsgs() {
+			typeURL := sdk.MsgTypeURL(msg)
+			table, ok := a.tables[typeURL]
+			if !ok {
+				continue
+			}
+
+			row, err := a.NewJSONMsg(indexer, msg, msgIndex, block.Block.Height, tx.Hash(), txRes.TxResult.Code == 0)
+			if err != nil {
+				a.log.Warn(
+					"Failed to build JSONMsg",
+					zap.Int64("height", block.Block.Height),
+					zap.String("type_url", typeURL),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+				continue
+			}
+
+			// The table differs per msg type, so rows are written directly rather than through indexer.Write
+			if err := indexer.DB.Table(table).Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+				a.log.Warn(
+					"Failed to insert JSONMsg into DB",
+					zap.Int64("height", block.Block.Height),
+					zap.String("table", table),
+					zap.String("type_url", typeURL),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+			}
+		}
+		return nil
+	})
+}
+
+// NewJSONMsg returns the JSONMsg for msg, encoded with the proto JSON encoding of the chain's codec.
+func (a *JSONMsgsAction) NewJSONMsg(indexer *indexer.Indexer, msg sdk.Msg, msgIndex int, height int64, hash []byte, success bool) (*JSONMsg, error) {
+	bz, err := indexer.Client.Codec.Marshaler.MarshalJSON(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode msg as JSON: %w", err)
+	}
+
+	row := &JSONMsg{
+		ChainID:  indexer.Client.Config.ChainID,
+		MsgIndex: msgIndex,
+		Height:   height,
+		TypeURL:  sdk.MsgTypeURL(msg),
+		Success:  success,
+	}
+	if err := row.TxHash.Set(hash); err != nil {
+		return nil, fmt.Errorf("failed to set tx hash: %w", err)
+	}
+	if err := row.Msg.Set(bz); err != nil {
+		return nil, fmt.Errorf("failed to set msg: %w", err)
+	}
+	return row, nil
+}
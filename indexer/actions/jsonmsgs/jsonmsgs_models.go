@@ -0,0 +1,15 @@
+package jsonmsgs
+
+import "github.com/jackc/pgtype"
+
+// JSONMsg is a single msg of a configured type, stored as its proto JSON encoding. There is no table for
+// the model itself, every handler writes the rows for its msg type to the table configured for it.
+type JSONMsg struct {
+	ChainID  string       `gorm:"primaryKey"`
+	TxHash   pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex int          `gorm:"primaryKey;autoIncrement:false"`
+	Height   int64        `gorm:"not null"`
+	TypeURL  string       `gorm:"not null"`
+	Success  bool         `gorm:"not null"`
+	Msg      pgtype.JSONB `gorm:"not null"`
+}
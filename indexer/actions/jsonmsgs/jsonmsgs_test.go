@@ -0,0 +1,178 @@
+package jsonmsgs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+var (
+	sendTypeURL = sdk.MsgTypeURL(&banktypes.MsgSend{})
+	voteTypeURL = sdk.MsgTypeURL(&govtypes.MsgVote{})
+)
+
+// newTestIndexer returns an Indexer for the chain of node decoding txs with the lens codec and writing to a dbtest DB.
+func newTestIndexer(t *testing.T, node *rpctest.Node) (*indexer.Indexer, *dbtest.Recorder) {
+	t.Helper()
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: node.ChainID()},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(lens.ModuleBasics),
+	}
+	db, rec := dbtest.New(t)
+	return indexer.NewIndexer(zap.NewNop(), client, db), rec
+}
+
+// encodeTx returns the bytes of a tx containing msgs, encoded with the indexer's codec.
+func encodeTx(t *testing.T, i *indexer.Indexer, msgs ...sdk.Msg) []byte {
+	t.Helper()
+	builder := i.Client.Codec.TxConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msgs...); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	bz, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+	return bz
+}
+
+func TestNewJSONMsgsAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		handlers []Handler
+		wantErr  bool
+	}{
+		{name: "valid", handlers: []Handler{{TypeURL: sendTypeURL, Table: "bank_sends"}, {TypeURL: voteTypeURL, Table: "bank_sends"}}},
+		{name: "no handlers", wantErr: true},
+		{name: "missing type url", handlers: []Handler{{Table: "bank_sends"}}, wantErr: true},
+		{name: "invalid table", handlers: []Handler{{TypeURL: sendTypeURL, Table: "bank_sends; DROP TABLE txes"}}, wantErr: true},
+		{name: "uppercase table", handlers: []Handler{{TypeURL: sendTypeURL, Table: "BankSends"}}, wantErr: true},
+		{name: "duplicate type url", handlers: []Handler{{TypeURL: sendTypeURL, Table: "a"}, {TypeURL: sendTypeURL, Table: "b"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := NewJSONMsgsAction(zap.NewNop(), tt.handlers)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: NewJSONMsgsAction returned %v, want error %t", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	i, _ := newTestIndexer(t, rpctest.New("cosmoshub-4"))
+
+	a, err := NewJSONMsgsAction(zap.NewNop(), []Handler{{TypeURL: sendTypeURL, Table: "bank_sends"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.ValidateActions([]indexer.BlockAction{a}); err != nil {
+		t.Errorf("ValidateActions returned %v for a registered msg type, want nil", err)
+	}
+
+	a, err = NewJSONMsgsAction(zap.NewNop(), []Handler{{TypeURL: "/osmosis.gamm.v1beta1.MsgSwapExactAmountIn", Table: "swaps"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.ValidateActions([]indexer.BlockAction{a}); err == nil {
+		t.Error("ValidateActions returned no error for a msg type missing from the codec")
+	}
+}
+
+func TestExecute(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+	a, err := NewJSONMsgsAction(zap.NewNop(), []Handler{{TypeURL: sendTypeURL, Table: "bank_sends"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := banktypes.NewMsgSend(sdk.AccAddress("sender"), sdk.AccAddress("receiver"), sdk.NewCoins(sdk.NewInt64Coin("uatom", 5)))
+	vote := govtypes.NewMsgVote(sdk.AccAddress("voter"), 1, govtypes.OptionYes)
+	tx := encodeTx(t, i, vote, send)
+	node.AddBlock(10, time.Now(), [][]byte{tx}, []*abcitypes.ResponseDeliverTx{{Code: 0}})
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := rec.Rows("bank_sends")
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows in bank_sends, want only the MsgSend", len(rows))
+	}
+	got := rows[0].(*JSONMsg)
+	if got.ChainID != "cosmoshub-4" || got.MsgIndex != 1 || got.Height != 10 || got.TypeURL != sendTypeURL || !got.Success ||
+		string(got.TxHash.Bytes) != string(tmtypes.Tx(tx).Hash()) {
+		t.Errorf("JSONMsg row = %+v, want the MsgSend at msg index 1 of the tx at height 10", got)
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(got.Msg.Bytes, &msg); err != nil {
+		t.Fatalf("stored msg isn't valid JSON: %v", err)
+	}
+	want := map[string]interface{}{
+		"from_address": send.FromAddress,
+		"to_address":   send.ToAddress,
+		"amount":       []interface{}{map[string]interface{}{"denom": "uatom", "amount": "5"}},
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("stored msg = %s, want the proto JSON encoding %v", got.Msg.Bytes, want)
+	}
+}
+
+func TestExecuteWatchedAddresses(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+	a, err := NewJSONMsgsAction(zap.NewNop(), []Handler{{TypeURL: sendTypeURL, Table: "bank_sends"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watched := sdk.AccAddress("watched").String()
+	path := filepath.Join(t.TempDir(), "addresses.txt")
+	if err := os.WriteFile(path, []byte("# compliance\n"+watched+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if i.WatchedAddresses, err = indexer.LoadAddressFile(path); err != nil {
+		t.Fatalf("LoadAddressFile returned unexpected error: %v", err)
+	}
+
+	// The addresses involved in a tx are found in its events
+	send := func(to sdk.AccAddress) ([]byte, *abcitypes.ResponseDeliverTx) {
+		msg := banktypes.NewMsgSend(sdk.AccAddress("sender"), to, sdk.NewCoins(sdk.NewInt64Coin("uatom", 5)))
+		return encodeTx(t, i, msg), &abcitypes.ResponseDeliverTx{Events: []abcitypes.Event{{
+			Type: "transfer",
+			Attributes: []abcitypes.EventAttribute{
+				{Key: []byte("recipient"), Value: []byte(msg.ToAddress)},
+				{Key: []byte("sender"), Value: []byte(msg.FromAddress)},
+			},
+		}}}
+	}
+	matching, matchingRes := send(sdk.AccAddress("watched"))
+	other, otherRes := send(sdk.AccAddress("other"))
+	node.AddBlock(10, time.Now(), [][]byte{other, matching}, []*abcitypes.ResponseDeliverTx{otherRes, matchingRes})
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := rec.Rows("bank_sends")
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows in bank_sends, want only the MsgSend to the watched address", len(rows))
+	}
+	if got := rows[0].(*JSONMsg); string(got.TxHash.Bytes) != string(tmtypes.Tx(matching).Hash()) {
+		t.Errorf("got the row of tx %X, want the tx sending to the watched address", got.TxHash.Bytes)
+	}
+}
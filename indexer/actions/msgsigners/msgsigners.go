@@ -0,0 +1,121 @@
+package msgsigners
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "msg_signers"
+
+// MsgSignersAction implements the indexer.BlockAction interface, it records the signers of every msg
+// regardless of its type or of which other actions handle it.
+type MsgSignersAction struct {
+	actionName string
+	log        *zap.Logger
+}
+
+// NewMsgSignersAction returns a new MsgSignersAction block action to be used by the indexer.
+func NewMsgSignersAction(log *zap.Logger) *MsgSignersAction {
+	return &MsgSignersAction{
+		actionName: BlockActionName,
+		log:        log,
+	}
+}
+
+// Name returns the block action name for identifying this action.
+func (a *MsgSignersAction) Name() string {
+	return a.actionName
+}
+
+// MigrateSchema runs the schema migrations for the MsgSigner model.
+func (a *MsgSignersAction) MigrateSchema(indexer *indexer.Indexer) error {
+	return indexer.DB.AutoMigrate(&MsgSigner{})
+}
+
+// Execute records the signers of every msg in the txs of the specified block.
+func (a *MsgSignersAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	return indexer.ForEachDecodedTx(ctx, a.log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx) error {
+		var rows []*MsgSigner
+		for msgIndex, msg := range sdkTx.GetMsgs() {
+			msgRows, err := a.NewMsgSigners(indexer, msg, msgIndex, block.Block.Height, tx.Hash())
+			if err != nil {
+				a.log.Warn(
+					"Failed to get msg signers",
+					zap.Int64("height", block.Block.Height),
+					zap.String("type_url", sdk.MsgTypeURL(msg)),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+				continue
+			}
+			rows = append(rows, msgRows...)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		if err := indexer.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+			return fmt.Errorf("failed to insert the msg signers of tx %d: %w", index+1, err)
+		}
+		return nil
+	})
+}
+
+// NewMsgSigners returns a MsgSigner for each distinct signer of msg, encoded with the account prefix of the indexed chain.
+func (a *MsgSignersAction) NewMsgSigners(indexer *indexer.Indexer, msg sdk.Msg, msgIndex int, height int64, hash []byte) ([]*MsgSigner, error) {
+	signers, err := getSigners(indexer, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	typeURL := sdk.MsgTypeURL(msg)
+	seen := make(map[string]bool, len(signers))
+	rows := make([]*MsgSigner, 0, len(signers))
+	for _, signer := range signers {
+		addr, err := indexer.Client.EncodeBech32AccAddr(signer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode signer address: %w", err)
+		}
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		row := &MsgSigner{
+			ChainID:  indexer.Client.Config.ChainID,
+			MsgIndex: msgIndex,
+			Signer:   addr,
+			TypeURL:  typeURL,
+			Height:   height,
+		}
+		if err := row.TxHash.Set(hash); err != nil {
+			return nil, fmt.Errorf("failed to set tx hash: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// getSigners returns the signers of msg. Most msgs parse their bech32 signer fields against the global sdk config,
+// so the config is set to the prefixes of the indexed chain for the duration of the call. The panics GetSigners
+// uses to report addresses it can't parse are returned as errors.
+func getSigners(indexer *indexer.Indexer, msg sdk.Msg) (signers []sdk.AccAddress, err error) {
+	done := indexer.Client.SetSDKContext()
+	defer done()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to get signers: %v", r)
+		}
+	}()
+	return msg.GetSigners(), nil
+}
@@ -0,0 +1,14 @@
+package msgsigners
+
+import "github.com/jackc/pgtype"
+
+// MsgSigner is a signer of a single msg, as returned by the msg's GetSigners. Msgs with several signers have a row
+// per signer, which allows the activity of an account to be queried across every msg type from one table.
+type MsgSigner struct {
+	ChainID  string       `gorm:"primaryKey"`
+	TxHash   pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex int          `gorm:"primaryKey;autoIncrement:false"`
+	Signer   string       `gorm:"primaryKey;index"`
+	TypeURL  string       `gorm:"not null"`
+	Height   int64        `gorm:"not null"`
+}
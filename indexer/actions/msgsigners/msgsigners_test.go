@@ -0,0 +1,172 @@
+package msgsigners
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	govtypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+var (
+	alice = sdk.AccAddress("alice")
+	bob   = sdk.AccAddress("bob")
+	carol = sdk.AccAddress("carol")
+)
+
+// newTestIndexer returns an Indexer for the chain of node decoding txs with the lens codec and writing to a dbtest DB.
+func newTestIndexer(t *testing.T, node *rpctest.Node) (*indexer.Indexer, *dbtest.Recorder) {
+	t.Helper()
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: node.ChainID(), AccountPrefix: "cosmos"},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(lens.ModuleBasics),
+	}
+	db, rec := dbtest.New(t)
+	return indexer.NewIndexer(zap.NewNop(), client, db), rec
+}
+
+// encodeTx returns the bytes of a tx containing msgs, encoded with the indexer's codec.
+func encodeTx(t *testing.T, i *indexer.Indexer, msgs ...sdk.Msg) []byte {
+	t.Helper()
+	builder := i.Client.Codec.TxConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msgs...); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	bz, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+	return bz
+}
+
+// multiSend returns a MsgMultiSend with an input from each of the addresses.
+func multiSend(from ...sdk.AccAddress) *banktypes.MsgMultiSend {
+	coins := sdk.NewCoins(sdk.NewInt64Coin("uatom", 1))
+	msg := &banktypes.MsgMultiSend{Outputs: []banktypes.Output{banktypes.NewOutput(carol, coins)}}
+	for _, addr := range from {
+		msg.Inputs = append(msg.Inputs, banktypes.NewInput(addr, coins))
+	}
+	return msg
+}
+
+func TestNewMsgSigners(t *testing.T) {
+	i, _ := newTestIndexer(t, rpctest.New("cosmoshub-4"))
+	a := NewMsgSignersAction(zap.NewNop())
+	hash := []byte{0xab, 0xcd}
+
+	tests := []struct {
+		name    string
+		msg     sdk.Msg
+		signers []string
+		wantErr bool
+	}{
+		{
+			name:    "single signer",
+			msg:     banktypes.NewMsgSend(alice, bob, sdk.NewCoins(sdk.NewInt64Coin("uatom", 5))),
+			signers: []string{alice.String()},
+		},
+		{
+			name:    "several signers",
+			msg:     multiSend(alice, bob),
+			signers: []string{alice.String(), bob.String()},
+		},
+		{
+			name:    "duplicate signer",
+			msg:     multiSend(bob, alice, bob),
+			signers: []string{bob.String(), alice.String()},
+		},
+		{
+			name:    "invalid signer",
+			msg:     &banktypes.MsgSend{FromAddress: "not-an-address", ToAddress: bob.String()},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := a.NewMsgSigners(i, tt.msg, 2, 10, hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMsgSigners returned %v, want error %t", err, tt.wantErr)
+			}
+
+			var signers []string
+			for _, row := range rows {
+				signers = append(signers, row.Signer)
+				if row.ChainID != "cosmoshub-4" || row.MsgIndex != 2 || row.Height != 10 || row.TypeURL != sdk.MsgTypeURL(tt.msg) ||
+					string(row.TxHash.Bytes) != string(hash) {
+					t.Errorf("row = %+v, want the msg at index 2 of the tx at height 10", row)
+				}
+			}
+			if !reflect.DeepEqual(signers, tt.signers) {
+				t.Errorf("signers = %v, want %v", signers, tt.signers)
+			}
+		})
+	}
+}
+
+func TestExecute(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+
+	send := banktypes.NewMsgSend(alice, bob, sdk.NewCoins(sdk.NewInt64Coin("uatom", 5)))
+	vote := govtypes.NewMsgVote(carol, 1, govtypes.OptionYes)
+	tx := encodeTx(t, i, send, multiSend(bob, carol, bob), vote)
+	node.AddBlock(10, time.Now(), [][]byte{tx}, []*abcitypes.ResponseDeliverTx{{Code: 0}})
+
+	actions := []indexer.BlockAction{NewMsgSignersAction(zap.NewNop())}
+	if err := i.ForEachBlock(context.Background(), []int64{10}, actions, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	type signer struct {
+		msgIndex int
+		signer   string
+		typeURL  string
+	}
+	var got []signer
+	for _, row := range rec.Rows("msg_signers") {
+		s := row.(*MsgSigner)
+		if string(s.TxHash.Bytes) != string(tmtypes.Tx(tx).Hash()) || s.Height != 10 {
+			t.Errorf("row = %+v, want a signer of the tx at height 10", s)
+		}
+		got = append(got, signer{s.MsgIndex, s.Signer, s.TypeURL})
+	}
+	want := []signer{
+		{0, alice.String(), sdk.MsgTypeURL(send)},
+		{1, bob.String(), sdk.MsgTypeURL(&banktypes.MsgMultiSend{})},
+		{1, carol.String(), sdk.MsgTypeURL(&banktypes.MsgMultiSend{})},
+		{2, carol.String(), sdk.MsgTypeURL(vote)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("signers = %+v, want %+v", got, want)
+	}
+}
+
+func TestExecuteInsertError(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+
+	tx := encodeTx(t, i, banktypes.NewMsgSend(alice, bob, sdk.NewCoins(sdk.NewInt64Coin("uatom", 5))))
+	node.AddBlock(10, time.Now(), [][]byte{tx}, []*abcitypes.ResponseDeliverTx{{Code: 0}})
+
+	// The block must be retried rather than recorded as indexed without its signers
+	rec.Fail("msg_signers", errors.New("insert failed"))
+	actions := []indexer.BlockAction{NewMsgSignersAction(zap.NewNop())}
+	if err := i.ForEachBlock(context.Background(), []int64{10}, actions, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if failed := i.FailedBlocks(); len(failed) != 1 || failed[0].Height != 10 {
+		t.Errorf("got failed blocks %+v, want height 10", failed)
+	}
+}
@@ -0,0 +1,189 @@
+package staking
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/jackc/pgtype"
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "staking"
+
+// StakingAction implements the indexer.BlockAction interface, it indexes delegations, undelegations,
+// redelegations and the creation of validators.
+type StakingAction struct {
+	actionName string
+	log        *zap.Logger
+}
+
+// NewStakingAction returns a new StakingAction block action to be used by the indexer.
+func NewStakingAction(log *zap.Logger) *StakingAction {
+	return &StakingAction{
+		actionName: BlockActionName,
+		log:        log,
+	}
+}
+
+// Name returns the block action name for identifying this action.
+func (a *StakingAction) Name() string {
+	return a.actionName
+}
+
+// MigrateSchema runs schema migrations for the specified models.
+func (a *StakingAction) MigrateSchema(indexer *indexer.Indexer) error {
+	return indexer.DB.AutoMigrate(
+		&Delegation{},
+		&Undelegation{},
+		&Redelegation{},
+		&ValidatorCreation{},
+	)
+}
+
+// MsgTypes returns the type URLs of the msgs handled by this action, txs without any of them are skipped.
+func (a *StakingAction) MsgTypes() []string {
+	return []string{
+		sdk.MsgTypeURL(&stakingtypes.MsgDelegate{}),
+		sdk.MsgTypeURL(&stakingtypes.MsgUndelegate{}),
+		sdk.MsgTypeURL(&stakingtypes.MsgBeginRedelegate{}),
+		sdk.MsgTypeURL(&stakingtypes.MsgCreateValidator{}),
+	}
+}
+
+// Execute indexes the staking msgs of the successful txs of the specified block.
+func (a *StakingAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	return indexer.ForEachSuccessfulTx(ctx, a.log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx, logs sdk.ABCIMessageLogs) error {
+		for msgIndex, msg := range sdkTx.GetMsgs() {
+			row, err := NewStakingRow(indexer.Client.Config.ChainID, msg, msgIndex, block.Block.Height, tx.Hash(), logs)
+			if err != nil {
+				a.log.Warn(
+					"Failed to build staking row",
+					zap.Int64("height", block.Block.Height),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+				continue
+			}
+			if row == nil {
+				continue
+			}
+
+			msgIndex, msgType := msgIndex, sdk.MsgTypeURL(msg)
+			indexer.Write(a.Name(), row, func(err error) {
+				if err != nil {
+					a.log.Warn(
+						"Failed to insert staking row into DB",
+						zap.Int64("height", block.Block.Height),
+						zap.Int("msg_index", msgIndex),
+						zap.String("msg_type", msgType),
+						zap.Error(err),
+					)
+				}
+			})
+		}
+		return nil
+	})
+}
+
+// NewStakingRow returns the row indexing msg, i.e. a *Delegation, *Undelegation, *Redelegation or *ValidatorCreation,
+// or nil if msg isn't one of the staking msgs. The completion times are read from the events of the msg in logs.
+func NewStakingRow(chainID string, msg sdk.Msg, msgIndex int, height int64, hash []byte, logs sdk.ABCIMessageLogs) (interface{}, error) {
+	var (
+		row    interface{}
+		txHash *pgtype.Bytea
+	)
+	switch m := msg.(type) {
+	case *stakingtypes.MsgDelegate:
+		r := &Delegation{
+			ChainID:   chainID,
+			MsgIndex:  msgIndex,
+			Delegator: m.DelegatorAddress,
+			Validator: m.ValidatorAddress,
+			Amount:    m.Amount.Amount.String(),
+			Denom:     m.Amount.Denom,
+			Height:    height,
+		}
+		row, txHash = r, &r.TxHash
+	case *stakingtypes.MsgUndelegate:
+		r := &Undelegation{
+			ChainID:        chainID,
+			MsgIndex:       msgIndex,
+			Delegator:      m.DelegatorAddress,
+			Validator:      m.ValidatorAddress,
+			Amount:         m.Amount.Amount.String(),
+			Denom:          m.Amount.Denom,
+			CompletionTime: completionTime(logs, msgIndex, stakingtypes.EventTypeUnbond),
+			Height:         height,
+		}
+		row, txHash = r, &r.TxHash
+	case *stakingtypes.MsgBeginRedelegate:
+		r := &Redelegation{
+			ChainID:        chainID,
+			MsgIndex:       msgIndex,
+			Delegator:      m.DelegatorAddress,
+			SrcValidator:   m.ValidatorSrcAddress,
+			DstValidator:   m.ValidatorDstAddress,
+			Amount:         m.Amount.Amount.String(),
+			Denom:          m.Amount.Denom,
+			CompletionTime: completionTime(logs, msgIndex, stakingtypes.EventTypeRedelegate),
+			Height:         height,
+		}
+		row, txHash = r, &r.TxHash
+	case *stakingtypes.MsgCreateValidator:
+		r := &ValidatorCreation{
+			ChainID:   chainID,
+			MsgIndex:  msgIndex,
+			Validator: m.ValidatorAddress,
+			Delegator: m.DelegatorAddress,
+			Moniker:   m.Description.Moniker,
+			Amount:    m.Value.Amount.String(),
+			Denom:     m.Value.Denom,
+			Height:    height,
+		}
+		row, txHash = r, &r.TxHash
+	default:
+		return nil, nil
+	}
+
+	if err := txHash.Set(hash); err != nil {
+		return nil, fmt.Errorf("failed to set tx hash: %w", err)
+	}
+	return row, nil
+}
+
+// completionTime returns the completion time attribute of the first event of eventType emitted for the msg at msgIndex,
+// or nil if there is no such event or its completion time can't be parsed.
+func completionTime(logs sdk.ABCIMessageLogs, msgIndex int, eventType string) *time.Time {
+	for _, log := range logs {
+		if int(log.MsgIndex) != msgIndex {
+			continue
+		}
+
+		for _, event := range log.Events {
+			if event.Type != eventType {
+				continue
+			}
+
+			for _, attr := range event.Attributes {
+				if attr.Key != stakingtypes.AttributeKeyCompletionTime {
+					continue
+				}
+				t, err := time.Parse(time.RFC3339, attr.Value)
+				if err != nil {
+					return nil
+				}
+				t = t.UTC()
+				return &t
+			}
+		}
+	}
+	return nil
+}
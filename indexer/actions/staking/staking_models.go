@@ -0,0 +1,61 @@
+package staking
+
+import (
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// Delegation is the amount delegated to Validator by a MsgDelegate.
+type Delegation struct {
+	ChainID   string       `gorm:"primaryKey"`
+	TxHash    pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex  int          `gorm:"primaryKey;autoIncrement:false"`
+	Delegator string       `gorm:"not null;index"`
+	Validator string       `gorm:"not null;index"`
+	Amount    string       `gorm:"not null"`
+	Denom     string       `gorm:"not null"`
+	Height    int64        `gorm:"not null"`
+}
+
+// Undelegation is the amount unbonded from Validator by a MsgUndelegate. CompletionTime is when the tokens are
+// released, it's taken from the unbond event of the msg and is null if the event couldn't be found.
+type Undelegation struct {
+	ChainID        string       `gorm:"primaryKey"`
+	TxHash         pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex       int          `gorm:"primaryKey;autoIncrement:false"`
+	Delegator      string       `gorm:"not null;index"`
+	Validator      string       `gorm:"not null;index"`
+	Amount         string       `gorm:"not null"`
+	Denom          string       `gorm:"not null"`
+	CompletionTime *time.Time
+	Height         int64 `gorm:"not null"`
+}
+
+// Redelegation is the amount moved from SrcValidator to DstValidator by a MsgBeginRedelegate. CompletionTime is
+// when the redelegation matures, it's taken from the redelegate event of the msg and is null if the event couldn't be found.
+type Redelegation struct {
+	ChainID        string       `gorm:"primaryKey"`
+	TxHash         pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex       int          `gorm:"primaryKey;autoIncrement:false"`
+	Delegator      string       `gorm:"not null;index"`
+	SrcValidator   string       `gorm:"not null;index"`
+	DstValidator   string       `gorm:"not null;index"`
+	Amount         string       `gorm:"not null"`
+	Denom          string       `gorm:"not null"`
+	CompletionTime *time.Time
+	Height         int64 `gorm:"not null"`
+}
+
+// ValidatorCreation is a validator created by a MsgCreateValidator, along with its self delegation.
+type ValidatorCreation struct {
+	ChainID   string       `gorm:"primaryKey"`
+	TxHash    pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex  int          `gorm:"primaryKey;autoIncrement:false"`
+	Validator string       `gorm:"not null;index"`
+	Delegator string       `gorm:"not null"`
+	Moniker   string       `gorm:"not null;default:''"`
+	Amount    string       `gorm:"not null"`
+	Denom     string       `gorm:"not null"`
+	Height    int64        `gorm:"not null"`
+}
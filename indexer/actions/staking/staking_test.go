@@ -0,0 +1,143 @@
+package staking
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/ed25519"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/jackc/pgtype"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+var (
+	delegator = sdk.AccAddress("delegator")
+	valA      = sdk.ValAddress("validator-a")
+	valB      = sdk.ValAddress("validator-b")
+)
+
+// newTestIndexer returns an Indexer for the chain of node decoding txs with the lens codec and writing to a dbtest DB.
+func newTestIndexer(t *testing.T, node *rpctest.Node) (*indexer.Indexer, *dbtest.Recorder) {
+	t.Helper()
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: node.ChainID(), AccountPrefix: "cosmos"},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(lens.ModuleBasics),
+	}
+	db, rec := dbtest.New(t)
+	return indexer.NewIndexer(zap.NewNop(), client, db), rec
+}
+
+// encodeTx returns the bytes of a tx containing msgs, encoded with the indexer's codec.
+func encodeTx(t *testing.T, i *indexer.Indexer, msgs ...sdk.Msg) []byte {
+	t.Helper()
+	builder := i.Client.Codec.TxConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msgs...); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	bz, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+	return bz
+}
+
+// completionLog returns the log of a msg emitting an event of eventType with the completion time.
+func completionLog(msgIndex uint32, eventType string, completion time.Time) sdk.ABCIMessageLog {
+	return sdk.ABCIMessageLog{MsgIndex: msgIndex, Events: sdk.StringEvents{{
+		Type:       eventType,
+		Attributes: []sdk.Attribute{{Key: stakingtypes.AttributeKeyCompletionTime, Value: completion.Format(time.RFC3339)}},
+	}}}
+}
+
+func TestExecute(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+
+	coin := sdk.NewInt64Coin("uatom", 100)
+	createValidator, err := stakingtypes.NewMsgCreateValidator(valB, ed25519.GenPrivKey().PubKey(), coin,
+		stakingtypes.NewDescription("bee", "", "", "", ""), stakingtypes.NewCommissionRates(sdk.ZeroDec(), sdk.ZeroDec(), sdk.ZeroDec()), sdk.OneInt())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []sdk.Msg{
+		stakingtypes.NewMsgDelegate(delegator, valA, coin),
+		stakingtypes.NewMsgUndelegate(delegator, valA, sdk.NewInt64Coin("uatom", 10)),
+		stakingtypes.NewMsgBeginRedelegate(delegator, valA, valB, sdk.NewInt64Coin("uatom", 20)),
+		createValidator,
+		// The redelegate event of this msg is missing from the logs
+		stakingtypes.NewMsgBeginRedelegate(delegator, valB, valA, sdk.NewInt64Coin("uatom", 5)),
+	}
+
+	unbonded := time.Date(2022, 5, 11, 8, 0, 0, 0, time.UTC)
+	redelegated := time.Date(2022, 5, 12, 8, 0, 0, 0, time.UTC)
+	logs, err := json.Marshal(sdk.ABCIMessageLogs{
+		completionLog(1, stakingtypes.EventTypeUnbond, unbonded),
+		completionLog(2, stakingtypes.EventTypeRedelegate, redelegated),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := [][]byte{encodeTx(t, i, msgs...), encodeTx(t, i, msgs[0])}
+	// The second tx failed, so it didn't delegate anything
+	node.AddBlock(10, time.Now(), txs, []*abcitypes.ResponseDeliverTx{{Code: 0, Log: string(logs)}, {Code: 5}})
+
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{NewStakingAction(zap.NewNop())}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	var hash pgtype.Bytea
+	if err := hash.Set(tmtypes.Tx(txs[0]).Hash()); err != nil {
+		t.Fatal(err)
+	}
+	rows := func(table string) []interface{} {
+		var values []interface{}
+		for _, row := range rec.Rows(table) {
+			values = append(values, reflect.ValueOf(row).Elem().Interface())
+		}
+		return values
+	}
+
+	tests := []struct {
+		table    string
+		expected []interface{}
+	}{
+		{"delegations", []interface{}{Delegation{
+			ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 0, Delegator: delegator.String(), Validator: valA.String(),
+			Amount: "100", Denom: "uatom", Height: 10,
+		}}},
+		{"undelegations", []interface{}{Undelegation{
+			ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 1, Delegator: delegator.String(), Validator: valA.String(),
+			Amount: "10", Denom: "uatom", CompletionTime: &unbonded, Height: 10,
+		}}},
+		{"redelegations", []interface{}{
+			Redelegation{
+				ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 2, Delegator: delegator.String(), SrcValidator: valA.String(),
+				DstValidator: valB.String(), Amount: "20", Denom: "uatom", CompletionTime: &redelegated, Height: 10,
+			},
+			Redelegation{
+				ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 4, Delegator: delegator.String(), SrcValidator: valB.String(),
+				DstValidator: valA.String(), Amount: "5", Denom: "uatom", Height: 10,
+			},
+		}},
+		{"validator_creations", []interface{}{ValidatorCreation{
+			ChainID: "cosmoshub-4", TxHash: hash, MsgIndex: 3, Validator: valB.String(), Delegator: sdk.AccAddress(valB).String(),
+			Moniker: "bee", Amount: "100", Denom: "uatom", Height: 10,
+		}}},
+	}
+	for _, tt := range tests {
+		if got := rows(tt.table); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("got %s %+v, expected %+v", tt.table, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package validators
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "validator_signatures"
+
+// ValidatorSignaturesAction implements the indexer.BlockAction interface, it records which validators signed
+// each block from the last commit of the following block, which is useful for tracking validator uptime.
+// It only relies on block data, so no tx needs to be decoded for it.
+type ValidatorSignaturesAction struct {
+	actionName string
+	log        *zap.Logger
+}
+
+// NewValidatorSignaturesAction returns a new ValidatorSignaturesAction block action to be used by the indexer.
+func NewValidatorSignaturesAction(log *zap.Logger) *ValidatorSignaturesAction {
+	return &ValidatorSignaturesAction{
+		actionName: BlockActionName,
+		log:        log,
+	}
+}
+
+// Name returns the block action name for identifying this action.
+func (a *ValidatorSignaturesAction) Name() string {
+	return a.actionName
+}
+
+// MigrateSchema runs schema migrations for the specified models.
+func (a *ValidatorSignaturesAction) MigrateSchema(indexer *indexer.Indexer) error {
+	return indexer.DB.AutoMigrate(
+		&ValidatorSignature{},
+	)
+}
+
+// MsgTypes returns no msg types, the signatures are read from the block itself so no tx needs to be decoded.
+func (a *ValidatorSignaturesAction) MsgTypes() []string {
+	return nil
+}
+
+// Execute records the signatures of the last commit in the specified block.
+// Blocks at genesis heights are skipped, their last commit is missing or its validator set can't always be queried.
+func (a *ValidatorSignaturesAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	if indexer.IsGenesisHeight(block.Block.Height) {
+		a.log.Debug(
+			"Skipping validator signatures at genesis height",
+			zap.Int64("height", block.Block.Height),
+		)
+		return nil
+	}
+
+	commit := block.Block.LastCommit
+	if commit == nil || commit.Height < 1 || len(commit.Signatures) == 0 {
+		return nil
+	}
+
+	// Absent signatures don't carry the validator address, the signatures are ordered the same as the validator set
+	validators, err := indexer.QueryValidators(ctx, commit.Height)
+	if err != nil {
+		return fmt.Errorf("failed to query validator set at height %d: %w", commit.Height, err)
+	}
+
+	signatures, err := Signatures(indexer.Client.Config.ChainID, commit, validators)
+	if err != nil {
+		return err
+	}
+
+	if err := indexer.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&signatures).Error; err != nil {
+		return fmt.Errorf("failed to insert the validator signatures of height %d: %w", commit.Height, err)
+	}
+	return nil
+}
+
+// Signatures returns a ValidatorSignature for every validator in the validator set of the commit's height.
+func Signatures(chainID string, commit *tmtypes.Commit, validators []*tmtypes.Validator) ([]ValidatorSignature, error) {
+	if len(validators) != len(commit.Signatures) {
+		return nil, fmt.Errorf("commit at height %d contains %d signatures but the validator set contains %d validators",
+			commit.Height, len(commit.Signatures), len(validators))
+	}
+
+	signatures := make([]ValidatorSignature, len(validators))
+	for j, sig := range commit.Signatures {
+		signatures[j] = ValidatorSignature{
+			ChainID:          chainID,
+			Height:           commit.Height,
+			ValidatorAddress: validators[j].Address.String(),
+			Signed:           !sig.Absent(),
+		}
+	}
+	return signatures, nil
+}
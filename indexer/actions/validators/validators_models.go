@@ -0,0 +1,10 @@
+package validators
+
+// ValidatorSignature records whether a validator signed the commit for a block, derived from the last commit
+// of the following block. A validator that voted nil still counts as signed, only absent votes are missed.
+type ValidatorSignature struct {
+	ChainID          string `gorm:"primaryKey"`
+	Height           int64  `gorm:"primaryKey;autoIncrement:false"`
+	ValidatorAddress string `gorm:"primaryKey"`
+	Signed           bool   `gorm:"not null"`
+}
@@ -0,0 +1,145 @@
+package validators
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+// newTestIndexer returns an Indexer for the chain of node writing to a dbtest DB.
+func newTestIndexer(t *testing.T, node *rpctest.Node) (*indexer.Indexer, *dbtest.Recorder) {
+	t.Helper()
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: node.ChainID()},
+		RPCClient: node,
+	}
+	db, rec := dbtest.New(t)
+	return indexer.NewIndexer(zap.NewNop(), client, db), rec
+}
+
+// newValidators returns a validator set of count validators.
+func newValidators(count int) []*tmtypes.Validator {
+	validators := make([]*tmtypes.Validator, count)
+	for j := range validators {
+		validators[j] = tmtypes.NewValidator(ed25519.GenPrivKey().PubKey(), 10)
+	}
+	return validators
+}
+
+// blockWithCommit returns the block at height whose last commit is signed by every validator except absent.
+func blockWithCommit(height int64, validators []*tmtypes.Validator, absent int) *coretypes.ResultBlock {
+	sigs := make([]tmtypes.CommitSig, len(validators))
+	for j, val := range validators {
+		sigs[j] = tmtypes.CommitSig{BlockIDFlag: tmtypes.BlockIDFlagCommit, ValidatorAddress: val.Address, Signature: []byte{0x01}}
+		if j == absent {
+			sigs[j] = tmtypes.NewCommitSigAbsent()
+		}
+	}
+	return &coretypes.ResultBlock{Block: &tmtypes.Block{
+		Header:     tmtypes.Header{ChainID: "cosmoshub-4", Height: height},
+		LastCommit: &tmtypes.Commit{Height: height - 1, Signatures: sigs},
+	}}
+}
+
+func TestCommitMissingSignature(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+	a := NewValidatorSignaturesAction(zap.NewNop())
+
+	// More validators than fit a single page of the validator set
+	validators := newValidators(120)
+	node.SetValidators(41, validators)
+	if err := a.Execute(context.Background(), i, blockWithCommit(42, validators, 7)); err != nil {
+		t.Fatalf("Execute returned unexpected error: %v", err)
+	}
+
+	rows := rec.Rows("validator_signatures")
+	if len(rows) != len(validators) {
+		t.Fatalf("got %d ValidatorSignature rows, want one per validator %d", len(rows), len(validators))
+	}
+	for j, row := range rows {
+		got := *row.(*ValidatorSignature)
+		want := ValidatorSignature{ChainID: "cosmoshub-4", Height: 41, ValidatorAddress: validators[j].Address.String(), Signed: j != 7}
+		if got != want {
+			t.Errorf("ValidatorSignature row %d = %+v, want %+v", j, got, want)
+		}
+	}
+}
+
+func TestInsertErrorReturned(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+	a := NewValidatorSignaturesAction(zap.NewNop())
+
+	// The block must be retried rather than recorded as indexed without its signatures
+	validators := newValidators(4)
+	node.SetValidators(9, validators)
+	rec.Fail("validator_signatures", errors.New("insert failed"))
+	if err := a.Execute(context.Background(), i, blockWithCommit(10, validators, -1)); err == nil {
+		t.Error("Execute returned no error for a failed insert")
+	}
+}
+
+func TestFirstBlockWithoutLastCommit(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+	a := NewValidatorSignaturesAction(zap.NewNop())
+
+	// The first block has no last commit, the validator set must not be queried for it
+	block := &coretypes.ResultBlock{Block: &tmtypes.Block{Header: tmtypes.Header{ChainID: "cosmoshub-4", Height: 1}}}
+	if err := a.Execute(context.Background(), i, block); err != nil {
+		t.Fatalf("Execute returned unexpected error: %v", err)
+	}
+	if rows := rec.Rows("validator_signatures"); len(rows) != 0 {
+		t.Errorf("got %d ValidatorSignature rows for the first block, want none", len(rows))
+	}
+}
+
+func TestSignaturesValidatorSetMismatch(t *testing.T) {
+	validators := newValidators(3)
+	commit := blockWithCommit(10, validators, -1).Block.LastCommit
+	if _, err := Signatures("cosmoshub-4", commit, validators[:2]); err == nil {
+		t.Error("Signatures returned no error for a validator set not matching the commit")
+	}
+}
+
+func TestGenesisHeightsSkipped(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+	a := NewValidatorSignaturesAction(zap.NewNop())
+
+	// Height 1 has no last commit and the validator set of height 1 isn't available on the node,
+	// signatures are only indexed from height 3 onwards
+	validators := newValidators(4)
+	node.AddBlock(1, time.Now(), nil, nil)
+	node.AddBlock(2, time.Now(), nil, nil).Block.LastCommit = blockWithCommit(2, validators, -1).Block.LastCommit
+	node.AddBlock(3, time.Now(), nil, nil).Block.LastCommit = blockWithCommit(3, validators, 0).Block.LastCommit
+	node.SetValidators(2, validators)
+
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []indexer.BlockAction{a}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if failed := i.FailedBlocks(); len(failed) != 0 {
+		t.Errorf("got failed blocks %+v, want none", failed)
+	}
+
+	rows := rec.Rows("validator_signatures")
+	if len(rows) != len(validators) {
+		t.Fatalf("got %d ValidatorSignature rows, want the %d signatures of the commit of height 2", len(rows), len(validators))
+	}
+	for j, row := range rows {
+		if got := row.(*ValidatorSignature); got.Height != 2 || got.Signed != (j != 0) {
+			t.Errorf("ValidatorSignature row %d = %+v, want a signature of height 2", j, got)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package vesting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	vestingtypes "github.com/cosmos/cosmos-sdk/x/auth/vesting/types"
+	"github.com/strangelove-ventures/valis/indexer"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+// BlockActionName is used for configuring block actions via the config file,
+// these names are read when starting the indexer for building the list of actions to take at runtime.
+const BlockActionName = "vesting_accounts"
+
+// VestingAction implements the indexer.BlockAction interface, it indexes the vesting accounts created on-chain.
+//
+// NOTE: The periodic and permanent locked vesting account msgs were only added in later sdk versions
+// than the one the indexer is built against, so their txs can't be decoded yet.
+type VestingAction struct {
+	actionName string
+	log        *zap.Logger
+}
+
+// NewVestingAction returns a new VestingAction block action to be used by the indexer.
+func NewVestingAction(log *zap.Logger) *VestingAction {
+	return &VestingAction{
+		actionName: BlockActionName,
+		log:        log,
+	}
+}
+
+// Name returns the block action name for identifying this action.
+func (a *VestingAction) Name() string {
+	return a.actionName
+}
+
+// MigrateSchema runs schema migrations for the specified models.
+func (a *VestingAction) MigrateSchema(indexer *indexer.Indexer) error {
+	return indexer.DB.AutoMigrate(&VestingAccount{})
+}
+
+// MsgTypes returns the type URLs of the msgs handled by this action, txs without any of them are skipped.
+func (a *VestingAction) MsgTypes() []string {
+	return []string{
+		sdk.MsgTypeURL(&vestingtypes.MsgCreateVestingAccount{}),
+	}
+}
+
+// Validate checks that the vesting msgs are registered in the codec of the chain being indexed.
+func (a *VestingAction) Validate(indexer *indexer.Indexer) error {
+	for _, typeURL := range a.MsgTypes() {
+		if _, err := indexer.Client.Codec.InterfaceRegistry.Resolve(typeURL); err != nil {
+			return fmt.Errorf("msg type %s is not registered in the codec for chain %s: %w", typeURL, indexer.Client.Config.ChainID, err)
+		}
+	}
+	return nil
+}
+
+// Execute indexes the vesting accounts created by the successful txs of the specified block.
+func (a *VestingAction) Execute(ctx context.Context, indexer *indexer.Indexer, block *coretypes.ResultBlock) error {
+	return indexer.ForEachSuccessfulTx(ctx, a.log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx, logs sdk.ABCIMessageLogs) error {
+		for msgIndex, msg := range sdkTx.GetMsgs() {
+			m, ok := msg.(*vestingtypes.MsgCreateVestingAccount)
+			if !ok {
+				continue
+			}
+
+			accounts, err := NewVestingAccounts(indexer.Client.Config.ChainID, m, msgIndex, block.Block.Height, block.Block.Time, tx.Hash())
+			if err != nil {
+				a.log.Warn(
+					"Failed to build VestingAccount",
+					zap.Int64("height", block.Block.Height),
+					zap.Int("msg_index", msgIndex),
+					zap.Error(err),
+				)
+				continue
+			}
+
+			for _, account := range accounts {
+				account := account
+				indexer.Write(a.Name(), account, func(err error) {
+					if err != nil {
+						a.log.Warn(
+							"Failed to insert VestingAccount into DB",
+							zap.Int64("height", account.Height),
+							zap.String("to_address", account.ToAddress),
+							zap.Int("msg_index", account.MsgIndex),
+							zap.Error(err),
+						)
+					}
+				})
+			}
+		}
+		return nil
+	})
+}
+
+// NewVestingAccounts returns a VestingAccount for each denom vested by msg, starting at the time of the block.
+func NewVestingAccounts(chainID string, msg *vestingtypes.MsgCreateVestingAccount, msgIndex int, height int64, blockTime time.Time, hash []byte) ([]*VestingAccount, error) {
+	accounts := make([]*VestingAccount, 0, len(msg.Amount))
+	for _, coin := range msg.Amount {
+		account := &VestingAccount{
+			ChainID:     chainID,
+			MsgIndex:    msgIndex,
+			Denom:       coin.Denom,
+			Amount:      coin.Amount.String(),
+			FromAddress: msg.FromAddress,
+			ToAddress:   msg.ToAddress,
+			Delayed:     msg.Delayed,
+			StartTime:   blockTime.UTC(),
+			EndTime:     time.Unix(msg.EndTime, 0).UTC(),
+			Height:      height,
+		}
+		if err := account.TxHash.Set(hash); err != nil {
+			return nil, fmt.Errorf("failed to set tx hash: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
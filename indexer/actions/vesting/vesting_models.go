@@ -0,0 +1,24 @@
+package vesting
+
+import (
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// VestingAccount is a vesting account created by a MsgCreateVestingAccount, with a row per denom of the vested amount.
+// StartTime is the time of the block the account was created in, tokens vest linearly until EndTime unless Delayed,
+// in which case they all vest at EndTime.
+type VestingAccount struct {
+	ChainID     string       `gorm:"primaryKey"`
+	TxHash      pgtype.Bytea `gorm:"primaryKey"`
+	MsgIndex    int          `gorm:"primaryKey;autoIncrement:false"`
+	Denom       string       `gorm:"primaryKey"`
+	Amount      string       `gorm:"not null"`
+	FromAddress string       `gorm:"not null"`
+	ToAddress   string       `gorm:"not null;index"`
+	Delayed     bool         `gorm:"not null"`
+	StartTime   time.Time    `gorm:"not null"`
+	EndTime     time.Time    `gorm:"not null"`
+	Height      int64        `gorm:"not null"`
+}
@@ -0,0 +1,120 @@
+package vesting
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/module"
+	authvesting "github.com/cosmos/cosmos-sdk/x/auth/vesting"
+	vestingtypes "github.com/cosmos/cosmos-sdk/x/auth/vesting/types"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/indexer"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+)
+
+// newTestIndexer returns an Indexer for the chain of node decoding txs with the lens codec, extended with the vesting
+// module like the chain clients of start, and writing to a dbtest DB.
+func newTestIndexer(t *testing.T, node *rpctest.Node) (*indexer.Indexer, *dbtest.Recorder) {
+	t.Helper()
+	modules := append([]module.AppModuleBasic{authvesting.AppModuleBasic{}}, lens.ModuleBasics...)
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: node.ChainID()},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(modules),
+	}
+	db, rec := dbtest.New(t)
+	return indexer.NewIndexer(zap.NewNop(), client, db), rec
+}
+
+// encodeTx returns the bytes of a tx containing msgs, encoded with the indexer's codec.
+func encodeTx(t *testing.T, i *indexer.Indexer, msgs ...sdk.Msg) []byte {
+	t.Helper()
+	builder := i.Client.Codec.TxConfig.NewTxBuilder()
+	if err := builder.SetMsgs(msgs...); err != nil {
+		t.Fatalf("failed to set msgs: %v", err)
+	}
+	bz, err := i.Client.Codec.TxConfig.TxEncoder()(builder.GetTx())
+	if err != nil {
+		t.Fatalf("failed to encode tx: %v", err)
+	}
+	return bz
+}
+
+func TestNewVestingAccounts(t *testing.T) {
+	blockTime := time.Date(2022, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	msg := vestingtypes.NewMsgCreateVestingAccount(
+		sdk.AccAddress("from"), sdk.AccAddress("to"),
+		sdk.NewCoins(sdk.NewInt64Coin("uatom", 100), sdk.NewInt64Coin("uosmo", 5)),
+		blockTime.Add(365*24*time.Hour).Unix(), true,
+	)
+
+	accounts, err := NewVestingAccounts("cosmoshub-4", msg, 1, 42, blockTime, []byte{0x01})
+	if err != nil {
+		t.Fatalf("NewVestingAccounts returned unexpected error: %v", err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("got %d accounts, want one per denom", len(accounts))
+	}
+	for j, denom := range []string{"uatom", "uosmo"} {
+		got := accounts[j]
+		if got.Denom != denom || got.Amount != msg.Amount.AmountOf(denom).String() {
+			t.Errorf("account %d has %s%s, want the %s of the msg", j, got.Amount, got.Denom, denom)
+		}
+		if got.ChainID != "cosmoshub-4" || got.MsgIndex != 1 || got.Height != 42 || !got.Delayed ||
+			got.FromAddress != msg.FromAddress || got.ToAddress != msg.ToAddress {
+			t.Errorf("account %d = %+v, want the delayed account of msg 1 at height 42", j, got)
+		}
+		if !got.StartTime.Equal(blockTime) || got.StartTime.Location() != time.UTC {
+			t.Errorf("account %d starts at %s, want the block time %s in UTC", j, got.StartTime, blockTime)
+		}
+		if got.EndTime != time.Unix(msg.EndTime, 0).UTC() {
+			t.Errorf("account %d ends at %s, want %s", j, got.EndTime, time.Unix(msg.EndTime, 0).UTC())
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	i, rec := newTestIndexer(t, node)
+
+	blockTime := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	endTime := blockTime.Add(30 * 24 * time.Hour).Unix()
+	coins := sdk.NewCoins(sdk.NewInt64Coin("uatom", 1000))
+	created := vestingtypes.NewMsgCreateVestingAccount(sdk.AccAddress("from"), sdk.AccAddress("to"), coins, endTime, false)
+	rejected := vestingtypes.NewMsgCreateVestingAccount(sdk.AccAddress("from"), sdk.AccAddress("other"), coins, endTime, false)
+
+	tx := encodeTx(t, i, created)
+	node.AddBlock(10, blockTime, [][]byte{tx, encodeTx(t, i, rejected)}, []*abcitypes.ResponseDeliverTx{{Code: 0}, {Code: 5}})
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []indexer.BlockAction{NewVestingAction(zap.NewNop())}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	rows := rec.Rows("vesting_accounts")
+	if len(rows) != 1 {
+		t.Fatalf("got %d vesting accounts, want only the account of the successful tx", len(rows))
+	}
+	got := *rows[0].(*VestingAccount)
+	want := VestingAccount{
+		ChainID:     "cosmoshub-4",
+		Denom:       "uatom",
+		Amount:      "1000",
+		FromAddress: created.FromAddress,
+		ToAddress:   created.ToAddress,
+		StartTime:   blockTime,
+		EndTime:     time.Unix(endTime, 0).UTC(),
+		Height:      10,
+	}
+	if err := want.TxHash.Set(tmtypes.Tx(tx).Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package indexer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+)
+
+// accSeqAttributeKey is the key of the tx event attribute holding the "<address>/<sequence>" of each signer.
+const accSeqAttributeKey = "acc_seq"
+
+// LoadAddressFile reads a set of watched addresses from the file at path, one address per line.
+// Blank lines and lines starting with # are ignored.
+func LoadAddressFile(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	addresses := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addresses[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read address file %s: %w", path, err)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("address file %s doesn't contain any addresses", path)
+	}
+	return addresses, nil
+}
+
+// InvolvesWatchedAddress reports whether a tx with the specified events involves any of the WatchedAddresses,
+// always true when no addresses are watched. Every address touched by a tx (signers, senders, recipients, contracts)
+// shows up as an event attribute value, so the events are checked rather than decoding the addresses of each msg type.
+func (i *Indexer) InvolvesWatchedAddress(events []abcitypes.Event) bool {
+	if i.WatchedAddresses == nil {
+		return true
+	}
+
+	for _, e := range events {
+		for _, attr := range e.Attributes {
+			value := string(attr.Value)
+			if string(attr.Key) == accSeqAttributeKey {
+				value = strings.SplitN(value, "/", 2)[0]
+			}
+			if _, ok := i.WatchedAddresses[value]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
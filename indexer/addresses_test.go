@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestLoadAddressFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "addresses.txt")
+	content := "# watched addresses\ncosmos1alice\n\n  cosmos1bob  \ncosmos1alice\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	addresses, err := LoadAddressFile(path)
+	if err != nil {
+		t.Fatalf("LoadAddressFile returned unexpected error: %v", err)
+	}
+	expected := map[string]struct{}{"cosmos1alice": {}, "cosmos1bob": {}}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("got addresses %v, expected %v", addresses, expected)
+	}
+
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("# nothing yet\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAddressFile(empty); err == nil {
+		t.Error("expected an error for a file without addresses")
+	}
+	if _, err := LoadAddressFile(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestInvolvesWatchedAddress(t *testing.T) {
+	event := func(key, value string) []abcitypes.Event {
+		return []abcitypes.Event{{Type: "tx", Attributes: []abcitypes.EventAttribute{{Key: []byte(key), Value: []byte(value)}}}}
+	}
+
+	tests := []struct {
+		name     string
+		watched  map[string]struct{}
+		events   []abcitypes.Event
+		expected bool
+	}{
+		{name: "nothing watched", events: event("recipient", "cosmos1carol"), expected: true},
+		{name: "recipient", watched: map[string]struct{}{"cosmos1bob": {}}, events: event("recipient", "cosmos1bob"), expected: true},
+		{name: "signer", watched: map[string]struct{}{"cosmos1bob": {}}, events: event("acc_seq", "cosmos1bob/42"), expected: true},
+		{name: "other address", watched: map[string]struct{}{"cosmos1bob": {}}, events: event("recipient", "cosmos1carol"), expected: false},
+		{name: "no events", watched: map[string]struct{}{"cosmos1bob": {}}, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Indexer{WatchedAddresses: tt.watched}
+			if got := i.InvolvesWatchedAddress(tt.events); got != tt.expected {
+				t.Errorf("got %t, expected %t", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package indexer
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// BatchConfig specifies when the rows buffered by a Batcher are flushed, whichever trigger is reached first.
+// Size is the number of buffered rows and MaxHold is how long the oldest buffered row may wait, zero disables it.
+type BatchConfig struct {
+	Size    int
+	MaxHold time.Duration
+}
+
+// Batcher buffers the rows written by a block action and writes them to the database in batches.
+// Rows are written in the order they were added, consecutive rows of the same model are inserted with a single
+// statement, so rows referencing earlier rows (e.g. msgs referencing their tx) are still written after them.
+type Batcher struct {
+	db  *gorm.DB
+	log *zap.Logger
+	cfg BatchConfig
+
+	// flushMu serializes flushes so batches are written in the order they were taken.
+	flushMu sync.Mutex
+
+	mu    sync.Mutex
+	rows  []batchedRow
+	timer *time.Timer
+}
+
+// batchedRow is a buffered row along with the callback to invoke once it was written, or failed to be.
+// reportsInserted is set for the rows added with AddInserted, whose callback tells apart inserted rows from
+// rows left out by the conflict clause of their model.
+type batchedRow struct {
+	row             interface{}
+	onWritten       func(inserted bool, err error)
+	reportsInserted bool
+}
+
+// errPartiallyInserted rolls back a batch in which only some of the rows of a model were inserted, while it's
+// needed to know which ones, so the rows are written one by one instead.
+var errPartiallyInserted = errors.New("only some of the rows of the batch were inserted")
+
+// NewBatcher returns a Batcher writing to db using the specified flush triggers.
+func NewBatcher(log *zap.Logger, db *gorm.DB, cfg BatchConfig) *Batcher {
+	if cfg.Size < 1 {
+		cfg.Size = 1
+	}
+	return &Batcher{
+		db:  db,
+		log: log,
+		cfg: cfg,
+	}
+}
+
+// Add buffers row to be written with the next batch, onWritten may be nil. If the batch is full it is flushed
+// before returning, otherwise the max hold timer is started when row is the first one buffered.
+func (b *Batcher) Add(row interface{}, onWritten func(err error)) {
+	var callback func(inserted bool, err error)
+	if onWritten != nil {
+		callback = func(_ bool, err error) { onWritten(err) }
+	}
+	b.add(batchedRow{row: row, onWritten: callback})
+}
+
+// AddInserted is Add with onWritten also told whether row was inserted, rather than left out by the conflict clause
+// of its model, see WriteInserted.
+func (b *Batcher) AddInserted(row interface{}, onWritten func(inserted bool, err error)) {
+	b.add(batchedRow{row: row, onWritten: onWritten, reportsInserted: true})
+}
+
+func (b *Batcher) add(r batchedRow) {
+	b.mu.Lock()
+	b.rows = append(b.rows, r)
+	full := len(b.rows) >= b.cfg.Size
+	if !full && len(b.rows) == 1 && b.cfg.MaxHold > 0 {
+		b.timer = time.AfterFunc(b.cfg.MaxHold, b.Flush)
+	}
+	b.mu.Unlock()
+
+	if full {
+		b.Flush()
+	}
+}
+
+// Flush writes every buffered row to the database.
+func (b *Batcher) Flush() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	rows := b.rows
+	b.rows = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	if len(rows) == 0 {
+		return
+	}
+
+	inserted := make([]bool, len(rows))
+	err := b.db.Transaction(func(tx *gorm.DB) error {
+		start := 0
+		for _, group := range groupRowsByModel(rows) {
+			result := tx.Clauses(conflictClauses(group)...).Create(group)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			// Only a group whose rows were either all inserted or all left out tells which rows were inserted
+			end := start + reflect.ValueOf(group).Len()
+			switch result.RowsAffected {
+			case int64(end - start):
+				for j := start; j < end; j++ {
+					inserted[j] = true
+				}
+			case 0:
+			default:
+				for _, r := range rows[start:end] {
+					if r.reportsInserted {
+						return errPartiallyInserted
+					}
+				}
+			}
+			start = end
+		}
+		return nil
+	})
+	if err == nil {
+		for j, r := range rows {
+			if r.onWritten != nil {
+				r.onWritten(inserted[j], nil)
+			}
+		}
+		return
+	}
+
+	// A single bad row fails the whole batch, so fall back to writing the rows one by one to report the error of
+	// each row, or whether each row was inserted.
+	b.log.Debug(
+		"Failed to write batch, writing rows individually",
+		zap.Int("rows", len(rows)),
+		zap.Error(err),
+	)
+	for _, r := range rows {
+		result := b.db.Clauses(conflictClauses(r.row)...).Create(r.row)
+		if r.onWritten != nil {
+			r.onWritten(result.Error == nil && result.RowsAffected > 0, result.Error)
+		}
+	}
+}
+
+// groupRowsByModel groups consecutive rows of the same type into typed slices that can be inserted at once.
+func groupRowsByModel(rows []batchedRow) []interface{} {
+	var (
+		groups []interface{}
+		group  reflect.Value
+	)
+	for _, r := range rows {
+		rv := reflect.ValueOf(r.row)
+		if !group.IsValid() || group.Type().Elem() != rv.Type() {
+			if group.IsValid() {
+				groups = append(groups, group.Interface())
+			}
+			group = reflect.MakeSlice(reflect.SliceOf(rv.Type()), 0, 1)
+		}
+		group = reflect.Append(group, rv)
+	}
+	if group.IsValid() {
+		groups = append(groups, group.Interface())
+	}
+	return groups
+}
+
+// UseBatching configures, per action name, the actions whose rows are written in batches, see Write.
+// The Batchers write through the Indexer's DB as it is when this is called, so it must be called on the Indexer
+// as built rather than on one of the copies made while processing a block, whose DB carries the block's context.
+func (i *Indexer) UseBatching(batching map[string]BatchConfig) {
+	i.batchersMu.Lock()
+	defer i.batchersMu.Unlock()
+
+	i.batchers = make(map[string]*Batcher, len(batching))
+	for actionName, cfg := range batching {
+		// Rows are counted when they're flushed, so they're counted for the action rather than for a block
+		db := i.withRowCounts(&i.rowCounts, actionName).DB
+		i.batchers[actionName] = NewBatcher(i.log.With(zap.String("batch", actionName)), db, cfg)
+	}
+}
+
+// Batcher returns the Batcher used for the rows of the named action,
+// or nil if batching isn't configured for the action.
+func (i *Indexer) Batcher(actionName string) *Batcher {
+	i.batchersMu.Lock()
+	defer i.batchersMu.Unlock()
+
+	return i.batchers[actionName]
+}
+
+// Write writes row for the named action, either immediately or through the action's Batcher if batching
+// is configured for it. onWritten, which may be nil, is invoked with the result once the row is written.
+// Conflicting rows are handled as declared by the model if it implements ConflictModel.
+// Within a block transaction rows are always written immediately, so they're part of the transaction.
+// Batched rows written for a block are flushed before the block is checkpointed, see ExecuteAction.
+func (i *Indexer) Write(actionName string, row interface{}, onWritten func(err error)) {
+	var callback func(inserted bool, err error)
+	if onWritten != nil {
+		callback = func(_ bool, err error) { onWritten(err) }
+	}
+	i.write(actionName, batchedRow{row: row, onWritten: callback})
+}
+
+// WriteInserted is Write with onWritten also told whether row was inserted, rather than left out by the conflict
+// clause of its model (rows updated by it count as inserted), e.g. so what's derived from the row is only applied
+// once when a block is indexed again. A batch in which only some of the rows of a model were inserted is then written
+// one row at a time.
+func (i *Indexer) WriteInserted(actionName string, row interface{}, onWritten func(inserted bool, err error)) {
+	i.write(actionName, batchedRow{row: row, onWritten: onWritten, reportsInserted: true})
+}
+
+func (i *Indexer) write(actionName string, r batchedRow) {
+	if b := i.Batcher(actionName); b != nil && !i.inBlockTx {
+		if writes := i.batchWrites; writes != nil {
+			callback := r.onWritten
+			r.onWritten = func(inserted bool, err error) {
+				writes.record(err)
+				if callback != nil {
+					callback(inserted, err)
+				}
+			}
+		}
+		b.add(r)
+		return
+	}
+
+	var inserted bool
+	err := i.retryConnExhausted(func() error {
+		result := i.DB.Clauses(conflictClauses(r.row)...).Create(r.row)
+		inserted = result.RowsAffected > 0
+		return result.Error
+	})
+	if i.inBlockTx && i.batchWrites != nil {
+		i.batchWrites.record(err)
+	}
+	if r.onWritten != nil {
+		r.onWritten(err == nil && inserted, err)
+	}
+}
+
+// FlushBatches writes the rows buffered by every Batcher.
+func (i *Indexer) FlushBatches() {
+	i.batchersMu.Lock()
+	defer i.batchersMu.Unlock()
+
+	for _, b := range i.batchers {
+		b.Flush()
+	}
+}
+
+// batchWrites collects the first error of the batched rows written for a block, the rows of a block may be flushed
+// along with those of other blocks so their errors are collected through their callbacks rather than from Flush.
+// Within a block transaction it collects the errors of the rows written immediately instead.
+type batchWrites struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (w *batchWrites) record(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// Err returns the first error of the rows written so far, nil if every one of them was written.
+func (w *batchWrites) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// withBatchWrites returns a copy of the Indexer collecting the errors of the rows it writes through a Batcher, or
+// within a block transaction.
+func (i *Indexer) withBatchWrites() (*Indexer, *batchWrites) {
+	writes := &batchWrites{}
+	batchIndexer := *i
+	batchIndexer.batchWrites = writes
+	return &batchIndexer, writes
+}
@@ -0,0 +1,92 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"go.uber.org/zap"
+)
+
+type batchRow struct {
+	ID     uint `gorm:"primaryKey"`
+	Height int64
+}
+
+func TestBatcherFlushesOnSize(t *testing.T) {
+	db, r := dbtest.New(t)
+	b := NewBatcher(zap.NewNop(), db, BatchConfig{Size: 3})
+
+	written := 0
+	for height := int64(1); height <= 2; height++ {
+		b.Add(&batchRow{Height: height}, func(err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			written++
+		})
+	}
+	if rows := r.Rows("batch_rows"); len(rows) != 0 {
+		t.Fatalf("got %d rows written before the batch was full", len(rows))
+	}
+
+	b.Add(&batchRow{Height: 3}, nil)
+	if rows := r.Rows("batch_rows"); len(rows) != 3 {
+		t.Fatalf("got %d rows written once the batch was full, expected 3", len(rows))
+	}
+	if written != 2 {
+		t.Errorf("got %d onWritten callbacks, expected 2", written)
+	}
+}
+
+func TestBatcherFlushesAfterMaxHold(t *testing.T) {
+	db, r := dbtest.New(t)
+	b := NewBatcher(zap.NewNop(), db, BatchConfig{Size: 100, MaxHold: 20 * time.Millisecond})
+
+	done := make(chan error, 1)
+	b.Add(&batchRow{Height: 1}, func(err error) { done <- err })
+
+	if rows := r.Rows("batch_rows"); len(rows) != 0 {
+		t.Fatalf("got %d rows written before the max hold time elapsed", len(rows))
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("partial batch wasn't flushed after the max hold time")
+	}
+	if rows := r.Rows("batch_rows"); len(rows) != 1 || rows[0].(*batchRow).Height != 1 {
+		t.Errorf("got rows %v, expected the one buffered row", rows)
+	}
+}
+
+// BenchmarkBlockWrites compares writing the rows of a block with many transfers one Create at a time to writing them
+// through a Batcher, which inserts them in one transaction.
+func BenchmarkBlockWrites(b *testing.B) {
+	const transfers = 500
+
+	b.Run("per_row", func(b *testing.B) {
+		db, _ := dbtest.New(b)
+		for n := 0; n < b.N; n++ {
+			for j := 0; j < transfers; j++ {
+				if err := db.Create(&batchRow{Height: int64(n)}).Error; err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		db, _ := dbtest.New(b)
+		batcher := NewBatcher(zap.NewNop(), db, BatchConfig{Size: transfers})
+		for n := 0; n < b.N; n++ {
+			for j := 0; j < transfers; j++ {
+				batcher.Add(&batchRow{Height: int64(n)}, nil)
+			}
+			batcher.Flush()
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	"go.uber.org/zap"
+)
+
+// ChainRun records a single run of the indexer against a chain, along with the software versions reported
+// by the node at the start of the run. This helps correlate decode issues with node versions.
+// SampleInterval is N for runs that only indexed every Nth block, the data of those runs isn't contiguous,
+// and 1 for runs that indexed every block. RunID is shared by the ChainRuns of every chain indexed by the same run.
+type ChainRun struct {
+	ID                uint      `gorm:"primaryKey"`
+	RunID             string    `gorm:"not null;default:'';index"`
+	ChainID           string    `gorm:"not null;index"`
+	StartTime         time.Time `gorm:"not null"`
+	AppName           string
+	AppVersion        string
+	CosmosSDKVersion  string `gorm:"column:cosmos_sdk_version"`
+	TendermintVersion string
+	BeginHeight       int64 `gorm:"not null"`
+	EndHeight         int64 `gorm:"not null"`
+	SampleInterval    int64 `gorm:"not null;default:1"`
+}
+
+// RecordChainRun stores a ChainRun for the indexer's chain covering the specified heights.
+// The versions are queried from the node's GetNodeInfo endpoint, falling back to the tendermint version
+// reported by the RPC status when that endpoint isn't available.
+func (i *Indexer) RecordChainRun(ctx context.Context, beginHeight, endHeight, sampleInterval int64) (*ChainRun, error) {
+	run := &ChainRun{
+		RunID:          i.RunID,
+		ChainID:        i.Client.Config.ChainID,
+		StartTime:      time.Now(),
+		BeginHeight:    beginHeight,
+		EndHeight:      endHeight,
+		SampleInterval: sampleInterval,
+	}
+
+	queryCtx, cancel := withTimeout(ctx, i.Timeouts.Query)
+	defer cancel()
+
+	nodeInfo, err := tmservice.NewServiceClient(i.Client).GetNodeInfo(queryCtx, &tmservice.GetNodeInfoRequest{})
+	if err == nil {
+		if nodeInfo.ApplicationVersion != nil {
+			run.AppName = nodeInfo.ApplicationVersion.AppName
+			run.AppVersion = nodeInfo.ApplicationVersion.Version
+			run.CosmosSDKVersion = nodeInfo.ApplicationVersion.CosmosSdkVersion
+		}
+		if nodeInfo.DefaultNodeInfo != nil {
+			run.TendermintVersion = nodeInfo.DefaultNodeInfo.Version
+		}
+	} else {
+		i.log.Info(
+			"Failed to query node info, falling back to the RPC status for the node version",
+			zap.Error(err),
+		)
+
+		status, err := i.Client.RPCClient.Status(queryCtx)
+		if err != nil {
+			i.log.Warn(
+				"Failed to query the node version",
+				zap.Error(err),
+			)
+		} else {
+			run.TendermintVersion = status.NodeInfo.Version
+		}
+	}
+
+	if err := i.DB.Create(run).Error; err != nil {
+		return nil, err
+	}
+	return run, nil
+}
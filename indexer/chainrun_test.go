@@ -0,0 +1,94 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/bytes"
+	"github.com/tendermint/tendermint/p2p"
+	tmp2p "github.com/tendermint/tendermint/proto/tendermint/p2p"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// versionNode is an RPC client answering GetNodeInfo queries with nodeInfo, or failing them if it's nil,
+// and status queries with the tendermint version.
+type versionNode struct {
+	rpcclient.Client
+	nodeInfo *tmservice.GetNodeInfoResponse
+	version  string
+}
+
+func (n *versionNode) ABCIQueryWithOptions(ctx context.Context, path string, data bytes.HexBytes, opts rpcclient.ABCIQueryOptions) (*coretypes.ResultABCIQuery, error) {
+	if n.nodeInfo == nil || path != "/cosmos.base.tendermint.v1beta1.Service/GetNodeInfo" {
+		return nil, errors.New("unknown query")
+	}
+	bz, err := n.nodeInfo.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &coretypes.ResultABCIQuery{Response: abcitypes.ResponseQuery{Value: bz}}, nil
+}
+
+func (n *versionNode) Status(ctx context.Context) (*coretypes.ResultStatus, error) {
+	return &coretypes.ResultStatus{NodeInfo: p2p.DefaultNodeInfo{Version: n.version}}, nil
+}
+
+func TestRecordChainRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		node   *versionNode
+		sample int64
+		want   ChainRun
+	}{
+		{
+			name: "node info",
+			node: &versionNode{
+				nodeInfo: &tmservice.GetNodeInfoResponse{
+					DefaultNodeInfo:    &tmp2p.DefaultNodeInfo{Version: "0.34.16"},
+					ApplicationVersion: &tmservice.VersionInfo{AppName: "gaiad", Version: "v7.0.0", CosmosSdkVersion: "v0.45.1"},
+				},
+				version: "0.34.15",
+			},
+			sample: 1,
+			want:   ChainRun{AppName: "gaiad", AppVersion: "v7.0.0", CosmosSDKVersion: "v0.45.1", TendermintVersion: "0.34.16", SampleInterval: 1},
+		},
+		{
+			name:   "status fallback",
+			node:   &versionNode{version: "0.34.16"},
+			sample: 10,
+			want:   ChainRun{TendermintVersion: "0.34.16", SampleInterval: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIndexer(t, tt.node)
+			i.RunID = "5f0c6e1b"
+			if _, err := i.RecordChainRun(context.Background(), 100, 200, tt.sample); err != nil {
+				t.Fatalf("RecordChainRun returned unexpected error: %v", err)
+			}
+
+			var runs []ChainRun
+			if err := i.DB.Find(&runs).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(runs) != 1 {
+				t.Fatalf("got %d chain runs, want 1", len(runs))
+			}
+			got := runs[0]
+			if got.ID == 0 || got.RunID != "5f0c6e1b" || got.ChainID != "cosmoshub-4" || got.StartTime.IsZero() || got.BeginHeight != 100 || got.EndHeight != 200 {
+				t.Errorf("chain run = %+v, want the run 5f0c6e1b of cosmoshub-4 from 100 to 200", got)
+			}
+			if got.AppName != tt.want.AppName || got.AppVersion != tt.want.AppVersion ||
+				got.CosmosSDKVersion != tt.want.CosmosSDKVersion || got.TendermintVersion != tt.want.TendermintVersion {
+				t.Errorf("chain run versions = %+v, want %+v", got, tt.want)
+			}
+			if got.SampleInterval != tt.want.SampleInterval {
+				t.Errorf("chain run sample interval = %d, want %d", got.SampleInterval, tt.want.SampleInterval)
+			}
+		})
+	}
+}
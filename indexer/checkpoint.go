@@ -0,0 +1,297 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IndexProgress is the checkpoint of an action on a chain, the highest block height the action was executed for.
+// Since blocks are processed concurrently, lower heights may not have been indexed yet.
+type IndexProgress struct {
+	ChainID           string `gorm:"primaryKey"`
+	ActionName        string `gorm:"primaryKey"`
+	LastIndexedHeight int64  `gorm:"not null"`
+}
+
+// IndexedBlock records that an action was executed for the block at Height, unlike IndexProgress it
+// covers every height so the blocks that were already indexed can be skipped when a range is indexed again.
+type IndexedBlock struct {
+	ChainID    string `gorm:"primaryKey"`
+	ActionName string `gorm:"primaryKey"`
+	Height     int64  `gorm:"primaryKey;autoIncrement:false"`
+}
+
+// ExecuteAction executes the action for the block and then updates the action's checkpoint.
+// With BlockTransactions enabled, the action receives a copy of the Indexer whose DB is a transaction that
+// the checkpoint update is also part of, so the rows and the checkpoint of the block commit or roll back together.
+// The block is rolled back if any row written through Write failed, even if the action logged the error and went on,
+// since a failed statement aborts the transaction. Actions writing through the DB directly should return the first
+// error of their writes within a block transaction, see InBlockTx.
+// Otherwise, when the rows of the action are batched, its Batcher is flushed before the checkpoint is updated and
+// the block fails if any of its rows failed to be written, so a block is never recorded as indexed without its rows.
+func (i *Indexer) ExecuteAction(ctx context.Context, a BlockAction, block *coretypes.ResultBlock) (err error) {
+	ctx, span := tracer.Start(ctx, "execute_action", trace.WithAttributes(
+		attribute.String("action", a.Name()),
+	))
+	defer func() { endSpan(span, err) }()
+	i = i.withSpan(span)
+
+	if !i.BlockTransactions {
+		i = i.withRowCounts(&i.rowCounts, a.Name())
+		b := i.Batcher(a.Name())
+		var writes *batchWrites
+		if b != nil {
+			i, writes = i.withBatchWrites()
+		}
+		if err := a.Execute(ctx, i, block); err != nil {
+			return err
+		}
+		if b != nil {
+			// Flushes are serialized, so once this returns the rows of the block were written even if another
+			// flush took them first
+			b.Flush()
+			if err := writes.Err(); err != nil {
+				return fmt.Errorf("failed to write batched rows: %w", err)
+			}
+		}
+		return i.saveCheckpoint(i.DB, a.Name(), block.Block.Height)
+	}
+
+	// The rows of the block are only counted once its transaction is committed
+	var blockCounts RowCounts
+	blockIndexer := i.withRowCounts(&blockCounts, a.Name())
+	err = blockIndexer.DB.Transaction(func(tx *gorm.DB) error {
+		txIndexer, writes := blockIndexer.withBlockTx(tx).withBatchWrites()
+		if err := a.Execute(ctx, txIndexer, block); err != nil {
+			return err
+		}
+		if err := writes.Err(); err != nil {
+			return fmt.Errorf("failed to write rows: %w", err)
+		}
+		return i.saveCheckpoint(tx, a.Name(), block.Block.Height)
+	})
+	if err == nil {
+		i.rowCounts.merge(&blockCounts)
+	}
+	return err
+}
+
+// withBlockTx returns a copy of the Indexer that writes through the block transaction tx.
+func (i *Indexer) withBlockTx(tx *gorm.DB) *Indexer {
+	blockIndexer := *i
+	blockIndexer.DB = tx
+	blockIndexer.inBlockTx = true
+	return &blockIndexer
+}
+
+// InBlockTx reports whether the DB of the Indexer is the transaction of a block, see BlockTransactions. A failed
+// statement aborts the transaction, so the actions must then return the error rather than log it and go on.
+func (i *Indexer) InBlockTx() bool {
+	return i.inBlockTx
+}
+
+// withSpan returns a copy of the Indexer whose DB statements are traced as children of span, or i itself
+// if span isn't being recorded. The DB context only carries the span, not the cancellation of the block.
+func (i *Indexer) withSpan(span trace.Span) *Indexer {
+	if !span.IsRecording() {
+		return i
+	}
+	spanIndexer := *i
+	spanIndexer.DB = i.DB.WithContext(trace.ContextWithSpan(context.Background(), span))
+	return &spanIndexer
+}
+
+// saveCheckpoint advances the checkpoint of the named action to height through db and records the block as indexed,
+// a checkpoint never moves backwards when blocks complete out of order.
+func (i *Indexer) saveCheckpoint(db *gorm.DB, actionName string, height int64) error {
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&IndexedBlock{
+		ChainID:    i.Client.Config.ChainID,
+		ActionName: actionName,
+		Height:     height,
+	}).Error; err != nil {
+		return err
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chain_id"}, {Name: "action_name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"last_indexed_height": gorm.Expr("GREATEST(index_progresses.last_indexed_height, excluded.last_indexed_height)"),
+		}),
+	}).Create(&IndexProgress{
+		ChainID:           i.Client.Config.ChainID,
+		ActionName:        actionName,
+		LastIndexedHeight: height,
+	}).Error
+}
+
+// Checkpoint returns the checkpoint of the named action on the indexer's chain, ok is false if it has none yet.
+func (i *Indexer) Checkpoint(actionName string) (height int64, ok bool, err error) {
+	var heights []int64
+	if err := i.DB.Model(&IndexProgress{}).
+		Where("chain_id = ? AND action_name = ?", i.Client.Config.ChainID, actionName).
+		Pluck("last_indexed_height", &heights).Error; err != nil {
+		return 0, false, err
+	}
+	if len(heights) == 0 {
+		return 0, false, nil
+	}
+	return heights[0], true, nil
+}
+
+// ContiguousIndexedHeight returns the highest height up to which the named action indexed every block on the
+// indexer's chain, starting from the lowest block it indexed. It's below the action's checkpoint while blocks
+// below the checkpoint are missing, e.g. failed blocks yet to be retried. ok is false if no block was indexed yet.
+func (i *Indexer) ContiguousIndexedHeight(actionName string) (height int64, ok bool, err error) {
+	indexedBlocks := func() *gorm.DB {
+		return i.DB.Model(&IndexedBlock{}).Where("chain_id = ? AND action_name = ?", i.Client.Config.ChainID, actionName)
+	}
+
+	var lowest, highest []int64
+	if err := indexedBlocks().Order("height").Limit(1).Pluck("height", &lowest).Error; err != nil {
+		return 0, false, err
+	}
+	if len(lowest) == 0 {
+		return 0, false, nil
+	}
+	if err := indexedBlocks().Order("height DESC").Limit(1).Pluck("height", &highest).Error; err != nil {
+		return 0, false, err
+	}
+
+	// Every height from the lowest one up to h is indexed when there are as many indexed blocks as heights, the end
+	// of the first run of consecutive heights is searched for by counting rather than loading every indexed height
+	contiguous, end := lowest[0], highest[0]
+	for contiguous < end {
+		mid := contiguous + (end-contiguous+1)/2
+		var count int64
+		if err := indexedBlocks().Where("height >= ? AND height <= ?", lowest[0], mid).Count(&count).Error; err != nil {
+			return 0, false, err
+		}
+		if count == mid-lowest[0]+1 {
+			contiguous = mid
+		} else {
+			end = mid - 1
+		}
+	}
+	return contiguous, true, nil
+}
+
+// ResumeHeight returns the height to resume indexing from after the blocks indexed by the actions, the lowest of their
+// contiguous indexed heights plus one, so blocks missing below a checkpoint, e.g. blocks that were in flight when the
+// indexer stopped, are indexed again. ok is false when any of the actions has no indexed block yet, since it still
+// needs every block indexed. Blocks that failed below the lowest indexed block are left to RetryFailedBlocks unless
+// RetryFailedActions is enabled, in which case indexing resumes from the lowest recorded failed block.
+func (i *Indexer) ResumeHeight(actions []BlockAction) (height int64, ok bool, err error) {
+	var lowest int64
+	for j, a := range actions {
+		contiguous, ok, err := i.ContiguousIndexedHeight(a.Name())
+		if err != nil || !ok {
+			return 0, false, err
+		}
+		if j == 0 || contiguous < lowest {
+			lowest = contiguous
+		}
+	}
+	if len(actions) == 0 {
+		return 0, false, nil
+	}
+	height = lowest + 1
+
+	if i.RetryFailedActions {
+		failed, err := LoadFailedBlocks(i.DB, i.Client.Config.ChainID)
+		if err != nil {
+			return 0, false, err
+		}
+		if len(failed) > 0 && failed[0].Height < height {
+			height = failed[0].Height
+		}
+	}
+	return height, true, nil
+}
+
+// SkipIndexedBlocks returns blocks without the heights that every one of the actions already indexed.
+func (i *Indexer) SkipIndexedBlocks(actions []BlockAction, blocks []int64) ([]int64, error) {
+	if len(blocks) == 0 || len(actions) == 0 {
+		return blocks, nil
+	}
+
+	names := make(map[string]struct{}, len(actions))
+	for _, a := range actions {
+		names[a.Name()] = struct{}{}
+	}
+	nameList := make([]string, 0, len(names))
+	for name := range names {
+		nameList = append(nameList, name)
+	}
+
+	lowest, highest := blocks[0], blocks[0]
+	for _, h := range blocks[1:] {
+		if h < lowest {
+			lowest = h
+		}
+		if h > highest {
+			highest = h
+		}
+	}
+
+	var indexed []int64
+	if err := i.DB.Model(&IndexedBlock{}).
+		Where("chain_id = ? AND action_name IN ? AND height >= ? AND height <= ?", i.Client.Config.ChainID, nameList, lowest, highest).
+		Group("height").
+		Having("COUNT(DISTINCT action_name) = ?", len(nameList)).
+		Pluck("height", &indexed).Error; err != nil {
+		return nil, err
+	}
+	if len(indexed) == 0 {
+		return blocks, nil
+	}
+
+	skip := make(map[int64]struct{}, len(indexed))
+	for _, h := range indexed {
+		skip[h] = struct{}{}
+	}
+	remaining := make([]int64, 0, len(blocks)-len(skip))
+	for _, h := range blocks {
+		if _, ok := skip[h]; !ok {
+			remaining = append(remaining, h)
+		}
+	}
+	return remaining, nil
+}
+
+// IndexedHeight is the highest block height indexed on a chain by any of the actions, according to their checkpoints.
+type IndexedHeight struct {
+	ChainID string `json:"chain_id"`
+	Height  int64  `json:"height"`
+}
+
+// LoadIndexedHeights returns the IndexedHeight of every chain with checkpoints sorted by chain id,
+// or only of chainID if it isn't empty.
+func LoadIndexedHeights(db *gorm.DB, chainID string) ([]IndexedHeight, error) {
+	query := db.Order("chain_id")
+	if chainID != "" {
+		query = query.Where("chain_id = ?", chainID)
+	}
+
+	var checkpoints []IndexProgress
+	if err := query.Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+
+	heights := make([]IndexedHeight, 0)
+	for _, c := range checkpoints {
+		if n := len(heights); n > 0 && heights[n-1].ChainID == c.ChainID {
+			if c.LastIndexedHeight > heights[n-1].Height {
+				heights[n-1].Height = c.LastIndexedHeight
+			}
+			continue
+		}
+		heights = append(heights, IndexedHeight{ChainID: c.ChainID, Height: c.LastIndexedHeight})
+	}
+	return heights, nil
+}
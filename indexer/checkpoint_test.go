@@ -0,0 +1,348 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"gorm.io/gorm"
+)
+
+// writingAction writes a row for every block and then returns err.
+type writingAction struct {
+	err error
+}
+
+func (a *writingAction) Name() string { return "writing" }
+
+func (a *writingAction) MigrateSchema(i *Indexer) error { return nil }
+
+func (a *writingAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	var err error
+	i.Write(a.Name(), &transferRow{Denom: "uatom", Amount: "1"}, func(writeErr error) { err = writeErr })
+	if err != nil {
+		return err
+	}
+	return a.err
+}
+
+func TestExecuteActionCheckpoint(t *testing.T) {
+	failed, writeFailed := errors.New("failed"), errors.New("write failed")
+	tests := []struct {
+		name              string
+		blockTransactions bool
+		batching          bool
+		err               error
+		writeErr          error
+		wantErr           error
+		wantRows          int
+		wantCheckpoint    bool
+	}{
+		// Rows of batched actions are written immediately within a block transaction
+		{name: "block transaction", blockTransactions: true, batching: true, wantRows: 1, wantCheckpoint: true},
+		{name: "block transaction rolled back", blockTransactions: true, batching: true, err: failed, wantErr: failed},
+		{name: "no block transaction", wantRows: 1, wantCheckpoint: true},
+		// Without a block transaction the rows written before the failure remain, but the checkpoint doesn't advance
+		{name: "no block transaction failed", err: failed, wantErr: failed, wantRows: 1},
+		// Batched rows are flushed before the checkpoint, which doesn't advance if they fail to be written
+		{name: "batched", batching: true, wantRows: 1, wantCheckpoint: true},
+		{name: "batched write failed", batching: true, writeErr: writeFailed, wantErr: writeFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIndexer(t, nil)
+			db, rec := dbtest.New(t)
+			i.DB = db
+			i.BlockTransactions = tt.blockTransactions
+			if tt.batching {
+				i.UseBatching(map[string]BatchConfig{"writing": {Size: 100}})
+			}
+			if tt.writeErr != nil {
+				rec.Fail("transfer_rows", tt.writeErr)
+			}
+
+			err := i.ExecuteAction(context.Background(), &writingAction{err: tt.err}, testBlock(5, 0))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExecuteAction returned %v, want %v", err, tt.wantErr)
+			}
+
+			if rows := rec.Rows("transfer_rows"); len(rows) != tt.wantRows {
+				t.Errorf("got %d rows, want %d", len(rows), tt.wantRows)
+			}
+			checkpoints := rec.Rows("index_progresses")
+			if !tt.wantCheckpoint {
+				if len(checkpoints) != 0 {
+					t.Errorf("got checkpoints %v, want none", checkpoints)
+				}
+				return
+			}
+			want := IndexProgress{ChainID: "cosmoshub-4", ActionName: "writing", LastIndexedHeight: 5}
+			if len(checkpoints) != 1 || *checkpoints[0].(*IndexProgress) != want {
+				t.Errorf("got checkpoints %v, want %+v", checkpoints, want)
+			}
+		})
+	}
+}
+
+func TestSaveCheckpointNeverMovesBackwards(t *testing.T) {
+	db, rec := dbtest.New(t)
+	i := newTestIndexer(t, nil)
+	i.DB = db
+
+	for _, height := range []int64{3, 7, 5} {
+		if err := i.saveCheckpoint(db, "writing", height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkpoints := rec.Rows("index_progresses")
+	if len(checkpoints) != 1 || checkpoints[0].(*IndexProgress).LastIndexedHeight != 7 {
+		t.Errorf("got checkpoints %v, want a single checkpoint at height 7", checkpoints)
+	}
+}
+
+func TestResumeHeight(t *testing.T) {
+	actions := []BlockAction{&writingAction{}, &recordingAction{}}
+	tests := []struct {
+		name       string
+		indexed    map[string][]int64
+		failed     int64
+		retry      bool
+		wantHeight int64
+		wantOK     bool
+	}{
+		{name: "first run"},
+		{name: "action without checkpoint", indexed: map[string][]int64{"writing": {40}}},
+		{name: "resume", indexed: map[string][]int64{"writing": {40}, "recording": {25}}, wantHeight: 26, wantOK: true},
+		{name: "gap below the checkpoint", indexed: map[string][]int64{"writing": {40}, "recording": {20, 21, 22, 24, 25}}, wantHeight: 23, wantOK: true},
+		{name: "failed block left to retries", indexed: map[string][]int64{"writing": {40}, "recording": {25}}, failed: 12, wantHeight: 26, wantOK: true},
+		{name: "retry failed actions", indexed: map[string][]int64{"writing": {40}, "recording": {25}}, failed: 12, retry: true, wantHeight: 12, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newTestIndexer(t, nil)
+			i.RetryFailedActions = tt.retry
+			if tt.failed != 0 {
+				fb := &FailedBlock{ChainID: "cosmoshub-4", Height: tt.failed, LastError: "out of gas", FailedAt: time.Now()}
+				if err := i.DB.Create(fb).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, heights := range tt.indexed {
+				for _, height := range heights {
+					if err := i.saveCheckpoint(i.DB, name, height); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			// Checkpoints of other chains are ignored
+			other := &IndexProgress{ChainID: "osmosis-1", ActionName: "recording", LastIndexedHeight: 100}
+			if err := i.DB.Create(other).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			height, ok, err := i.ResumeHeight(actions)
+			if err != nil {
+				t.Fatalf("ResumeHeight returned unexpected error: %v", err)
+			}
+			if height != tt.wantHeight || ok != tt.wantOK {
+				t.Errorf("ResumeHeight = %d, %t, want %d, %t", height, ok, tt.wantHeight, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestResumeHeightReindexesGap(t *testing.T) {
+	i := newTestIndexer(t, newFakeNode(0, nil))
+	action := &recordingAction{}
+	actions := []BlockAction{action}
+
+	// Height 4 was in flight when the indexer stopped, after the blocks above it were indexed
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3, 5, 6, 7, 8}, actions, 1); err != nil {
+		t.Fatal(err)
+	}
+	height, ok, err := i.ResumeHeight(actions)
+	if err != nil || !ok || height != 4 {
+		t.Fatalf("ResumeHeight = %d, %t, %v, want 4, true, <nil>", height, ok, err)
+	}
+
+	blocks, err := i.SkipIndexedBlocks(actions, []int64{4, 5, 6, 7, 8, 9, 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.ForEachBlock(context.Background(), blocks, actions, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := action.executed(), []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("executed heights %v, want %v", got, want)
+	}
+	if height, ok, err := i.ResumeHeight(actions); err != nil || !ok || height != 11 {
+		t.Errorf("ResumeHeight = %d, %t, %v, want 11, true, <nil>", height, ok, err)
+	}
+}
+
+// childRowsAction writes a transferRow and then a batchRow for every block, returning the first write error unless
+// ignoreErrors is set, like the actions that log a failed write and carry on with the block.
+type childRowsAction struct {
+	ignoreErrors bool
+}
+
+func (a *childRowsAction) Name() string { return "child_rows" }
+
+func (a *childRowsAction) MigrateSchema(i *Indexer) error { return nil }
+
+func (a *childRowsAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	var err error
+	onWritten := func(writeErr error) {
+		if err == nil {
+			err = writeErr
+		}
+	}
+	i.Write(a.Name(), &transferRow{Denom: "uatom", Amount: "1"}, onWritten)
+	i.Write(a.Name(), &batchRow{Height: block.Block.Height}, onWritten)
+	if a.ignoreErrors {
+		return nil
+	}
+	return err
+}
+
+func TestBlockTransactionMidBlockFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		action *childRowsAction
+	}{
+		{"returned error", &childRowsAction{}},
+		{"ignored error", &childRowsAction{ignoreErrors: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			i := newTestIndexer(t, newFakeNode(0, nil))
+			db, rec := dbtest.New(t)
+			i.DB = db
+			i.BlockTransactions = true
+
+			// The child insert of height 2 fails after its parent row was written
+			failed := errors.New("insert failed")
+			err := db.Callback().Create().Before("gorm:create").Register("test:fail_height", func(db *gorm.DB) {
+				if row, ok := db.Statement.Dest.(*batchRow); ok && row.Height == 2 {
+					_ = db.AddError(failed)
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The block is rolled back and recorded as failed, the other blocks are indexed
+			if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []BlockAction{tc.action}, 1); err != nil {
+				t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+			}
+
+			if rows := rec.Rows("transfer_rows"); len(rows) != 2 {
+				t.Errorf("got %d parent rows, want the rows of heights 1 and 3 only", len(rows))
+			}
+			var heights []int64
+			for _, row := range rec.Rows("batch_rows") {
+				heights = append(heights, row.(*batchRow).Height)
+			}
+			if !reflect.DeepEqual(heights, []int64{1, 3}) {
+				t.Errorf("got child rows of heights %v, want [1 3]", heights)
+			}
+
+			saved, err := LoadFailedBlocks(i.DB, "cosmoshub-4")
+			if err != nil {
+				t.Fatalf("LoadFailedBlocks returned unexpected error: %v", err)
+			}
+			if len(saved) != 1 || saved[0].Height != 2 {
+				t.Errorf("got failed blocks %+v, want height 2", saved)
+			}
+			var indexed []int64
+			for _, row := range rec.Rows("indexed_blocks") {
+				indexed = append(indexed, row.(*IndexedBlock).Height)
+			}
+			if !reflect.DeepEqual(indexed, []int64{1, 3}) {
+				t.Errorf("got indexed blocks %v, want [1 3]", indexed)
+			}
+		})
+	}
+}
+
+func TestLoadIndexedHeights(t *testing.T) {
+	db, _ := dbtest.New(t)
+	for _, c := range []IndexProgress{
+		{ChainID: "osmosis-1", ActionName: "ics20_transfers", LastIndexedHeight: 30},
+		{ChainID: "cosmoshub-4", ActionName: "ics20_transfers", LastIndexedHeight: 12},
+		{ChainID: "cosmoshub-4", ActionName: "msg_signers", LastIndexedHeight: 15},
+		{ChainID: "cosmoshub-4", ActionName: "validator_signatures", LastIndexedHeight: 9},
+	} {
+		c := c
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		chainID  string
+		expected []IndexedHeight
+	}{
+		{chainID: "", expected: []IndexedHeight{{ChainID: "cosmoshub-4", Height: 15}, {ChainID: "osmosis-1", Height: 30}}},
+		{chainID: "cosmoshub-4", expected: []IndexedHeight{{ChainID: "cosmoshub-4", Height: 15}}},
+		{chainID: "juno-1", expected: []IndexedHeight{}},
+	}
+	for _, tt := range tests {
+		heights, err := LoadIndexedHeights(db, tt.chainID)
+		if err != nil {
+			t.Fatalf("LoadIndexedHeights(%q) returned unexpected error: %v", tt.chainID, err)
+		}
+		if !reflect.DeepEqual(heights, tt.expected) {
+			t.Errorf("LoadIndexedHeights(%q) = %+v, expected %+v", tt.chainID, heights, tt.expected)
+		}
+	}
+}
+
+func TestSkipIndexedBlocks(t *testing.T) {
+	i := newTestIndexer(t, nil)
+	writing, recording := &writingAction{}, &recordingAction{}
+
+	// Height 2 was indexed by both actions, height 3 only by one of them
+	for _, h := range []int64{2, 3} {
+		if err := i.ExecuteAction(context.Background(), writing, testBlock(h, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := i.ExecuteAction(context.Background(), recording, testBlock(2, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		actions  []BlockAction
+		blocks   []int64
+		expected []int64
+	}{
+		{name: "both actions", actions: []BlockAction{writing, recording}, blocks: []int64{1, 2, 3, 4}, expected: []int64{1, 3, 4}},
+		{name: "one action", actions: []BlockAction{writing}, blocks: []int64{1, 2, 3, 4}, expected: []int64{1, 4}},
+		{name: "sampled", actions: []BlockAction{writing}, blocks: []int64{1, 3}, expected: []int64{1}},
+		{name: "nothing indexed", actions: []BlockAction{writing, recording}, blocks: []int64{5, 6}, expected: []int64{5, 6}},
+	}
+	for _, tt := range tests {
+		remaining, err := i.SkipIndexedBlocks(tt.actions, tt.blocks)
+		if err != nil {
+			t.Fatalf("%s: SkipIndexedBlocks returned unexpected error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(remaining, tt.expected) {
+			t.Errorf("%s: got blocks %v, expected %v", tt.name, remaining, tt.expected)
+		}
+	}
+
+	// Other chains don't count
+	i.Client.Config.ChainID = "osmosis-1"
+	remaining, err := i.SkipIndexedBlocks([]BlockAction{writing}, []int64{2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(remaining, []int64{2, 3}) {
+		t.Errorf("got blocks %v of another chain, expected [2 3]", remaining)
+	}
+}
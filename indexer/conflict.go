@@ -0,0 +1,39 @@
+package indexer
+
+import (
+	"reflect"
+
+	"gorm.io/gorm/clause"
+)
+
+// ConflictModel can optionally be implemented by the models written through (*Indexer).Write to declare how a row
+// conflicting with an existing one is handled, e.g. ignored or updated. Rows of other models fail on conflict.
+//
+// NOTE: OnConflict should be implemented with a value receiver, so it can be called on any row of the model.
+type ConflictModel interface {
+	OnConflict() clause.OnConflict
+}
+
+// conflictClauses returns the OnConflict clause declared by the model of row, which may also be a slice of rows
+// of the same model or a pointer to one, or no clauses if the model doesn't implement ConflictModel.
+func conflictClauses(row interface{}) []clause.Expression {
+	rv := reflect.ValueOf(row)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Slice {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Slice {
+		if rv.Len() == 0 {
+			return nil
+		}
+		rv = rv.Index(0)
+	}
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+
+	m, ok := rv.Interface().(ConflictModel)
+	if !ok {
+		return nil
+	}
+	return []clause.Expression{m.OnConflict()}
+}
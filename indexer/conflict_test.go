@@ -0,0 +1,121 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"gorm.io/gorm/clause"
+)
+
+// upsertRow updates the value of the row with the same key on conflict.
+type upsertRow struct {
+	ID    uint   `gorm:"primaryKey"`
+	Key   string `gorm:"uniqueIndex"`
+	Value string
+}
+
+func (upsertRow) OnConflict() clause.OnConflict {
+	return clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value"}),
+	}
+}
+
+func TestConflictClauses(t *testing.T) {
+	expected := []clause.Expression{upsertRow{}.OnConflict()}
+	tests := []struct {
+		name     string
+		row      interface{}
+		expected []clause.Expression
+	}{
+		{name: "row", row: &upsertRow{}, expected: expected},
+		{name: "slice", row: []*upsertRow{{}, {}}, expected: expected},
+		{name: "pointer to a slice", row: &[]upsertRow{{}}, expected: expected},
+		{name: "empty slice", row: []*upsertRow{}},
+		{name: "nil row", row: (*upsertRow)(nil)},
+		{name: "model without conflict handling", row: &transferRow{}},
+	}
+	for _, tt := range tests {
+		if got := conflictClauses(tt.row); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: got clauses %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestWriteConflictModel(t *testing.T) {
+	for _, batched := range []bool{false, true} {
+		i := newTestIndexer(t, nil)
+		db, rec := dbtest.New(t)
+		i.DB = db
+		if batched {
+			i.UseBatching(map[string]BatchConfig{"upserting": {Size: 2}})
+		}
+
+		for _, row := range []*upsertRow{{Key: "a", Value: "1"}, {Key: "b", Value: "1"}, {Key: "a", Value: "2"}, {Key: "c", Value: "1"}} {
+			i.Write("upserting", row, func(err error) {
+				if err != nil {
+					t.Errorf("batched %t: write of %+v failed: %v", batched, row, err)
+				}
+			})
+		}
+
+		got := make(map[string]string)
+		for _, row := range rec.Rows("upsert_rows") {
+			got[row.(*upsertRow).Key] = row.(*upsertRow).Value
+		}
+		if expected := map[string]string{"a": "2", "b": "1", "c": "1"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("batched %t: got rows %v, expected %v", batched, got, expected)
+		}
+
+		// Models without conflict handling still fail on conflict
+		i.Write("plain", &transferRow{ID: 1}, nil)
+		var err error
+		i.Write("plain", &transferRow{ID: 1}, func(writeErr error) { err = writeErr })
+		if err == nil {
+			t.Errorf("batched %t: conflicting write of a model without conflict handling didn't fail", batched)
+		}
+	}
+}
+
+// ignoredRow leaves the row with the same id as is on conflict.
+type ignoredRow struct {
+	ID uint `gorm:"primaryKey;autoIncrement:false"`
+}
+
+func (ignoredRow) OnConflict() clause.OnConflict {
+	return clause.OnConflict{DoNothing: true}
+}
+
+func TestWriteInserted(t *testing.T) {
+	for _, batched := range []bool{false, true} {
+		i := newTestIndexer(t, nil)
+		db, rec := dbtest.New(t)
+		i.DB = db
+		if batched {
+			i.UseBatching(map[string]BatchConfig{"ignoring": {Size: 2}})
+		}
+
+		// The second pair is only partially inserted and the last one not at all
+		writes := [][]uint{{1, 2}, {2, 3}, {1, 3}}
+		expected := [][]bool{{true, true}, {false, true}, {false, false}}
+		for j, ids := range writes {
+			got := make([]bool, len(ids))
+			for k, id := range ids {
+				k := k
+				i.WriteInserted("ignoring", &ignoredRow{ID: id}, func(inserted bool, err error) {
+					if err != nil {
+						t.Errorf("batched %t: write of row %d failed: %v", batched, id, err)
+					}
+					got[k] = inserted
+				})
+			}
+			if !reflect.DeepEqual(got, expected[j]) {
+				t.Errorf("batched %t: writing rows %v reported inserted %v, expected %v", batched, ids, got, expected[j])
+			}
+		}
+		if rows := rec.Rows("ignored_rows"); len(rows) != 3 {
+			t.Errorf("batched %t: got %d rows, expected 3", batched, len(rows))
+		}
+	}
+}
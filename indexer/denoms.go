@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm/clause"
+)
+
+// DenomMetadata is the bank module metadata of a denom, used to convert indexed base denom amounts to display units.
+// Exponent is the exponent of the Display unit, i.e. amount / 10^Exponent is the amount in display units.
+type DenomMetadata struct {
+	ChainID   string `gorm:"primaryKey"`
+	Denom     string `gorm:"primaryKey"`
+	Display   string `gorm:"not null"`
+	Exponent  uint32 `gorm:"not null"`
+	Symbol    string `gorm:"not null;default:''"`
+	Name      string `gorm:"not null;default:''"`
+	UpdatedAt time.Time
+}
+
+// TableName overrides the pluralized table name gorm would use by default.
+func (DenomMetadata) TableName() string {
+	return "denom_metadata"
+}
+
+// EnrichDenom stores the DenomMetadata of denom when DenomMetadata is enabled. Each denom is only queried once
+// per run, denoms without metadata are remembered as well, other query errors are logged and retried next time.
+func (i *Indexer) EnrichDenom(ctx context.Context, denom string) {
+	if !i.DenomMetadata || denom == "" {
+		return
+	}
+	if _, ok := i.denoms.Load(denom); ok {
+		return
+	}
+
+	metadata, err := i.QueryDenomMetadata(ctx, denom)
+	if err != nil {
+		i.log.Debug(
+			"Failed to query denom metadata",
+			zap.String("denom", denom),
+			zap.Error(err),
+		)
+		return
+	}
+	if metadata == nil {
+		i.denoms.Store(denom, struct{}{})
+		return
+	}
+
+	err = i.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "denom"}},
+		DoUpdates: clause.AssignmentColumns([]string{"display", "exponent", "symbol", "name", "updated_at"}),
+	}).Create(metadata).Error
+	if err != nil {
+		i.log.Warn(
+			"Failed to insert DenomMetadata into DB",
+			zap.String("denom", denom),
+			zap.Error(err),
+		)
+		return
+	}
+	i.denoms.Store(denom, struct{}{})
+}
+
+// QueryDenomMetadata queries the bank module for the metadata of denom, bounded by the Query timeout.
+// A nil DenomMetadata without an error is returned when the chain has no metadata for denom.
+func (i *Indexer) QueryDenomMetadata(ctx context.Context, denom string) (*DenomMetadata, error) {
+	queryCtx, cancel := withTimeout(ctx, i.Timeouts.Query)
+	defer cancel()
+
+	res, err := banktypes.NewQueryClient(i.Client).DenomMetadata(queryCtx, &banktypes.QueryDenomMetadataRequest{Denom: denom})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return NewDenomMetadata(i.Client.Config.ChainID, denom, res.Metadata), nil
+}
+
+// NewDenomMetadata returns the DenomMetadata for the bank metadata of denom. The exponent is looked up
+// in the denom units, including their aliases, and is zero when the display unit isn't listed.
+func NewDenomMetadata(chainID, denom string, metadata banktypes.Metadata) *DenomMetadata {
+	dm := &DenomMetadata{
+		ChainID: chainID,
+		Denom:   denom,
+		Display: metadata.Display,
+		Symbol:  metadata.Symbol,
+		Name:    metadata.Name,
+	}
+	for _, unit := range metadata.DenomUnits {
+		if unit == nil {
+			continue
+		}
+		if unit.Denom == metadata.Display {
+			dm.Exponent = unit.Exponent
+			break
+		}
+		for _, alias := range unit.Aliases {
+			if alias == metadata.Display {
+				dm.Exponent = unit.Exponent
+			}
+		}
+	}
+	return dm
+}
+
+// isNotFound reports whether err is a NotFound gRPC error. Queries are made over ABCI, where the gRPC status
+// is flattened into the error log, so the code is also looked for in the error message.
+func isNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound || strings.Contains(err.Error(), "code = "+codes.NotFound.String())
+}
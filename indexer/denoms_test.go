@@ -0,0 +1,102 @@
+package indexer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const denomMetadataPath = "/cosmos.bank.v1beta1.Query/DenomMetadata"
+
+var atomMetadata = banktypes.Metadata{
+	Base:    "uatom",
+	Display: "atom",
+	Symbol:  "ATOM",
+	Name:    "Cosmos Hub Atom",
+	DenomUnits: []*banktypes.DenomUnit{
+		{Denom: "uatom", Exponent: 0, Aliases: []string{"microatom"}},
+		{Denom: "matom", Exponent: 3, Aliases: []string{"milliatom"}},
+		{Denom: "atom", Exponent: 6},
+	},
+}
+
+func TestNewDenomMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		display  string
+		exponent uint32
+	}{
+		{name: "display unit", display: "atom", exponent: 6},
+		{name: "display alias", display: "milliatom", exponent: 3},
+		{name: "base unit", display: "uatom", exponent: 0},
+		{name: "unlisted display unit", display: "katom", exponent: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := atomMetadata
+			metadata.Display = tt.display
+			metadata.DenomUnits = append(metadata.DenomUnits, nil)
+
+			got := NewDenomMetadata("cosmoshub-4", "uatom", metadata)
+			expected := &DenomMetadata{ChainID: "cosmoshub-4", Denom: "uatom", Display: tt.display, Exponent: tt.exponent, Symbol: "ATOM", Name: "Cosmos Hub Atom"}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("got %+v, expected %+v", got, expected)
+			}
+		})
+	}
+}
+
+func TestEnrichDenom(t *testing.T) {
+	node := rpctest.New("cosmoshub-4")
+	node.HandleQuery(denomMetadataPath, func(data []byte) (codec.ProtoMarshaler, error) {
+		var req banktypes.QueryDenomMetadataRequest
+		if err := req.Unmarshal(data); err != nil {
+			return nil, err
+		}
+		if req.Denom != "uatom" {
+			return nil, status.Errorf(codes.NotFound, "no metadata for denom %s", req.Denom)
+		}
+		return &banktypes.QueryDenomMetadataResponse{Metadata: atomMetadata}, nil
+	})
+
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: "cosmoshub-4"},
+		RPCClient: node,
+		Codec:     lens.MakeCodec(lens.ModuleBasics),
+	}
+	db, r := dbtest.New(t)
+	i := NewIndexer(zap.NewNop(), client, db)
+
+	// Disabled by default
+	i.EnrichDenom(context.Background(), "uatom")
+	if queried := node.Queried(denomMetadataPath); queried != 0 {
+		t.Fatalf("denom metadata queried %d times while disabled", queried)
+	}
+
+	i.DenomMetadata = true
+	for j := 0; j < 2; j++ {
+		i.EnrichDenom(context.Background(), "uatom")
+		i.EnrichDenom(context.Background(), "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2")
+	}
+	if queried := node.Queried(denomMetadataPath); queried != 2 {
+		t.Errorf("denom metadata queried %d times, want once per denom", queried)
+	}
+
+	rows := r.Rows("denom_metadata")
+	if len(rows) != 1 {
+		t.Fatalf("got %d denom metadata rows, want only the one of uatom", len(rows))
+	}
+	got := *rows[0].(*DenomMetadata)
+	if got.ChainID != "cosmoshub-4" || got.Denom != "uatom" || got.Display != "atom" || got.Exponent != 6 || got.Symbol != "ATOM" {
+		t.Errorf("got denom metadata %+v, want the metadata of uatom", got)
+	}
+}
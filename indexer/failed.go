@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoadFailedBlocks returns the failed blocks recorded in the database for chainID, sorted by height.
+// An empty chainID returns the failed blocks of every chain.
+func LoadFailedBlocks(db *gorm.DB, chainID string) ([]FailedBlock, error) {
+	failed := make([]FailedBlock, 0)
+	if !db.Migrator().HasTable(&FailedBlock{}) {
+		return failed, nil
+	}
+
+	query := db.Order("chain_id").Order("height")
+	if chainID != "" {
+		query = query.Where(&FailedBlock{ChainID: chainID})
+	}
+	if err := query.Find(&failed).Error; err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// RetryFailedBlocks re-attempts processing the failed blocks recorded in the database for the indexer's chain.
+// Blocks that are processed successfully are removed from the database and their heights are returned,
+// blocks that fail again stay recorded with their latest error.
+func (i *Indexer) RetryFailedBlocks(ctx context.Context, actions []BlockAction, concurrentBlocks uint) ([]int64, error) {
+	failed, err := LoadFailedBlocks(i.DB, i.Client.Config.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	if len(failed) == 0 {
+		return nil, nil
+	}
+
+	heights := make([]int64, len(failed))
+	for j, fb := range failed {
+		heights[j] = fb.Height
+	}
+
+	var failedBlocksErr *FailedBlocksError
+	retryErr := i.ForEachBlock(ctx, heights, actions, concurrentBlocks)
+	if retryErr != nil && !errors.As(retryErr, &failedBlocksErr) {
+		return nil, retryErr
+	}
+
+	stillFailing := make(map[int64]struct{})
+	for _, fb := range i.FailedBlocks() {
+		stillFailing[fb.Height] = struct{}{}
+	}
+
+	var recovered []int64
+	for _, h := range heights {
+		if _, ok := stillFailing[h]; !ok {
+			recovered = append(recovered, h)
+		}
+	}
+
+	if len(recovered) > 0 {
+		err = i.DB.Where("chain_id = ? AND height IN ?", i.Client.Config.ChainID, recovered).
+			Delete(&FailedBlock{}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return recovered, retryErr
+}
+
+// deleteFailedBlock removes the failure of the block at height recorded in the database, once the block succeeded.
+// Failures to do so are only logged, the block is then left to RetryFailedBlocks.
+func (i *Indexer) deleteFailedBlock(height int64) {
+	err := i.DB.Where(&FailedBlock{ChainID: i.Client.Config.ChainID, Height: height}).Delete(&FailedBlock{}).Error
+	if err != nil {
+		i.log.Warn(
+			"Failed to remove recovered failed block",
+			zap.Int64("height", height),
+			zap.Error(err),
+		)
+	}
+}
+
+// saveFailedBlock records the current failure of the block at height in the database,
+// failures to do so are only logged since the block is still tracked in memory.
+func (i *Indexer) saveFailedBlock(height int64) {
+	i.failedMu.Lock()
+	fb, ok := i.failed[height]
+	i.failedMu.Unlock()
+	if !ok {
+		return
+	}
+
+	err := i.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "height"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_error", "failed_at"}),
+	}).Create(&fb).Error
+	if err != nil {
+		i.log.Warn(
+			"Failed to record failed block",
+			zap.Int64("height", height),
+			zap.Error(err),
+		)
+	}
+}
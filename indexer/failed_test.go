@@ -0,0 +1,181 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+func TestRetryFailedBlocks(t *testing.T) {
+	// Height 6 is still unavailable, height 5 can now be processed
+	node := newFakeNode(0, map[int64]int{6: -1})
+	i := newTestIndexer(t, node)
+	i.RetryDeadline = time.Nanosecond
+
+	seeded := []FailedBlock{
+		{ChainID: "cosmoshub-4", Height: 5, LastError: "timeout", FailedAt: time.Now()},
+		{ChainID: "cosmoshub-4", Height: 6, LastError: "timeout", FailedAt: time.Now()},
+		{ChainID: "osmosis-1", Height: 5, LastError: "timeout", FailedAt: time.Now()},
+	}
+	if err := i.DB.Create(&seeded).Error; err != nil {
+		t.Fatalf("failed to seed failed blocks: %v", err)
+	}
+
+	action := &recordingAction{}
+	recovered, err := i.RetryFailedBlocks(context.Background(), []BlockAction{action}, 2)
+	var failed *FailedBlocksError
+	if !errors.As(err, &failed) || !reflect.DeepEqual(failed.Heights, []int64{6}) {
+		t.Fatalf("RetryFailedBlocks returned %v, want height 6 to still fail", err)
+	}
+	if !reflect.DeepEqual(recovered, []int64{5}) {
+		t.Errorf("recovered heights %v, want [5]", recovered)
+	}
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{5}) {
+		t.Errorf("executed heights %v, want [5]", got)
+	}
+
+	remaining, err := LoadFailedBlocks(i.DB, "")
+	if err != nil {
+		t.Fatalf("LoadFailedBlocks returned unexpected error: %v", err)
+	}
+	if len(remaining) != 2 {
+		t.Fatalf("got failed blocks %+v, want height 6 and the block of the other chain", remaining)
+	}
+	if fb := remaining[0]; fb.ChainID != "cosmoshub-4" || fb.Height != 6 || fb.LastError != "height 6 is not available" {
+		t.Errorf("failed block = %+v, want height 6 with its latest error", fb)
+	}
+	if fb := remaining[1]; fb.ChainID != "osmosis-1" || fb.Height != 5 || fb.LastError != "timeout" {
+		t.Errorf("failed block of another chain = %+v, want it untouched", fb)
+	}
+
+	chain, err := LoadFailedBlocks(i.DB, "osmosis-1")
+	if err != nil {
+		t.Fatalf("LoadFailedBlocks returned unexpected error: %v", err)
+	}
+	if len(chain) != 1 || chain[0].ChainID != "osmosis-1" {
+		t.Errorf("got failed blocks %+v for osmosis-1, want only its own", chain)
+	}
+}
+
+func TestForEachBlockSavesFailedBlocks(t *testing.T) {
+	// Height 2 can't be queried and the action fails for height 3
+	node := newFakeNode(0, map[int64]int{2: -1})
+	i := newTestIndexer(t, node)
+	i.RetryDeadline = 50 * time.Millisecond
+
+	action := &failingAction{failures: map[int64]error{3: errors.New("out of gas")}}
+	err := i.ForEachBlock(context.Background(), []int64{1, 2, 3, 4}, []BlockAction{action}, 2)
+	var failed *FailedBlocksError
+	if !errors.As(err, &failed) {
+		t.Fatalf("ForEachBlock returned %v, want a *FailedBlocksError", err)
+	}
+
+	saved, err := LoadFailedBlocks(i.DB, "cosmoshub-4")
+	if err != nil {
+		t.Fatalf("LoadFailedBlocks returned unexpected error: %v", err)
+	}
+	got := make(map[int64]string)
+	for _, fb := range saved {
+		got[fb.Height] = fb.LastError
+		if fb.FailedAt.IsZero() {
+			t.Errorf("failed block %d has no failure time", fb.Height)
+		}
+	}
+	if len(got) != 2 || got[2] != "height 2 is not available" || got[3] == "" {
+		t.Errorf("got failed blocks %v, want heights 2 and 3 with their errors", got)
+	}
+}
+
+// flakyAction is a recordingAction failing the first attempts of blocks, failures holds the number of attempts
+// left to fail for each height.
+type flakyAction struct {
+	recordingAction
+	mu       sync.Mutex
+	failures map[int64]int
+}
+
+func (a *flakyAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	_ = a.recordingAction.Execute(ctx, i, block)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failures[block.Block.Height] == 0 {
+		return nil
+	}
+	a.failures[block.Block.Height]--
+	return errors.New("out of gas")
+}
+
+func TestForEachBlockRetryFailedActions(t *testing.T) {
+	node := newFakeNode(0, nil)
+	i := newTestIndexer(t, node)
+	i.RetryFailedActions = true
+
+	// The action fails the first attempt of height 2 and then succeeds
+	action := &flakyAction{failures: map[int64]int{2: 1}}
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []BlockAction{action}, 2); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	executed := action.executed()
+	sort.Slice(executed, func(a, b int) bool { return executed[a] < executed[b] })
+	if !reflect.DeepEqual(executed, []int64{1, 2, 2, 3}) {
+		t.Errorf("executed heights = %v, want height 2 to be retried", executed)
+	}
+
+	remaining, err := LoadFailedBlocks(i.DB, "")
+	if err != nil {
+		t.Fatalf("LoadFailedBlocks returned unexpected error: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("got failed blocks %+v, want the recovered block removed", remaining)
+	}
+}
+
+// cancellingNode is a fakeNode cancelling a context once a block query fails.
+type cancellingNode struct {
+	*fakeNode
+	cancel context.CancelFunc
+}
+
+func (n *cancellingNode) Block(ctx context.Context, height *int64) (*coretypes.ResultBlock, error) {
+	block, err := n.fakeNode.Block(ctx, height)
+	if err != nil {
+		n.cancel()
+	}
+	return block, err
+}
+
+func TestForEachBlockCancelledWithFailedBlocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	node := &cancellingNode{fakeNode: newFakeNode(0, map[int64]int{2: -1}), cancel: cancel}
+	i := newTestIndexer(t, node)
+
+	action := &recordingAction{}
+	err := i.ForEachBlock(ctx, []int64{2}, []BlockAction{action}, 1)
+	var failed *FailedBlocksError
+	if !errors.As(err, &failed) || !reflect.DeepEqual(failed.Heights, []int64{2}) {
+		t.Fatalf("ForEachBlock returned %v, want height 2 to still fail", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ForEachBlock returned %v, want it to wrap the context error", err)
+	}
+	if q := node.queries[2]; q != 1 {
+		t.Errorf("height 2 queried %d times, want no other pass after the context was cancelled", q)
+	}
+
+	remaining, err := LoadFailedBlocks(i.DB, "")
+	if err != nil {
+		t.Fatalf("LoadFailedBlocks returned unexpected error: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].Height != 2 {
+		t.Errorf("got failed blocks %+v, want height 2 saved for later", remaining)
+	}
+}
@@ -0,0 +1,56 @@
+package indexer
+
+import (
+	"sort"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// ProportionalShares splits total across the specified weights proportionally, e.g. to attribute a tx fee
+// across the outputs of a MsgMultiSend weighted by the amount of each output.
+//
+// Each share is first rounded down, then the units left over by rounding are handed out one at a time to the
+// shares with the largest remainders (ties go to the earlier share). The shares therefore always sum to total.
+// If the weights sum to zero the whole total is attributed to the first share.
+func ProportionalShares(total sdk.Int, weights []sdk.Int) []sdk.Int {
+	shares := make([]sdk.Int, len(weights))
+	if len(weights) == 0 {
+		return shares
+	}
+
+	sum := sdk.ZeroInt()
+	for _, w := range weights {
+		sum = sum.Add(w)
+	}
+	if sum.IsZero() {
+		shares[0] = total
+		for j := 1; j < len(shares); j++ {
+			shares[j] = sdk.ZeroInt()
+		}
+		return shares
+	}
+
+	remainders := make([]sdk.Int, len(weights))
+	allocated := sdk.ZeroInt()
+	for j, w := range weights {
+		product := total.Mul(w)
+		shares[j] = product.Quo(sum)
+		remainders[j] = product.Mod(sum)
+		allocated = allocated.Add(shares[j])
+	}
+
+	order := make([]int, len(weights))
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].GT(remainders[order[b]])
+	})
+
+	leftover := total.Sub(allocated).Int64()
+	for j := int64(0); j < leftover; j++ {
+		k := order[j%int64(len(order))]
+		shares[k] = shares[k].AddRaw(1)
+	}
+	return shares
+}
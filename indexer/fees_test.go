@@ -0,0 +1,76 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+func ints(values ...int64) []sdk.Int {
+	out := make([]sdk.Int, len(values))
+	for j, v := range values {
+		out[j] = sdk.NewInt(v)
+	}
+	return out
+}
+
+func TestProportionalShares(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int64
+		weights  []sdk.Int
+		expected []sdk.Int
+	}{
+		{"even", 100, ints(1, 1, 2), ints(25, 25, 50)},
+		{"largest remainders", 10, ints(1, 1, 1), ints(4, 3, 3)},
+		{"remainders ordered", 7, ints(1, 2, 4), ints(1, 2, 4)},
+		{"uneven", 1000, ints(333, 333, 334), ints(333, 333, 334)},
+		{"rounding", 5, ints(3, 3, 1), ints(2, 2, 1)},
+		{"zero weights", 9, ints(0, 0), ints(9, 0)},
+		{"zero total", 0, ints(5, 7), ints(0, 0)},
+		{"no weights", 9, nil, ints()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := ProportionalShares(sdk.NewInt(tt.total), tt.weights)
+			if fmt.Sprint(shares) != fmt.Sprint(tt.expected) {
+				t.Errorf("got shares %v, expected %v", shares, tt.expected)
+			}
+
+			if len(tt.weights) == 0 {
+				return
+			}
+			sum := sdk.ZeroInt()
+			for _, s := range shares {
+				sum = sum.Add(s)
+			}
+			if !sum.Equal(sdk.NewInt(tt.total)) {
+				t.Errorf("shares %v sum to %s, expected the total fee %d", shares, sum, tt.total)
+			}
+		})
+	}
+}
+
+// The shares must sum to the total whatever the rounding, including for amounts that overflow an int64 once multiplied.
+func TestProportionalSharesSumToTotal(t *testing.T) {
+	large, ok := sdk.NewIntFromString("340282366920938463463374607431768211455")
+	if !ok {
+		t.Fatal("failed to parse large amount")
+	}
+	totals := []sdk.Int{sdk.NewInt(1), sdk.NewInt(997), sdk.NewInt(1_000_003), large}
+	weights := []sdk.Int{sdk.NewInt(3), sdk.NewInt(0), sdk.NewInt(7), sdk.NewInt(11), large, sdk.NewInt(1)}
+
+	for _, total := range totals {
+		sum := sdk.ZeroInt()
+		for _, share := range ProportionalShares(total, weights) {
+			if share.IsNegative() {
+				t.Errorf("total %s: negative share %s", total, share)
+			}
+			sum = sum.Add(share)
+		}
+		if !sum.Equal(total) {
+			t.Errorf("shares of %s sum to %s", total, sum)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package indexer
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// DefaultGenesisHeights is the default number of heights, starting at the chain's initial height,
+// that are treated as genesis heights, see IsGenesisHeight.
+const DefaultGenesisHeights = 2
+
+// IsGenesisHeight reports whether height is one of the first GenesisHeights heights of the chain. The first block
+// has no last commit and some queries (e.g. the validator set or block results) fail at the earliest heights on
+// some nodes, so failures at these heights are logged rather than retried and signatures aren't indexed for them.
+// It always returns false until the initial height was loaded by ForEachBlock.
+func (i *Indexer) IsGenesisHeight(height int64) bool {
+	if i.GenesisHeights <= 0 {
+		return false
+	}
+	initialHeight := atomic.LoadInt64(&i.initialHeight)
+	return initialHeight > 0 && height >= initialHeight && height < initialHeight+i.GenesisHeights
+}
+
+// loadInitialHeight loads the initial height of the chain, used by IsGenesisHeight, unless it was already loaded.
+// It's the earliest height available on the node, which is the chain's initial height for archive nodes.
+// If the node can't be queried the initial height is assumed to be 1.
+func (i *Indexer) loadInitialHeight(ctx context.Context) {
+	if i.GenesisHeights <= 0 || atomic.LoadInt64(&i.initialHeight) > 0 {
+		return
+	}
+
+	initialHeight := int64(1)
+	queryCtx, cancel := withTimeout(ctx, i.Timeouts.Query)
+	status, err := i.Client.RPCClient.Status(queryCtx)
+	cancel()
+	if err != nil {
+		i.log.Warn(
+			"Failed to query earliest block height, assuming the chain starts at height 1",
+			zap.String("chain_id", i.Client.Config.ChainID),
+			zap.Error(err),
+		)
+	} else if status.SyncInfo.EarliestBlockHeight > 0 {
+		initialHeight = status.SyncInfo.EarliestBlockHeight
+	}
+	atomic.StoreInt64(&i.initialHeight, initialHeight)
+}
@@ -0,0 +1,73 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// failingAction is a recordingAction failing with failures[h] at height h, the heights it fails at are recorded too.
+type failingAction struct {
+	recordingAction
+	failures map[int64]error
+}
+
+func (a *failingAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	_ = a.recordingAction.Execute(ctx, i, block)
+	return a.failures[block.Block.Height]
+}
+
+func TestIsGenesisHeight(t *testing.T) {
+	tests := []struct {
+		name           string
+		genesisHeights int64
+		initialHeight  int64
+		height         int64
+		expected       bool
+	}{
+		{name: "first height", genesisHeights: 2, initialHeight: 1, height: 1, expected: true},
+		{name: "last genesis height", genesisHeights: 2, initialHeight: 1, height: 2, expected: true},
+		{name: "after genesis heights", genesisHeights: 2, initialHeight: 1, height: 3},
+		{name: "chain with an initial height", genesisHeights: 2, initialHeight: 5200791, height: 5200791, expected: true},
+		{name: "before the initial height", genesisHeights: 2, initialHeight: 5200791, height: 1},
+		{name: "disabled", initialHeight: 1, height: 1},
+		{name: "initial height not loaded", genesisHeights: 2, height: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &Indexer{GenesisHeights: tt.genesisHeights, state: &state{initialHeight: tt.initialHeight}}
+			if got := i.IsGenesisHeight(tt.height); got != tt.expected {
+				t.Errorf("got %t, expected %t", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestForEachBlockGenesisHeights(t *testing.T) {
+	// The chain starts at height 100, whose block isn't available on the node, and the action fails at height 101.
+	// Height 102 is past the genesis heights, so it's retried until it's available.
+	node := newFakeNode(0, map[int64]int{100: -1, 102: 1})
+	node.earliestHeight = 100
+	i := newTestIndexer(t, node)
+	i.GenesisHeights = 2
+
+	action := &failingAction{failures: map[int64]error{101: errors.New("no validator set")}}
+	if err := i.ForEachBlock(context.Background(), []int64{100, 101, 102}, []BlockAction{action}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if node.queries[100] != 1 {
+		t.Errorf("height 100 queried %d times, want the genesis height to only be attempted once", node.queries[100])
+	}
+	if node.queries[102] != 2 {
+		t.Errorf("height 102 queried %d times, want it to be retried", node.queries[102])
+	}
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{101, 102}) {
+		t.Errorf("executed heights = %v, want [101 102]", got)
+	}
+	if failed := i.FailedBlocks(); len(failed) != 0 {
+		t.Errorf("got failed blocks %+v, want failures at genesis heights to only be logged", failed)
+	}
+}
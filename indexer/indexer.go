@@ -2,12 +2,26 @@ package indexer
 
 import (
 	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/avast/retry-go/v4"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
 	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -32,9 +46,246 @@ type Indexer struct {
 	Client *lens.ChainClient
 	DB     *gorm.DB
 
+	// RunID identifies the run of the indexer, see NewRunID.
+	RunID string
+
+	// ConcurrentTxs is the max number of txs, within a single block, that a BlockAction may process concurrently.
+	ConcurrentTxs uint
+
+	// BlockResultsFallback enables querying each tx individually when BlockResults is unavailable for a height.
+	BlockResultsFallback bool
+
+	// TrackMsgProgress enables recording the last msg written by an action within a block, see MsgProgress.
+	// The progress is only meaningful when txs are processed sequentially, i.e. ConcurrentTxs is 1.
+	TrackMsgProgress bool
+
+	// EventsSummary enables storing a compact map of event type -> count along with each tx, see SummarizeEvents.
+	EventsSummary bool
+
+	// TxResultsCacheSize is the max number of blocks whose tx results are cached, zero disables the cache.
+	TxResultsCacheSize int
+
+	// StoreSuccessLog enables storing the raw logs of successful txs, which hold the full event logs and can be large.
+	// When disabled, successful txs are stored with an empty raw log while failed txs keep their error logs.
+	StoreSuccessLog bool
+
+	// DenomMetadata enables storing the bank module metadata of the denoms seen by actions, see EnrichDenom.
+	DenomMetadata bool
+
+	// WatchedAddresses restricts the txs written by actions to those involving any of the addresses,
+	// nil means every tx is written, see InvolvesWatchedAddress.
+	WatchedAddresses map[string]struct{}
+
+	// NormalizedTransfers enables writing incoming and outgoing ics-20 transfers to a single normalized table.
+	NormalizedTransfers bool
+
+	// FailedRawLog limits the size of the raw logs stored for failed txs, see FailedTxRawLog.
+	FailedRawLog RawLogPolicy
+
+	// Timeouts are applied to the context of each RPC query made by the indexer.
+	Timeouts Timeouts
+
+	// RetryDeadline bounds how long ForEachBlock keeps retrying failed blocks, zero means retry indefinitely.
+	RetryDeadline time.Duration
+
+	// MaxRetryPasses bounds how many passes ForEachBlock makes over the failed blocks after the first pass over all
+	// of the blocks, zero means there is no limit. Whichever of MaxRetryPasses and RetryDeadline is reached first applies.
+	MaxRetryPasses int
+
+	// GenesisHeights is the number of heights, starting at the chain's initial height, whose failures are logged
+	// rather than retried, zero disables the special case, see IsGenesisHeight.
+	GenesisHeights int64
+
+	// DBThrottle, if set, reduces the number of blocks processed concurrently and retries writes
+	// while the database is out of connections.
+	DBThrottle *DBThrottle
+
+	// RawBlockWindow is the number of most recent blocks whose raw JSON is stored, zero disables it, see RawBlock.
+	RawBlockWindow int64
+
+	// RawTxDumpDir, if set, is the directory the raw bytes of txs that fail to decode are written to, see RawTxDumpPath.
+	RawTxDumpDir string
+
+	// TxRateLimit, if set, limits how many txs per second are handed to the block actions, see ForEachTx.
+	TxRateLimit *TxRateLimit
+
+	// BlockTransactions enables writing everything an action does for a block, along with the action's checkpoint,
+	// in a single database transaction so the block either fully commits or is rolled back, see ExecuteAction.
+	BlockTransactions bool
+
+	// RetryFailedActions enables retrying the whole block when any of its actions fails, the same way as blocks
+	// that fail to be queried, rather than only recording it as failed. The block stays recorded as failed until
+	// every action succeeds for it, so ResumeHeight doesn't resume past it.
+	RetryFailedActions bool
+
+	// Metrics, if set, records the indexing progress, see NewMetrics.
+	Metrics *Metrics
+
 	log *zap.Logger
+
+	// The state is shared with the copies of the Indexer handed to actions within a block transaction.
+	*state
+
+	// inBlockTx is set on the copies of the Indexer whose DB is a block transaction.
+	inBlockTx bool
+
+	// batchWrites is set on the copies of the Indexer executing an action whose rows are batched, see ExecuteAction.
+	batchWrites *batchWrites
+
+	// msgTypes is the union of the msg type URLs handled by the actions being executed,
+	// nil when at least one action needs to see every tx.
+	msgTypes map[string]struct{}
 }
 
+// state is the mutable state of an Indexer.
+type state struct {
+	// lastHeight is the highest block height processed so far, accessed atomically.
+	// It's the first field to guarantee 64-bit alignment.
+	lastHeight int64
+
+	// initialHeight is the initial height of the chain once loaded, accessed atomically, see IsGenesisHeight.
+	initialHeight int64
+
+	failedMu sync.Mutex
+	failed   map[int64]FailedBlock
+
+	batchersMu sync.Mutex
+	batchers   map[string]*Batcher
+
+	// decoded caches the decoded txs of the blocks being processed, keyed by tx hash.
+	decoded sync.Map
+
+	txResults txResultsCache
+
+	// denoms holds the denoms whose metadata was already resolved, see EnrichDenom.
+	denoms sync.Map
+
+	// rowCounts holds the number of rows created by each action, see UseRowCounts.
+	rowCounts RowCounts
+}
+
+// RawLogPolicy determines how the raw log of a failed tx is stored once it's larger than MaxSize bytes,
+// either truncated to MaxSize or omitted entirely. A zero MaxSize stores every raw log in full.
+type RawLogPolicy struct {
+	MaxSize int
+	Omit    bool
+}
+
+// failedTxLog is the JSON document stored as the raw log of a failed tx.
+type failedTxLog struct {
+	Code      uint32 `json:"code"`
+	Error     string `json:"error,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// FailedTxRawLog returns the JSON document to store as the raw log of a failed tx, since the raw log of a failed
+// tx is a plain error message. Error messages larger than the FailedRawLog policy allows are truncated,
+// or omitted so only the code is kept, and marked as truncated.
+func (i *Indexer) FailedTxRawLog(code uint32, rawLog string) (string, error) {
+	doc := failedTxLog{Code: code, Error: rawLog}
+	if max := i.FailedRawLog.MaxSize; max > 0 && len(rawLog) > max {
+		doc.Truncated = true
+		if i.FailedRawLog.Omit {
+			doc.Error = ""
+		} else {
+			doc.Error = strings.ToValidUTF8(rawLog[:max], "")
+		}
+	}
+
+	bz, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(bz), nil
+}
+
+// Timeouts specifies the timeouts for the different RPC queries made while indexing, a zero value means no timeout.
+// Fetching the results of a large block can legitimately take much longer than a status query, so they're distinct.
+// Note that the chain client's own HTTP timeout still applies on top of these.
+type Timeouts struct {
+	Block        time.Duration
+	BlockResults time.Duration
+	Query        time.Duration
+}
+
+// FailedBlock describes a block height that is currently failing to be processed.
+// Blocks that are given up on, or whose actions fail, are also recorded in the failed_blocks table
+// so they can be retried later, see RetryFailedBlocks.
+type FailedBlock struct {
+	ChainID   string    `gorm:"primaryKey" json:"chain_id"`
+	Height    int64     `gorm:"primaryKey;autoIncrement:false" json:"height"`
+	LastError string    `gorm:"not null" json:"last_error"`
+	FailedAt  time.Time `gorm:"not null" json:"failed_at"`
+}
+
+// MsgTypeFilter can optionally be implemented by a BlockAction to declare the msg type URLs it handles.
+// When every action being executed implements it, txs containing none of the declared msg types are skipped
+// by DecodeTx before being fully decoded.
+type MsgTypeFilter interface {
+	MsgTypes() []string
+}
+
+// SequentialAction can optionally be implemented by a BlockAction whose state only makes sense when blocks are
+// applied in height order (e.g. running balances). When any action being executed reports Sequential, ForEachBlock
+// processes a single block at a time regardless of concurrentBlocks. Failed blocks are still retried after the
+// blocks following them, so such actions should write their state in a way that doesn't depend on the order.
+type SequentialAction interface {
+	Sequential() bool
+}
+
+// sequentialActions returns the names of the actions requiring blocks to be processed one at a time.
+func sequentialActions(actions []BlockAction) []string {
+	var names []string
+	for _, a := range actions {
+		if s, ok := a.(SequentialAction); ok && s.Sequential() {
+			names = append(names, a.Name())
+		}
+	}
+	return names
+}
+
+// ActionValidator can optionally be implemented by a BlockAction to check its configuration against the chain
+// being indexed (e.g. that the msg types it handles are registered in the chain's codec) before any block is processed.
+type ActionValidator interface {
+	Validate(indexer *Indexer) error
+}
+
+// ValidateActions validates each of the specified actions that implements ActionValidator against the Indexer's chain.
+func (i *Indexer) ValidateActions(actions []BlockAction) error {
+	for _, a := range actions {
+		v, ok := a.(ActionValidator)
+		if !ok {
+			continue
+		}
+		if err := v.Validate(i); err != nil {
+			return fmt.Errorf("invalid configuration for block action %s: %w", a.Name(), err)
+		}
+	}
+	return nil
+}
+
+// FailedBlocksError is returned by ForEachBlock when some block heights could not be processed
+// before the retry budget was exhausted, or before the context was cancelled in which case Err is the context error.
+type FailedBlocksError struct {
+	Heights []int64
+	Err     error
+}
+
+func (e *FailedBlocksError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("stopped with %d block(s) still failing: %v: %v", len(e.Heights), e.Err, e.Heights)
+	}
+	return fmt.Sprintf("failed to process %d block(s) before the retry budget was exhausted: %v", len(e.Heights), e.Heights)
+}
+
+func (e *FailedBlocksError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNoMigrations can be returned by BlockAction.MigrateSchema for actions that don't write any models,
+// the action is then logged and skipped by MigrateSchemas rather than failing the migration.
+var ErrNoMigrations = errors.New("block action has no schema migrations")
+
 // BlockAction represents a set of actions to be taken, on a per-block basis, as the Indexer processes blocks.
 type BlockAction interface {
 	Name() string
@@ -44,15 +295,71 @@ type BlockAction interface {
 
 func NewIndexer(log *zap.Logger, client *lens.ChainClient, db *gorm.DB) *Indexer {
 	return &Indexer{
-		Client: client,
-		DB:     db,
-		log:    log.With(zap.String("indexer", fmt.Sprintf("valis_%s_indexer", client.Config.ChainID))),
+		Client:               client,
+		DB:                   db,
+		ConcurrentTxs:        1,
+		BlockResultsFallback: true,
+		TxResultsCacheSize:   DefaultTxResultsCacheSize,
+		StoreSuccessLog:      true,
+		GenesisHeights:       DefaultGenesisHeights,
+		log:                  log.With(zap.String("indexer", fmt.Sprintf("valis_%s_indexer", client.Config.ChainID))),
+		state:                &state{failed: make(map[int64]FailedBlock)},
+	}
+}
+
+// NewMigrationIndexer returns an Indexer without a chain client, it's only meant for running schema migrations
+// (e.g. MigrateSchemas or BlockAction.MigrateSchema) and must not be used to process blocks.
+func NewMigrationIndexer(log *zap.Logger, db *gorm.DB) *Indexer {
+	return &Indexer{
+		DB:    db,
+		log:   log.With(zap.String("indexer", "valis_migration_indexer")),
+		state: &state{failed: make(map[int64]FailedBlock)},
 	}
 }
 
 // ForEachBlock specifies what actions should occur for every block being indexed.
 // ForEachBlock will process the blocks using concurrentBlocks number of goroutines.
+// Blocks that fail to be queried are retried until they succeed, the RetryDeadline is reached or MaxRetryPasses
+// passes were made over them, in which case a *FailedBlocksError containing the still failed heights is returned. The same error, wrapping the
+// context error, is returned when the context is cancelled while blocks are failing, including the blocks in flight
+// whose queries were cancelled.
 func (i *Indexer) ForEachBlock(ctx context.Context, blocks []int64, actions []BlockAction, concurrentBlocks uint) error {
+	i.msgTypes = msgTypesFilter(actions)
+	i.loadInitialHeight(ctx)
+
+	if names := sequentialActions(actions); len(names) > 0 && concurrentBlocks > 1 {
+		i.log.Info(
+			"Processing blocks one at a time for sequential block actions",
+			zap.String("chain_id", i.Client.Config.ChainID),
+			zap.Strings("actions", names),
+			zap.Uint("concurrent_blocks", concurrentBlocks),
+		)
+		concurrentBlocks = 1
+	}
+
+	// Summarize the rows written by the actions once the buffered rows below are flushed
+	defer func() {
+		i.log.Info(
+			"Rows written by block actions",
+			zap.Int("blocks", len(blocks)),
+			zap.String("rows", i.rowCounts.String()),
+		)
+	}()
+
+	// Write any rows still buffered once the blocks are processed
+	defer i.FlushBatches()
+
+	var deadline time.Time
+	if i.RetryDeadline > 0 {
+		deadline = time.Now().Add(i.RetryDeadline)
+	}
+	return i.forEachBlock(ctx, blocks, actions, concurrentBlocks, deadline, 0)
+}
+
+// forEachBlock processes a single pass over blocks, recursing over the failed blocks until there are none left,
+// the deadline has passed or MaxRetryPasses is reached. A zero deadline means there is no deadline, pass is the
+// number of passes over the failed blocks made before this one.
+func (i *Indexer) forEachBlock(ctx context.Context, blocks []int64, actions []BlockAction, concurrentBlocks uint, deadline time.Time, pass int) error {
 	var (
 		mutex        sync.Mutex
 		failedBlocks = make([]int64, 0)
@@ -67,57 +374,143 @@ func (i *Indexer) ForEachBlock(ctx context.Context, blocks []int64, actions []Bl
 
 	for _, h := range blocks {
 		h := h
-		sem <- struct{}{}
+
+		// Stop handing out work if the context has been cancelled, the blocks already in flight are waited on
+		// so no goroutine outlives this call while still holding a semaphore token, and the blocks that failed are
+		// saved so they can be retried later.
+		select {
+		case <-egCtx.Done():
+			_ = eg.Wait()
+			return i.cancelledWithFailedBlocks(ctx, failedBlocks)
+		case sem <- struct{}{}:
+		}
+
+		// While the database is out of connections fewer blocks are processed at once, the tokens held by the blocks
+		// in flight are counted by the semaphore itself.
+		for i.DBThrottle != nil && uint(len(sem)) > i.DBThrottle.Limit(concurrentBlocks) {
+			select {
+			case <-egCtx.Done():
+				<-sem
+				_ = eg.Wait()
+				return i.cancelledWithFailedBlocks(ctx, failedBlocks)
+			case <-time.After(throttleWait):
+			}
+		}
 
 		// Check if the context has been cancelled on each iteration
 		select {
-		case <-ctx.Done():
-			return ctx.Err()
+		case <-egCtx.Done():
+			<-sem
+			_ = eg.Wait()
+			return i.cancelledWithFailedBlocks(ctx, failedBlocks)
 		case <-time.After(time.Millisecond * 100):
 			// continue
 		}
 
 		eg.Go(func() error {
-			var block *coretypes.ResultBlock
+			// Release the token on every return path
+			defer func() { <-sem }()
+
+			// Every span of the block descends from a root span of its own, so each block is a separate trace
+			blockCtx, blockSpan := tracer.Start(egCtx, "block", trace.WithNewRoot(), trace.WithAttributes(
+				attribute.String("chain_id", i.Client.Config.ChainID),
+				attribute.Int64("height", h),
+			))
+			defer blockSpan.End()
 
 			// Query a block
-			if err := retry.Do(func() error {
-				var err error
-				block, err = i.Client.RPCClient.Block(egCtx, &h)
-				return err
-			}, retry.Context(egCtx), RtyAtt, RtyDel, RtyErr, retry.DelayType(retry.BackOffDelay), retry.OnRetry(func(n uint, err error) {
+			block, err := i.fetchBlock(blockCtx, h)
+			if err != nil && i.IsGenesisHeight(h) && egCtx.Err() == nil {
 				i.log.Info(
-					"Failed to get block",
+					"Skipping block at genesis height that is unavailable on the node",
+					zap.String("chain_id", i.Client.Config.ChainID),
 					zap.Int64("height", h),
-					zap.Uint("attempt", n),
 					zap.Error(err),
 				)
-			})); err != nil {
-				// If we fail to get a block add it to the slice of failed blocks
+				return nil
+			}
+			if err != nil {
+				blockSpan.SetStatus(codes.Error, "failed to get block")
+				// If we fail to get a block add it to the slice of failed blocks, so it's retried on the next pass
 				func() {
 					mutex.Lock()
 					defer mutex.Unlock()
 					failedBlocks = append(failedBlocks, h)
 				}()
+				i.markFailed(h, err)
+				i.Metrics.blockFailed(i.Client.Config.ChainID)
+				return nil
+			}
 
-				<-sem
-				return err
+			wasFailing := i.clearFailed(h)
+			defer i.updateLastHeight(h)
+			defer i.forgetDecodedTxs(block)
+			defer i.dumpUndecodedTxs(block)
+
+			// Decoding is otherwise spread over the actions' tx workers, when tracing the txs are decoded up front
+			// so the time spent decoding shows up as a span of its own. The actions then hit the decode cache.
+			if blockSpan.IsRecording() {
+				_, decodeSpan := tracer.Start(blockCtx, "decode_txs", trace.WithAttributes(
+					attribute.Int("txs", len(block.Block.Data.Txs)),
+				))
+				for _, tx := range block.Block.Data.Txs {
+					_, _ = i.DecodeTx(tx)
+				}
+				decodeSpan.End()
 			}
 
 			// Execute BlockAction's for every block
+			var failed bool
 			for _, a := range actions {
-				if err := a.Execute(egCtx, i, block); err != nil {
-					// TODO how to handle actions failing to execute properly
+				if err := i.ExecuteAction(blockCtx, a, block); err != nil {
+					if i.IsGenesisHeight(h) && egCtx.Err() == nil {
+						i.log.Info(
+							"Block action failed at genesis height, not retrying",
+							zap.String("block_action_name", a.Name()),
+							zap.Int64("block_height", block.Block.Height),
+							zap.Error(err),
+						)
+						continue
+					}
 					i.log.Warn(
 						"Failed to execute block action properly",
 						zap.String("block_action_name", a.Name()),
 						zap.Int64("block_height", block.Block.Height),
 						zap.Error(err),
 					)
+
+					// Record the failure so the block can be retried later
+					i.markFailed(h, fmt.Errorf("block action %s: %w", a.Name(), err))
+					i.saveFailedBlock(h)
+					failed = true
 				}
 			}
+			if failed {
+				blockSpan.SetStatus(codes.Error, "failed to execute block actions")
+				i.Metrics.blockFailed(i.Client.Config.ChainID)
+			} else {
+				i.Metrics.blockProcessed(i.Client.Config.ChainID)
+			}
 
-			<-sem
+			// The block is retried on the next pass along with the blocks that failed to be queried, once every action
+			// succeeds the failure recorded by a previous attempt is removed.
+			if i.RetryFailedActions {
+				switch {
+				case failed:
+					func() {
+						mutex.Lock()
+						defer mutex.Unlock()
+						failedBlocks = append(failedBlocks, h)
+					}()
+				case wasFailing:
+					i.deleteFailedBlock(h)
+				}
+			}
+
+			// The tx results are only kept for blocks that may be retried
+			if !failed {
+				i.txResults.remove(h)
+			}
 			return nil
 		})
 	}
@@ -125,25 +518,662 @@ func (i *Indexer) ForEachBlock(ctx context.Context, blocks []int64, actions []Bl
 		return err
 	}
 
-	// Recursively call the function until there are no failed blocks
+	// Recursively call the function until there are no failed blocks or the retry budget is exhausted
 	if len(failedBlocks) > 0 {
-		return i.ForEachBlock(ctx, failedBlocks, actions, concurrentBlocks)
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			i.log.Warn(
+				"Retry deadline reached with blocks still failing",
+				zap.String("chain_id", i.Client.Config.ChainID),
+				zap.Int64s("failed_blocks", failedBlocks),
+			)
+			for _, h := range failedBlocks {
+				i.saveFailedBlock(h)
+			}
+			return &FailedBlocksError{Heights: failedBlocks}
+		}
+
+		if i.MaxRetryPasses > 0 && pass >= i.MaxRetryPasses {
+			i.log.Warn(
+				"Max retry passes reached with blocks still failing",
+				zap.String("chain_id", i.Client.Config.ChainID),
+				zap.Int("retry_passes", pass),
+				zap.Int64s("failed_blocks", failedBlocks),
+			)
+			for _, h := range failedBlocks {
+				i.saveFailedBlock(h)
+			}
+			return &FailedBlocksError{Heights: failedBlocks}
+		}
+
+		// Don't start another pass when shutting down
+		if ctx.Err() != nil {
+			return i.cancelledWithFailedBlocks(ctx, failedBlocks)
+		}
+		return i.forEachBlock(ctx, failedBlocks, actions, concurrentBlocks, deadline, pass+1)
 	}
 	return nil
 }
 
+// cancelledWithFailedBlocks saves the blocks that failed in a pass stopped by the cancellation of ctx, so they can be
+// retried later, and returns the context error wrapped in a *FailedBlocksError if any did.
+func (i *Indexer) cancelledWithFailedBlocks(ctx context.Context, failedBlocks []int64) error {
+	if len(failedBlocks) == 0 {
+		return ctx.Err()
+	}
+
+	i.log.Info(
+		"Context cancelled with blocks still failing",
+		zap.String("chain_id", i.Client.Config.ChainID),
+		zap.Int64s("failed_blocks", failedBlocks),
+	)
+	for _, h := range failedBlocks {
+		i.saveFailedBlock(h)
+	}
+	return &FailedBlocksError{Heights: failedBlocks, Err: ctx.Err()}
+}
+
+// fetchBlock returns the block at height h, either from the raw blocks window or by querying it.
+// Queried blocks are stored in the raw blocks window, if it's enabled.
+func (i *Indexer) fetchBlock(ctx context.Context, h int64) (*coretypes.ResultBlock, error) {
+	if block := i.fetchStoredBlock(h); block != nil {
+		return block, nil
+	}
+
+	// Blocks at genesis heights are only attempted once, since some nodes can't serve them at all
+	attempts := RtyAtt
+	if i.IsGenesisHeight(h) {
+		attempts = retry.Attempts(1)
+	}
+
+	var block *coretypes.ResultBlock
+	fetchCtx, fetchSpan := tracer.Start(ctx, "fetch_block")
+	err := retry.Do(func() error {
+		var err error
+		queryCtx, cancel := withTimeout(fetchCtx, i.Timeouts.Block)
+		defer cancel()
+		block, err = i.Client.RPCClient.Block(queryCtx, &h)
+		return err
+	}, retry.Context(fetchCtx), attempts, RtyDel, RtyErr, retry.DelayType(retry.BackOffDelay), retry.OnRetry(func(n uint, err error) {
+		i.log.Info(
+			"Failed to get block",
+			zap.Int64("height", h),
+			zap.Uint("attempt", n),
+			zap.Error(err),
+		)
+	}))
+	endSpan(fetchSpan, err)
+	if err != nil {
+		return nil, err
+	}
+
+	i.storeRawBlock(block)
+	return block, nil
+}
+
+// ForEachTx calls fn for every tx in the specified block, using up to ConcurrentTxs goroutines.
+// The first error returned by fn cancels the context passed to the remaining calls and is returned.
+// Since gorm.DB is safe for concurrent use, fn may write to the DB directly from each worker.
+// Each tx waits for the TxRateLimit, if one is set, before fn is called for it.
+func (i *Indexer) ForEachTx(ctx context.Context, block *coretypes.ResultBlock, fn func(ctx context.Context, index int, tx tmtypes.Tx) error) error {
+	concurrentTxs := i.ConcurrentTxs
+	if concurrentTxs < 1 {
+		concurrentTxs = 1
+	}
+
+	var (
+		sem       = make(chan struct{}, concurrentTxs)
+		eg, egCtx = errgroup.WithContext(ctx)
+	)
+
+	for index, tx := range block.Block.Data.Txs {
+		index, tx := index, tx
+
+		// Stop handing out work if a worker failed or the context has been cancelled
+		select {
+		case <-egCtx.Done():
+			if err := eg.Wait(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		if err := i.TxRateLimit.Wait(egCtx); err != nil {
+			<-sem
+			if werr := eg.Wait(); werr != nil {
+				return werr
+			}
+			return err
+		}
+
+		eg.Go(func() error {
+			defer func() { <-sem }()
+			return fn(egCtx, index, tx)
+		})
+	}
+
+	return eg.Wait()
+}
+
+// DecodedTxFunc is called by ForEachDecodedTx with a decoded tx of the block and its results.
+type DecodedTxFunc func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx) error
+
+// SuccessfulTxFunc is called by ForEachSuccessfulTx with a successful tx of the block, its results and its msg logs.
+type SuccessfulTxFunc func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx, logs sdk.ABCIMessageLogs) error
+
+// ForEachDecodedTx calls fn, through ForEachTx, for every tx of the block that has msgs handled by the actions being
+// executed and involves the watched addresses, if any are configured. Txs that fail to be decoded or whose results
+// failed to be queried are logged to log, the logger of the calling action, and skipped.
+func (i *Indexer) ForEachDecodedTx(ctx context.Context, log *zap.Logger, block *coretypes.ResultBlock, fn DecodedTxFunc) error {
+	txResults, err := i.TxResults(ctx, block)
+	if err != nil {
+		return err
+	}
+
+	return i.ForEachTx(ctx, block, func(ctx context.Context, index int, tx tmtypes.Tx) error {
+		// Check if the context has been cancelled on each iteration
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// continue
+		}
+
+		sdkTx, err := i.DecodeTx(tx)
+		if err != nil {
+			log.Debug(
+				"Failed to decode tx",
+				zap.Int64("height", block.Block.Height),
+				zap.Int("tx_index", index+1),
+				zap.Int("total_txs", len(block.Block.Data.Txs)),
+				zap.Error(err),
+			)
+			return nil
+		}
+
+		// Txs without any msgs handled by the configured actions are skipped before being decoded
+		if sdkTx == nil {
+			return nil
+		}
+
+		// Results are missing for txs that failed to be queried, see (*Indexer).TxResults
+		txRes := txResults[index]
+		if txRes == nil {
+			log.Debug(
+				"Missing tx results",
+				zap.Int64("height", block.Block.Height),
+				zap.Int("tx_index", index+1),
+				zap.Int("total_txs", len(block.Block.Data.Txs)),
+			)
+			return nil
+		}
+
+		// Only txs involving the watched addresses are indexed, if any are configured
+		if !i.InvolvesWatchedAddress(txRes.TxResult.Events) {
+			return nil
+		}
+
+		return fn(ctx, index, tx, sdkTx, txRes)
+	})
+}
+
+// ForEachSuccessfulTx is ForEachDecodedTx for the actions that only index successful txs, since failed txs don't
+// change any state. fn also receives the msg logs of the tx, they're nil if they failed to be parsed.
+func (i *Indexer) ForEachSuccessfulTx(ctx context.Context, log *zap.Logger, block *coretypes.ResultBlock, fn SuccessfulTxFunc) error {
+	return i.ForEachDecodedTx(ctx, log, block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx) error {
+		if txRes.TxResult.Code != 0 {
+			return nil
+		}
+
+		// The msg logs hold what isn't part of the msgs themselves, e.g. the ids assigned by the chain
+		logs, err := sdk.ParseABCILogs(txRes.TxResult.Log)
+		if err != nil {
+			log.Debug(
+				"Failed to parse tx logs",
+				zap.Int64("height", block.Block.Height),
+				zap.Int("tx_index", index+1),
+				zap.Int("total_txs", len(block.Block.Data.Txs)),
+				zap.Error(err),
+			)
+		}
+
+		return fn(ctx, index, tx, sdkTx, txRes, logs)
+	})
+}
+
+// LastHeight returns the highest block height processed so far, or 0 if no block was processed yet.
+// Since blocks are processed concurrently, lower heights may still be in flight.
+func (i *Indexer) LastHeight() int64 {
+	return atomic.LoadInt64(&i.lastHeight)
+}
+
+// updateLastHeight records that the block at height was processed, if it's the highest height so far.
+func (i *Indexer) updateLastHeight(height int64) {
+	for {
+		last := atomic.LoadInt64(&i.lastHeight)
+		if height <= last {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&i.lastHeight, last, height) {
+			i.Metrics.setIndexedHeight(i.Client.Config.ChainID, height)
+			return
+		}
+	}
+}
+
+// FailedBlocks returns the block heights that are currently failing to be processed, sorted by height.
+func (i *Indexer) FailedBlocks() []FailedBlock {
+	i.failedMu.Lock()
+	defer i.failedMu.Unlock()
+
+	failed := make([]FailedBlock, 0, len(i.failed))
+	for _, fb := range i.failed {
+		failed = append(failed, fb)
+	}
+	sort.Slice(failed, func(a, b int) bool {
+		return failed[a].Height < failed[b].Height
+	})
+	return failed
+}
+
+// markFailed records that the block at height failed to be processed with the specified error.
+func (i *Indexer) markFailed(height int64, err error) {
+	i.failedMu.Lock()
+	defer i.failedMu.Unlock()
+
+	i.failed[height] = FailedBlock{
+		ChainID:   i.Client.Config.ChainID,
+		Height:    height,
+		LastError: err.Error(),
+		FailedAt:  time.Now(),
+	}
+}
+
+// clearFailed removes the block at height from the set of failed blocks, reporting whether it was failing.
+func (i *Indexer) clearFailed(height int64) bool {
+	i.failedMu.Lock()
+	defer i.failedMu.Unlock()
+
+	_, ok := i.failed[height]
+	delete(i.failed, height)
+	return ok
+}
+
+// SummarizeEvents returns a map of event type -> number of occurrences for the specified tx events,
+// allowing cheap event presence queries without storing every event.
+func (i *Indexer) SummarizeEvents(events []abcitypes.Event) map[string]int {
+	summary := make(map[string]int, len(events))
+	for _, e := range events {
+		summary[e.Type]++
+	}
+	return summary
+}
+
+// msgTypesFilter returns the union of the msg type URLs declared by the specified actions,
+// or nil if any of the actions doesn't implement MsgTypeFilter.
+func msgTypesFilter(actions []BlockAction) map[string]struct{} {
+	msgTypes := make(map[string]struct{})
+	for _, a := range actions {
+		filter, ok := a.(MsgTypeFilter)
+		if !ok {
+			return nil
+		}
+		for _, typeURL := range filter.MsgTypes() {
+			msgTypes[typeURL] = struct{}{}
+		}
+	}
+	return msgTypes
+}
+
+// DecodeTx decodes the specified raw tx bytes. If the actions being executed declare the msg types they handle,
+// the msg type URLs are first read from the raw tx body and a nil sdk.Tx is returned, without an error and without
+// fully decoding the tx, when none of them match. This avoids the comparatively expensive TxDecoder for irrelevant txs.
+//
+// Decoded txs are cached while their block is being processed, so each tx is only decoded once no matter
+// how many actions are executed for the block.
+func (i *Indexer) DecodeTx(tx tmtypes.Tx) (sdk.Tx, error) {
+	key := string(tx.Hash())
+	if cached, ok := i.decoded.Load(key); ok {
+		d := cached.(decodedTx)
+		return d.tx, d.err
+	}
+
+	sdkTx, err := i.decodeTx(tx)
+	if sdkTx != nil || err != nil {
+		i.Metrics.txDecoded(i.Client.Config.ChainID, err)
+	}
+	i.decoded.Store(key, decodedTx{tx: sdkTx, err: err})
+	return sdkTx, err
+}
+
+// decodedTx is the cached result of DecodeTx.
+type decodedTx struct {
+	tx  sdk.Tx
+	err error
+}
+
+// forgetDecodedTxs removes the txs of the block from the decode cache once the block was processed.
+func (i *Indexer) forgetDecodedTxs(block *coretypes.ResultBlock) {
+	for _, tx := range block.Block.Data.Txs {
+		i.decoded.Delete(string(tx.Hash()))
+	}
+}
+
+// decodeTx decodes the specified raw tx bytes, see DecodeTx.
+func (i *Indexer) decodeTx(tx tmtypes.Tx) (sdk.Tx, error) {
+	if i.msgTypes != nil {
+		var raw txtypes.TxRaw
+		if err := raw.Unmarshal(tx); err != nil {
+			return nil, err
+		}
+
+		// Unmarshalling the body doesn't resolve the msg Anys, only the type URLs and raw values are read
+		var body txtypes.TxBody
+		if err := body.Unmarshal(raw.BodyBytes); err != nil {
+			return nil, err
+		}
+
+		// Txs without any msgs are always decoded, so they can still be recorded
+		matched := len(body.Messages) == 0
+		for _, msg := range body.Messages {
+			if _, ok := i.msgTypes[msg.TypeUrl]; ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, nil
+		}
+	}
+
+	return i.Client.Codec.TxConfig.TxDecoder()(tx)
+}
+
+// QueryLatestHeight returns the latest block height of the chain, bounded by the Query timeout.
+func (i *Indexer) QueryLatestHeight(ctx context.Context) (int64, error) {
+	queryCtx, cancel := withTimeout(ctx, i.Timeouts.Query)
+	defer cancel()
+	return i.Client.QueryLatestHeight(queryCtx)
+}
+
+// QueryValidators returns the validator set of the chain at height, in the order used by the commits
+// of that height. Each page of the validator set is queried under the Query timeout.
+func (i *Indexer) QueryValidators(ctx context.Context, height int64) ([]*tmtypes.Validator, error) {
+	var (
+		validators []*tmtypes.Validator
+		page       = 1
+		perPage    = 100
+	)
+	for {
+		queryCtx, cancel := withTimeout(ctx, i.Timeouts.Query)
+		res, err := i.Client.RPCClient.Validators(queryCtx, &height, &page, &perPage)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		validators = append(validators, res.Validators...)
+		if len(res.Validators) == 0 || len(validators) >= res.Total {
+			return validators, nil
+		}
+		page++
+	}
+}
+
+// withTimeout returns a copy of ctx bounded by timeout, or a cancellable copy of ctx if timeout is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// TxResults returns the results for every tx in the specified block, ordered the same as block.Block.Data.Txs.
+// The results are fetched with a single BlockResults query, if that fails (e.g. very old heights on some nodes)
+// and BlockResultsFallback is enabled, each tx is queried individually instead.
+// In the fallback case the entries for txs that could not be queried are nil.
+//
+// Results are cached by height, shared by every action executed for the block and kept for the block's retries
+// when one of its actions fails. The cache holds at most TxResultsCacheSize blocks, the oldest are evicted first.
+func (i *Indexer) TxResults(ctx context.Context, block *coretypes.ResultBlock) ([]*coretypes.ResultTx, error) {
+	if results, ok := i.txResults.get(block.Block.Height); ok {
+		return results, nil
+	}
+
+	results, blockResults, err := i.queryTxResults(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	if blockResults != nil {
+		i.txResults.putEndBlockEvents(block.Block.Height, blockResults.EndBlockEvents, i.TxResultsCacheSize)
+	}
+
+	// Results with txs that failed to be queried aren't cached, so the next attempt can query them again
+	complete := true
+	for _, res := range results {
+		if res == nil {
+			complete = false
+			break
+		}
+	}
+	if complete {
+		i.txResults.put(block.Block.Height, results, i.TxResultsCacheSize)
+	}
+	return results, nil
+}
+
+// blockTxResults returns the tx results of block from its block results,
+// which must contain as many tx results as the block contains txs.
+func blockTxResults(block *coretypes.ResultBlock, res *coretypes.ResultBlockResults) []*coretypes.ResultTx {
+	txs := block.Block.Data.Txs
+	results := make([]*coretypes.ResultTx, len(txs))
+	for index, txResult := range res.TxsResults {
+		results[index] = &coretypes.ResultTx{
+			Hash:     txs[index].Hash(),
+			Height:   block.Block.Height,
+			Index:    uint32(index),
+			TxResult: *txResult,
+			Tx:       txs[index],
+		}
+	}
+	return results
+}
+
+// EndBlockEvents returns the events emitted by the end blockers of the modules for the specified block, e.g. the
+// results of the gov proposals whose periods ended. They're cached along with the tx results when those are fetched
+// from the block results, otherwise the block results are queried. There is no fallback, the events are only part
+// of the block results.
+func (i *Indexer) EndBlockEvents(ctx context.Context, block *coretypes.ResultBlock) ([]abcitypes.Event, error) {
+	height := block.Block.Height
+	if events, ok := i.txResults.getEndBlockEvents(height); ok {
+		return events, nil
+	}
+
+	resultsCtx, cancel := withTimeout(ctx, i.Timeouts.BlockResults)
+	res, err := i.Client.RPCClient.BlockResults(resultsCtx, &height)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query block results for height %d: %w", height, err)
+	}
+	i.txResults.putEndBlockEvents(height, res.EndBlockEvents, i.TxResultsCacheSize)
+	return res.EndBlockEvents, nil
+}
+
+// queryTxResults queries the results for every tx in the specified block, see TxResults.
+// The block results are returned along with them unless the txs were queried individually.
+func (i *Indexer) queryTxResults(ctx context.Context, block *coretypes.ResultBlock) ([]*coretypes.ResultTx, *coretypes.ResultBlockResults, error) {
+	height := block.Block.Height
+	txs := block.Block.Data.Txs
+
+	resultsCtx, cancel := withTimeout(ctx, i.Timeouts.BlockResults)
+	res, err := i.Client.RPCClient.BlockResults(resultsCtx, &height)
+	cancel()
+	if err == nil && len(res.TxsResults) != len(txs) {
+		err = fmt.Errorf("block results contain %d tx results but the block contains %d txs", len(res.TxsResults), len(txs))
+	}
+	if err == nil {
+		return blockTxResults(block, res), res, nil
+	}
+
+	if !i.BlockResultsFallback {
+		return nil, nil, fmt.Errorf("failed to query block results for height %d: %w", height, err)
+	}
+
+	i.log.Warn(
+		"Failed to query block results, falling back to querying txs individually",
+		zap.String("chain_id", i.Client.Config.ChainID),
+		zap.Int64("height", height),
+		zap.Error(err),
+	)
+
+	results := make([]*coretypes.ResultTx, len(txs))
+	for index, tx := range txs {
+		queryCtx, cancel := withTimeout(ctx, i.Timeouts.Query)
+		txRes, err := i.Client.QueryTx(queryCtx, hex.EncodeToString(tx.Hash()), false)
+		cancel()
+		if err != nil {
+			i.log.Debug(
+				"Failed to query tx results",
+				zap.Int64("height", height),
+				zap.Int("tx_index", index+1),
+				zap.Int("total_txs", len(txs)),
+				zap.Error(err),
+			)
+			continue
+		}
+		results[index] = txRes
+	}
+	return results, nil, nil
+}
+
+// DatabaseOptions configures how statements are sent to the database. PreferSimpleProtocol disables the implicit
+// prepared statements of pgx, PrepareStmt caches prepared statements in gorm for repeated queries.
+// Prepared statements are tied to a connection, so PrepareStmt should be left off behind poolers such as pgbouncer.
+// The connection pool settings are applied to the underlying sql.DB, zero values keep the database/sql defaults.
+type DatabaseOptions struct {
+	PreferSimpleProtocol bool
+	PrepareStmt          bool
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultMaxOpenConns caps the connections opened for the concurrent blocks by default,
+// staying well below the default max_connections of postgres (100).
+const DefaultMaxOpenConns = 50
+
+// DefaultDatabaseOptions returns the DatabaseOptions used when none are configured.
+func DefaultDatabaseOptions() DatabaseOptions {
+	return DatabaseOptions{PreferSimpleProtocol: true}
+}
+
+// WithConcurrencyDefaults returns a copy of the options where the connection pool settings that aren't set are
+// derived from the number of blocks processed concurrently. A connection is opened per concurrent block, up to
+// DefaultMaxOpenConns, and kept idle between blocks rather than being reconnected for every block.
+func (o DatabaseOptions) WithConcurrencyDefaults(concurrentBlocks uint) DatabaseOptions {
+	if o.MaxOpenConns == 0 {
+		o.MaxOpenConns = DefaultMaxOpenConns
+		if concurrentBlocks < DefaultMaxOpenConns {
+			o.MaxOpenConns = int(concurrentBlocks)
+		}
+	}
+	if o.MaxIdleConns == 0 {
+		o.MaxIdleConns = o.MaxOpenConns
+	}
+	return o
+}
+
 // ConnectToDatabase attempts to connect to the database using the specified driver and connection string.
-// If a connection cannot be established an error is returned. gormSilent will disable gorm logging if true.
-func ConnectToDatabase(connString string, gormLogLevel logger.LogLevel) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.New(postgres.Config{
+// If a connection cannot be established an error is returned. gormLogLevel sets the verbosity of gorm logging.
+func ConnectToDatabase(connString string, gormLogLevel logger.LogLevel, opts DatabaseOptions) (*gorm.DB, error) {
+	pgConfig, gormConfig := databaseConfigs(connString, gormLogLevel, opts)
+	db, err := gorm.Open(postgres.New(pgConfig), gormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initalize db session, ensure db server is running & check conn string: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	opts.applyPool(sqlDB)
+
+	return db, nil
+}
+
+// applyPool applies the connection pool settings of the options that are set to sqlDB.
+func (o DatabaseOptions) applyPool(sqlDB *sql.DB) {
+	if o.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+}
+
+// databaseConfigs returns the postgres driver and gorm configs ConnectToDatabase opens the database with.
+func databaseConfigs(connString string, gormLogLevel logger.LogLevel, opts DatabaseOptions) (postgres.Config, *gorm.Config) {
+	return postgres.Config{
 		DSN:                  connString,
-		PreferSimpleProtocol: true,
+		PreferSimpleProtocol: opts.PreferSimpleProtocol,
+	}, &gorm.Config{
+		Logger:      logger.Default.LogMode(gormLogLevel),
+		PrepareStmt: opts.PrepareStmt,
+	}
+}
+
+// NewDryRunDatabase returns a database session that never connects to a database instance.
+// Statements are built as usual but never executed, so actions can be run without persisting anything.
+func NewDryRunDatabase() (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: &dryRunConnPool{},
 	}), &gorm.Config{
-		Logger: logger.Default.LogMode(gormLogLevel),
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to initalize db session, ensure db server is running & check conn string: %w", err)
+		return nil, fmt.Errorf("failed to initalize dry run db session: %w", err)
 	}
 
 	return db, nil
 }
+
+// errDryRun is returned if a dry run session ever attempts to talk to the database.
+var errDryRun = errors.New("dry run database session can't execute statements")
+
+// dryRunConnPool is a gorm.ConnPool that is never connected, transactions are no-ops so that
+// actions writing inside of DB.Transaction can still be dry run.
+type dryRunConnPool struct{}
+
+func (*dryRunConnPool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, errDryRun
+}
+
+func (*dryRunConnPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errDryRun
+}
+
+func (*dryRunConnPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errDryRun
+}
+
+func (*dryRunConnPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return &sql.Row{}
+}
+
+func (p *dryRunConnPool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return p, nil
+}
+
+func (*dryRunConnPool) Commit() error {
+	return nil
+}
+
+func (*dryRunConnPool) Rollback() error {
+	return nil
+}
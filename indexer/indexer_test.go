@@ -0,0 +1,1024 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/cosmos/cosmos-sdk/client"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	transfertypes "github.com/cosmos/ibc-go/v2/modules/apps/transfer/types"
+	clienttypes "github.com/cosmos/ibc-go/v2/modules/core/02-client/types"
+	lens "github.com/strangelove-ventures/lens/client"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"github.com/strangelove-ventures/valis/internal/indexdebug"
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	// Don't wait between attempts when a test node fails a query
+	RtyDel = retry.Delay(time.Millisecond)
+	os.Exit(m.Run())
+}
+
+// fakeNode is an RPC client serving blocks with txCount txs, failing the first failures[h] queries for height h.
+// A negative failure count fails every query for that height. The result of the tx at index j has code j.
+type fakeNode struct {
+	rpcclient.Client
+
+	mu       sync.Mutex
+	txCount  int
+	failures map[int64]int
+	queries  map[int64]int
+	blocks   map[int64]*coretypes.ResultBlock
+
+	// noBlockResults fails every BlockResults query and missingTxs fails the Tx queries for those txs.
+	noBlockResults      bool
+	missingTxs          map[string]bool
+	txQueries           int
+	blockResultsQueries int
+
+	// earliestHeight is the earliest height reported by Status.
+	earliestHeight int64
+}
+
+func newFakeNode(txCount int, failures map[int64]int) *fakeNode {
+	return &fakeNode{
+		txCount:    txCount,
+		failures:   failures,
+		queries:    make(map[int64]int),
+		blocks:     make(map[int64]*coretypes.ResultBlock),
+		missingTxs: make(map[string]bool),
+	}
+}
+
+// block returns the block at height, the same block is returned for every call.
+func (n *fakeNode) block(height int64) *coretypes.ResultBlock {
+	if _, ok := n.blocks[height]; !ok {
+		n.blocks[height] = testBlock(height, n.txCount)
+	}
+	return n.blocks[height]
+}
+
+func (n *fakeNode) Block(ctx context.Context, height *int64) (*coretypes.ResultBlock, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.queries[*height]++
+	if f := n.failures[*height]; f < 0 || n.queries[*height] <= f {
+		return nil, fmt.Errorf("height %d is not available", *height)
+	}
+	return n.block(*height), nil
+}
+
+func (n *fakeNode) Status(ctx context.Context) (*coretypes.ResultStatus, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &coretypes.ResultStatus{SyncInfo: coretypes.SyncInfo{EarliestBlockHeight: n.earliestHeight}}, nil
+}
+
+func (n *fakeNode) BlockResults(ctx context.Context, height *int64) (*coretypes.ResultBlockResults, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.blockResultsQueries++
+	if n.noBlockResults {
+		return nil, fmt.Errorf("block results for height %d are not available", *height)
+	}
+	res := &coretypes.ResultBlockResults{Height: *height}
+	for j := range n.block(*height).Block.Data.Txs {
+		res.TxsResults = append(res.TxsResults, &abcitypes.ResponseDeliverTx{Code: uint32(j)})
+	}
+	return res, nil
+}
+
+func (n *fakeNode) Tx(ctx context.Context, hash []byte, prove bool) (*coretypes.ResultTx, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.txQueries++
+	if n.missingTxs[string(hash)] {
+		return nil, fmt.Errorf("tx %X not found", hash)
+	}
+	for height, block := range n.blocks {
+		for j, tx := range block.Block.Data.Txs {
+			if string(tx.Hash()) == string(hash) {
+				return &coretypes.ResultTx{Hash: hash, Height: height, Index: uint32(j), TxResult: abcitypes.ResponseDeliverTx{Code: uint32(j)}, Tx: tx}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("tx %X not found", hash)
+}
+
+// recordingAction records the heights of the blocks it's executed for.
+type recordingAction struct {
+	mu      sync.Mutex
+	heights []int64
+}
+
+func (a *recordingAction) Name() string { return "recording" }
+
+func (a *recordingAction) MigrateSchema(i *Indexer) error { return nil }
+
+func (a *recordingAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.heights = append(a.heights, block.Block.Height)
+	return nil
+}
+
+func (a *recordingAction) executed() []int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	heights := append([]int64(nil), a.heights...)
+	sort.Slice(heights, func(x, y int) bool { return heights[x] < heights[y] })
+	return heights
+}
+
+// newTestIndexer returns an Indexer for cosmoshub-4 querying node and writing to a dbtest DB.
+// The tests fail the first heights on purpose, so they aren't treated as genesis heights.
+func newTestIndexer(t testing.TB, node rpcclient.Client) *Indexer {
+	client := &lens.ChainClient{
+		Config:    &lens.ChainClientConfig{ChainID: "cosmoshub-4"},
+		RPCClient: node,
+	}
+	db, _ := dbtest.New(t)
+	i := NewIndexer(zap.NewNop(), client, db)
+	i.GenesisHeights = 0
+	return i
+}
+
+// testBlock returns a block at height containing txCount txs.
+func testBlock(height int64, txCount int) *coretypes.ResultBlock {
+	txs := make(tmtypes.Txs, txCount)
+	for j := range txs {
+		txs[j] = tmtypes.Tx(fmt.Sprintf("%d/%d", height, j))
+	}
+	return &coretypes.ResultBlock{Block: &tmtypes.Block{
+		Header: tmtypes.Header{ChainID: "cosmoshub-4", Height: height},
+		Data:   tmtypes.Data{Txs: txs},
+	}}
+}
+
+func TestForEachTx(t *testing.T) {
+	for _, concurrentTxs := range []uint{0, 1, 4, 500} {
+		i := &Indexer{ConcurrentTxs: concurrentTxs}
+		block := testBlock(1, 200)
+
+		var (
+			mu              sync.Mutex
+			seen            = make(map[int]int)
+			inFlight, peak  int32
+			wantConcurrency = int32(concurrentTxs)
+		)
+		if wantConcurrency < 1 {
+			wantConcurrency = 1
+		}
+		err := i.ForEachTx(context.Background(), block, func(ctx context.Context, index int, tx tmtypes.Tx) error {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(100 * time.Microsecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if string(tx) != string(block.Block.Data.Txs[index]) {
+				t.Errorf("tx %d passed with the bytes of another tx", index)
+			}
+			seen[index]++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("concurrency %d: ForEachTx returned unexpected error: %v", concurrentTxs, err)
+		}
+		for index := range block.Block.Data.Txs {
+			if seen[index] != 1 {
+				t.Errorf("concurrency %d: tx %d processed %d times, want once", concurrentTxs, index, seen[index])
+			}
+		}
+		if peak > wantConcurrency {
+			t.Errorf("concurrency %d: %d txs processed at once", concurrentTxs, peak)
+		}
+	}
+}
+
+func TestForEachTxError(t *testing.T) {
+	i := &Indexer{ConcurrentTxs: 4}
+	errTx := errors.New("tx failed")
+
+	var calls int32
+	err := i.ForEachTx(context.Background(), testBlock(1, 1000), func(ctx context.Context, index int, tx tmtypes.Tx) error {
+		atomic.AddInt32(&calls, 1)
+		if index == 10 {
+			return errTx
+		}
+		return nil
+	})
+	if !errors.Is(err, errTx) {
+		t.Errorf("ForEachTx returned %v, want %v", err, errTx)
+	}
+	if calls == 1000 {
+		t.Errorf("every tx was processed after one failed")
+	}
+}
+
+func TestForEachBlockRetryDeadline(t *testing.T) {
+	node := newFakeNode(0, map[int64]int{2: -1})
+	i := newTestIndexer(t, node)
+	i.RetryDeadline = 50 * time.Millisecond
+
+	action := &recordingAction{}
+	err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []BlockAction{action}, 2)
+
+	var failed *FailedBlocksError
+	if !errors.As(err, &failed) {
+		t.Fatalf("ForEachBlock returned %v, want a *FailedBlocksError", err)
+	}
+	if !reflect.DeepEqual(failed.Heights, []int64{2}) {
+		t.Errorf("failed heights = %v, want [2]", failed.Heights)
+	}
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{1, 3}) {
+		t.Errorf("executed heights = %v, want [1 3]", got)
+	}
+}
+
+func TestForEachBlockMaxRetryPasses(t *testing.T) {
+	// Height 2 never succeeds, so only the cap on the passes stops the retries
+	node := newFakeNode(0, map[int64]int{2: -1})
+	i := newTestIndexer(t, node)
+	i.MaxRetryPasses = 2
+
+	action := &recordingAction{}
+	err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []BlockAction{action}, 2)
+
+	var failed *FailedBlocksError
+	if !errors.As(err, &failed) || !reflect.DeepEqual(failed.Heights, []int64{2}) {
+		t.Fatalf("ForEachBlock returned %v, want height 2 reported as failed", err)
+	}
+	if want := 3 * int(RtyAttNum); node.queries[2] != want {
+		t.Errorf("height 2 queried %d times, want %d over the first pass and 2 retry passes", node.queries[2], want)
+	}
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{1, 3}) {
+		t.Errorf("executed heights = %v, want [1 3]", got)
+	}
+
+	saved, err := LoadFailedBlocks(i.DB, "cosmoshub-4")
+	if err != nil {
+		t.Fatalf("LoadFailedBlocks returned unexpected error: %v", err)
+	}
+	if len(saved) != 1 || saved[0].Height != 2 {
+		t.Errorf("got failed blocks %+v, want height 2 saved", saved)
+	}
+}
+
+// sequentialAction is a recordingAction requiring blocks to be processed one at a time, it records the highest
+// number of blocks it was executed for at once.
+type sequentialAction struct {
+	recordingAction
+	running, maxRunning int32
+}
+
+func (a *sequentialAction) Sequential() bool { return true }
+
+func (a *sequentialAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	running := atomic.AddInt32(&a.running, 1)
+	defer atomic.AddInt32(&a.running, -1)
+	for {
+		max := atomic.LoadInt32(&a.maxRunning)
+		if running <= max || atomic.CompareAndSwapInt32(&a.maxRunning, max, running) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return a.recordingAction.Execute(ctx, i, block)
+}
+
+func TestForEachBlockSequentialAction(t *testing.T) {
+	i := newTestIndexer(t, newFakeNode(0, nil))
+
+	action := &sequentialAction{}
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3, 4, 5, 6}, []BlockAction{action, &recordingAction{}}, 4); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("executed heights = %v, want [1 2 3 4 5 6]", got)
+	}
+	if action.maxRunning != 1 {
+		t.Errorf("action executed for %d blocks at once, want a single block at a time", action.maxRunning)
+	}
+}
+
+func TestForEachBlockRetriesFailedBlocks(t *testing.T) {
+	// Height 2 fails every attempt of the first pass, so it's only indexed when the failed blocks are retried
+	node := newFakeNode(0, map[int64]int{2: int(RtyAttNum)})
+	i := newTestIndexer(t, node)
+
+	action := &recordingAction{}
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []BlockAction{action}, 2); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("executed heights = %v, want [1 2 3]", got)
+	}
+	if node.queries[2] != int(RtyAttNum)+1 {
+		t.Errorf("height 2 queried %d times, want %d", node.queries[2], RtyAttNum+1)
+	}
+}
+
+func TestForEachBlockConcurrentFailures(t *testing.T) {
+	// Several blocks fail at once, each recording itself as failed while the others are still being fetched
+	failures := map[int64]int{}
+	var heights []int64
+	for h := int64(1); h <= 20; h++ {
+		heights = append(heights, h)
+		if h%2 == 0 {
+			failures[h] = int(RtyAttNum)
+		}
+	}
+	node := newFakeNode(0, failures)
+	i := newTestIndexer(t, node)
+
+	action := &recordingAction{}
+	done := make(chan error, 1)
+	go func() {
+		done <- i.ForEachBlock(context.Background(), heights, []BlockAction{action}, 4)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ForEachBlock didn't return after blocks failed")
+	}
+	if got := action.executed(); !reflect.DeepEqual(got, heights) {
+		t.Errorf("executed heights = %v, want %v", got, heights)
+	}
+}
+
+// slowNode delays each Block query of a fakeNode and records the peak number of concurrent queries.
+type slowNode struct {
+	*fakeNode
+	delay          time.Duration
+	inFlight, peak int32
+}
+
+func (n *slowNode) Block(ctx context.Context, height *int64) (*coretypes.ResultBlock, error) {
+	in := atomic.AddInt32(&n.inFlight, 1)
+	defer atomic.AddInt32(&n.inFlight, -1)
+	for {
+		p := atomic.LoadInt32(&n.peak)
+		if in <= p || atomic.CompareAndSwapInt32(&n.peak, p, in) {
+			break
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(n.delay):
+	}
+	return n.fakeNode.Block(ctx, height)
+}
+
+// settledGoroutines waits for the number of goroutines to drop to at most want, returning the last count.
+func settledGoroutines(want int) int {
+	n := runtime.NumGoroutine()
+	for deadline := time.Now().Add(2 * time.Second); n > want && time.Now().Before(deadline); n = runtime.NumGoroutine() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return n
+}
+
+func TestForEachBlockReleasesSemaphore(t *testing.T) {
+	const concurrentBlocks = 3
+	failures := make(map[int64]int)
+	var heights []int64
+	for h := int64(1); h <= 20; h++ {
+		heights = append(heights, h)
+		if h%2 == 0 {
+			failures[h] = -1
+		}
+	}
+
+	t.Run("failing blocks", func(t *testing.T) {
+		node := &slowNode{fakeNode: newFakeNode(0, failures), delay: time.Millisecond}
+		i := newTestIndexer(t, node)
+		i.RetryDeadline = time.Nanosecond
+		before := runtime.NumGoroutine()
+
+		action := &recordingAction{}
+		var failed *FailedBlocksError
+		if err := i.ForEachBlock(context.Background(), heights, []BlockAction{action}, concurrentBlocks); !errors.As(err, &failed) {
+			t.Fatalf("ForEachBlock returned %v, want a *FailedBlocksError", err)
+		}
+		if len(failed.Heights) != 10 || len(action.executed()) != 10 {
+			t.Errorf("got %d failed and %d executed blocks, want 10 of each", len(failed.Heights), len(action.executed()))
+		}
+		if peak := atomic.LoadInt32(&node.peak); peak > concurrentBlocks {
+			t.Errorf("%d blocks were queried concurrently, want at most %d", peak, concurrentBlocks)
+		}
+		if n := settledGoroutines(before); n > before {
+			t.Errorf("%d goroutines are left running, want at most %d", n, before)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		node := &slowNode{fakeNode: newFakeNode(0, failures), delay: time.Second}
+		i := newTestIndexer(t, node)
+		before := runtime.NumGoroutine()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := i.ForEachBlock(ctx, heights, nil, concurrentBlocks)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("ForEachBlock returned %v, want the context error", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("ForEachBlock took %s to return after the context was cancelled", elapsed)
+		}
+
+		// The blocks in flight failed once their queries were cancelled, they're saved to be retried later
+		var failed *FailedBlocksError
+		if !errors.As(err, &failed) || len(failed.Heights) == 0 {
+			t.Fatalf("ForEachBlock returned %v, want a *FailedBlocksError with the blocks in flight", err)
+		}
+		saved, err := LoadFailedBlocks(i.DB, "cosmoshub-4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(saved) != len(failed.Heights) {
+			t.Errorf("got %d saved failed blocks, want the %d blocks in flight", len(saved), len(failed.Heights))
+		}
+		if n := settledGoroutines(before); n > before {
+			t.Errorf("%d goroutines are left running, want at most %d", n, before)
+		}
+	})
+}
+
+func TestTxResults(t *testing.T) {
+	tests := []struct {
+		name           string
+		noBlockResults bool
+		fallback       bool
+		wantErr        bool
+		wantTxQueries  int
+	}{
+		{name: "block results", fallback: true},
+		{name: "fallback to tx queries", noBlockResults: true, fallback: true, wantTxQueries: 4},
+		{name: "fallback disabled", noBlockResults: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode(4, nil)
+			node.noBlockResults = tt.noBlockResults
+			block := node.block(10)
+			// One tx can't be queried on its own either, its results are left out
+			node.missingTxs[string(block.Block.Data.Txs[2].Hash())] = true
+
+			i := newTestIndexer(t, node)
+			i.BlockResultsFallback = tt.fallback
+			results, err := i.TxResults(context.Background(), block)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("TxResults returned no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TxResults returned unexpected error: %v", err)
+			}
+			if node.txQueries != tt.wantTxQueries {
+				t.Errorf("queried %d txs individually, want %d", node.txQueries, tt.wantTxQueries)
+			}
+			if len(results) != 4 {
+				t.Fatalf("got %d results, want one per tx", len(results))
+			}
+			for j, res := range results {
+				if tt.noBlockResults && j == 2 {
+					if res != nil {
+						t.Errorf("got results for tx %d which couldn't be queried", j)
+					}
+					continue
+				}
+				if res == nil {
+					t.Errorf("missing results for tx %d", j)
+					continue
+				}
+				if res.TxResult.Code != uint32(j) || string(res.Hash) != string(block.Block.Data.Txs[j].Hash()) || res.Height != 10 {
+					t.Errorf("results of tx %d = %+v", j, res)
+				}
+			}
+		})
+	}
+}
+
+// deadlineNode records the time left until the deadline of the context of each query made to a fakeNode.
+type deadlineNode struct {
+	*fakeNode
+	left map[string]time.Duration
+}
+
+func (n *deadlineNode) record(ctx context.Context, query string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		n.left[query] = time.Until(deadline)
+	}
+}
+
+func (n *deadlineNode) Block(ctx context.Context, height *int64) (*coretypes.ResultBlock, error) {
+	n.record(ctx, "block")
+	return n.fakeNode.Block(ctx, height)
+}
+
+func (n *deadlineNode) BlockResults(ctx context.Context, height *int64) (*coretypes.ResultBlockResults, error) {
+	n.record(ctx, "block-results")
+	return n.fakeNode.BlockResults(ctx, height)
+}
+
+func (n *deadlineNode) Tx(ctx context.Context, hash []byte, prove bool) (*coretypes.ResultTx, error) {
+	n.record(ctx, "tx")
+	return n.fakeNode.Tx(ctx, hash, prove)
+}
+
+func (n *deadlineNode) Status(ctx context.Context) (*coretypes.ResultStatus, error) {
+	n.record(ctx, "status")
+	return &coretypes.ResultStatus{SyncInfo: coretypes.SyncInfo{LatestBlockHeight: 10}}, nil
+}
+
+func TestTimeouts(t *testing.T) {
+	node := &deadlineNode{fakeNode: newFakeNode(2, nil), left: make(map[string]time.Duration)}
+	node.noBlockResults = true
+	i := newTestIndexer(t, node)
+	i.BlockResultsFallback = true
+	i.Timeouts = Timeouts{Block: time.Hour, BlockResults: 2 * time.Hour, Query: 3 * time.Hour}
+
+	if err := i.ForEachBlock(context.Background(), []int64{10}, []BlockAction{&recordingAction{}}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if _, err := i.TxResults(context.Background(), node.block(10)); err != nil {
+		t.Fatalf("TxResults returned unexpected error: %v", err)
+	}
+	if _, err := i.QueryLatestHeight(context.Background()); err != nil {
+		t.Fatalf("QueryLatestHeight returned unexpected error: %v", err)
+	}
+
+	for query, timeout := range map[string]time.Duration{
+		"block":         time.Hour,
+		"block-results": 2 * time.Hour,
+		"tx":            3 * time.Hour,
+		"status":        3 * time.Hour,
+	} {
+		left, ok := node.left[query]
+		if !ok {
+			t.Errorf("%s query had no deadline", query)
+			continue
+		}
+		if left > timeout || left < timeout-time.Minute {
+			t.Errorf("%s query had %s left until its deadline, want about %s", query, left, timeout)
+		}
+	}
+
+	// No timeout leaves the context without a deadline
+	node.left = make(map[string]time.Duration)
+	i.Timeouts = Timeouts{}
+	if _, err := i.TxResults(context.Background(), node.block(10)); err != nil {
+		t.Fatalf("TxResults returned unexpected error: %v", err)
+	}
+	if len(node.left) != 0 {
+		t.Errorf("queries had deadlines without timeouts: %v", node.left)
+	}
+}
+
+func TestFailedBlocksEndpoint(t *testing.T) {
+	// Heights 2 and 3 fail the first pass, only height 3 recovers when it's processed again
+	node := newFakeNode(0, map[int64]int{2: -1, 3: int(RtyAttNum)})
+	i := newTestIndexer(t, node)
+	i.RetryDeadline = time.Nanosecond
+
+	var failed *FailedBlocksError
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, nil, 3); !errors.As(err, &failed) {
+		t.Fatalf("ForEachBlock returned %v, want a *FailedBlocksError", err)
+	}
+	if err := i.ForEachBlock(context.Background(), []int64{3}, nil, 3); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	indexdebug.StartDebugServer(ctx, zap.NewNop(), ln, indexdebug.Route{
+		Pattern: "/failed-blocks",
+		Handler: indexdebug.JSONHandler(zap.NewNop(), func() interface{} { return i.FailedBlocks() }),
+	})
+
+	res, err := http.Get("http://" + ln.Addr().String() + "/failed-blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var got []FailedBlock
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode /failed-blocks response: %v", err)
+	}
+
+	if len(got) != 1 || got[0].Height != 2 || got[0].ChainID != "cosmoshub-4" {
+		t.Fatalf("/failed-blocks = %+v, want only height 2", got)
+	}
+	if got[0].LastError != "height 2 is not available" || got[0].FailedAt.IsZero() {
+		t.Errorf("failed block 2 = %+v, want its last error and failure time", got[0])
+	}
+}
+
+// filterAction is a recordingAction that only handles msgs of the specified types.
+type filterAction struct {
+	recordingAction
+	msgTypes []string
+}
+
+func (a *filterAction) MsgTypes() []string { return a.msgTypes }
+
+// countingTxConfig counts the txs fully decoded with its TxDecoder.
+type countingTxConfig struct {
+	client.TxConfig
+	decodes int64
+}
+
+func (c *countingTxConfig) TxDecoder() sdk.TxDecoder {
+	decode := c.TxConfig.TxDecoder()
+	return func(bz []byte) (sdk.Tx, error) {
+		atomic.AddInt64(&c.decodes, 1)
+		return decode(bz)
+	}
+}
+
+// newDecodingIndexer returns an Indexer decoding txs with the lens codec, counting the txs it fully decodes,
+// and a tx containing a bank MsgSend and one containing an IBC MsgTransfer.
+func newDecodingIndexer(t testing.TB) (i *Indexer, txConfig *countingTxConfig, send, transfer tmtypes.Tx) {
+	i = newTestIndexer(t, nil)
+	i.Client.Codec = lens.MakeCodec(lens.ModuleBasics)
+	txConfig = &countingTxConfig{TxConfig: i.Client.Codec.TxConfig}
+	i.Client.Codec.TxConfig = txConfig
+
+	encode := func(msg sdk.Msg) tmtypes.Tx {
+		builder := txConfig.NewTxBuilder()
+		if err := builder.SetMsgs(msg); err != nil {
+			t.Fatal(err)
+		}
+		bz, err := txConfig.TxEncoder()(builder.GetTx())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bz
+	}
+	coin := sdk.NewInt64Coin("uatom", 1)
+	send = encode(banktypes.NewMsgSend(sdk.AccAddress("sender"), sdk.AccAddress("receiver"), sdk.NewCoins(coin)))
+	transfer = encode(transfertypes.NewMsgTransfer("transfer", "channel-0", coin, "cosmos1sender", "osmo1receiver", clienttypes.NewHeight(1, 100), 0))
+	return i, txConfig, send, transfer
+}
+
+func TestDecodeTx(t *testing.T) {
+	transferType := sdk.MsgTypeURL(&transfertypes.MsgTransfer{})
+	tests := []struct {
+		name        string
+		actions     []BlockAction
+		wantSend    bool
+		wantDecodes int64
+	}{
+		{name: "filtered", actions: []BlockAction{&filterAction{msgTypes: []string{transferType}}}, wantDecodes: 1},
+		{name: "union of filters", actions: []BlockAction{
+			&filterAction{msgTypes: []string{transferType}},
+			&filterAction{msgTypes: []string{sdk.MsgTypeURL(&banktypes.MsgSend{})}},
+		}, wantSend: true, wantDecodes: 2},
+		{name: "action without filter", actions: []BlockAction{
+			&filterAction{msgTypes: []string{transferType}},
+			&recordingAction{},
+		}, wantSend: true, wantDecodes: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, txConfig, send, transfer := newDecodingIndexer(t)
+			i.msgTypes = msgTypesFilter(tt.actions)
+
+			sdkTx, err := i.DecodeTx(transfer)
+			if err != nil || sdkTx == nil {
+				t.Fatalf("DecodeTx(transfer) = %v, %v, want the decoded tx", sdkTx, err)
+			}
+			if _, ok := sdkTx.GetMsgs()[0].(*transfertypes.MsgTransfer); !ok {
+				t.Errorf("decoded msg %T, want a MsgTransfer", sdkTx.GetMsgs()[0])
+			}
+
+			sdkTx, err = i.DecodeTx(send)
+			if err != nil {
+				t.Fatalf("DecodeTx(send) returned unexpected error: %v", err)
+			}
+			if (sdkTx != nil) != tt.wantSend {
+				t.Errorf("DecodeTx(send) = %v, want decoded %t", sdkTx, tt.wantSend)
+			}
+			if txConfig.decodes != tt.wantDecodes {
+				t.Errorf("fully decoded %d txs, want %d", txConfig.decodes, tt.wantDecodes)
+			}
+		})
+	}
+}
+
+// BenchmarkDecodeTx decodes blocks where one in ten txs is an IBC transfer, reporting the txs fully decoded per block
+// with and without the msg types of the actions filtering txs.
+func BenchmarkDecodeTx(b *testing.B) {
+	for _, bm := range []struct {
+		name    string
+		actions []BlockAction
+	}{
+		{"unfiltered", []BlockAction{&recordingAction{}}},
+		{"filtered", []BlockAction{&filterAction{msgTypes: []string{sdk.MsgTypeURL(&transfertypes.MsgTransfer{})}}}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			i, txConfig, send, transfer := newDecodingIndexer(b)
+			i.msgTypes = msgTypesFilter(bm.actions)
+			txs := make(tmtypes.Txs, 100)
+			for j := range txs {
+				txs[j] = send
+				if j%10 == 0 {
+					txs[j] = transfer
+				}
+			}
+
+			// The txs repeat within the block, so decode them bypassing the cache of decoded txs
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for _, tx := range txs {
+					if _, err := i.decodeTx(tx); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(txConfig.decodes)/float64(b.N), "decodes/block")
+		})
+	}
+}
+
+// decodingAction decodes every tx of the blocks it's executed for.
+type decodingAction struct {
+	recordingAction
+}
+
+func (a *decodingAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	return i.ForEachTx(ctx, block, func(ctx context.Context, index int, tx tmtypes.Tx) error {
+		_, err := i.DecodeTx(tx)
+		return err
+	})
+}
+
+// newDecodingBlock adds a block at height to node containing txCount distinct bank MsgSend txs.
+func newDecodingBlock(t testing.TB, i *Indexer, node *rpctest.Node, height int64, txCount int) {
+	txConfig := i.Client.Codec.TxConfig
+	txs := make([][]byte, txCount)
+	results := make([]*abcitypes.ResponseDeliverTx, txCount)
+	for j := range txs {
+		builder := txConfig.NewTxBuilder()
+		coins := sdk.NewCoins(sdk.NewInt64Coin("uatom", int64(j+1)))
+		if err := builder.SetMsgs(banktypes.NewMsgSend(sdk.AccAddress("sender"), sdk.AccAddress("receiver"), coins)); err != nil {
+			t.Fatal(err)
+		}
+		bz, err := txConfig.TxEncoder()(builder.GetTx())
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs[j] = bz
+		results[j] = &abcitypes.ResponseDeliverTx{}
+	}
+	node.AddBlock(height, time.Now(), txs, results)
+}
+
+func TestDecodeTxCache(t *testing.T) {
+	i, txConfig, _, _ := newDecodingIndexer(t)
+	node := rpctest.New("cosmoshub-4")
+	i.Client.RPCClient = node
+	newDecodingBlock(t, i, node, 1, 10)
+	newDecodingBlock(t, i, node, 2, 10)
+
+	actions := []BlockAction{&decodingAction{}, &decodingAction{}, &decodingAction{}}
+	if err := i.ForEachBlock(context.Background(), []int64{1}, actions, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if txConfig.decodes != 10 {
+		t.Errorf("fully decoded %d txs for 3 actions, want each of the 10 txs decoded once", txConfig.decodes)
+	}
+
+	// The cache only lives as long as the block is processed, block 2 contains the same txs as block 1
+	if err := i.ForEachBlock(context.Background(), []int64{2}, actions, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if txConfig.decodes != 20 {
+		t.Errorf("fully decoded %d txs after the second block, want 20", txConfig.decodes)
+	}
+	var cached int
+	i.decoded.Range(func(key, value interface{}) bool {
+		cached++
+		return true
+	})
+	if cached != 0 {
+		t.Errorf("got %d cached txs once the blocks were processed, want none", cached)
+	}
+}
+
+// BenchmarkDecodeTxActions processes blocks of 100 txs with a growing number of actions decoding every tx,
+// reporting the txs fully decoded per tx of the blocks.
+func BenchmarkDecodeTxActions(b *testing.B) {
+	for _, actionCount := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("%d actions", actionCount), func(b *testing.B) {
+			i, txConfig, _, _ := newDecodingIndexer(b)
+			node := rpctest.New("cosmoshub-4")
+			i.Client.RPCClient = node
+			newDecodingBlock(b, i, node, 1, 100)
+
+			actions := make([]BlockAction, actionCount)
+			for j := range actions {
+				actions[j] = &decodingAction{}
+			}
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if err := i.ForEachBlock(context.Background(), []int64{1}, actions, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(txConfig.decodes)/float64(b.N*100), "decodes/tx")
+		})
+	}
+}
+
+func TestFailedTxRawLog(t *testing.T) {
+	oversized := strings.Repeat("out of gas ", 1000)
+	tests := []struct {
+		name   string
+		policy RawLogPolicy
+		rawLog string
+		want   string
+	}{
+		{name: "no limit", rawLog: oversized, want: `{"code":11,"error":` + strconv.Quote(oversized) + `}`},
+		{name: "within limit", policy: RawLogPolicy{MaxSize: 64}, rawLog: "out of gas", want: `{"code":11,"error":"out of gas"}`},
+		{name: "truncated", policy: RawLogPolicy{MaxSize: 14}, rawLog: oversized, want: `{"code":11,"error":"out of gas out","truncated":true}`},
+		{name: "omitted", policy: RawLogPolicy{MaxSize: 14, Omit: true}, rawLog: oversized, want: `{"code":11,"truncated":true}`},
+		{name: "quotes escaped", rawLog: `invalid "denom"`, want: `{"code":11,"error":"invalid \"denom\""}`},
+		// Truncating in the middle of a multi-byte rune doesn't produce invalid UTF-8
+		{name: "truncated rune", policy: RawLogPolicy{MaxSize: 2}, rawLog: "aé b", want: `{"code":11,"error":"a","truncated":true}`},
+	}
+	for _, tt := range tests {
+		i := &Indexer{FailedRawLog: tt.policy}
+		got, err := i.FailedTxRawLog(11, tt.rawLog)
+		if err != nil {
+			t.Errorf("%s: FailedTxRawLog returned unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: FailedTxRawLog() = %.200s, want %.200s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDatabaseConfigs(t *testing.T) {
+	pgConfig, gormConfig := databaseConfigs("host=localhost", logger.Silent, DefaultDatabaseOptions())
+	if pgConfig.DSN != "host=localhost" || !pgConfig.PreferSimpleProtocol || gormConfig.PrepareStmt {
+		t.Errorf("default options configured %+v and prepare statements %t, want only the simple protocol", pgConfig, gormConfig.PrepareStmt)
+	}
+
+	pgConfig, gormConfig = databaseConfigs("host=localhost", logger.Silent, DatabaseOptions{PrepareStmt: true})
+	if pgConfig.PreferSimpleProtocol || !gormConfig.PrepareStmt {
+		t.Errorf("configured %+v and prepare statements %t, want only prepared statements", pgConfig, gormConfig.PrepareStmt)
+	}
+}
+
+func TestDatabaseOptionsWithConcurrencyDefaults(t *testing.T) {
+	tests := []struct {
+		name             string
+		opts             DatabaseOptions
+		concurrentBlocks uint
+		expected         DatabaseOptions
+	}{
+		{name: "few blocks", concurrentBlocks: 10, expected: DatabaseOptions{MaxOpenConns: 10, MaxIdleConns: 10}},
+		{name: "many blocks", concurrentBlocks: 100, expected: DatabaseOptions{MaxOpenConns: DefaultMaxOpenConns, MaxIdleConns: DefaultMaxOpenConns}},
+		{name: "configured", opts: DatabaseOptions{MaxOpenConns: 20, MaxIdleConns: 5}, concurrentBlocks: 100, expected: DatabaseOptions{MaxOpenConns: 20, MaxIdleConns: 5}},
+		{name: "configured max open", opts: DatabaseOptions{MaxOpenConns: 20}, concurrentBlocks: 5, expected: DatabaseOptions{MaxOpenConns: 20, MaxIdleConns: 20}},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.WithConcurrencyDefaults(tt.concurrentBlocks); got != tt.expected {
+			t.Errorf("%s: got options %+v, expected %+v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestDatabaseOptionsApplyPool(t *testing.T) {
+	// Opening doesn't connect, so the pool can be configured without a database server
+	sqlDB, err := sql.Open("pgx", "host=localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	DatabaseOptions{}.applyPool(sqlDB)
+	if got := sqlDB.Stats().MaxOpenConnections; got != 0 {
+		t.Errorf("got %d max open connections without pool settings, want unlimited", got)
+	}
+
+	DatabaseOptions{MaxOpenConns: 12, MaxIdleConns: 4, ConnMaxLifetime: time.Minute}.applyPool(sqlDB)
+	if got := sqlDB.Stats().MaxOpenConnections; got != 12 {
+		t.Errorf("got %d max open connections, expected 12", got)
+	}
+}
+
+func TestForEachSuccessfulTx(t *testing.T) {
+	i, txConfig, _, _ := newDecodingIndexer(t)
+	node := rpctest.New("cosmoshub-4")
+	i.Client.RPCClient = node
+
+	encode := func(memo string) []byte {
+		builder := txConfig.NewTxBuilder()
+		coins := sdk.NewCoins(sdk.NewInt64Coin("uatom", 1))
+		if err := builder.SetMsgs(banktypes.NewMsgSend(sdk.AccAddress("sender"), sdk.AccAddress("receiver"), coins)); err != nil {
+			t.Fatal(err)
+		}
+		builder.SetMemo(memo)
+		bz, err := txConfig.TxEncoder()(builder.GetTx())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bz
+	}
+	txs := [][]byte{encode("ok"), []byte("not a tx"), encode("failed"), encode("bad logs")}
+	results := []*abcitypes.ResponseDeliverTx{
+		{Log: `[{"msg_index":0,"events":[]}]`},
+		{},
+		{Code: 5, Log: "insufficient funds"},
+		{Log: "not logs"},
+	}
+	block := node.AddBlock(1, time.Now(), txs, results)
+
+	var (
+		mu      sync.Mutex
+		decoded []int
+	)
+	err := i.ForEachDecodedTx(context.Background(), zap.NewNop(), block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx) error {
+		mu.Lock()
+		defer mu.Unlock()
+		decoded = append(decoded, index)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachDecodedTx returned unexpected error: %v", err)
+	}
+	sort.Ints(decoded)
+	if !reflect.DeepEqual(decoded, []int{0, 2, 3}) {
+		t.Errorf("ForEachDecodedTx called fn for txs %v, want the decodable txs [0 2 3]", decoded)
+	}
+
+	successful := make(map[int]sdk.ABCIMessageLogs)
+	err = i.ForEachSuccessfulTx(context.Background(), zap.NewNop(), block, func(ctx context.Context, index int, tx tmtypes.Tx, sdkTx sdk.Tx, txRes *coretypes.ResultTx, logs sdk.ABCIMessageLogs) error {
+		mu.Lock()
+		defer mu.Unlock()
+		successful[index] = logs
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachSuccessfulTx returned unexpected error: %v", err)
+	}
+	if len(successful) != 2 {
+		t.Fatalf("ForEachSuccessfulTx called fn for txs %v, want the successful txs 0 and 3", successful)
+	}
+	if logs, ok := successful[0]; !ok || len(logs) != 1 {
+		t.Errorf("got logs %v for tx 0, want its single msg log", logs)
+	}
+	// Txs whose logs fail to be parsed are still handed to fn, without logs
+	if logs, ok := successful[3]; !ok || logs != nil {
+		t.Errorf("got logs %v for tx 3, want none", logs)
+	}
+}
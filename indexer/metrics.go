@@ -0,0 +1,102 @@
+package indexer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// metricsCallback is the name of the gorm callback counting the failed inserts of the block actions.
+const metricsCallback = "valis:metrics"
+
+// Metrics are the prometheus metrics of the indexing progress, labeled by chain. A Metrics is shared by the indexers
+// of every chain, a nil Metrics doesn't record anything.
+type Metrics struct {
+	blocksProcessed   *prometheus.CounterVec
+	blocksFailed      *prometheus.CounterVec
+	txsDecoded        *prometheus.CounterVec
+	txDecodeFailures  *prometheus.CounterVec
+	actionInsertFails *prometheus.CounterVec
+	indexedHeight     *prometheus.GaugeVec
+}
+
+// NewMetrics returns Metrics whose collectors are registered with reg.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		blocksProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "valis_blocks_processed_total",
+			Help: "Number of blocks every block action was executed for.",
+		}, []string{"chain_id"}),
+		blocksFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "valis_blocks_failed_total",
+			Help: "Number of attempts at processing a block that failed, either querying it or executing a block action.",
+		}, []string{"chain_id"}),
+		txsDecoded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "valis_txs_decoded_total",
+			Help: "Number of txs decoded, txs skipped without decoding by the msg type filter aren't counted.",
+		}, []string{"chain_id"}),
+		txDecodeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "valis_tx_decode_failures_total",
+			Help: "Number of txs that failed to be decoded.",
+		}, []string{"chain_id"}),
+		actionInsertFails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "valis_action_insert_errors_total",
+			Help: "Number of insert statements of a block action that failed.",
+		}, []string{"chain_id", "action"}),
+		indexedHeight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "valis_indexed_height",
+			Help: "Highest block height processed so far, lower heights may still be in flight.",
+		}, []string{"chain_id"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.blocksProcessed, m.blocksFailed, m.txsDecoded, m.txDecodeFailures, m.actionInsertFails, m.indexedHeight,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) blockProcessed(chainID string) {
+	if m != nil {
+		m.blocksProcessed.WithLabelValues(chainID).Inc()
+	}
+}
+
+func (m *Metrics) blockFailed(chainID string) {
+	if m != nil {
+		m.blocksFailed.WithLabelValues(chainID).Inc()
+	}
+}
+
+func (m *Metrics) txDecoded(chainID string, err error) {
+	switch {
+	case m == nil:
+	case err != nil:
+		m.txDecodeFailures.WithLabelValues(chainID).Inc()
+	default:
+		m.txsDecoded.WithLabelValues(chainID).Inc()
+	}
+}
+
+func (m *Metrics) setIndexedHeight(chainID string, height int64) {
+	if m != nil {
+		m.indexedHeight.WithLabelValues(chainID).Set(float64(height))
+	}
+}
+
+// UseMetrics registers a gorm callback counting the failed inserts of the block actions through db in m.
+// Since callbacks are shared by every session of db, this should be called once after connecting.
+func UseMetrics(db *gorm.DB, m *Metrics) error {
+	return db.Callback().Create().After("gorm:create").Register(metricsCallback, func(tx *gorm.DB) {
+		if tx.Error == nil || tx.Statement.Schema == nil || isIndexerModel(tx.Statement.Schema) {
+			return
+		}
+		scope, ok := tx.Statement.Context.Value(rowCountScopeKey{}).(rowCountScope)
+		if !ok {
+			return
+		}
+		m.actionInsertFails.WithLabelValues(scope.chainID, scope.actionName).Inc()
+	})
+}
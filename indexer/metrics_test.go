@@ -0,0 +1,77 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func TestMetricsScrape(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := newTestIndexer(t, newFakeNode(0, nil))
+	db, rec := dbtest.New(t)
+	i.DB = db
+	i.RetryDeadline = 50 * time.Millisecond
+	i.Metrics = metrics
+	if err := UseMetrics(db, metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two blocks are processed, then the insert of a third block fails
+	action := &writingAction{}
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2}, []BlockAction{action}, 1); err != nil {
+		t.Fatal(err)
+	}
+	rec.Fail("transfer_rows", errors.New("insert failed"))
+	_ = i.ForEachBlock(context.Background(), []int64{3}, []BlockAction{action}, 1)
+
+	decoding, _, send, _ := newDecodingIndexer(t)
+	decoding.Metrics = metrics
+	if _, err := decoding.DecodeTx(send); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoding.DecodeTx(tmtypes.Tx("not a tx")); err == nil {
+		t.Fatal("expected an error decoding an invalid tx")
+	}
+
+	srv := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sample := range []string{
+		`valis_blocks_processed_total{chain_id="cosmoshub-4"} 2`,
+		`valis_blocks_failed_total{chain_id="cosmoshub-4"}`,
+		`valis_txs_decoded_total{chain_id="cosmoshub-4"} 1`,
+		`valis_tx_decode_failures_total{chain_id="cosmoshub-4"} 1`,
+		`valis_action_insert_errors_total{action="writing",chain_id="cosmoshub-4"}`,
+		// Like LastHeight, the height is the highest block processed whether or not its actions failed
+		`valis_indexed_height{chain_id="cosmoshub-4"} 3`,
+	} {
+		if !strings.Contains(string(body), sample) {
+			t.Errorf("scraped metrics are missing %s:\n%s", sample, body)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MsgProgress records the last msg, within a block, that an action successfully wrote. It allows a block that was
+// interrupted (e.g. by a crash) to be resumed without re-attempting the writes for the msgs that were already written.
+// A MsgIndex of -1 means the tx itself was written but none of its msgs were.
+type MsgProgress struct {
+	ChainID    string `gorm:"primaryKey"`
+	ActionName string `gorm:"primaryKey"`
+	Height     int64  `gorm:"primaryKey;autoIncrement:false"`
+	TxIndex    int    `gorm:"not null"`
+	MsgIndex   int    `gorm:"not null"`
+}
+
+// TxWritten reports whether every msg of the tx at txIndex was already written according to the progress.
+// A nil MsgProgress means nothing was written yet.
+func (p *MsgProgress) TxWritten(txIndex int) bool {
+	return p != nil && txIndex < p.TxIndex
+}
+
+// Written reports whether the msg at msgIndex of the tx at txIndex was already written according to the progress.
+// A nil MsgProgress means nothing was written yet.
+func (p *MsgProgress) Written(txIndex, msgIndex int) bool {
+	if p == nil {
+		return false
+	}
+	return txIndex < p.TxIndex || (txIndex == p.TxIndex && msgIndex <= p.MsgIndex)
+}
+
+// indexerModels are the models owned by the indexer itself, as opposed to a BlockAction.
+var indexerModels = []interface{}{
+	&MsgProgress{},
+	&FailedBlock{},
+	&ChainRun{},
+	&IndexProgress{},
+	&IndexedBlock{},
+	&DenomMetadata{},
+	&RawBlock{},
+	&SchemaVersion{},
+}
+
+// MigrateSchema runs schema migrations for the models owned by the indexer itself, as opposed to a BlockAction,
+// and records them as migrated to IndexerSchemaVersion.
+func (i *Indexer) MigrateSchema() error {
+	if err := i.DB.AutoMigrate(indexerModels...); err != nil {
+		return err
+	}
+	return i.saveSchemaVersion(IndexerSchemaName, IndexerSchemaVersion)
+}
+
+// MigrateSchemas runs the schema migrations for the indexer's own models followed by those of each action.
+// Actions returning ErrNoMigrations are logged and skipped, any other error stops the migrations.
+func (i *Indexer) MigrateSchemas(actions []BlockAction) error {
+	if err := i.MigrateSchema(); err != nil {
+		return err
+	}
+
+	for _, a := range actions {
+		if err := i.MigrateActionSchema(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateActionSchema runs the schema migrations of a single action, besides recording its schema version it doesn't
+// touch any other tables. An action returning ErrNoMigrations is logged and skipped.
+func (i *Indexer) MigrateActionSchema(a BlockAction) error {
+	err := a.MigrateSchema(i)
+	switch {
+	case errors.Is(err, ErrNoMigrations):
+		i.log.Info(
+			"Skipping schema migrations for block action without migrations",
+			zap.String("block_action_name", a.Name()),
+		)
+	case err != nil:
+		return fmt.Errorf("failed to migrate schema for block action %s: %w", a.Name(), err)
+	default:
+		i.log.Info(
+			"Migrated schema for block action",
+			zap.String("block_action_name", a.Name()),
+		)
+	}
+
+	// The version table is created along with the indexer's own models, which may not have been migrated yet
+	if err := i.DB.AutoMigrate(&SchemaVersion{}); err != nil {
+		return err
+	}
+	if err := i.saveSchemaVersion(a.Name(), actionSchemaVersion(a)); err != nil {
+		return fmt.Errorf("failed to record schema version for block action %s: %w", a.Name(), err)
+	}
+	return nil
+}
+
+// LoadMsgProgress returns the recorded progress of the named action for the block at height, or nil if
+// msg progress tracking is disabled or the block has no recorded progress.
+func (i *Indexer) LoadMsgProgress(actionName string, height int64) (*MsgProgress, error) {
+	if !i.TrackMsgProgress {
+		return nil, nil
+	}
+
+	var progress MsgProgress
+	err := i.DB.Where(&MsgProgress{ChainID: i.Client.Config.ChainID, ActionName: actionName, Height: height}).
+		First(&progress).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// SaveMsgProgress records that the named action wrote the msg at msgIndex of the tx at txIndex in the block at height.
+// It is a no-op if msg progress tracking is disabled.
+func (i *Indexer) SaveMsgProgress(actionName string, height int64, txIndex, msgIndex int) error {
+	if !i.TrackMsgProgress {
+		return nil
+	}
+
+	return i.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "action_name"}, {Name: "height"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tx_index", "msg_index"}),
+	}).Create(&MsgProgress{
+		ChainID:    i.Client.Config.ChainID,
+		ActionName: actionName,
+		Height:     height,
+		TxIndex:    txIndex,
+		MsgIndex:   msgIndex,
+	}).Error
+}
+
+// ClearMsgProgress removes the recorded progress of the named action for the block at height,
+// it should be called once every msg in the block has been written.
+func (i *Indexer) ClearMsgProgress(actionName string, height int64) error {
+	if !i.TrackMsgProgress {
+		return nil
+	}
+
+	return i.DB.Where(&MsgProgress{ChainID: i.Client.Config.ChainID, ActionName: actionName, Height: height}).
+		Delete(&MsgProgress{}).Error
+}
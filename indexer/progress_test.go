@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"gorm.io/gorm"
+)
+
+// migratingAction is a block action migrating models, or returning err from MigrateSchema,
+// and recording that it was called.
+type migratingAction struct {
+	name     string
+	err      error
+	models   []interface{}
+	migrated *[]string
+}
+
+func (a *migratingAction) Name() string { return a.name }
+
+func (a *migratingAction) MigrateSchema(i *Indexer) error {
+	*a.migrated = append(*a.migrated, a.name)
+	if a.err != nil {
+		return a.err
+	}
+	return i.DB.AutoMigrate(a.models...)
+}
+
+func (a *migratingAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	return nil
+}
+
+func TestMigrateSchemas(t *testing.T) {
+	i := newTestIndexer(t, nil)
+
+	var migrated []string
+	actions := []BlockAction{
+		&migratingAction{name: "stats", err: ErrNoMigrations, migrated: &migrated},
+		&migratingAction{name: "ibc", migrated: &migrated},
+	}
+	if err := i.MigrateSchemas(actions); err != nil {
+		t.Fatalf("MigrateSchemas returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(migrated, []string{"stats", "ibc"}) {
+		t.Errorf("migrated actions = %v, want [stats ibc]", migrated)
+	}
+
+	failed := errors.New("failed")
+	migrated = nil
+	actions = []BlockAction{
+		&migratingAction{name: "ibc", err: failed, migrated: &migrated},
+		&migratingAction{name: "daodao", migrated: &migrated},
+	}
+	if err := i.MigrateSchemas(actions); !errors.Is(err, failed) {
+		t.Errorf("MigrateSchemas returned %v, want %v", err, failed)
+	}
+	if !reflect.DeepEqual(migrated, []string{"ibc"}) {
+		t.Errorf("migrated actions = %v, want [ibc]", migrated)
+	}
+}
+
+// createdTables returns the tables created through db so far.
+func createdTables(t *testing.T, db *gorm.DB) func() []string {
+	createTable := regexp.MustCompile(`^CREATE TABLE "(\w+)"`)
+	var tables []string
+	err := db.Callback().Raw().After("gorm:raw").Register("test:created_tables", func(db *gorm.DB) {
+		if m := createTable.FindStringSubmatch(db.Statement.SQL.String()); m != nil {
+			tables = append(tables, m[1])
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() []string { return tables }
+}
+
+func TestMigrateActionSchema(t *testing.T) {
+	i := newTestIndexer(t, nil)
+	tables := createdTables(t, i.DB)
+
+	var migrated []string
+	action := &migratingAction{name: "transfers", models: []interface{}{&transferRow{}}, migrated: &migrated}
+	if err := i.MigrateActionSchema(action); err != nil {
+		t.Fatalf("MigrateActionSchema returned unexpected error: %v", err)
+	}
+	// Besides the action's tables, only the table recording its schema version is created
+	if got := tables(); !reflect.DeepEqual(got, []string{"transfer_rows", "valis_schema_versions"}) {
+		t.Errorf("created tables = %v, want only the action's [transfer_rows] and valis_schema_versions", got)
+	}
+
+	if err := i.MigrateActionSchema(&migratingAction{name: "stats", err: ErrNoMigrations, migrated: &migrated}); err != nil {
+		t.Errorf("MigrateActionSchema returned %v for an action without migrations, want nil", err)
+	}
+}
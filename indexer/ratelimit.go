@@ -0,0 +1,55 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TxRateLimit spaces out the txs handed to the block actions so at most PerSec txs are started per second,
+// across every block being processed concurrently. A nil TxRateLimit doesn't limit anything.
+type TxRateLimit struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewTxRateLimit returns a TxRateLimit allowing perSec txs per second, or nil if perSec isn't positive.
+func NewTxRateLimit(perSec float64) *TxRateLimit {
+	if perSec <= 0 {
+		return nil
+	}
+	return &TxRateLimit{interval: time.Duration(float64(time.Second) / perSec)}
+}
+
+// Wait blocks until the next tx may be started or the context is cancelled.
+func (r *TxRateLimit) Wait(ctx context.Context) error {
+	if r == nil {
+		return ctx.Err()
+	}
+
+	// Reserve the next slot before waiting, so concurrent callers are spaced out rather than released together
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	slot := r.next
+	r.next = slot.Add(r.interval)
+	r.mu.Unlock()
+
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func TestTxRateLimit(t *testing.T) {
+	if NewTxRateLimit(0) != nil {
+		t.Error("a rate limit of 0 txs per second limits txs")
+	}
+	var unlimited *TxRateLimit
+	if err := unlimited.Wait(context.Background()); err != nil {
+		t.Errorf("Wait of an unlimited rate returned %v", err)
+	}
+
+	// Concurrent waits are spaced out by the interval rather than released together
+	limit := NewTxRateLimit(100)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for j := 0; j < 6; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limit.Wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("6 txs were started in %s at 100 txs per second, want at least 50ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewTxRateLimit(0.001).Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait returned %v after the context was cancelled, want %v", err, context.Canceled)
+	}
+}
+
+func TestForEachTxRateLimit(t *testing.T) {
+	i := newTestIndexer(t, nil)
+	i.ConcurrentTxs = 4
+	i.TxRateLimit = NewTxRateLimit(200)
+
+	start := time.Now()
+	var mu sync.Mutex
+	called := 0
+	err := i.ForEachTx(context.Background(), testBlock(1, 11), func(ctx context.Context, index int, tx tmtypes.Tx) error {
+		mu.Lock()
+		defer mu.Unlock()
+		called++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachTx returned unexpected error: %v", err)
+	}
+	if called != 11 {
+		t.Errorf("fn called for %d txs, want 11", called)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("11 txs were handled in %s at 200 txs per second, want at least 50ms", elapsed)
+	}
+}
+
+// BenchmarkForEachTxThroughput compares the tx throughput of the 100ms sleep the actions used to do for every tx
+// with the throughput without a rate limit, and with a limit of 1000 txs per second.
+func BenchmarkForEachTxThroughput(b *testing.B) {
+	const txCount = 10
+	block := testBlock(1, txCount)
+
+	benchmarks := []struct {
+		name  string
+		limit float64
+		sleep time.Duration
+	}{
+		{name: "sleep 100ms", sleep: 100 * time.Millisecond},
+		{name: "unlimited"},
+		{name: "limit 1000 per sec", limit: 1000},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			i := newTestIndexer(b, nil)
+			i.TxRateLimit = NewTxRateLimit(bm.limit)
+
+			b.ResetTimer()
+			start := time.Now()
+			for n := 0; n < b.N; n++ {
+				err := i.ForEachTx(context.Background(), block, func(ctx context.Context, index int, tx tmtypes.Tx) error {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-time.After(bm.sleep):
+						return nil
+					}
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*txCount)/time.Since(start).Seconds(), "txs/s")
+		})
+	}
+}
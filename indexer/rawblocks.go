@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jackc/pgtype"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RawBlock is the raw JSON of a block as returned by the RPC, only the RawBlockWindow most recent blocks of each chain
+// are kept. Blocks within the window are reprocessed from their stored JSON rather than queried again, e.g. when
+// recovering from a reorg or when retrying the block after one of its actions failed.
+type RawBlock struct {
+	ChainID   string       `gorm:"primaryKey"`
+	Height    int64        `gorm:"primaryKey;autoIncrement:false"`
+	Block     pgtype.JSONB `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// LoadRawBlock returns the stored block at height, or nil if the block isn't stored.
+func (i *Indexer) LoadRawBlock(height int64) (*coretypes.ResultBlock, error) {
+	var raw RawBlock
+	err := i.DB.Where(&RawBlock{ChainID: i.Client.Config.ChainID, Height: height}).First(&raw).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block := new(coretypes.ResultBlock)
+	if err := tmjson.Unmarshal(raw.Block.Bytes, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// SaveRawBlock stores the JSON of block and prunes the stored blocks of the chain that fell out of the window,
+// i.e. that are RawBlockWindow or more heights below the highest stored block.
+func (i *Indexer) SaveRawBlock(block *coretypes.ResultBlock) error {
+	bz, err := tmjson.Marshal(block)
+	if err != nil {
+		return err
+	}
+
+	chainID := i.Client.Config.ChainID
+	err = i.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "height"}},
+		DoUpdates: clause.AssignmentColumns([]string{"block", "created_at"}),
+	}).Create(&RawBlock{
+		ChainID: chainID,
+		Height:  block.Block.Height,
+		Block:   pgtype.JSONB{Bytes: bz, Status: pgtype.Present},
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	var highest []int64
+	err = i.DB.Model(&RawBlock{}).Where("chain_id = ?", chainID).Order("height desc").Limit(1).Pluck("height", &highest).Error
+	if err != nil || len(highest) == 0 {
+		return err
+	}
+	return i.DB.
+		Where("chain_id = ? AND height <= ?", chainID, highest[0]-i.RawBlockWindow).
+		Delete(&RawBlock{}).Error
+}
+
+// fetchStoredBlock returns the block at height from the raw blocks window, or nil if it isn't stored there.
+// Failures to load the block are logged, the block is then queried as usual.
+func (i *Indexer) fetchStoredBlock(height int64) *coretypes.ResultBlock {
+	if i.RawBlockWindow <= 0 {
+		return nil
+	}
+
+	block, err := i.LoadRawBlock(height)
+	if err != nil {
+		i.log.Warn(
+			"Failed to load stored raw block",
+			zap.String("chain_id", i.Client.Config.ChainID),
+			zap.Int64("height", height),
+			zap.Error(err),
+		)
+		return nil
+	}
+	return block
+}
+
+// storeRawBlock stores the block in the raw blocks window, if it's enabled. Failures are logged since the window
+// is only an optimization, the block is queried again if it's needed later.
+func (i *Indexer) storeRawBlock(block *coretypes.ResultBlock) {
+	if i.RawBlockWindow <= 0 {
+		return
+	}
+
+	if err := i.SaveRawBlock(block); err != nil {
+		i.log.Warn(
+			"Failed to store raw block",
+			zap.String("chain_id", i.Client.Config.ChainID),
+			zap.Int64("height", block.Block.Height),
+			zap.Error(err),
+		)
+	}
+}
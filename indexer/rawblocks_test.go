@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSaveRawBlockPrunesWindow(t *testing.T) {
+	node := newFakeNode(1, nil)
+	i := newTestIndexer(t, node)
+	i.RawBlockWindow = 3
+
+	for h := int64(1); h <= 6; h++ {
+		if err := i.SaveRawBlock(node.block(h)); err != nil {
+			t.Fatalf("SaveRawBlock(%d) returned unexpected error: %v", h, err)
+		}
+	}
+	// Storing a block again doesn't grow the window
+	if err := i.SaveRawBlock(node.block(6)); err != nil {
+		t.Fatal(err)
+	}
+
+	var heights []int64
+	if err := i.DB.Model(&RawBlock{}).Order("height").Pluck("height", &heights).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(heights, []int64{4, 5, 6}) {
+		t.Errorf("stored heights = %v, want the 3 most recent [4 5 6]", heights)
+	}
+
+	block, err := i.LoadRawBlock(5)
+	if err != nil {
+		t.Fatalf("LoadRawBlock returned unexpected error: %v", err)
+	}
+	if block == nil || block.Block.Height != 5 || len(block.Block.Txs) != 1 {
+		t.Errorf("loaded block %v, want the block at height 5", block)
+	}
+	if block, err := i.LoadRawBlock(2); err != nil || block != nil {
+		t.Errorf("LoadRawBlock of a pruned block returned %v, %v, want nil", block, err)
+	}
+}
+
+func TestForEachBlockRawBlockWindow(t *testing.T) {
+	node := newFakeNode(0, nil)
+	i := newTestIndexer(t, node)
+	i.RawBlockWindow = 2
+
+	action := &recordingAction{}
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []BlockAction{action}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	// Blocks within the window are reprocessed from their stored JSON, older blocks are queried again
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []BlockAction{action}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	want := map[int64]int{1: 2, 2: 1, 3: 1}
+	for h, queries := range want {
+		if node.queries[h] != queries {
+			t.Errorf("height %d queried %d times, want %d", h, node.queries[h], queries)
+		}
+	}
+	if got := action.executed(); !reflect.DeepEqual(got, []int64{1, 1, 2, 2, 3, 3}) {
+		t.Errorf("executed heights = %v, want each height twice", got)
+	}
+}
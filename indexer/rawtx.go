@@ -0,0 +1,49 @@
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"go.uber.org/zap"
+)
+
+// RawTxDumpPath returns the path the raw bytes of the tx at index of the block at height are written to
+// when it fails to decode, see RawTxDumpDir.
+func RawTxDumpPath(dir, chainID string, height int64, index int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_%d_%d.tx", chainID, height, index))
+}
+
+// dumpUndecodedTxs writes the raw bytes of the txs of the block that failed to decode to the RawTxDumpDir,
+// so they can be inspected offline to find the module missing from the codec. It's a no-op without a RawTxDumpDir.
+func (i *Indexer) dumpUndecodedTxs(block *coretypes.ResultBlock) {
+	if i.RawTxDumpDir == "" {
+		return
+	}
+
+	for index, tx := range block.Block.Data.Txs {
+		cached, ok := i.decoded.Load(string(tx.Hash()))
+		if !ok || cached.(decodedTx).err == nil {
+			continue
+		}
+
+		path := RawTxDumpPath(i.RawTxDumpDir, i.Client.Config.ChainID, block.Block.Height, index)
+		if err := os.WriteFile(path, tx, 0o644); err != nil {
+			i.log.Warn(
+				"Failed to dump raw tx",
+				zap.Int64("height", block.Block.Height),
+				zap.Int("tx_index", index),
+				zap.String("path", path),
+				zap.Error(err),
+			)
+			continue
+		}
+		i.log.Debug(
+			"Dumped raw tx that failed to decode",
+			zap.Int64("height", block.Block.Height),
+			zap.Int("tx_index", index),
+			zap.String("path", path),
+		)
+	}
+}
@@ -0,0 +1,62 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/strangelove-ventures/valis/internal/rpctest"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// skippingAction decodes every tx of the block, skipping the txs that fail to decode like the actions do.
+type skippingAction struct {
+	recordingAction
+}
+
+func (a *skippingAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	return i.ForEachTx(ctx, block, func(ctx context.Context, index int, tx tmtypes.Tx) error {
+		_, _ = i.DecodeTx(tx)
+		return nil
+	})
+}
+
+func TestDumpUndecodedTxs(t *testing.T) {
+	i, _, send, transfer := newDecodingIndexer(t)
+	node := rpctest.New("cosmoshub-4")
+	i.Client.RPCClient = node
+	i.RawTxDumpDir = t.TempDir()
+
+	undecodable := []byte("not a tx of any known module")
+	results := []*abcitypes.ResponseDeliverTx{{}, {}, {}}
+	node.AddBlock(7, time.Now(), [][]byte{send, undecodable, transfer}, results)
+
+	if err := i.ForEachBlock(context.Background(), []int64{7}, []BlockAction{&skippingAction{}}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	path := RawTxDumpPath(i.RawTxDumpDir, "cosmoshub-4", 7, 1)
+	if filepath.Base(path) != "cosmoshub-4_7_1.tx" {
+		t.Errorf("dump path = %s, want it named by chain id, height and tx index", path)
+	}
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("undecodable tx wasn't dumped: %v", err)
+	}
+	if !bytes.Equal(bz, undecodable) {
+		t.Errorf("dumped %q, want the raw bytes of the tx %q", bz, undecodable)
+	}
+
+	entries, err := os.ReadDir(i.RawTxDumpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("dumped %d txs, want only the undecodable one", len(entries))
+	}
+}
@@ -0,0 +1,48 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reconciler can be implemented by a BlockAction whose indexed state may drift from the chain's state over long runs,
+// e.g. balances derived from events. Reconcile compares the indexed state against the chain and corrects it.
+type Reconciler interface {
+	Reconcile(ctx context.Context, indexer *Indexer) error
+}
+
+// ReconcileEvery runs Reconcile every interval until ctx is done.
+func (i *Indexer) ReconcileEvery(ctx context.Context, actions []BlockAction, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.Reconcile(ctx, actions)
+		}
+	}
+}
+
+// Reconcile reconciles the state of every action implementing Reconciler. Failures are logged rather than
+// returned, the state is reconciled again on the next run.
+func (i *Indexer) Reconcile(ctx context.Context, actions []BlockAction) {
+	for _, a := range actions {
+		r, ok := a.(Reconciler)
+		if !ok {
+			continue
+		}
+		if err := r.Reconcile(ctx, i); err != nil && ctx.Err() == nil {
+			i.log.Warn(
+				"Failed to reconcile block action state",
+				zap.String("chain_id", i.Client.Config.ChainID),
+				zap.String("block_action_name", a.Name()),
+				zap.Error(err),
+			)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// LoadBlockFile reads a block saved as JSON, either the result of the /block RPC endpoint or the full JSON-RPC
+// response containing it, e.g. as saved with curl.
+func LoadBlockFile(path string) (*coretypes.ResultBlock, error) {
+	block := new(coretypes.ResultBlock)
+	if err := loadRPCResultFile(path, block); err != nil {
+		return nil, err
+	}
+	if block.Block == nil {
+		return nil, fmt.Errorf("file %s does not contain a block", path)
+	}
+	return block, nil
+}
+
+// LoadBlockResultsFile reads block results saved as JSON, either the result of the /block_results RPC endpoint
+// or the full JSON-RPC response containing it.
+func LoadBlockResultsFile(path string) (*coretypes.ResultBlockResults, error) {
+	results := new(coretypes.ResultBlockResults)
+	if err := loadRPCResultFile(path, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// loadRPCResultFile unmarshals the JSON file at path into result, unwrapping the JSON-RPC response if there is one.
+func loadRPCResultFile(path string, result interface{}) error {
+	bz, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(bz, &response); err == nil && len(response.Result) > 0 {
+		bz = response.Result
+	}
+
+	if err := tmjson.Unmarshal(bz, result); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// ReplayBlock executes the actions for a block loaded from a file rather than queried, see LoadBlockFile.
+// If results is nil the tx results are queried from the chain as usual, otherwise they and the end block events
+// are taken from results.
+// Unlike ForEachBlock the block isn't retried nor recorded as failed, the first failing action is returned.
+func (i *Indexer) ReplayBlock(ctx context.Context, block *coretypes.ResultBlock, results *coretypes.ResultBlockResults, actions []BlockAction) error {
+	if block.Block.ChainID != i.Client.Config.ChainID {
+		return fmt.Errorf("block is from chain %s, not %s", block.Block.ChainID, i.Client.Config.ChainID)
+	}
+
+	if results != nil {
+		if len(results.TxsResults) != len(block.Block.Data.Txs) {
+			return fmt.Errorf("block results contain %d tx results but the block contains %d txs", len(results.TxsResults), len(block.Block.Data.Txs))
+		}
+		i.txResults.put(block.Block.Height, blockTxResults(block, results), 1)
+		i.txResults.putEndBlockEvents(block.Block.Height, results.EndBlockEvents, 1)
+		defer i.txResults.remove(block.Block.Height)
+	}
+
+	i.msgTypes = msgTypesFilter(actions)
+	defer i.forgetDecodedTxs(block)
+	defer i.FlushBatches()
+
+	for _, a := range actions {
+		if err := i.ExecuteAction(ctx, a, block); err != nil {
+			return fmt.Errorf("block action %s: %w", a.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// codesAction records the result codes of the txs of the blocks it's executed for.
+type codesAction struct {
+	codes []uint32
+}
+
+func (a *codesAction) Name() string { return "codes" }
+
+func (a *codesAction) MigrateSchema(i *Indexer) error { return nil }
+
+func (a *codesAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	results, err := i.TxResults(ctx, block)
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		a.codes = append(a.codes, res.TxResult.Code)
+	}
+	return nil
+}
+
+// saveRPCResult saves result as JSON to a file in dir, wrapped in a JSON-RPC response if wrap is set.
+func saveRPCResult(t *testing.T, dir, name string, result interface{}, wrap bool) string {
+	t.Helper()
+	bz, err := tmjson.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap {
+		bz = []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":-1,"result":%s}`, bz))
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, bz, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplayBlock(t *testing.T) {
+	dir := t.TempDir()
+	saved := testBlock(42, 2)
+	results := &coretypes.ResultBlockResults{Height: 42, TxsResults: []*abcitypes.ResponseDeliverTx{{Code: 0}, {Code: 5}}}
+
+	for _, wrap := range []bool{false, true} {
+		block, err := LoadBlockFile(saveRPCResult(t, dir, "block.json", saved, wrap))
+		if err != nil {
+			t.Fatalf("LoadBlockFile returned unexpected error: %v", err)
+		}
+		if block.Block.Height != 42 || len(block.Block.Data.Txs) != 2 {
+			t.Fatalf("loaded block %d with %d txs, want block 42 with 2 txs", block.Block.Height, len(block.Block.Data.Txs))
+		}
+		loadedResults, err := LoadBlockResultsFile(saveRPCResult(t, dir, "block_results.json", results, wrap))
+		if err != nil {
+			t.Fatalf("LoadBlockResultsFile returned unexpected error: %v", err)
+		}
+
+		// The tx results are taken from the saved results rather than queried, the node has no blocks
+		i := newTestIndexer(t, newFakeNode(0, nil))
+		action := &codesAction{}
+		if err := i.ReplayBlock(context.Background(), block, loadedResults, []BlockAction{action}); err != nil {
+			t.Fatalf("ReplayBlock returned unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(action.codes, []uint32{0, 5}) {
+			t.Errorf("got tx result codes %v, want [0 5]", action.codes)
+		}
+		if height, ok, err := i.ResumeHeight([]BlockAction{action}); err != nil || !ok || height != 43 {
+			t.Errorf("got resume height %d, %t, %v, want the checkpoint of the replayed block", height, ok, err)
+		}
+	}
+
+	i := newTestIndexer(t, nil)
+	if err := i.ReplayBlock(context.Background(), saved, &coretypes.ResultBlockResults{}, nil); err == nil || !strings.Contains(err.Error(), "0 tx results") {
+		t.Errorf("got error %v for mismatched block results", err)
+	}
+	i.Client.Config.ChainID = "osmosis-1"
+	if err := i.ReplayBlock(context.Background(), saved, nil, nil); err == nil {
+		t.Error("expected an error replaying a block of another chain")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "empty.json"), []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBlockFile(filepath.Join(dir, "empty.json")); err == nil {
+		t.Error("expected an error loading a file without a block")
+	}
+}
@@ -0,0 +1,141 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// rowCountCallback is the name of the gorm callback counting the rows created by the block actions.
+const rowCountCallback = "valis:count_rows"
+
+// RowCounts is the number of rows each block action created per table.
+type RowCounts struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int64
+}
+
+// Add records that the named action created n rows in table.
+func (c *RowCounts) Add(actionName, table string, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[string]map[string]int64)
+	}
+	if c.counts[actionName] == nil {
+		c.counts[actionName] = make(map[string]int64)
+	}
+	c.counts[actionName][table] += n
+}
+
+// merge adds the counts of other to c.
+func (c *RowCounts) merge(other *RowCounts) {
+	for actionName, tables := range other.Snapshot() {
+		for table, n := range tables {
+			c.Add(actionName, table, n)
+		}
+	}
+}
+
+// Snapshot returns a copy of the counts, keyed by action name and then by table.
+func (c *RowCounts) Snapshot() map[string]map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make(map[string]map[string]int64, len(c.counts))
+	for actionName, tables := range c.counts {
+		snapshot[actionName] = make(map[string]int64, len(tables))
+		for table, n := range tables {
+			snapshot[actionName][table] = n
+		}
+	}
+	return snapshot
+}
+
+// String summarizes the counts sorted by action and table, e.g. "ics20_transfers: 10,234 txs, 8,102 msg_transfers".
+func (c *RowCounts) String() string {
+	snapshot := c.Snapshot()
+
+	actionNames := make([]string, 0, len(snapshot))
+	for actionName := range snapshot {
+		actionNames = append(actionNames, actionName)
+	}
+	sort.Strings(actionNames)
+
+	summaries := make([]string, 0, len(actionNames))
+	for _, actionName := range actionNames {
+		tables := make([]string, 0, len(snapshot[actionName]))
+		for table := range snapshot[actionName] {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+
+		counts := make([]string, len(tables))
+		for j, table := range tables {
+			counts[j] = fmt.Sprintf("%s %s", formatCount(snapshot[actionName][table]), table)
+		}
+		summaries = append(summaries, fmt.Sprintf("%s: %s", actionName, strings.Join(counts, ", ")))
+	}
+	return strings.Join(summaries, "; ")
+}
+
+// formatCount formats n with thousands separators.
+func formatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	for j := len(s) - 3; j > 0; j -= 3 {
+		s = s[:j] + "," + s[j:]
+	}
+	return s
+}
+
+// rowCountScopeKey is the context key of the rowCountScope of a statement.
+type rowCountScopeKey struct{}
+
+// rowCountScope is where the rows created by a statement are counted, and for which chain and action.
+type rowCountScope struct {
+	chainID    string
+	actionName string
+	counts     *RowCounts
+}
+
+// withRowCounts returns a copy of the Indexer whose DB counts the rows it creates for the named action in counts.
+func (i *Indexer) withRowCounts(counts *RowCounts, actionName string) *Indexer {
+	countingIndexer := *i
+	ctx := context.WithValue(i.DB.Statement.Context, rowCountScopeKey{}, rowCountScope{
+		chainID:    i.Client.Config.ChainID,
+		actionName: actionName,
+		counts:     counts,
+	})
+	countingIndexer.DB = i.DB.WithContext(ctx)
+	return &countingIndexer
+}
+
+// RowCounts returns the number of rows each block action created per table so far.
+func (i *Indexer) RowCounts() map[string]map[string]int64 {
+	return i.rowCounts.Snapshot()
+}
+
+// UseRowCounts registers a gorm callback counting the rows created through db by the block actions, see
+// (*Indexer).RowCounts. Since callbacks are shared by every session of db, this should be called once after connecting.
+func UseRowCounts(db *gorm.DB) error {
+	return db.Callback().Create().After("gorm:create").Register(rowCountCallback, func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || tx.RowsAffected == 0 || isIndexerModel(tx.Statement.Schema) {
+			return
+		}
+		scope, ok := tx.Statement.Context.Value(rowCountScopeKey{}).(rowCountScope)
+		if !ok {
+			return
+		}
+		scope.counts.Add(scope.actionName, tx.Statement.Table, tx.RowsAffected)
+	})
+}
@@ -0,0 +1,119 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// batchingAction creates two rows in a single statement for every block.
+type batchingAction struct{}
+
+func (a *batchingAction) Name() string { return "batching" }
+
+func (a *batchingAction) MigrateSchema(i *Indexer) error { return nil }
+
+func (a *batchingAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	height := block.Block.Height
+	return i.DB.Create(&[]batchRow{{Height: height}, {Height: height}}).Error
+}
+
+func TestRowCounts(t *testing.T) {
+	i := newTestIndexer(t, newFakeNode(0, nil))
+	db, rec := dbtest.New(t)
+	i.DB = db
+	if err := UseRowCounts(db); err != nil {
+		t.Fatalf("UseRowCounts returned unexpected error: %v", err)
+	}
+
+	actions := []BlockAction{&writingAction{}, &batchingAction{}}
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, actions, 2); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	// The checkpoints written for each block aren't counted
+	expected := map[string]map[string]int64{
+		"writing":  {"transfer_rows": int64(len(rec.Rows("transfer_rows")))},
+		"batching": {"batch_rows": int64(len(rec.Rows("batch_rows")))},
+	}
+	if expected["writing"]["transfer_rows"] != 3 || expected["batching"]["batch_rows"] != 6 {
+		t.Fatalf("got %d transfer rows and %d batch rows, want 3 and 6", len(rec.Rows("transfer_rows")), len(rec.Rows("batch_rows")))
+	}
+	if got := i.RowCounts(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got row counts %v, expected %v", got, expected)
+	}
+}
+
+func TestRowCountsBlockTransactions(t *testing.T) {
+	i := newTestIndexer(t, nil)
+	db, rec := dbtest.New(t)
+	i.DB = db
+	i.BlockTransactions = true
+	if err := UseRowCounts(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.ExecuteAction(context.Background(), &writingAction{}, testBlock(1, 0)); err != nil {
+		t.Fatalf("ExecuteAction returned unexpected error: %v", err)
+	}
+	// The rows of a rolled back block aren't counted
+	failed := errors.New("failed")
+	if err := i.ExecuteAction(context.Background(), &writingAction{err: failed}, testBlock(2, 0)); !errors.Is(err, failed) {
+		t.Fatalf("ExecuteAction returned %v, want %v", err, failed)
+	}
+
+	if rows := rec.Rows("transfer_rows"); len(rows) != 1 {
+		t.Fatalf("got %d rows, want the row of the committed block", len(rows))
+	}
+	expected := map[string]map[string]int64{"writing": {"transfer_rows": 1}}
+	if got := i.RowCounts(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got row counts %v, expected %v", got, expected)
+	}
+}
+
+func TestRowCountsBatching(t *testing.T) {
+	i := newTestIndexer(t, newFakeNode(0, nil))
+	db, rec := dbtest.New(t)
+	i.DB = db
+	if err := UseRowCounts(db); err != nil {
+		t.Fatal(err)
+	}
+	i.UseBatching(map[string]BatchConfig{"writing": {Size: 100}})
+	if i.Batcher("batching") != nil {
+		t.Error("got a Batcher for an action without batching configured")
+	}
+
+	if err := i.ForEachBlock(context.Background(), []int64{1, 2, 3}, []BlockAction{&writingAction{}}, 2); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	// The rows are flushed after their blocks are done, they're still counted for the action
+	if rows := rec.Rows("transfer_rows"); len(rows) != 3 {
+		t.Fatalf("got %d rows, want a row per block", len(rows))
+	}
+	expected := map[string]map[string]int64{"writing": {"transfer_rows": 3}}
+	if got := i.RowCounts(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got row counts %v, expected %v", got, expected)
+	}
+}
+
+func TestRowCountsString(t *testing.T) {
+	var counts RowCounts
+	counts.Add("ics20_transfers", "msg_transfers", 10234)
+	counts.Add("ics20_transfers", "msg_recv_packets", 8102)
+	counts.Add("bank", "bank_sends", 55000)
+	counts.Add("bank", "bank_sends", 1000000)
+	counts.Add("bank", "bank_multi_sends", 0)
+
+	expected := "bank: 1,055,000 bank_sends; ics20_transfers: 8,102 msg_recv_packets, 10,234 msg_transfers"
+	if got := counts.String(); got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+	if got := (&RowCounts{}).String(); got != "" {
+		t.Errorf("got %q for no rows, expected an empty summary", got)
+	}
+}
@@ -0,0 +1,42 @@
+package indexer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"reflect"
+)
+
+// NewRunID returns a random id identifying a single run of the indexer, it's recorded on the ChainRun of every chain
+// indexed by the run and, when stamped with RunIDTransformer, on the rows written by the run.
+func NewRunID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RunIDTransformer returns a RowTransformer stamping runID on the rows of the models declaring a RunID field,
+// either a string or a *string, so the rows written by a specific run can be identified and rolled back.
+// Rows of models without the field are left untouched.
+func RunIDTransformer(runID string) RowTransformer {
+	return RowTransformerFunc(func(row interface{}) error {
+		v := reflect.Indirect(reflect.ValueOf(row))
+		if v.Kind() != reflect.Struct {
+			return nil
+		}
+
+		field := v.FieldByName("RunID")
+		if !field.IsValid() || !field.CanSet() {
+			return nil
+		}
+		switch {
+		case field.Kind() == reflect.String:
+			field.SetString(runID)
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.String:
+			id := runID
+			field.Set(reflect.ValueOf(&id))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+)
+
+func TestNewRunID(t *testing.T) {
+	a, err := NewRunID()
+	if err != nil {
+		t.Fatalf("NewRunID returned unexpected error: %v", err)
+	}
+	b, err := NewRunID()
+	if err != nil {
+		t.Fatalf("NewRunID returned unexpected error: %v", err)
+	}
+	if bz, err := hex.DecodeString(a); err != nil || len(bz) != 16 {
+		t.Errorf("got run id %q, want 16 hex encoded bytes", a)
+	}
+	if a == b {
+		t.Errorf("got the same run id %s twice", a)
+	}
+}
+
+type stampedRow struct {
+	ID    uint `gorm:"primaryKey"`
+	RunID string
+}
+
+type optionalStampedRow struct {
+	ID    uint `gorm:"primaryKey"`
+	RunID *string
+}
+
+func TestRunIDTransformer(t *testing.T) {
+	db, rec := dbtest.New(t)
+	if err := UseRowTransformer(db, RunIDTransformer("5f0c6e1b")); err != nil {
+		t.Fatalf("UseRowTransformer returned unexpected error: %v", err)
+	}
+
+	for _, row := range []interface{}{&stampedRow{}, &optionalStampedRow{}, &transferRow{Denom: "uatom", Amount: "1"}} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("failed to create %T: %v", row, err)
+		}
+	}
+
+	if rows := rec.Rows("stamped_rows"); len(rows) != 1 || rows[0].(*stampedRow).RunID != "5f0c6e1b" {
+		t.Errorf("got rows %+v, want the row stamped with the run id", rows)
+	}
+	if rows := rec.Rows("optional_stamped_rows"); len(rows) != 1 || rows[0].(*optionalStampedRow).RunID == nil ||
+		*rows[0].(*optionalStampedRow).RunID != "5f0c6e1b" {
+		t.Errorf("got rows %+v, want the row stamped with the run id", rows)
+	}
+	if rows := rec.Rows("transfer_rows"); len(rows) != 1 || rows[0].(*transferRow).Denom != "uatom" {
+		t.Errorf("got rows %+v, want the row without a run id untouched", rows)
+	}
+}
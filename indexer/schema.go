@@ -0,0 +1,95 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SchemaDDL returns the CREATE statements gorm would execute to create the tables of the specified actions,
+// along with the indexer's own tables when indexerModels is true. The migrations are run against a dry run
+// session, so nothing is executed and the statements are generated as if none of the tables existed yet.
+func SchemaDDL(log *zap.Logger, actions []BlockAction, indexerModels bool) ([]string, error) {
+	db, err := NewDryRunDatabase()
+	if err != nil {
+		return nil, err
+	}
+	recorder := &ddlRecorder{}
+	i := NewMigrationIndexer(log, db.Session(&gorm.Session{Logger: recorder}))
+
+	if indexerModels {
+		if err := i.MigrateSchema(); err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range actions {
+		if err := a.MigrateSchema(i); err != nil && !errors.Is(err, ErrNoMigrations) {
+			return nil, fmt.Errorf("failed to generate schema for block action %s: %w", a.Name(), err)
+		}
+	}
+	return recorder.statements, nil
+}
+
+// createTableRegexp matches the name of the table created by a CREATE TABLE statement.
+var createTableRegexp = regexp.MustCompile(`(?i)^CREATE TABLE "?([^"\s(]+)"?`)
+
+// CheckSharedTables returns an error if the migrations of more than one of the actions create the same table.
+// Rows are keyed by (chain_id, tx_hash, msg_index), so two actions writing the same msg to a shared table would
+// conflict, e.g. when a json_msgs handler is configured with the table of a typed action.
+func CheckSharedTables(log *zap.Logger, actions []BlockAction) error {
+	owners := make(map[string]string)
+	for _, a := range actions {
+		statements, err := SchemaDDL(log, []BlockAction{a}, false)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range statements {
+			m := createTableRegexp.FindStringSubmatch(stmt)
+			if m == nil {
+				continue
+			}
+			table := m[1]
+			if owner, ok := owners[table]; ok && owner != a.Name() {
+				return fmt.Errorf("block actions %s and %s both write to table %s", owner, a.Name(), table)
+			}
+			owners[table] = a.Name()
+		}
+	}
+	return nil
+}
+
+// ddlRecorder is a gorm logger recording the CREATE statements traced by a dry run session,
+// the queries checking for existing tables and columns are ignored.
+type ddlRecorder struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (r *ddlRecorder) LogMode(logger.LogLevel) logger.Interface {
+	return r
+}
+
+func (r *ddlRecorder) Info(context.Context, string, ...interface{}) {}
+
+func (r *ddlRecorder) Warn(context.Context, string, ...interface{}) {}
+
+func (r *ddlRecorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *ddlRecorder) Trace(_ context.Context, _ time.Time, fc func() (sql string, rowsAffected int64), _ error) {
+	sql, _ := fc()
+	if !strings.HasPrefix(strings.ToUpper(sql), "CREATE ") {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, sql)
+}
@@ -0,0 +1,25 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCheckSharedTables(t *testing.T) {
+	var migrated []string
+	transfers := &migratingAction{name: "transfers", models: []interface{}{&transferRow{}}, migrated: &migrated}
+	batches := &migratingAction{name: "batches", models: []interface{}{&batchRow{}}, migrated: &migrated}
+	stats := &migratingAction{name: "stats", err: ErrNoMigrations, migrated: &migrated}
+
+	if err := CheckSharedTables(zap.NewNop(), []BlockAction{transfers, batches, stats}); err != nil {
+		t.Errorf("CheckSharedTables returned %v for actions writing to their own tables", err)
+	}
+
+	overlapping := &migratingAction{name: "json_transfers", models: []interface{}{&transferRow{}, &batchRow{}}, migrated: &migrated}
+	err := CheckSharedTables(zap.NewNop(), []BlockAction{transfers, overlapping})
+	if err == nil || !strings.Contains(err.Error(), "transfer_rows") {
+		t.Errorf("CheckSharedTables returned %v for actions sharing transfer_rows, want an error naming the table", err)
+	}
+}
@@ -0,0 +1,139 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// IndexerSchemaName is the name the schema version of the indexer's own models is recorded under, see SchemaVersion.
+const IndexerSchemaName = "indexer"
+
+// IndexerSchemaVersion is the version of the indexer's own models, it must be bumped along with changes to them.
+const IndexerSchemaVersion = 1
+
+// DefaultSchemaVersion is the schema version of the actions that don't implement SchemaVersioner.
+const DefaultSchemaVersion = 1
+
+// SchemaVersioner can optionally be implemented by a BlockAction to declare the version of its models. Actions must
+// bump their version along with changes to their models, so a database that wasn't migrated since is detected.
+type SchemaVersioner interface {
+	SchemaVersion() int
+}
+
+// SchemaVersion records the version of the schema of the indexer or of a block action the database was last
+// migrated to, Name is either IndexerSchemaName or the name of the action.
+type SchemaVersion struct {
+	Name       string    `gorm:"primaryKey"`
+	Version    int       `gorm:"not null"`
+	MigratedAt time.Time `gorm:"not null"`
+}
+
+// TableName overrides the pluralized table name gorm would use by default.
+func (SchemaVersion) TableName() string {
+	return "valis_schema_versions"
+}
+
+// SchemaMismatch is a schema whose version in the database differs from the version expected by the code.
+// Migrated is zero for schemas that were never recorded as migrated.
+type SchemaMismatch struct {
+	Name     string
+	Expected int
+	Migrated int
+}
+
+// OutdatedSchemaError is returned by CheckSchemaVersions when the database was migrated to an older version of some
+// of the schemas than the code expects, i.e. the schema migrations need to be run before indexing.
+type OutdatedSchemaError struct {
+	Outdated []SchemaMismatch
+}
+
+func (e *OutdatedSchemaError) Error() string {
+	schemas := make([]string, len(e.Outdated))
+	for j, m := range e.Outdated {
+		if m.Migrated == 0 {
+			schemas[j] = fmt.Sprintf("%s (not migrated, expected version %d)", m.Name, m.Expected)
+			continue
+		}
+		schemas[j] = fmt.Sprintf("%s (version %d, expected %d)", m.Name, m.Migrated, m.Expected)
+	}
+	return fmt.Sprintf("database schema is outdated for %s", strings.Join(schemas, ", "))
+}
+
+// actionSchemaVersion returns the schema version declared by the action, or DefaultSchemaVersion if it declares none.
+func actionSchemaVersion(a BlockAction) int {
+	if v, ok := a.(SchemaVersioner); ok {
+		return v.SchemaVersion()
+	}
+	return DefaultSchemaVersion
+}
+
+// expectedSchemaVersions returns the schema versions of the indexer and of each action, keyed by schema name.
+func expectedSchemaVersions(actions []BlockAction) map[string]int {
+	expected := map[string]int{IndexerSchemaName: IndexerSchemaVersion}
+	for _, a := range actions {
+		expected[a.Name()] = actionSchemaVersion(a)
+	}
+	return expected
+}
+
+// saveSchemaVersion records that the named schema was migrated to version.
+func (i *Indexer) saveSchemaVersion(name string, version int) error {
+	return i.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"version", "migrated_at"}),
+	}).Create(&SchemaVersion{Name: name, Version: version, MigratedAt: time.Now().UTC()}).Error
+}
+
+// CheckSchemaVersions compares the schema versions the database was migrated to against those of the indexer and of
+// the specified actions. An *OutdatedSchemaError is returned if any schema is older than expected or was never
+// recorded as migrated. Schemas newer than expected, i.e. migrated by a newer binary, are only logged.
+func (i *Indexer) CheckSchemaVersions(actions []BlockAction) error {
+	var migrated []SchemaVersion
+	if i.DB.Migrator().HasTable(&SchemaVersion{}) {
+		if err := i.DB.Find(&migrated).Error; err != nil {
+			return fmt.Errorf("failed to load schema versions: %w", err)
+		}
+	}
+
+	outdated, newer := compareSchemaVersions(expectedSchemaVersions(actions), migrated)
+	for _, m := range newer {
+		i.log.Warn(
+			"Database schema was migrated by a newer version of the indexer",
+			zap.String("schema", m.Name),
+			zap.Int("expected_version", m.Expected),
+			zap.Int("migrated_version", m.Migrated),
+		)
+	}
+	if len(outdated) > 0 {
+		return &OutdatedSchemaError{Outdated: outdated}
+	}
+	return nil
+}
+
+// compareSchemaVersions returns the expected schemas whose migrated version is older, or missing, and those whose
+// migrated version is newer, both sorted by name. Migrated schemas that aren't expected are ignored.
+func compareSchemaVersions(expected map[string]int, migrated []SchemaVersion) (outdated, newer []SchemaMismatch) {
+	versions := make(map[string]int, len(migrated))
+	for _, v := range migrated {
+		versions[v.Name] = v.Version
+	}
+
+	for name, version := range expected {
+		m := SchemaMismatch{Name: name, Expected: version, Migrated: versions[name]}
+		switch {
+		case m.Migrated < m.Expected:
+			outdated = append(outdated, m)
+		case m.Migrated > m.Expected:
+			newer = append(newer, m)
+		}
+	}
+
+	sort.Slice(outdated, func(a, b int) bool { return outdated[a].Name < outdated[b].Name })
+	sort.Slice(newer, func(a, b int) bool { return newer[a].Name < newer[b].Name })
+	return outdated, newer
+}
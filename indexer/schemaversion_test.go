@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompareSchemaVersions(t *testing.T) {
+	tests := []struct {
+		name         string
+		expected     map[string]int
+		migrated     []SchemaVersion
+		wantOutdated []SchemaMismatch
+		wantNewer    []SchemaMismatch
+	}{
+		{
+			name:     "up to date",
+			expected: map[string]int{"indexer": 1, "bank_transfers": 2},
+			migrated: []SchemaVersion{{Name: "indexer", Version: 1}, {Name: "bank_transfers", Version: 2}},
+		},
+		{
+			name:     "never migrated",
+			expected: map[string]int{"indexer": 1, "bank_transfers": 1},
+			wantOutdated: []SchemaMismatch{
+				{Name: "bank_transfers", Expected: 1},
+				{Name: "indexer", Expected: 1},
+			},
+		},
+		{
+			name:     "older and newer",
+			expected: map[string]int{"indexer": 1, "ics20_transfers": 2, "gov": 1},
+			migrated: []SchemaVersion{{Name: "indexer", Version: 1}, {Name: "ics20_transfers", Version: 1}, {Name: "gov", Version: 3}},
+			wantOutdated: []SchemaMismatch{
+				{Name: "ics20_transfers", Expected: 2, Migrated: 1},
+			},
+			wantNewer: []SchemaMismatch{
+				{Name: "gov", Expected: 1, Migrated: 3},
+			},
+		},
+		{
+			name:     "unexpected schemas are ignored",
+			expected: map[string]int{"indexer": 1},
+			migrated: []SchemaVersion{{Name: "indexer", Version: 1}, {Name: "daodao", Version: 7}},
+		},
+	}
+	for _, tt := range tests {
+		outdated, newer := compareSchemaVersions(tt.expected, tt.migrated)
+		if !reflect.DeepEqual(outdated, tt.wantOutdated) {
+			t.Errorf("%s: outdated = %+v, want %+v", tt.name, outdated, tt.wantOutdated)
+		}
+		if !reflect.DeepEqual(newer, tt.wantNewer) {
+			t.Errorf("%s: newer = %+v, want %+v", tt.name, newer, tt.wantNewer)
+		}
+	}
+}
+
+// versionedAction is a recordingAction declaring a schema version.
+type versionedAction struct {
+	recordingAction
+	version int
+}
+
+func (a *versionedAction) SchemaVersion() int { return a.version }
+
+func TestCheckSchemaVersions(t *testing.T) {
+	i := newTestIndexer(t, nil)
+
+	err := i.CheckSchemaVersions([]BlockAction{&recordingAction{}})
+	var outdated *OutdatedSchemaError
+	if !errors.As(err, &outdated) || len(outdated.Outdated) != 2 {
+		t.Fatalf("CheckSchemaVersions returned %v before any migration, want both schemas outdated", err)
+	}
+
+	if err := i.MigrateSchemas([]BlockAction{&recordingAction{}}); err != nil {
+		t.Fatalf("MigrateSchemas returned unexpected error: %v", err)
+	}
+	if err := i.CheckSchemaVersions([]BlockAction{&recordingAction{}}); err != nil {
+		t.Errorf("CheckSchemaVersions returned %v after migrating, want nil", err)
+	}
+
+	// A binary expecting a newer schema of the action refuses to start until it's migrated
+	err = i.CheckSchemaVersions([]BlockAction{&versionedAction{version: 2}})
+	want := []SchemaMismatch{{Name: "recording", Expected: 2, Migrated: DefaultSchemaVersion}}
+	if !errors.As(err, &outdated) || !reflect.DeepEqual(outdated.Outdated, want) {
+		t.Errorf("CheckSchemaVersions returned %v, want %+v outdated", err, want)
+	}
+
+	// An older binary only logs the newer schema
+	if err := i.MigrateSchemas([]BlockAction{&versionedAction{version: 2}}); err != nil {
+		t.Fatalf("MigrateSchemas returned unexpected error: %v", err)
+	}
+	if err := i.CheckSchemaVersions([]BlockAction{&recordingAction{}}); err != nil {
+		t.Errorf("CheckSchemaVersions returned %v for a newer schema, want nil", err)
+	}
+}
@@ -0,0 +1,160 @@
+package indexer
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Sink receives every row written to the database by the block actions, allowing the indexed data to be
+// fanned out to additional outputs (e.g. a JSONL file) while Postgres remains the primary store.
+type Sink interface {
+	Name() string
+	Write(table string, row map[string]interface{}) error
+	Close() error
+}
+
+// SinkPolicy determines how a failure to write a row to one of the sinks is handled.
+type SinkPolicy string
+
+const (
+	// SinkPolicyFailFast fails the database write, rolling it back, when any sink fails to write the row.
+	SinkPolicyFailFast SinkPolicy = "fail-fast"
+
+	// SinkPolicyBestEffort logs sink failures and keeps writing the row to the remaining sinks and the database.
+	SinkPolicyBestEffort SinkPolicy = "best-effort"
+)
+
+// ParseSinkPolicy returns the SinkPolicy represented by s, an empty string defaults to SinkPolicyBestEffort.
+func ParseSinkPolicy(s string) (SinkPolicy, error) {
+	switch SinkPolicy(s) {
+	case "", SinkPolicyBestEffort:
+		return SinkPolicyBestEffort, nil
+	case SinkPolicyFailFast:
+		return SinkPolicyFailFast, nil
+	default:
+		return "", fmt.Errorf("invalid sink policy %q, expected %s or %s", s, SinkPolicyFailFast, SinkPolicyBestEffort)
+	}
+}
+
+// sinkCallback is the name of the gorm callback used to fan rows out to the sinks.
+const sinkCallback = "valis:write_sinks"
+
+// UseSinks registers the sinks to receive every row created through db, after it has been written to the database
+// but before the database transaction is committed, so with SinkPolicyFailFast a sink failure also rolls back
+// the database write. Since callbacks are shared by every session of db, this should be called once after connecting.
+func UseSinks(db *gorm.DB, log *zap.Logger, policy SinkPolicy, sinks ...Sink) error {
+	return db.Callback().Create().After("gorm:create").Register(sinkCallback, func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || tx.RowsAffected == 0 || isIndexerModel(tx.Statement.Schema) {
+			return
+		}
+
+		rows := make([]map[string]interface{}, 0, 1)
+		rv := tx.Statement.ReflectValue
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				rows = append(rows, sinkRow(tx.Statement, reflect.Indirect(rv.Index(i))))
+			}
+		case reflect.Struct:
+			rows = append(rows, sinkRow(tx.Statement, rv))
+		}
+
+		for _, s := range sinks {
+			for _, row := range rows {
+				if err := s.Write(tx.Statement.Table, row); err != nil {
+					if policy == SinkPolicyFailFast {
+						_ = tx.AddError(fmt.Errorf("failed to write row to sink %s: %w", s.Name(), err))
+						return
+					}
+					log.Warn(
+						"Failed to write row to sink",
+						zap.String("sink", s.Name()),
+						zap.String("table", tx.Statement.Table),
+						zap.Error(err),
+					)
+					// Skip the rest of the batch for this sink, the remaining sinks still get every row
+					break
+				}
+			}
+		}
+	})
+}
+
+// sinkRow returns the column values of the row held by v, keyed by column name.
+// Values are converted the same way they would be for the database driver.
+func sinkRow(stmt *gorm.Statement, v reflect.Value) map[string]interface{} {
+	row := make(map[string]interface{}, len(stmt.Schema.DBNames))
+	for _, name := range stmt.Schema.DBNames {
+		field := stmt.Schema.FieldsByDBName[name]
+		value, _ := field.ValueOf(stmt.Context, v)
+		if valuer, ok := value.(driver.Valuer); ok {
+			if dv, err := valuer.Value(); err == nil {
+				value = dv
+			}
+		}
+		if b, ok := value.([]byte); ok {
+			value = hex.EncodeToString(b)
+		}
+		row[name] = value
+	}
+	return row
+}
+
+// isIndexerModel reports whether s is one of the indexerModels rather than a model of a block action,
+// those rows are bookkeeping and aren't passed to row transformers or sinks.
+func isIndexerModel(s *schema.Schema) bool {
+	for _, m := range indexerModels {
+		if s.ModelType == reflect.TypeOf(m).Elem() {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONLSink is a Sink that appends each row as a JSON line to a file.
+type JSONLSink struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	enc  *json.Encoder
+}
+
+// jsonlRecord is a single line written by a JSONLSink.
+type jsonlRecord struct {
+	Table string                 `json:"table"`
+	Row   map[string]interface{} `json:"row"`
+}
+
+// NewJSONLSink opens, or creates, the file at path for appending rows.
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLSink{path: path, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *JSONLSink) Name() string {
+	return "jsonl:" + s.path
+}
+
+func (s *JSONLSink) Write(table string, row map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(jsonlRecord{Table: table, Row: row})
+}
+
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
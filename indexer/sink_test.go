@@ -0,0 +1,140 @@
+package indexer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// memorySink records the rows written to it, or fails every write with err.
+type memorySink struct {
+	name string
+	err  error
+	rows []map[string]interface{}
+}
+
+func (s *memorySink) Name() string { return s.name }
+
+func (s *memorySink) Write(table string, row map[string]interface{}) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.rows = append(s.rows, row)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestUseSinks(t *testing.T) {
+	rows := []transferRow{{Denom: "uatom", Amount: "1"}, {Denom: "uosmo", Amount: "2"}}
+
+	tests := []struct {
+		policy   SinkPolicy
+		wantErr  bool
+		wantRows int
+	}{
+		{policy: SinkPolicyBestEffort, wantRows: 2},
+		{policy: SinkPolicyFailFast, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			db, rec := dbtest.New(t)
+			file := &memorySink{name: "file"}
+			broken := &memorySink{name: "broken", err: errors.New("disk full")}
+			if err := UseSinks(db, zap.NewNop(), tt.policy, file, broken); err != nil {
+				t.Fatalf("UseSinks returned unexpected error: %v", err)
+			}
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return tx.Create(append([]transferRow(nil), rows...)).Error
+			})
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Create returned error %v, want an error: %t", err, tt.wantErr)
+			}
+			if got := len(rec.Rows("transfer_rows")); got != tt.wantRows {
+				t.Errorf("got %d rows in the database, want %d", got, tt.wantRows)
+			}
+			// The healthy sink is written to before the failing one either way
+			if len(file.rows) != 2 || file.rows[0]["denom"] != "uatom" || file.rows[1]["amount"] != "2" {
+				t.Errorf("file sink got rows %v, want both rows", file.rows)
+			}
+
+			// Bookkeeping rows of the indexer aren't passed to the sinks
+			file.rows = nil
+			if err := db.Create(&FailedBlock{ChainID: "cosmoshub-4", Height: 1, LastError: "timeout"}).Error; err != nil {
+				t.Fatalf("failed to create failed block: %v", err)
+			}
+			if len(file.rows) != 0 {
+				t.Errorf("file sink got indexer rows %v", file.rows)
+			}
+		})
+	}
+}
+
+func TestJSONLSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.jsonl")
+	sink, err := NewJSONLSink(path)
+	if err != nil {
+		t.Fatalf("NewJSONLSink returned unexpected error: %v", err)
+	}
+	db, _ := dbtest.New(t)
+	if err := UseSinks(db, zap.NewNop(), SinkPolicyFailFast, sink); err != nil {
+		t.Fatalf("UseSinks returned unexpected error: %v", err)
+	}
+	if err := db.Create(&transferRow{Denom: "uatom", Amount: "7"}).Error; err != nil {
+		t.Fatalf("failed to create row: %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close returned unexpected error: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 1 {
+		t.Fatalf("got lines %q, want one line per row", lines)
+	}
+	var record jsonlRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("failed to decode line %q: %v", lines[0], err)
+	}
+	if record.Table != "transfer_rows" || record.Row["denom"] != "uatom" || record.Row["amount"] != "7" || !strings.HasPrefix(sink.Name(), "jsonl:") {
+		t.Errorf("got record %+v, want the transfer row", record)
+	}
+}
+
+func TestIsIndexerModel(t *testing.T) {
+	cache := &sync.Map{}
+	parse := func(model interface{}) *schema.Schema {
+		s, err := schema.Parse(model, cache, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatalf("failed to parse schema of %T: %v", model, err)
+		}
+		return s
+	}
+
+	for _, m := range indexerModels {
+		if !isIndexerModel(parse(m)) {
+			t.Errorf("%T isn't reported as an indexer model", m)
+		}
+	}
+	if isIndexerModel(parse(&transferRow{})) {
+		t.Error("transferRow is reported as an indexer model")
+	}
+}
@@ -0,0 +1,169 @@
+package indexer
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go/v4"
+	"github.com/jackc/pgconn"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// pgTooManyConnections is the SQLSTATE postgres rejects connections with once every connection slot is taken.
+const pgTooManyConnections = "53300"
+
+// Defaults of the DBThrottle timings.
+const (
+	DefaultThrottleCooldown = 5 * time.Second
+	DefaultThrottleRecovery = 30 * time.Second
+)
+
+// throttleWait is how often a throttled ForEachBlock checks whether another block may be started.
+const throttleWait = 100 * time.Millisecond
+
+// maxThrottleLevel bounds how many times the concurrency can be halved, anything beyond a single block is pointless.
+const maxThrottleLevel = 16
+
+// IsConnExhausted reports whether err is postgres rejecting a connection because every connection slot is taken.
+func IsConnExhausted(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgTooManyConnections
+	}
+	// The error is only available as a string when it's returned while connecting
+	msg := err.Error()
+	return strings.Contains(msg, "SQLSTATE "+pgTooManyConnections) || strings.Contains(msg, "too many clients already")
+}
+
+// DBThrottle backs the indexers off when the database runs out of connections. Each time the statements executed
+// through the database fail with connection exhaustion errors the throttle level is raised, halving the number of
+// blocks each indexer processes concurrently, at most once per Cooldown. Once no such error was seen for Recovery
+// the level is lowered again, one step per Recovery. A single DBThrottle should be shared by every indexer
+// writing to the same database, see UseDBThrottle.
+type DBThrottle struct {
+	Cooldown time.Duration
+	Recovery time.Duration
+
+	log *zap.Logger
+
+	mu         sync.Mutex
+	level      int
+	lastErr    time.Time
+	lastChange time.Time
+}
+
+// NewDBThrottle returns a DBThrottle using the default timings.
+func NewDBThrottle(log *zap.Logger) *DBThrottle {
+	return &DBThrottle{
+		Cooldown: DefaultThrottleCooldown,
+		Recovery: DefaultThrottleRecovery,
+		log:      log,
+	}
+}
+
+// Observe raises the throttle level if err is a connection exhaustion error.
+func (t *DBThrottle) Observe(err error) {
+	if !IsConnExhausted(err) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.lastErr = now
+	if t.level >= maxThrottleLevel || now.Sub(t.lastChange) < t.Cooldown {
+		return
+	}
+	t.level++
+	t.lastChange = now
+	t.log.Warn(
+		"Database is out of connections, reducing block concurrency",
+		zap.Int("throttle_level", t.level),
+		zap.Error(err),
+	)
+}
+
+// Limit returns the number of blocks that may be processed concurrently, out of the configured concurrency,
+// at the current throttle level. It's never less than 1.
+func (t *DBThrottle) Limit(concurrency uint) uint {
+	level := t.Level()
+	if level >= 32 {
+		return 1
+	}
+	if limit := concurrency >> uint(level); limit > 0 {
+		return limit
+	}
+	return 1
+}
+
+// Backoff scales delay by the current throttle level, so writes retried while the database is out of connections
+// wait longer the longer the exhaustion lasts.
+func (t *DBThrottle) Backoff(delay time.Duration) time.Duration {
+	return delay * time.Duration(1+t.Level())
+}
+
+// Level returns the current throttle level, lowering it first if no connection exhaustion error was seen recently.
+func (t *DBThrottle) Level() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.level > 0 && now.Sub(t.lastErr) >= t.Recovery && now.Sub(t.lastChange) >= t.Recovery {
+		t.level--
+		t.lastChange = now
+		t.log.Info(
+			"Database connection errors subsided, restoring block concurrency",
+			zap.Int("throttle_level", t.level),
+		)
+	}
+	return t.level
+}
+
+// dbThrottleCallback is the name of the gorm callbacks feeding the errors of every statement to the DBThrottle.
+const dbThrottleCallback = "valis:db_throttle"
+
+// UseDBThrottle registers gorm callbacks passing the error of every statement executed through db to t.
+// Callbacks are shared by every session of db, so this should be called once after connecting to the database.
+func UseDBThrottle(db *gorm.DB, t *DBThrottle) error {
+	observe := func(tx *gorm.DB) {
+		t.Observe(tx.Error)
+	}
+	for _, register := range []func(name string, fn func(*gorm.DB)) error{
+		db.Callback().Create().After("gorm:create").Register,
+		db.Callback().Query().After("gorm:query").Register,
+		db.Callback().Update().After("gorm:update").Register,
+		db.Callback().Delete().After("gorm:delete").Register,
+		db.Callback().Raw().After("gorm:raw").Register,
+		db.Callback().Row().After("gorm:row").Register,
+	} {
+		if err := register(dbThrottleCallback, observe); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryConnExhausted runs write, retrying it with a backoff widened by the DBThrottle while it fails because
+// the database is out of connections. Other errors are returned right away.
+func (i *Indexer) retryConnExhausted(write func() error) error {
+	if i.DBThrottle == nil || i.inBlockTx {
+		return write()
+	}
+	return retry.Do(
+		write,
+		RtyAtt,
+		RtyErr,
+		retry.RetryIf(IsConnExhausted),
+		RtyDel,
+		retry.DelayType(func(n uint, err error, config *retry.Config) time.Duration {
+			return i.DBThrottle.Backoff(retry.BackOffDelay(n, err, config))
+		}),
+	)
+}
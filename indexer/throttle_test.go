@@ -0,0 +1,138 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var errTooManyClients = &pgconn.PgError{Severity: "FATAL", Code: pgTooManyConnections, Message: "sorry, too many clients already"}
+
+func TestIsConnExhausted(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil"},
+		{name: "too many connections", err: errTooManyClients, expected: true},
+		{name: "wrapped", err: fmt.Errorf("insert: %w", errTooManyClients), expected: true},
+		{name: "other postgres error", err: &pgconn.PgError{Code: "23505"}},
+		{name: "connecting", err: errors.New("failed to connect to `host=localhost`: server error (FATAL: sorry, too many clients already (SQLSTATE 53300))"), expected: true},
+		{name: "other error", err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsConnExhausted(tt.err); got != tt.expected {
+				t.Errorf("got %t, expected %t", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDBThrottle(t *testing.T) {
+	throttle := NewDBThrottle(zap.NewNop())
+	throttle.Recovery = time.Hour
+
+	throttle.Observe(errors.New("connection refused"))
+	if limit := throttle.Limit(8); limit != 8 {
+		t.Fatalf("got limit %d without connection exhaustion errors, expected 8", limit)
+	}
+
+	// Errors within the cooldown only raise the level once
+	throttle.Observe(errTooManyClients)
+	throttle.Observe(errTooManyClients)
+	if limit := throttle.Limit(8); limit != 4 {
+		t.Errorf("got limit %d after a burst of errors, expected 4", limit)
+	}
+	if backoff := throttle.Backoff(time.Second); backoff != 2*time.Second {
+		t.Errorf("got backoff %s, expected 2s", backoff)
+	}
+
+	throttle.Cooldown = 0
+	for j := 0; j < 4; j++ {
+		throttle.Observe(errTooManyClients)
+	}
+	if limit := throttle.Limit(8); limit != 1 {
+		t.Errorf("got limit %d while throttled, expected at least one block", limit)
+	}
+
+	// The level is lowered one step per recovery period once the errors subside
+	throttle.Recovery = 10 * time.Millisecond
+	time.Sleep(20 * time.Millisecond)
+	if level := throttle.Level(); level != 4 {
+		t.Errorf("got level %d after the errors subsided, expected 4", level)
+	}
+	if level := throttle.Level(); level != 4 {
+		t.Errorf("got level %d within the recovery period, expected 4", level)
+	}
+}
+
+func TestForEachBlockThrottled(t *testing.T) {
+	const concurrentBlocks = 4
+	var heights []int64
+	for h := int64(1); h <= 8; h++ {
+		heights = append(heights, h)
+	}
+
+	throttle := NewDBThrottle(zap.NewNop())
+	throttle.Cooldown, throttle.Recovery = 0, time.Hour
+	throttle.Observe(errTooManyClients)
+	throttle.Observe(errTooManyClients)
+
+	node := &slowNode{fakeNode: newFakeNode(0, nil), delay: 20 * time.Millisecond}
+	i := newTestIndexer(t, node)
+	i.DBThrottle = throttle
+
+	if err := i.ForEachBlock(context.Background(), heights, nil, concurrentBlocks); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if peak := atomic.LoadInt32(&node.peak); peak != 1 {
+		t.Errorf("%d blocks were queried concurrently, want 1 while the database is out of connections", peak)
+	}
+}
+
+func TestWriteRetriesConnExhausted(t *testing.T) {
+	i := newTestIndexer(t, newFakeNode(0, nil))
+	throttle := NewDBThrottle(zap.NewNop())
+	throttle.Cooldown, throttle.Recovery = 0, time.Hour
+	if err := UseDBThrottle(i.DB, throttle); err != nil {
+		t.Fatalf("UseDBThrottle returned unexpected error: %v", err)
+	}
+	i.DBThrottle = throttle
+
+	// The first two inserts are rejected as if postgres was out of connections
+	var rejected int
+	err := i.DB.Callback().Create().Before("gorm:create").Register("test:too_many_clients", func(tx *gorm.DB) {
+		if rejected < 2 {
+			rejected++
+			_ = tx.AddError(errTooManyClients)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var writeErr error
+	i.Write("writing", &transferRow{Denom: "uatom", Amount: "1"}, func(err error) { writeErr = err })
+	if writeErr != nil {
+		t.Fatalf("write failed: %v", writeErr)
+	}
+	if rejected != 2 {
+		t.Errorf("insert rejected %d times, want 2", rejected)
+	}
+	if level := throttle.Level(); level != 2 {
+		t.Errorf("got throttle level %d, want it raised for each rejected insert", level)
+	}
+	var count int64
+	if err := i.DB.Model(&transferRow{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("got %d rows (%v), want the row written once", count, err)
+	}
+}
@@ -0,0 +1,300 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// tracer creates the spans of the indexer. It delegates to the global TracerProvider, so spans are only recorded
+// once one is registered with otel.SetTracerProvider, e.g. the one returned by NewOTLPTracerProvider.
+var tracer = otel.Tracer("github.com/strangelove-ventures/valis/indexer")
+
+// endSpan ends span, recording err as its status if it isn't nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingSpanKey is the gorm instance key holding the span of a statement between the tracing callbacks.
+const tracingSpanKey = "valis:span"
+
+// UseTracing registers gorm callbacks creating a span for every create, update, delete and raw statement executed
+// through db, as a child of the span in the statement's context. Callbacks are shared by every session of db.
+func UseTracing(db *gorm.DB) error {
+	type registerFunc func(name string, fn func(*gorm.DB)) error
+	ops := []struct {
+		name          string
+		before, after registerFunc
+	}{
+		{"create", db.Callback().Create().Before("gorm:create").Register, db.Callback().Create().After("gorm:create").Register},
+		{"update", db.Callback().Update().Before("gorm:update").Register, db.Callback().Update().After("gorm:update").Register},
+		{"delete", db.Callback().Delete().Before("gorm:delete").Register, db.Callback().Delete().After("gorm:delete").Register},
+		{"raw", db.Callback().Raw().Before("gorm:raw").Register, db.Callback().Raw().After("gorm:raw").Register},
+	}
+	for _, op := range ops {
+		spanName := "db." + op.name
+		if err := op.before("valis:trace_before_"+op.name, func(tx *gorm.DB) {
+			_, span := tracer.Start(tx.Statement.Context, spanName, trace.WithSpanKind(trace.SpanKindClient))
+			tx.InstanceSet(tracingSpanKey, span)
+		}); err != nil {
+			return err
+		}
+		if err := op.after("valis:trace_after_"+op.name, func(tx *gorm.DB) {
+			v, ok := tx.InstanceGet(tracingSpanKey)
+			if !ok {
+				return
+			}
+			span := v.(trace.Span)
+			span.SetAttributes(
+				semconv.DBSystemPostgreSQL,
+				semconv.DBSQLTableKey.String(tx.Statement.Table),
+				attribute.Int64("db.rows_affected", tx.RowsAffected),
+			)
+			endSpan(span, tx.Error)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewOTLPTracerProvider returns a TracerProvider batching spans to the OTLP/HTTP collector at endpoint,
+// e.g. http://localhost:4318. Shutdown should be called before exiting to flush the remaining spans.
+func NewOTLPTracerProvider(endpoint string) (*sdktrace.TracerProvider, error) {
+	exporter, err := NewOTLPExporter(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("valis"),
+		)),
+	), nil
+}
+
+// OTLPExporter is an sdktrace.SpanExporter posting spans to an OTLP/HTTP collector using the JSON encoding.
+// It's used instead of the otlptrace exporters since those require a newer grpc than the cosmos-sdk supports.
+type OTLPExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewOTLPExporter returns an OTLPExporter for the collector at endpoint, spans are posted to its /v1/traces path.
+func NewOTLPExporter(endpoint string) (*OTLPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: expected an http(s) URL", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	return &OTLPExporter{
+		url:    u.String(),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// ExportSpans posts spans to the collector.
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(otlpTracesRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("OTLP collector responded with %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Shutdown is a no-op, there is nothing to release.
+func (e *OTLPExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// The OTLP JSON encoding of an ExportTraceServiceRequest, only the fields set by the indexer are included.
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// otlpTracesRequest groups spans by resource and instrumentation library into an OTLP request.
+func otlpTracesRequest(spans []sdktrace.ReadOnlySpan) otlpRequest {
+	var req otlpRequest
+	resources := make(map[*resource.Resource]int)
+	for _, s := range spans {
+		ri, ok := resources[s.Resource()]
+		if !ok {
+			ri = len(req.ResourceSpans)
+			resources[s.Resource()] = ri
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource: otlpResource{Attributes: otlpAttributes(s.Resource().Attributes())},
+			})
+		}
+		rs := &req.ResourceSpans[ri]
+
+		lib := s.InstrumentationLibrary()
+		si := -1
+		for i, scope := range rs.ScopeSpans {
+			if scope.Scope.Name == lib.Name && scope.Scope.Version == lib.Version {
+				si = i
+				break
+			}
+		}
+		if si < 0 {
+			si = len(rs.ScopeSpans)
+			rs.ScopeSpans = append(rs.ScopeSpans, otlpScopeSpans{Scope: otlpScope{Name: lib.Name, Version: lib.Version}})
+		}
+		rs.ScopeSpans[si].Spans = append(rs.ScopeSpans[si].Spans, newOTLPSpan(s))
+	}
+	return req
+}
+
+// newOTLPSpan returns the OTLP encoding of s.
+func newOTLPSpan(s sdktrace.ReadOnlySpan) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.SpanContext().TraceID().String(),
+		SpanID:            s.SpanContext().SpanID().String(),
+		Name:              s.Name(),
+		Kind:              int(s.SpanKind()),
+		StartTimeUnixNano: unixNano(s.StartTime()),
+		EndTimeUnixNano:   unixNano(s.EndTime()),
+		Attributes:        otlpAttributes(s.Attributes()),
+		Status:            otlpStatus{Message: s.Status().Description},
+	}
+	if s.Parent().HasSpanID() {
+		span.ParentSpanID = s.Parent().SpanID().String()
+	}
+	// The OTLP status codes are ordered differently than the codes package: UNSET, OK, ERROR
+	switch s.Status().Code {
+	case codes.Ok:
+		span.Status.Code = 1
+	case codes.Error:
+		span.Status.Code = 2
+	}
+	for _, e := range s.Events() {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: unixNano(e.Time),
+			Name:         e.Name,
+			Attributes:   otlpAttributes(e.Attributes),
+		})
+	}
+	return span
+}
+
+// otlpAttributes returns the OTLP encoding of attrs, slice values are encoded as strings.
+func otlpAttributes(attrs []attribute.KeyValue) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		var v otlpAnyValue
+		switch attr.Value.Type() {
+		case attribute.BOOL:
+			b := attr.Value.AsBool()
+			v.BoolValue = &b
+		case attribute.INT64:
+			i := strconv.FormatInt(attr.Value.AsInt64(), 10)
+			v.IntValue = &i
+		case attribute.FLOAT64:
+			f := attr.Value.AsFloat64()
+			v.DoubleValue = &f
+		default:
+			str := attr.Value.Emit()
+			v.StringValue = &str
+		}
+		kvs = append(kvs, otlpKeyValue{Key: string(attr.Key), Value: v})
+	}
+	return kvs
+}
+
+// unixNano returns t as a decimal string of nanoseconds since the Unix epoch, as 64-bit integers are encoded in JSON.
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,178 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans makes the indexer's tracer record its spans in memory for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	global := tracer
+	tracer = provider.Tracer("github.com/strangelove-ventures/valis/indexer")
+	t.Cleanup(func() { tracer = global })
+	return spans
+}
+
+func TestForEachBlockSpans(t *testing.T) {
+	spans := recordSpans(t)
+
+	i := newTestIndexer(t, newFakeNode(0, nil))
+	if err := UseTracing(i.DB); err != nil {
+		t.Fatalf("UseTracing returned unexpected error: %v", err)
+	}
+	if err := i.ForEachBlock(context.Background(), []int64{5}, []BlockAction{&writingAction{}}, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+
+	// The action's row and its checkpoint are both written with a db.create span
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	var tables []string
+	for _, s := range spans.Ended() {
+		byName[s.Name()] = s
+		if s.Name() == "db.create" {
+			for _, attr := range s.Attributes() {
+				if attr.Key == "db.sql.table" {
+					tables = append(tables, attr.Value.AsString())
+				}
+			}
+		}
+	}
+	for _, name := range []string{"block", "fetch_block", "decode_txs", "execute_action", "db.create"} {
+		if byName[name] == nil {
+			t.Fatalf("no %s span was recorded, got %v", name, byName)
+		}
+	}
+
+	block := byName["block"]
+	if block.Parent().IsValid() {
+		t.Errorf("block span has parent %s, want a root span", block.Parent().SpanID())
+	}
+	if !hasAttribute(block, attribute.Int64("height", 5)) || !hasAttribute(block, attribute.String("chain_id", "cosmoshub-4")) {
+		t.Errorf("block span attributes = %v, want the chain id and height", block.Attributes())
+	}
+	parents := map[string]string{
+		"fetch_block":    "block",
+		"decode_txs":     "block",
+		"execute_action": "block",
+		"db.create":      "execute_action",
+	}
+	for name, parent := range parents {
+		if got, want := byName[name].Parent().SpanID(), byName[parent].SpanContext().SpanID(); got != want {
+			t.Errorf("%s span has parent %s, want the %s span %s", name, got, parent, want)
+		}
+		if byName[name].SpanContext().TraceID() != block.SpanContext().TraceID() {
+			t.Errorf("%s span isn't part of the trace of the block", name)
+		}
+	}
+	if !hasAttribute(byName["execute_action"], attribute.String("action", "writing")) {
+		t.Errorf("execute_action span attributes = %v, want the action name", byName["execute_action"].Attributes())
+	}
+	expected := []string{"transfer_rows", "indexed_blocks", "index_progresses"}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Errorf("got db.create spans for %v, expected %v", tables, expected)
+	}
+}
+
+func TestExecuteActionSpanError(t *testing.T) {
+	spans := recordSpans(t)
+
+	i := newTestIndexer(t, newFakeNode(0, nil))
+	failed := errors.New("failed")
+	if err := i.ExecuteAction(context.Background(), &writingAction{err: failed}, testBlock(5, 0)); !errors.Is(err, failed) {
+		t.Fatalf("ExecuteAction returned %v, want %v", err, failed)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 1 || ended[0].Name() != "execute_action" {
+		t.Fatalf("got spans %v, want only the execute_action span", ended)
+	}
+	if status := ended[0].Status(); status.Code != codes.Error || status.Description != "failed" {
+		t.Errorf("execute_action span status = %+v, want the action error", status)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	spans := recordSpans(t)
+	i := newTestIndexer(t, newFakeNode(0, nil))
+	if err := i.ExecuteAction(context.Background(), &writingAction{}, testBlock(5, 0)); err != nil {
+		t.Fatalf("ExecuteAction returned unexpected error: %v", err)
+	}
+	exported := spans.Ended()
+
+	var (
+		got      otlpRequest
+		status   = http.StatusOK
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method != http.MethodPost || r.URL.Path != "/collector/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s %s with content type %q, want a JSON POST to /collector/v1/traces",
+				r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode the OTLP request: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	exporter, err := NewOTLPExporter(srv.URL + "/collector/")
+	if err != nil {
+		t.Fatalf("NewOTLPExporter returned unexpected error: %v", err)
+	}
+	if err := exporter.ExportSpans(context.Background(), nil); err != nil || requests != 0 {
+		t.Errorf("exporting no spans made %d requests and returned %v, want nothing to be posted", requests, err)
+	}
+	if err := exporter.ExportSpans(context.Background(), exported); err != nil {
+		t.Fatalf("ExportSpans returned unexpected error: %v", err)
+	}
+
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("got OTLP request %+v, want the spans of a single resource and scope", got)
+	}
+	scope := got.ResourceSpans[0].ScopeSpans[0]
+	if scope.Scope.Name != "github.com/strangelove-ventures/valis/indexer" || len(scope.Spans) != 1 {
+		t.Fatalf("got scope %+v, want the execute_action span of the indexer's tracer", scope)
+	}
+	span, s := scope.Spans[0], exported[0]
+	if span.Name != "execute_action" || span.TraceID != s.SpanContext().TraceID().String() || span.SpanID != s.SpanContext().SpanID().String() ||
+		span.ParentSpanID != "" || span.StartTimeUnixNano != unixNano(s.StartTime()) || span.EndTimeUnixNano != unixNano(s.EndTime()) {
+		t.Errorf("got OTLP span %+v, want the encoding of %s", span, s.Name())
+	}
+	if len(span.Attributes) != 1 || span.Attributes[0].Key != "action" || span.Attributes[0].Value.StringValue == nil ||
+		*span.Attributes[0].Value.StringValue != "writing" {
+		t.Errorf("got OTLP span attributes %+v, want the action name", span.Attributes)
+	}
+
+	status = http.StatusBadRequest
+	if err := exporter.ExportSpans(context.Background(), exported); err == nil {
+		t.Error("expected an error when the collector rejects the spans")
+	}
+
+	if _, err := NewOTLPExporter("localhost:4318"); err == nil {
+		t.Error("expected an error for an endpoint without a scheme")
+	}
+}
+
+// hasAttribute reports whether s has the attribute kv.
+func hasAttribute(s sdktrace.ReadOnlySpan, kv attribute.KeyValue) bool {
+	for _, attr := range s.Attributes() {
+		if attr == kv {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// RowTransformer is invoked on each row, a pointer to one of the action models, right before it is written.
+// It allows derived fields (e.g. normalized amounts, tags) to be added without changing the actions themselves.
+type RowTransformer interface {
+	Transform(row interface{}) error
+}
+
+// RowTransformerFunc is an adapter to allow the use of ordinary functions as a RowTransformer.
+type RowTransformerFunc func(row interface{}) error
+
+// Transform calls f(row).
+func (f RowTransformerFunc) Transform(row interface{}) error {
+	return f(row)
+}
+
+// NopRowTransformer is the default RowTransformer, it leaves rows untouched.
+type NopRowTransformer struct{}
+
+// Transform is a no-op.
+func (NopRowTransformer) Transform(interface{}) error {
+	return nil
+}
+
+// RowTransformers chains multiple RowTransformer's, they are invoked in order and the first error stops the chain.
+type RowTransformers []RowTransformer
+
+// Transform invokes each RowTransformer in the chain on the row.
+func (ts RowTransformers) Transform(row interface{}) error {
+	for _, t := range ts {
+		if err := t.Transform(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowTransformerCallback is the name of the gorm callback used to invoke the RowTransformer.
+const rowTransformerCallback = "valis:transform_rows"
+
+// UseRowTransformer registers t to be invoked on every row created through db, including batches and associations.
+// The indexer's own bookkeeping rows (e.g. MsgProgress) are not passed to t.
+// Since callbacks are shared by every session of db, this should be called once after connecting to the database.
+func UseRowTransformer(db *gorm.DB, t RowTransformer) error {
+	return db.Callback().Create().Before("gorm:create").Register(rowTransformerCallback, func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || isIndexerModel(tx.Statement.Schema) {
+			return
+		}
+
+		rv := tx.Statement.ReflectValue
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				if err := transformRow(t, rv.Index(i)); err != nil {
+					_ = tx.AddError(err)
+					return
+				}
+			}
+		case reflect.Struct:
+			if err := transformRow(t, rv); err != nil {
+				_ = tx.AddError(err)
+			}
+		}
+	})
+}
+
+// transformRow invokes t on the row held by v, passing a pointer so the transformer can modify it.
+func transformRow(t RowTransformer, v reflect.Value) error {
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+	return t.Transform(v.Interface())
+}
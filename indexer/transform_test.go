@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/strangelove-ventures/valis/internal/dbtest"
+)
+
+type transferRow struct {
+	ID     uint `gorm:"primaryKey"`
+	Denom  string
+	Amount string
+	Tag    string
+}
+
+func TestUseRowTransformer(t *testing.T) {
+	db, rec := dbtest.New(t)
+
+	// The tag is derived from the denom, the second transformer sees the changes made by the first
+	var chain RowTransformers
+	chain = append(chain,
+		NopRowTransformer{},
+		RowTransformerFunc(func(row interface{}) error {
+			if r, ok := row.(*transferRow); ok {
+				r.Tag = strings.TrimPrefix(r.Denom, "u")
+			}
+			return nil
+		}),
+		RowTransformerFunc(func(row interface{}) error {
+			if r, ok := row.(*transferRow); ok && r.Tag == "fail" {
+				return errors.New("rejected row")
+			}
+			if r, ok := row.(*transferRow); ok {
+				r.Tag = strings.ToUpper(r.Tag)
+			}
+			return nil
+		}),
+	)
+	if err := UseRowTransformer(db, chain); err != nil {
+		t.Fatalf("UseRowTransformer returned unexpected error: %v", err)
+	}
+
+	if err := db.Create(&transferRow{Denom: "uatom", Amount: "1"}).Error; err != nil {
+		t.Fatalf("failed to create row: %v", err)
+	}
+	if err := db.Create([]transferRow{{Denom: "uosmo", Amount: "2"}, {Denom: "ujuno", Amount: "3"}}).Error; err != nil {
+		t.Fatalf("failed to create rows: %v", err)
+	}
+	if err := db.Create(&transferRow{Denom: "ufail", Amount: "4"}).Error; err == nil {
+		t.Error("created a row rejected by a transformer")
+	}
+
+	var tags []string
+	for _, row := range rec.Rows("transfer_rows") {
+		tags = append(tags, row.(*transferRow).Tag)
+	}
+	if got, want := strings.Join(tags, ","), "ATOM,OSMO,JUNO"; got != want {
+		t.Errorf("got tags %s, want %s", got, want)
+	}
+}
+
+func TestUseRowTransformerSkipsIndexerModels(t *testing.T) {
+	db, _ := dbtest.New(t)
+	var transformed []interface{}
+	err := UseRowTransformer(db, RowTransformerFunc(func(row interface{}) error {
+		transformed = append(transformed, row)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("UseRowTransformer returned unexpected error: %v", err)
+	}
+
+	// The denom metadata enriching the indexed rows is bookkeeping of the indexer too
+	if err := db.Create(&DenomMetadata{ChainID: "cosmoshub-4", Denom: "uatom", Display: "atom", Exponent: 6}).Error; err != nil {
+		t.Fatalf("failed to create denom metadata: %v", err)
+	}
+	if err := db.Create(&transferRow{Denom: "uatom", Amount: "1"}).Error; err != nil {
+		t.Fatalf("failed to create row: %v", err)
+	}
+	if len(transformed) != 1 {
+		t.Fatalf("transformed %d rows, want only the transfer row", len(transformed))
+	}
+	if _, ok := transformed[0].(*transferRow); !ok {
+		t.Errorf("transformed %T, want the transfer row", transformed[0])
+	}
+}
@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"sync"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// DefaultTxResultsCacheSize is the default max number of blocks whose tx results are cached.
+const DefaultTxResultsCacheSize = 100
+
+// txResultsCache is a bounded cache of the tx results and the end block events of blocks, keyed by height.
+type txResultsCache struct {
+	mu     sync.Mutex
+	blocks map[int64]*cachedBlock
+	order  []int64
+}
+
+// cachedBlock holds the results cached for a block, the tx results and the end block events are cached separately
+// since the tx results may be queried tx by tx, without the end block events.
+type cachedBlock struct {
+	txResults         []*coretypes.ResultTx
+	hasTxResults      bool
+	endBlockEvents    []abcitypes.Event
+	hasEndBlockEvents bool
+}
+
+func (c *txResultsCache) get(height int64) ([]*coretypes.ResultTx, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.blocks[height]
+	if !ok || !b.hasTxResults {
+		return nil, false
+	}
+	return b.txResults, true
+}
+
+func (c *txResultsCache) getEndBlockEvents(height int64) ([]abcitypes.Event, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.blocks[height]
+	if !ok || !b.hasEndBlockEvents {
+		return nil, false
+	}
+	return b.endBlockEvents, true
+}
+
+// put caches the results of the block at height, evicting the oldest blocks to stay within size blocks.
+func (c *txResultsCache) put(height int64, results []*coretypes.ResultTx, size int) {
+	c.update(height, size, func(b *cachedBlock) {
+		b.txResults, b.hasTxResults = results, true
+	})
+}
+
+// putEndBlockEvents caches the end block events of the block at height, evicting like put.
+func (c *txResultsCache) putEndBlockEvents(height int64, events []abcitypes.Event, size int) {
+	c.update(height, size, func(b *cachedBlock) {
+		b.endBlockEvents, b.hasEndBlockEvents = events, true
+	})
+}
+
+// update applies set to the cached block at height, adding it if it isn't cached yet.
+func (c *txResultsCache) update(height int64, size int, set func(b *cachedBlock)) {
+	if size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.blocks == nil {
+		c.blocks = make(map[int64]*cachedBlock)
+	}
+	b, ok := c.blocks[height]
+	if !ok {
+		b = &cachedBlock{}
+		c.blocks[height] = b
+		c.order = append(c.order, height)
+	}
+	set(b)
+
+	for len(c.order) > size {
+		delete(c.blocks, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func (c *txResultsCache) remove(height int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.blocks[height]; !ok {
+		return
+	}
+	delete(c.blocks, height)
+	for j, h := range c.order {
+		if h == height {
+			c.order = append(c.order[:j], c.order[j+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// resultsAction queries the tx results of every block it's executed for, failing the first failures executions.
+type resultsAction struct {
+	recordingAction
+	failures int
+}
+
+func (a *resultsAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	if _, err := i.TxResults(ctx, block); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failures > 0 {
+		a.failures--
+		return errors.New("failed")
+	}
+	a.heights = append(a.heights, block.Block.Height)
+	return nil
+}
+
+func TestTxResultsCachedForRetries(t *testing.T) {
+	node := newFakeNode(3, nil)
+	i := newTestIndexer(t, node)
+
+	// Both actions share the results of the block, and the failure of the second keeps them cached for the retry
+	actions := []BlockAction{&resultsAction{}, &resultsAction{failures: 1}}
+	if err := i.ForEachBlock(context.Background(), []int64{7}, actions, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if node.blockResultsQueries != 1 {
+		t.Errorf("block results queried %d times for 2 actions, want 1", node.blockResultsQueries)
+	}
+
+	recovered, err := i.RetryFailedBlocks(context.Background(), actions, 1)
+	if err != nil {
+		t.Fatalf("RetryFailedBlocks returned unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(recovered, []int64{7}) {
+		t.Errorf("recovered heights %v, want [7]", recovered)
+	}
+	if node.blockResultsQueries != 1 {
+		t.Errorf("block results queried %d times, want the retried block to reuse the cached results", node.blockResultsQueries)
+	}
+
+	// Once the block succeeded its results are no longer cached
+	if _, ok := i.txResults.get(7); ok {
+		t.Error("results of block 7 still cached after it was indexed")
+	}
+}
+
+func TestTxResultsCacheBounded(t *testing.T) {
+	var c txResultsCache
+	for h := int64(1); h <= 4; h++ {
+		c.put(h, []*coretypes.ResultTx{{Height: h}}, 3)
+	}
+	if _, ok := c.get(1); ok {
+		t.Error("oldest block wasn't evicted from a full cache")
+	}
+	for h := int64(2); h <= 4; h++ {
+		if results, ok := c.get(h); !ok || results[0].Height != h {
+			t.Errorf("results of block %d = %v, want them cached", h, results)
+		}
+	}
+
+	c.remove(3)
+	c.put(5, nil, 3)
+	if !reflect.DeepEqual(c.order, []int64{2, 4, 5}) {
+		t.Errorf("cached blocks %v, want [2 4 5]", c.order)
+	}
+
+	var disabled txResultsCache
+	disabled.put(1, nil, 0)
+	if _, ok := disabled.get(1); ok {
+		t.Error("results cached with a zero cache size")
+	}
+}
+
+// endBlockAction queries both the tx results and the end block events of every block it's executed for.
+type endBlockAction struct {
+	recordingAction
+}
+
+func (a *endBlockAction) Execute(ctx context.Context, i *Indexer, block *coretypes.ResultBlock) error {
+	if _, err := i.TxResults(ctx, block); err != nil {
+		return err
+	}
+	_, err := i.EndBlockEvents(ctx, block)
+	return err
+}
+
+func TestEndBlockEventsCachedWithTxResults(t *testing.T) {
+	node := newFakeNode(3, nil)
+	i := newTestIndexer(t, node)
+
+	actions := []BlockAction{&endBlockAction{}, &endBlockAction{}}
+	if err := i.ForEachBlock(context.Background(), []int64{7}, actions, 1); err != nil {
+		t.Fatalf("ForEachBlock returned unexpected error: %v", err)
+	}
+	if node.blockResultsQueries != 1 {
+		t.Errorf("block results queried %d times for the tx results and end block events, want 1", node.blockResultsQueries)
+	}
+}
@@ -0,0 +1,172 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultLagCheckInterval is how often a LagWatchdog compares the indexed height to the chain head by default.
+const DefaultLagCheckInterval = 30 * time.Second
+
+// LagWatchdog raises an alert when the indexing of a chain falls more than Threshold blocks behind the chain head,
+// by logging an error, counting the alert and, if a WebhookURL is set, posting a LagAlert to it. A chain only alerts
+// once each time it falls behind, it has to catch up to within the Threshold again before it can alert again.
+// A single LagWatchdog may watch several chains.
+type LagWatchdog struct {
+	Threshold  int64
+	Interval   time.Duration
+	WebhookURL string
+
+	log    *zap.Logger
+	client *http.Client
+
+	mu      sync.Mutex
+	alerts  map[string]int64
+	lagging map[string]bool
+}
+
+// LagAlert is the JSON body posted to the webhook of a LagWatchdog.
+type LagAlert struct {
+	ChainID       string `json:"chain_id"`
+	IndexedHeight int64  `json:"indexed_height"`
+	ChainHeight   int64  `json:"chain_height"`
+	Lag           int64  `json:"lag"`
+	Threshold     int64  `json:"threshold"`
+}
+
+// NewLagWatchdog returns a LagWatchdog alerting once a chain is more than threshold blocks behind,
+// checking every DefaultLagCheckInterval. webhookURL may be empty.
+func NewLagWatchdog(log *zap.Logger, threshold int64, webhookURL string) *LagWatchdog {
+	return &LagWatchdog{
+		Threshold:  threshold,
+		Interval:   DefaultLagCheckInterval,
+		WebhookURL: webhookURL,
+		log:        log,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		alerts:     make(map[string]int64),
+		lagging:    make(map[string]bool),
+	}
+}
+
+// Watch checks the lag of the indexer's chain every Interval until the context is cancelled.
+func (w *LagWatchdog) Watch(ctx context.Context, i *Indexer) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		latestHeight, err := i.QueryLatestHeight(ctx)
+		if err != nil {
+			w.log.Debug(
+				"Failed to query latest height for lag check",
+				zap.String("chain_id", i.Client.Config.ChainID),
+				zap.Error(err),
+			)
+			continue
+		}
+		w.Check(ctx, i.Client.Config.ChainID, i.LastHeight(), latestHeight)
+	}
+}
+
+// Check compares the indexed height of the chain to its latest height, alerting if the chain just fell more than
+// Threshold blocks behind. It reports whether an alert was raised. Nothing is checked before a block was indexed.
+func (w *LagWatchdog) Check(ctx context.Context, chainID string, indexedHeight, latestHeight int64) bool {
+	if indexedHeight == 0 {
+		return false
+	}
+	lag := latestHeight - indexedHeight
+	lagging := lag > w.Threshold
+
+	w.mu.Lock()
+	wasLagging := w.lagging[chainID]
+	w.lagging[chainID] = lagging
+	if lagging && !wasLagging {
+		w.alerts[chainID]++
+	}
+	w.mu.Unlock()
+
+	if !lagging {
+		if wasLagging {
+			w.log.Info(
+				"Indexing caught up with the chain head",
+				zap.String("chain_id", chainID),
+				zap.Int64("lag", lag),
+			)
+		}
+		return false
+	}
+	if wasLagging {
+		return false
+	}
+
+	alert := LagAlert{
+		ChainID:       chainID,
+		IndexedHeight: indexedHeight,
+		ChainHeight:   latestHeight,
+		Lag:           lag,
+		Threshold:     w.Threshold,
+	}
+	w.log.Error(
+		"Indexing is lagging behind the chain head",
+		zap.String("chain_id", chainID),
+		zap.Int64("indexed_height", indexedHeight),
+		zap.Int64("chain_height", latestHeight),
+		zap.Int64("lag", lag),
+		zap.Int64("threshold", w.Threshold),
+	)
+	if w.WebhookURL != "" {
+		if err := w.postAlert(ctx, alert); err != nil {
+			w.log.Warn(
+				"Failed to post lag alert to webhook",
+				zap.String("chain_id", chainID),
+				zap.Error(err),
+			)
+		}
+	}
+	return true
+}
+
+// Alerts returns the number of lag alerts raised for the chain.
+func (w *LagWatchdog) Alerts(chainID string) int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.alerts[chainID]
+}
+
+// postAlert posts the JSON encoding of alert to the WebhookURL.
+func (w *LagWatchdog) postAlert(ctx context.Context, alert LagAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("webhook responded with %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLagWatchdogCheck(t *testing.T) {
+	alerts := make(chan LagAlert, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert LagAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Error(err)
+		}
+		alerts <- alert
+	}))
+	defer srv.Close()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	w := NewLagWatchdog(zap.New(core), 10, srv.URL)
+	ctx := context.Background()
+
+	// The lag grows past the threshold while the chain head moves on
+	for _, check := range []struct {
+		indexed, latest int64
+		alert           bool
+	}{
+		{0, 100, false},
+		{95, 100, false},
+		{100, 110, false},
+		{105, 120, true},
+		{106, 140, false},
+		{135, 140, false},
+		{136, 160, true},
+	} {
+		if got := w.Check(ctx, "cosmoshub-4", check.indexed, check.latest); got != check.alert {
+			t.Errorf("got alert %t at %d/%d, expected %t", got, check.indexed, check.latest, check.alert)
+		}
+	}
+
+	if got := w.Alerts("cosmoshub-4"); got != 2 {
+		t.Errorf("got %d alerts, expected 2", got)
+	}
+	if got := w.Alerts("osmosis-1"); got != 0 {
+		t.Errorf("got %d alerts of another chain, expected 0", got)
+	}
+	if got := logs.FilterMessage("Indexing is lagging behind the chain head").Len(); got != 2 {
+		t.Errorf("got %d lag errors logged, expected 2", got)
+	}
+	if got := logs.FilterMessage("Indexing caught up with the chain head").Len(); got != 1 {
+		t.Errorf("got %d catch up messages logged, expected 1", got)
+	}
+
+	close(alerts)
+	var posted []LagAlert
+	for alert := range alerts {
+		posted = append(posted, alert)
+	}
+	expected := []LagAlert{
+		{ChainID: "cosmoshub-4", IndexedHeight: 105, ChainHeight: 120, Lag: 15, Threshold: 10},
+		{ChainID: "cosmoshub-4", IndexedHeight: 136, ChainHeight: 160, Lag: 24, Threshold: 10},
+	}
+	if !reflect.DeepEqual(posted, expected) {
+		t.Errorf("got posted alerts %+v, expected %+v", posted, expected)
+	}
+}
+
+func TestLagWatchdogWebhookFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	w := NewLagWatchdog(zap.New(core), 10, srv.URL)
+	if !w.Check(context.Background(), "cosmoshub-4", 1, 100) {
+		t.Error("expected an alert although the webhook failed")
+	}
+	if got := logs.FilterMessage("Failed to post lag alert to webhook").Len(); got != 1 {
+		t.Errorf("got %d webhook failures logged, expected 1", got)
+	}
+}
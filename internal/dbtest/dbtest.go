@@ -0,0 +1,741 @@
+// Package dbtest provides a gorm DB for tests that keeps the rows written through it in memory instead of executing
+// the statements against postgres. Statements are built by the postgres dialector in dry run mode and their clauses
+// are then applied to the in memory tables: inserts (including ON CONFLICT DO NOTHING and DO UPDATE upserts),
+// updates, deletes and simple queries are supported, as are transactions and savepoints. Raw SQL is not executed,
+// apart from the query checking whether a table exists (tables exist once a row was written to them).
+//
+// Conditions and assignments are evaluated for the subset of SQL the indexer uses: comparisons, IS [NOT] NULL,
+// IN, LIKE, AND/OR/NOT, + and - on integers and numeric strings, and GREATEST/LEAST. Queries may be grouped, with
+// HAVING conditions on the count of the rows of a group. Anything else fails the statement so tests don't silently
+// pass on statements that aren't modelled.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// ErrTxAborted is returned for the statements of a transaction after one of its statements failed, like postgres
+// does until the transaction is rolled back.
+var ErrTxAborted = errors.New("current transaction is aborted, commands ignored until end of transaction block")
+
+// Row is a row of a table.
+type Row struct {
+	Table string
+	Value interface{}
+}
+
+// Recorder holds the tables of a DB returned by New.
+type Recorder struct {
+	mu    sync.Mutex
+	state *state
+	fails map[string]error
+	sqlDB *sql.DB
+}
+
+// New returns a DB keeping its tables in the returned Recorder.
+func New(t testing.TB) (*gorm.DB, *Recorder) {
+	t.Helper()
+
+	r := &Recorder{state: newState(), fails: make(map[string]error)}
+	r.sqlDB = openSQLDB(r)
+	t.Cleanup(func() { _ = r.sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: &pool{r: r}}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("failed to open test DB: %v", err)
+	}
+
+	for _, cb := range []struct {
+		name     string
+		register func(name string, fn func(*gorm.DB)) error
+	}{
+		{"dbtest:create", db.Callback().Create().After("gorm:create").Register},
+		{"dbtest:update", db.Callback().Update().After("gorm:update").Register},
+		{"dbtest:delete", db.Callback().Delete().After("gorm:delete").Register},
+		{"dbtest:query", db.Callback().Query().After("gorm:query").Register},
+		{"dbtest:raw", db.Callback().Raw().After("gorm:raw").Register},
+	} {
+		if err := cb.register(cb.name, r.apply); err != nil {
+			t.Fatalf("failed to register %s callback: %v", cb.name, err)
+		}
+	}
+	if err := db.Callback().Row().After("gorm:row").Register("dbtest:row", r.row); err != nil {
+		t.Fatalf("failed to register dbtest:row callback: %v", err)
+	}
+	return db, r
+}
+
+// Fail makes writing any row to table fail with err.
+func (r *Recorder) Fail(table string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fails[table] = err
+}
+
+// Rows returns the committed rows of table, in the order they were inserted.
+func (r *Recorder) Rows(table string) []interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]interface{}(nil), r.state.tables[table]...)
+}
+
+// All returns every committed row, grouped by table in the order the tables were first written to.
+func (r *Recorder) All() []Row {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rows []Row
+	for _, table := range r.state.order {
+		for _, value := range r.state.tables[table] {
+			rows = append(rows, Row{Table: table, Value: value})
+		}
+	}
+	return rows
+}
+
+// apply is the callback applying the statements of db to the tables of the recorder, or of its transaction.
+func (r *Recorder) apply(db *gorm.DB) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := r.state
+	t, _ := db.Statement.ConnPool.(*tx)
+	if t != nil {
+		st = t.state
+	}
+	if db.Statement.Schema == nil {
+		if t != nil {
+			t.raw(db.Statement.SQL.String())
+		}
+		return
+	}
+	if db.Error != nil {
+		return
+	}
+	if t != nil && t.aborted {
+		_ = db.AddError(ErrTxAborted)
+		return
+	}
+
+	_, query := db.Statement.Clauses["SELECT"]
+	table := db.Statement.Table
+	var err error
+	if !query {
+		err = r.fails[table]
+	}
+	if err == nil {
+		switch {
+		case hasClause(db, "INSERT"):
+			err = st.insert(db)
+		case hasClause(db, "UPDATE"):
+			err = st.update(db)
+		case hasClause(db, "DELETE"):
+			err = st.delete(db)
+		case query:
+			err = st.query(db)
+		}
+	}
+	if err != nil {
+		_ = db.AddError(err)
+		if t != nil {
+			t.aborted = true
+		}
+	}
+}
+
+func hasClause(db *gorm.DB, name string) bool {
+	_, ok := db.Statement.Clauses[name]
+	return ok
+}
+
+// state is the content of the tables, each row is a pointer to a struct of the table's model.
+type state struct {
+	tables map[string][]interface{}
+	order  []string
+	nextID map[string]int64
+}
+
+func newState() *state {
+	return &state{tables: make(map[string][]interface{}), nextID: make(map[string]int64)}
+}
+
+// clone returns a copy of s whose rows can be changed without changing the rows of s.
+func (s *state) clone() *state {
+	c := &state{
+		tables: make(map[string][]interface{}, len(s.tables)),
+		order:  append([]string(nil), s.order...),
+		nextID: make(map[string]int64, len(s.nextID)),
+	}
+	for table, rows := range s.tables {
+		copies := make([]interface{}, len(rows))
+		for j, row := range rows {
+			copies[j] = copyRow(row)
+		}
+		c.tables[table] = copies
+	}
+	for table, id := range s.nextID {
+		c.nextID[table] = id
+	}
+	return c
+}
+
+// copyRow returns a pointer to a copy of the struct row points to.
+func copyRow(row interface{}) interface{} {
+	rv := reflect.Indirect(reflect.ValueOf(row))
+	c := reflect.New(rv.Type())
+	c.Elem().Set(rv)
+	return c.Interface()
+}
+
+// insert applies an insert statement, rows conflicting with an existing row on a unique key fail the statement
+// unless they're handled by its ON CONFLICT clause. RowsAffected is set to the number of rows inserted or updated.
+func (s *state) insert(db *gorm.DB) error {
+	sch, table := db.Statement.Schema, db.Statement.Table
+	onConflict, upsert := db.Statement.Clauses["ON CONFLICT"].Expression.(clause.OnConflict)
+
+	keys := uniqueKeys(sch)
+	if upsert && len(onConflict.Columns) > 0 {
+		target := make([]*schema.Field, len(onConflict.Columns))
+		for j, column := range onConflict.Columns {
+			if target[j] = sch.LookUpField(column.Name); target[j] == nil {
+				return fmt.Errorf("dbtest: unknown conflict column %s of %s", column.Name, table)
+			}
+		}
+		keys = [][]*schema.Field{target}
+	}
+
+	var affected int64
+	for _, value := range flatten(db.Statement.Dest) {
+		row := copyRow(value)
+		if f := sch.PrioritizedPrimaryField; f != nil && f.AutoIncrement {
+			if v, zero := f.ValueOf(context.Background(), reflect.ValueOf(row).Elem()); zero || v == nil {
+				s.nextID[table]++
+				for _, rv := range []reflect.Value{reflect.ValueOf(row).Elem(), reflect.Indirect(reflect.ValueOf(value))} {
+					if err := f.Set(context.Background(), rv, s.nextID[table]); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		existing, err := s.conflict(table, keys, row)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			if _, ok := s.tables[table]; !ok {
+				s.order = append(s.order, table)
+			}
+			s.tables[table] = append(s.tables[table], row)
+			affected++
+			continue
+		}
+
+		switch {
+		case !upsert:
+			return fmt.Errorf("duplicate key value violates unique constraint on %s", table)
+		case onConflict.DoNothing:
+			continue
+		}
+
+		e := &env{schema: sch, table: table, row: reflect.ValueOf(existing).Elem(), excluded: reflect.ValueOf(row).Elem()}
+		ok, err := e.where(onConflict.Where)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		assignments := onConflict.DoUpdates
+		if onConflict.UpdateAll {
+			assignments = nil
+			for _, f := range sch.Fields {
+				if f.DBName != "" && !f.PrimaryKey {
+					assignments = append(assignments, clause.Assignment{Column: clause.Column{Name: f.DBName}, Value: clause.Column{Table: "excluded", Name: f.DBName}})
+				}
+			}
+		}
+		if err := e.assign(assignments); err != nil {
+			return err
+		}
+		affected++
+	}
+
+	db.RowsAffected = affected
+	return nil
+}
+
+// uniqueKeys returns the sets of columns whose values must be unique across the rows of a table: the primary key and
+// the unique indexes.
+func uniqueKeys(sch *schema.Schema) [][]*schema.Field {
+	var keys [][]*schema.Field
+	if len(sch.PrimaryFields) > 0 {
+		keys = append(keys, sch.PrimaryFields)
+	}
+
+	indexes := sch.ParseIndexes()
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if idx := indexes[name]; idx.Class == "UNIQUE" {
+			var fields []*schema.Field
+			for _, opt := range idx.Fields {
+				fields = append(fields, opt.Field)
+			}
+			keys = append(keys, fields)
+		}
+	}
+	for _, f := range sch.Fields {
+		if f.Unique {
+			keys = append(keys, []*schema.Field{f})
+		}
+	}
+	return keys
+}
+
+// conflict returns the row of table with the same values as row for any of the keys, nil if there is none.
+// Like postgres, NULL values never conflict.
+func (s *state) conflict(table string, keys [][]*schema.Field, row interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(row).Elem()
+	for _, existing := range s.tables[table] {
+		ev := reflect.ValueOf(existing).Elem()
+		for _, key := range keys {
+			match := true
+			for _, f := range key {
+				a, _ := f.ValueOf(context.Background(), rv)
+				b, _ := f.ValueOf(context.Background(), ev)
+				c, err := compare(a, b)
+				if err == errNull || (err == nil && c != 0) {
+					match = false
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			if match {
+				return existing, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// update applies the SET clause of an update statement to the rows matching its WHERE clause.
+func (s *state) update(db *gorm.DB) error {
+	set, _ := db.Statement.Clauses["SET"].Expression.(clause.Set)
+	rows, err := s.matching(db)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		e := &env{schema: db.Statement.Schema, table: db.Statement.Table, row: reflect.ValueOf(row).Elem()}
+		if err := e.assign(set); err != nil {
+			return err
+		}
+	}
+	db.RowsAffected = int64(len(rows))
+	return nil
+}
+
+// delete removes the rows matching the WHERE clause of a delete statement.
+func (s *state) delete(db *gorm.DB) error {
+	rows, err := s.matching(db)
+	if err != nil {
+		return err
+	}
+	deleted := make(map[interface{}]bool, len(rows))
+	for _, row := range rows {
+		deleted[row] = true
+	}
+
+	table := db.Statement.Table
+	kept := s.tables[table][:0]
+	for _, row := range s.tables[table] {
+		if !deleted[row] {
+			kept = append(kept, row)
+		}
+	}
+	s.tables[table] = kept
+	db.RowsAffected = int64(len(rows))
+	return nil
+}
+
+// matching returns the rows of the statement's table matching its WHERE clause.
+func (s *state) matching(db *gorm.DB) ([]interface{}, error) {
+	where, _ := db.Statement.Clauses["WHERE"].Expression.(clause.Where)
+	var rows []interface{}
+	for _, row := range s.tables[db.Statement.Table] {
+		e := &env{schema: db.Statement.Schema, table: db.Statement.Table, row: reflect.ValueOf(row).Elem()}
+		ok, err := e.where(where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// query sets the destination of a select statement to the rows matching its WHERE clause, sorted by its ORDER BY
+// clause and limited by its LIMIT clause. Counts and plucking a single column are supported.
+func (s *state) query(db *gorm.DB) error {
+	stmt := db.Statement
+	if len(stmt.Joins) > 0 {
+		return fmt.Errorf("dbtest: unsupported query on %s", stmt.Table)
+	}
+
+	rows, err := s.matching(db)
+	if err != nil {
+		return err
+	}
+	if groupBy, ok := stmt.Clauses["GROUP BY"].Expression.(clause.GroupBy); ok {
+		if rows, err = group(stmt, rows, groupBy); err != nil {
+			return err
+		}
+	}
+
+	sel, ok := stmt.Clauses["SELECT"].Expression.(clause.Expr)
+	if s, isSelect := stmt.Clauses["SELECT"].Expression.(clause.Select); isSelect {
+		sel, ok = s.Expression.(clause.Expr)
+	}
+	if ok {
+		if !strings.HasPrefix(strings.ToLower(sel.SQL), "count(") {
+			return fmt.Errorf("dbtest: unsupported select %s on %s", sel.SQL, stmt.Table)
+		}
+		count, ok := stmt.Dest.(*int64)
+		if !ok {
+			return fmt.Errorf("dbtest: unsupported count destination %T", stmt.Dest)
+		}
+		*count = int64(len(rows))
+		db.RowsAffected = 1
+		return nil
+	}
+
+	if orderBy, ok := stmt.Clauses["ORDER BY"].Expression.(clause.OrderBy); ok {
+		if err := s.sort(stmt, rows, orderBy); err != nil {
+			return err
+		}
+	}
+	if limit, ok := stmt.Clauses["LIMIT"].Expression.(clause.Limit); ok {
+		if limit.Offset > len(rows) {
+			limit.Offset = len(rows)
+		}
+		rows = rows[limit.Offset:]
+		if limit.Limit > 0 && limit.Limit < len(rows) {
+			rows = rows[:limit.Limit]
+		}
+	}
+
+	db.RowsAffected = int64(len(rows))
+	return scan(stmt, rows)
+}
+
+// group returns the first row of each group of rows with the same values for the columns of groupBy, for the groups
+// satisfying its HAVING conditions. Only the grouped columns can be selected from the returned rows.
+func group(stmt *gorm.Statement, rows []interface{}, groupBy clause.GroupBy) ([]interface{}, error) {
+	var keys []string
+	groups := make(map[string][]interface{})
+	for _, row := range rows {
+		e := &env{schema: stmt.Schema, table: stmt.Table, row: reflect.ValueOf(row).Elem()}
+		var key []string
+		for _, c := range groupBy.Columns {
+			v, err := e.column(c)
+			if err != nil {
+				return nil, err
+			}
+			key = append(key, fmt.Sprintf("%v", norm(v)))
+		}
+		k := strings.Join(key, "\x00")
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], row)
+	}
+
+	grouped := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		ok, err := having(stmt, groups[k], groupBy.Having)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			grouped = append(grouped, groups[k][0])
+		}
+	}
+	return grouped, nil
+}
+
+// countSQL matches the HAVING conditions comparing the count of the rows of a group.
+var countSQL = regexp.MustCompile(`(?i)^COUNT\((DISTINCT\s+)?([\w."]+|\*)\)\s*(=|<>|!=|>=|<=|>|<)\s*\?$`)
+
+// having returns whether the rows of a group satisfy all the conditions, which compare COUNT(*), COUNT(column) or
+// COUNT(DISTINCT column) with a value.
+func having(stmt *gorm.Statement, rows []interface{}, conds []clause.Expression) (bool, error) {
+	for _, cond := range conds {
+		expr, ok := cond.(clause.Expr)
+		m := countSQL.FindStringSubmatch(strings.TrimSpace(expr.SQL))
+		if !ok || m == nil || len(expr.Vars) != 1 {
+			return false, fmt.Errorf("dbtest: unsupported HAVING condition %v on %s", cond, stmt.Table)
+		}
+
+		count := len(rows)
+		if m[2] != "*" {
+			distinct := make(map[string]bool)
+			count = 0
+			for _, row := range rows {
+				e := &env{schema: stmt.Schema, table: stmt.Table, row: reflect.ValueOf(row).Elem()}
+				v, err := e.ident(m[2])
+				if err != nil {
+					return false, err
+				}
+				if v = norm(v); v == nil {
+					continue
+				}
+				if k := fmt.Sprintf("%v", v); m[1] == "" || !distinct[k] {
+					distinct[k] = true
+					count++
+				}
+			}
+		}
+
+		ok, err := compareOp(count, expr.Vars[0], m[3])
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// sort sorts rows by the columns of orderBy.
+func (s *state) sort(stmt *gorm.Statement, rows []interface{}, orderBy clause.OrderBy) error {
+	type key struct {
+		field *schema.Field
+		desc  bool
+	}
+	var keys []key
+	for _, c := range orderBy.Columns {
+		names := []string{c.Column.Name}
+		if c.Column.Raw {
+			names = strings.Split(c.Column.Name, ",")
+		}
+		for _, name := range names {
+			parts := strings.Fields(name)
+			if len(parts) == 0 || len(parts) > 2 {
+				return fmt.Errorf("dbtest: unsupported order %q", c.Column.Name)
+			}
+			k := key{desc: c.Desc || (len(parts) == 2 && strings.EqualFold(parts[1], "desc"))}
+			if parts[0] == clause.PrimaryKey {
+				k.field = primaryField(stmt.Schema)
+			} else {
+				k.field = stmt.Schema.LookUpField(unquote(parts[0]))
+			}
+			if k.field == nil {
+				return fmt.Errorf("dbtest: unknown order column %s of %s", parts[0], stmt.Table)
+			}
+			keys = append(keys, k)
+		}
+	}
+
+	var err error
+	sort.SliceStable(rows, func(x, y int) bool {
+		for _, k := range keys {
+			a, _ := k.field.ValueOf(context.Background(), reflect.ValueOf(rows[x]).Elem())
+			b, _ := k.field.ValueOf(context.Background(), reflect.ValueOf(rows[y]).Elem())
+			c, cmpErr := compare(a, b)
+			if cmpErr != nil && cmpErr != errNull {
+				err = cmpErr
+			}
+			if c != 0 {
+				return (c < 0) != k.desc
+			}
+		}
+		return false
+	})
+	return err
+}
+
+// scan sets the destination of stmt to rows.
+func scan(stmt *gorm.Statement, rows []interface{}) error {
+	dest := reflect.ValueOf(stmt.Dest)
+	if dest.Kind() != reflect.Ptr {
+		return fmt.Errorf("dbtest: unsupported query destination %T", stmt.Dest)
+	}
+	dest = dest.Elem()
+
+	// Plucking a single column
+	column := ""
+	if len(stmt.Selects) == 1 {
+		column = stmt.Selects[0]
+	} else if sel, ok := stmt.Clauses["SELECT"].Expression.(clause.Select); ok && len(sel.Columns) == 1 {
+		column = sel.Columns[0].Name
+	}
+	if dest.Kind() == reflect.Slice && column != "" && reflect.Indirect(reflect.New(dest.Type().Elem())).Kind() != reflect.Struct {
+		f := stmt.Schema.LookUpField(column)
+		if f == nil {
+			return fmt.Errorf("dbtest: unknown column %s of %s", column, stmt.Table)
+		}
+		values := reflect.MakeSlice(dest.Type(), 0, len(rows))
+		for _, row := range rows {
+			v := reflect.Indirect(reflect.ValueOf(row)).FieldByIndex(f.StructField.Index)
+			values = reflect.Append(values, v.Convert(dest.Type().Elem()))
+		}
+		dest.Set(values)
+		return nil
+	}
+
+	switch dest.Kind() {
+	case reflect.Slice:
+		elem := dest.Type().Elem()
+		values := reflect.MakeSlice(dest.Type(), 0, len(rows))
+		for _, row := range rows {
+			v := reflect.ValueOf(copyRow(row))
+			if elem.Kind() != reflect.Ptr {
+				v = v.Elem()
+			}
+			values = reflect.Append(values, v)
+		}
+		dest.Set(values)
+	case reflect.Struct:
+		if len(rows) == 0 {
+			if stmt.RaiseErrorOnNotFound {
+				return gorm.ErrRecordNotFound
+			}
+			return nil
+		}
+		dest.Set(reflect.ValueOf(rows[0]).Elem())
+	default:
+		return fmt.Errorf("dbtest: unsupported query destination %T", stmt.Dest)
+	}
+	return nil
+}
+
+// primaryField returns the field gorm uses for clause.PrimaryKey: the prioritized primary field, or the first
+// column of the table if there is none (e.g. composite primary keys).
+func primaryField(sch *schema.Schema) *schema.Field {
+	if sch.PrioritizedPrimaryField != nil {
+		return sch.PrioritizedPrimaryField
+	}
+	if len(sch.DBNames) > 0 {
+		return sch.LookUpField(sch.DBNames[0])
+	}
+	return nil
+}
+
+// flatten returns the rows of the destination of an insert, a struct pointer or a slice of them.
+func flatten(dest interface{}) []interface{} {
+	rv := reflect.ValueOf(dest)
+	for rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Slice {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Slice {
+		return []interface{}{dest}
+	}
+
+	rows := make([]interface{}, rv.Len())
+	for j := range rows {
+		row := rv.Index(j)
+		if row.Kind() != reflect.Ptr && row.CanAddr() {
+			row = row.Addr()
+		}
+		rows[j] = row.Interface()
+	}
+	return rows
+}
+
+// pool is the connection pool of the DB, statements aren't executed in dry run mode so only transactions are used.
+type pool struct {
+	r *Recorder
+}
+
+func (p *pool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	p.r.mu.Lock()
+	defer p.r.mu.Unlock()
+	return &tx{pool: *p, state: p.r.state.clone()}, nil
+}
+
+func (p *pool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, errors.New("dbtest: statements are not executed")
+}
+
+func (p *pool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errors.New("dbtest: statements are not executed")
+}
+
+func (p *pool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("dbtest: statements are not executed")
+}
+
+func (p *pool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+// tx is a transaction working on a copy of the tables, which replaces the tables of the recorder once it commits.
+// Transactions aren't isolated from each other, the last one to commit wins.
+type tx struct {
+	pool
+	state      *state
+	aborted    bool
+	savepoints []savepoint
+}
+
+type savepoint struct {
+	name  string
+	state *state
+}
+
+func (t *tx) Commit() error {
+	if t.aborted {
+		return ErrTxAborted
+	}
+	t.r.mu.Lock()
+	defer t.r.mu.Unlock()
+	t.r.state = t.state
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.state = newState()
+	return nil
+}
+
+// raw handles the savepoint statements of t.
+func (t *tx) raw(stmt string) {
+	fields := strings.Fields(stmt)
+	switch {
+	case len(fields) == 2 && fields[0] == "SAVEPOINT":
+		t.savepoints = append(t.savepoints, savepoint{name: fields[1], state: t.state.clone()})
+	case len(fields) == 4 && strings.Join(fields[:3], " ") == "ROLLBACK TO SAVEPOINT":
+		for j := len(t.savepoints) - 1; j >= 0; j-- {
+			if sp := t.savepoints[j]; sp.name == fields[3] {
+				t.state, t.aborted = sp.state.clone(), false
+				t.savepoints = t.savepoints[:j+1]
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package dbtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type balance struct {
+	ID      uint   `gorm:"primaryKey"`
+	ChainID string `gorm:"uniqueIndex:idx_balance"`
+	Address string `gorm:"uniqueIndex:idx_balance"`
+	Amount  string
+	Height  int64
+}
+
+func balances(r *Recorder) []balance {
+	var rows []balance
+	for _, row := range r.Rows("balances") {
+		rows = append(rows, *row.(*balance))
+	}
+	return rows
+}
+
+func TestInsertConflicts(t *testing.T) {
+	db, r := New(t)
+
+	if err := db.Create(&balance{ChainID: "a", Address: "x", Amount: "1", Height: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&balance{ChainID: "a", Address: "x", Amount: "2", Height: 2}).Error; err == nil {
+		t.Error("expected a unique constraint violation")
+	}
+
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&[]balance{
+		{ChainID: "a", Address: "x", Amount: "3"},
+		{ChainID: "b", Address: "x", Amount: "4"},
+	})
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if res.RowsAffected != 1 {
+		t.Errorf("got %d rows affected, expected 1", res.RowsAffected)
+	}
+
+	// Like a postgres sequence, conflicting inserts use up IDs
+	expected := []balance{
+		{ID: 1, ChainID: "a", Address: "x", Amount: "1", Height: 1},
+		{ID: 4, ChainID: "b", Address: "x", Amount: "4"},
+	}
+	if got := balances(r); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+}
+
+func TestUpsertExpressions(t *testing.T) {
+	db, r := New(t)
+
+	upsert := func(amount string, height int64) int64 {
+		res := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "chain_id"}, {Name: "address"}},
+			Where:   clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "balances.height <= excluded.height"}}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "amount"}, Value: clause.Expr{SQL: "balances.amount + excluded.amount"}},
+				{Column: clause.Column{Name: "height"}, Value: clause.Expr{SQL: "GREATEST(balances.height, excluded.height, ?)", Vars: []interface{}{0}}},
+			},
+		}).Create(&balance{ChainID: "a", Address: "x", Amount: amount, Height: height})
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		return res.RowsAffected
+	}
+
+	upsert("10", 1)
+	if affected := upsert("-3", 2); affected != 1 {
+		t.Errorf("got %d rows affected, expected 1", affected)
+	}
+	// Older than the stored height
+	if affected := upsert("100", 1); affected != 0 {
+		t.Errorf("got %d rows affected, expected 0", affected)
+	}
+
+	expected := []balance{{ID: 1, ChainID: "a", Address: "x", Amount: "7", Height: 2}}
+	if got := balances(r); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+}
+
+func TestUpdateDeleteQuery(t *testing.T) {
+	db, r := New(t)
+
+	for j, chainID := range []string{"a", "a", "b", "a"} {
+		if err := db.Create(&balance{ChainID: chainID, Address: string(rune('w' + j)), Height: int64(j + 1)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := db.Model(&balance{}).Where("chain_id = ? AND height IN ?", "a", []int64{1, 2, 3}).Update("amount", "5")
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if res.RowsAffected != 2 {
+		t.Errorf("got %d rows updated, expected 2", res.RowsAffected)
+	}
+	if err := db.Where(&balance{ChainID: "a", Height: 4}).Delete(&balance{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	if err := db.Model(&balance{}).Where("amount IS NOT NULL AND amount = ?", "5").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got count %d, expected 2", count)
+	}
+
+	if err := db.Model(&balance{}).Where("address LIKE ? AND address NOT LIKE ?", "_", "%x%").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got LIKE count %d, expected 2", count)
+	}
+
+	var heights []int64
+	if err := db.Model(&balance{}).Order("height desc").Limit(2).Pluck("height", &heights).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(heights, []int64{3, 2}) {
+		t.Errorf("got heights %v, expected [3 2]", heights)
+	}
+
+	var first balance
+	if err := db.Where("chain_id = ?", "b").First(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	if first.Address != "y" {
+		t.Errorf("got address %s, expected y", first.Address)
+	}
+	if err := db.Where("chain_id = ?", "c").First(&first).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("got error %v, expected record not found", err)
+	}
+
+	if len(r.Rows("balances")) != 3 {
+		t.Errorf("got %d rows, expected 3", len(r.Rows("balances")))
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	db, r := New(t)
+	failed := errors.New("failed")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&balance{ChainID: "a", Address: "x"}).Error; err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Errorf("got error %v, expected %v", err, failed)
+	}
+	if rows := r.Rows("balances"); len(rows) != 0 {
+		t.Errorf("got rows %v of a rolled back transaction", rows)
+	}
+
+	r.Fail("balances", failed)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		tx.SavePoint("sp")
+		if err := tx.Create(&balance{ChainID: "a", Address: "x"}).Error; err != failed {
+			t.Errorf("got error %v, expected %v", err, failed)
+		}
+		if err := tx.Create(&balance{ChainID: "a", Address: "y"}).Error; err != ErrTxAborted {
+			t.Errorf("got error %v, expected %v", err, ErrTxAborted)
+		}
+		return tx.RollbackTo("sp").Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Fail("balances", nil)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&balance{ChainID: "a", Address: "z"}).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := balances(r); len(rows) != 1 || rows[0].Address != "z" {
+		t.Errorf("got rows %+v, expected the one committed row", rows)
+	}
+}
+
+func TestHasTable(t *testing.T) {
+	db, _ := New(t)
+	if db.Migrator().HasTable(&balance{}) {
+		t.Error("table exists before any row was written to it")
+	}
+	if err := db.Create(&balance{ChainID: "a", Address: "x"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasTable(&balance{}) {
+		t.Error("table doesn't exist after a row was written to it")
+	}
+}
+
+func TestGroupHaving(t *testing.T) {
+	db, _ := New(t)
+	for _, b := range []balance{
+		{ChainID: "a", Address: "x", Height: 1},
+		{ChainID: "b", Address: "x", Height: 1},
+		{ChainID: "a", Address: "y", Height: 2},
+		{ChainID: "a", Address: "z", Height: 3},
+		{ChainID: "b", Address: "z", Height: 3},
+	} {
+		b := b
+		if err := db.Create(&b).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var heights []int64
+	err := db.Model(&balance{}).Where("height <= ?", 3).Group("height").
+		Having("COUNT(DISTINCT chain_id) = ?", 2).Order("height").Pluck("height", &heights).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(heights, []int64{1, 3}) {
+		t.Errorf("got heights %v, expected [1 3]", heights)
+	}
+
+	if err := db.Model(&balance{}).Group("height").Having("COUNT(*) < ?", 2).Pluck("height", &heights).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(heights, []int64{2}) {
+		t.Errorf("got heights %v, expected [2]", heights)
+	}
+
+	if err := db.Model(&balance{}).Group("height").Having("SUM(height) > ?", 1).Pluck("height", &heights).Error; err == nil {
+		t.Error("expected an error for an unsupported HAVING condition")
+	}
+}
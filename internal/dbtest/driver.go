@@ -0,0 +1,121 @@
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"gorm.io/gorm"
+)
+
+// hasTableSQL matches the query the postgres Migrator uses for HasTable.
+var hasTableSQL = regexp.MustCompile(`^SELECT count\(\*\) FROM information_schema\.tables WHERE table_schema = (?:CURRENT_SCHEMA\(\)|\$\d) AND table_name = \$\d AND table_type = \$\d$`)
+
+// stateKey is the context key of the state a row query is executed against.
+type stateKey struct{}
+
+// row is the callback answering the row queries of db (Row, Rows, and Raw(...).Scan) with the rows of a sql driver
+// reading the tables of the recorder. Only the query checking whether a table exists is supported, tables exist
+// once a row was written to them.
+func (r *Recorder) row(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+
+	r.mu.Lock()
+	st := r.state
+	if t, ok := db.Statement.ConnPool.(*tx); ok {
+		st = t.state
+	}
+	r.mu.Unlock()
+
+	ctx := context.WithValue(db.Statement.Context, stateKey{}, st)
+	if rows, ok := db.Get("rows"); ok && rows.(bool) {
+		db.Statement.Settings.Delete("rows")
+		db.Statement.Dest, db.Error = r.sqlDB.QueryContext(ctx, db.Statement.SQL.String(), db.Statement.Vars...)
+	} else {
+		db.Statement.Dest = r.sqlDB.QueryRowContext(ctx, db.Statement.SQL.String(), db.Statement.Vars...)
+	}
+}
+
+// connector returns connections answering row queries against the state passed in their context.
+type connector struct {
+	r *Recorder
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return conn{r: c.r}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return nil
+}
+
+type conn struct {
+	r *Recorder
+}
+
+func (c conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("dbtest: prepared statements are not supported")
+}
+
+func (c conn) Close() error {
+	return nil
+}
+
+func (c conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("dbtest: transactions are not supported on row queries")
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	st, _ := ctx.Value(stateKey{}).(*state)
+	if st == nil {
+		return nil, errors.New("dbtest: row query without a state")
+	}
+
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+
+	if hasTableSQL.MatchString(query) && len(args) >= 2 {
+		var count int64
+		if table, ok := args[len(args)-2].Value.(string); ok {
+			if _, exists := st.tables[table]; exists {
+				count = 1
+			}
+		}
+		return &rows{columns: []string{"count"}, values: [][]driver.Value{{count}}}, nil
+	}
+	return nil, fmt.Errorf("dbtest: unsupported row query %s", query)
+}
+
+// rows are the rows of a row query.
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// openSQLDB returns the sql.DB used to answer the row queries of r.
+func openSQLDB(r *Recorder) *sql.DB {
+	return sql.OpenDB(connector{r: r})
+}
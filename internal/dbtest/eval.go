@@ -0,0 +1,732 @@
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// errNull is returned when comparing or computing with a NULL value, conditions comparing NULL are false.
+var errNull = errors.New("dbtest: null value")
+
+// env evaluates conditions and assignments against row of table, and against the row excluded by an upsert.
+type env struct {
+	schema   *schema.Schema
+	table    string
+	row      reflect.Value
+	excluded reflect.Value
+}
+
+// where returns whether all the expressions of w hold.
+func (e *env) where(w clause.Where) (bool, error) {
+	return e.all(w.Exprs)
+}
+
+func (e *env) all(exprs []clause.Expression) (bool, error) {
+	for _, expr := range exprs {
+		ok, err := e.cond(expr)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// cond returns whether the condition expr holds.
+func (e *env) cond(expr clause.Expression) (bool, error) {
+	switch c := expr.(type) {
+	case clause.Where:
+		return e.all(c.Exprs)
+	case clause.AndConditions:
+		return e.all(c.Exprs)
+	case clause.OrConditions:
+		for _, expr := range c.Exprs {
+			ok, err := e.cond(expr)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case clause.NotConditions:
+		for _, expr := range c.Exprs {
+			ok, err := e.cond(expr)
+			if err != nil || ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case clause.Expr:
+		p := &parser{env: e, tokens: tokenize(c.SQL), vars: c.Vars}
+		ok, err := p.or()
+		if err == nil && p.pos < len(p.tokens) {
+			err = fmt.Errorf("dbtest: unsupported condition %q", c.SQL)
+		}
+		return ok, err
+	case clause.Eq:
+		return e.compareColumn(c.Column, c.Value, "=")
+	case clause.Neq:
+		return e.compareColumn(c.Column, c.Value, "<>")
+	case clause.Gt:
+		return e.compareColumn(c.Column, c.Value, ">")
+	case clause.Gte:
+		return e.compareColumn(c.Column, c.Value, ">=")
+	case clause.Lt:
+		return e.compareColumn(c.Column, c.Value, "<")
+	case clause.Lte:
+		return e.compareColumn(c.Column, c.Value, "<=")
+	case clause.IN:
+		v, err := e.column(c.Column)
+		if err != nil {
+			return false, err
+		}
+		return in(v, c.Values)
+	}
+	return false, fmt.Errorf("dbtest: unsupported condition %T", expr)
+}
+
+// compareColumn compares the value of column with value, a slice value is a list of values for =.
+func (e *env) compareColumn(column, value interface{}, op string) (bool, error) {
+	v, err := e.column(column)
+	if err != nil {
+		return false, err
+	}
+	if list, ok := listOf(value); ok && op == "=" {
+		return in(v, list)
+	}
+	if norm(value) == nil {
+		// Eq and Neq with a nil value are IS NULL and IS NOT NULL
+		return (norm(v) == nil) == (op == "="), nil
+	}
+	return compareOp(v, value, op)
+}
+
+// column returns the value of the column named by a clause.Column or a string.
+func (e *env) column(column interface{}) (interface{}, error) {
+	switch c := column.(type) {
+	case clause.Column:
+		name := c.Name
+		if name == clause.PrimaryKey {
+			f := primaryField(e.schema)
+			if f == nil {
+				return nil, fmt.Errorf("dbtest: %s has no primary key", e.table)
+			}
+			name = f.DBName
+		}
+		if c.Table != "" && c.Table != clause.CurrentTable {
+			name = c.Table + "." + name
+		}
+		return e.ident(name)
+	case string:
+		return e.ident(c)
+	}
+	return nil, fmt.Errorf("dbtest: unsupported column %T", column)
+}
+
+// ident returns the value of the possibly table qualified and quoted column ident.
+func (e *env) ident(ident string) (interface{}, error) {
+	row := e.row
+	parts := strings.Split(ident, ".")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("dbtest: unsupported column %s", ident)
+	}
+	if len(parts) == 2 {
+		switch table := unquote(parts[0]); table {
+		case "excluded":
+			if !e.excluded.IsValid() {
+				return nil, fmt.Errorf("dbtest: %s outside of an upsert", ident)
+			}
+			row = e.excluded
+		case e.table:
+		default:
+			return nil, fmt.Errorf("dbtest: unknown table %s", table)
+		}
+	}
+
+	f := e.schema.LookUpField(unquote(parts[len(parts)-1]))
+	if f == nil {
+		return nil, fmt.Errorf("dbtest: unknown column %s of %s", ident, e.table)
+	}
+	v, _ := f.ValueOf(context.Background(), row)
+	return v, nil
+}
+
+// assign applies the assignments to the row.
+func (e *env) assign(set clause.Set) error {
+	for _, a := range set {
+		f := e.schema.LookUpField(a.Column.Name)
+		if f == nil {
+			return fmt.Errorf("dbtest: unknown column %s of %s", a.Column.Name, e.table)
+		}
+
+		var (
+			v   interface{}
+			err error
+		)
+		switch value := a.Value.(type) {
+		case clause.Column:
+			v, err = e.column(value)
+		case clause.Expr:
+			p := &parser{env: e, tokens: tokenize(value.SQL), vars: value.Vars}
+			v, err = p.arith()
+			if err == nil && p.pos < len(p.tokens) {
+				err = fmt.Errorf("dbtest: unsupported expression %q", value.SQL)
+			}
+			if err == errNull {
+				v, err = nil, nil
+			}
+		default:
+			v = value
+		}
+		if err != nil {
+			return err
+		}
+		if err := setField(f, e.row, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setField sets the field of row to v, converting computed integers to the type of the field.
+func setField(f *schema.Field, row reflect.Value, v interface{}) error {
+	if n, ok := v.(*big.Int); ok {
+		switch f.IndirectFieldType.Kind() {
+		case reflect.String:
+			v = n.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v = n.Int64()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v = n.Uint64()
+		default:
+			return fmt.Errorf("dbtest: can't assign a number to %s", f.DBName)
+		}
+	}
+	return f.Set(context.Background(), row, v)
+}
+
+// parser evaluates the SQL of a clause.Expr, consuming its vars for the ? placeholders.
+type parser struct {
+	env     *env
+	tokens  []string
+	pos     int
+	vars    []interface{}
+	nextVar int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) accept(tokens ...string) bool {
+	for j, token := range tokens {
+		if p.pos+j >= len(p.tokens) || !strings.EqualFold(p.tokens[p.pos+j], token) {
+			return false
+		}
+	}
+	p.pos += len(tokens)
+	return true
+}
+
+func (p *parser) or() (bool, error) {
+	ok, err := p.and()
+	for err == nil && p.accept("OR") {
+		var next bool
+		next, err = p.and()
+		ok = ok || next
+	}
+	return ok, err
+}
+
+func (p *parser) and() (bool, error) {
+	ok, err := p.not()
+	for err == nil && p.accept("AND") {
+		var next bool
+		next, err = p.not()
+		ok = ok && next
+	}
+	return ok, err
+}
+
+func (p *parser) not() (bool, error) {
+	if p.accept("NOT") {
+		ok, err := p.not()
+		return !ok, err
+	}
+	if p.peek() == "(" {
+		start, nextVar := p.pos, p.nextVar
+		p.pos++
+		ok, err := p.or()
+		if err == nil && p.accept(")") {
+			return ok, nil
+		}
+		// Not a parenthesized condition, e.g. (a + b) > c
+		p.pos, p.nextVar = start, nextVar
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (bool, error) {
+	left, err := p.arith()
+	if err != nil && err != errNull {
+		return false, err
+	}
+	leftNull := err == errNull || norm(left) == nil
+
+	switch {
+	case p.accept("IS", "NOT", "NULL"):
+		return !leftNull, nil
+	case p.accept("IS", "NULL"):
+		return leftNull, nil
+	case p.accept("NOT", "IN"):
+		list, err := p.list()
+		if err != nil || leftNull {
+			return false, err
+		}
+		ok, err := in(left, list)
+		return !ok && err == nil, err
+	case p.accept("IN"):
+		list, err := p.list()
+		if err != nil || leftNull {
+			return false, err
+		}
+		return in(left, list)
+	case p.accept("NOT", "LIKE"):
+		ok, err := p.like(left, leftNull)
+		return !ok && err == nil && !leftNull, err
+	case p.accept("LIKE"):
+		return p.like(left, leftNull)
+	}
+
+	op := p.peek()
+	switch op {
+	case "=", "<>", "!=", ">", ">=", "<", "<=":
+		p.pos++
+	default:
+		return false, fmt.Errorf("dbtest: unsupported operator %q", op)
+	}
+	right, err := p.arith()
+	if err == errNull || leftNull {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return compareOp(left, right, op)
+}
+
+// like parses the pattern of LIKE and reports whether left matches it, % matches any sequence of characters and _
+// any single character.
+func (p *parser) like(left interface{}, leftNull bool) (bool, error) {
+	pattern, err := p.arith()
+	if err == errNull || leftNull {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s, ok := norm(left).(string)
+	pat, patOK := norm(pattern).(string)
+	if !ok || !patOK {
+		return false, fmt.Errorf("dbtest: unsupported LIKE of %v and %v", left, pattern)
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	for _, r := range pat {
+		switch r {
+		case '%':
+			re.WriteString(".*")
+		case '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String()).MatchString(s), nil
+}
+
+// list parses the values of IN, a ? placeholder for a slice or a parenthesized list.
+func (p *parser) list() ([]interface{}, error) {
+	if p.accept("?") {
+		v, err := p.variable()
+		if err != nil {
+			return nil, err
+		}
+		if list, ok := listOf(v); ok {
+			return list, nil
+		}
+		return []interface{}{v}, nil
+	}
+	if !p.accept("(") {
+		return nil, fmt.Errorf("dbtest: unsupported IN list at %q", p.peek())
+	}
+	var list []interface{}
+	for {
+		v, err := p.arith()
+		if err != nil && err != errNull {
+			return nil, err
+		}
+		if values, ok := listOf(v); ok {
+			list = append(list, values...)
+		} else {
+			list = append(list, v)
+		}
+		if p.accept(")") {
+			return list, nil
+		}
+		if !p.accept(",") {
+			return nil, fmt.Errorf("dbtest: unsupported IN list at %q", p.peek())
+		}
+	}
+}
+
+// arith evaluates additions and subtractions of integers and numeric strings.
+func (p *parser) arith() (interface{}, error) {
+	v, err := p.primary()
+	for {
+		var sign int
+		switch {
+		case p.accept("+"):
+			sign = 1
+		case p.accept("-"):
+			sign = -1
+		default:
+			return v, err
+		}
+		next, nextErr := p.primary()
+		if err == nil {
+			err = nextErr
+		}
+		if err != nil {
+			continue
+		}
+		a, aok := toInt(v)
+		b, bok := toInt(next)
+		if !aok || !bok {
+			if norm(v) == nil || norm(next) == nil {
+				err = errNull
+				continue
+			}
+			return nil, fmt.Errorf("dbtest: can't compute %v %+d * %v", v, sign, next)
+		}
+		if sign > 0 {
+			v = new(big.Int).Add(a, b)
+		} else {
+			v = new(big.Int).Sub(a, b)
+		}
+	}
+}
+
+func (p *parser) primary() (interface{}, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, errors.New("dbtest: unexpected end of expression")
+	case token == "?":
+		p.pos++
+		return p.variable()
+	case token == "(":
+		p.pos++
+		v, err := p.arith()
+		if !p.accept(")") && (err == nil || err == errNull) {
+			err = fmt.Errorf("dbtest: unsupported expression at %q", p.peek())
+		}
+		return v, err
+	case unicode.IsDigit(rune(token[0])):
+		p.pos++
+		n, ok := new(big.Int).SetString(token, 10)
+		if !ok {
+			return nil, fmt.Errorf("dbtest: unsupported number %s", token)
+		}
+		return n, nil
+	case token[0] == '\'':
+		p.pos++
+		return strings.ReplaceAll(strings.Trim(token, "'"), "''", "'"), nil
+	case strings.EqualFold(token, "NULL"):
+		p.pos++
+		return nil, errNull
+	case strings.EqualFold(token, "GREATEST") || strings.EqualFold(token, "LEAST"):
+		p.pos++
+		return p.extreme(strings.EqualFold(token, "GREATEST"))
+	}
+	p.pos++
+	v, err := p.env.ident(token)
+	if err == nil && norm(v) == nil {
+		err = errNull
+	}
+	return v, err
+}
+
+// extreme evaluates the arguments of GREATEST or LEAST, which ignore NULL arguments.
+func (p *parser) extreme(greatest bool) (interface{}, error) {
+	if !p.accept("(") {
+		return nil, fmt.Errorf("dbtest: unsupported expression at %q", p.peek())
+	}
+	var result interface{}
+	for {
+		v, err := p.arith()
+		if err != nil && err != errNull {
+			return nil, err
+		}
+		if err == nil {
+			if result == nil {
+				result = v
+			} else {
+				c, err := compare(v, result)
+				if err != nil {
+					return nil, err
+				}
+				if (c > 0) == greatest && c != 0 {
+					result = v
+				}
+			}
+		}
+		if p.accept(")") {
+			if result == nil {
+				return nil, errNull
+			}
+			return result, nil
+		}
+		if !p.accept(",") {
+			return nil, fmt.Errorf("dbtest: unsupported expression at %q", p.peek())
+		}
+	}
+}
+
+func (p *parser) variable() (interface{}, error) {
+	if p.nextVar >= len(p.vars) {
+		return nil, errors.New("dbtest: missing expression var")
+	}
+	v := p.vars[p.nextVar]
+	p.nextVar++
+	return v, nil
+}
+
+// tokenize splits SQL into identifiers (including qualified and quoted ones), numbers, strings, placeholders
+// and operators.
+func tokenize(sql string) []string {
+	var tokens []string
+	for j := 0; j < len(sql); {
+		c := sql[j]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			j++
+		case strings.ContainsRune("()?,+-", rune(c)):
+			tokens = append(tokens, string(c))
+			j++
+		case strings.ContainsRune("<>=!", rune(c)):
+			k := j + 1
+			for k < len(sql) && strings.ContainsRune("<>=", rune(sql[k])) {
+				k++
+			}
+			tokens = append(tokens, sql[j:k])
+			j = k
+		case c == '\'':
+			k := j + 1
+			for k < len(sql) && (sql[k] != '\'' || (k+1 < len(sql) && sql[k+1] == '\'')) {
+				if sql[k] == '\'' {
+					k++
+				}
+				k++
+			}
+			tokens = append(tokens, sql[j:k+1])
+			j = k + 1
+		default:
+			k := j
+			for k < len(sql) && !strings.ContainsRune(" \t\n()?,+-<>=!'", rune(sql[k])) {
+				k++
+			}
+			tokens = append(tokens, sql[j:k])
+			j = k
+		}
+	}
+	return tokens
+}
+
+func unquote(ident string) string {
+	return strings.Trim(ident, "\"`")
+}
+
+// listOf returns the values of v if it's a slice, other than []byte.
+func listOf(v interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	list := make([]interface{}, rv.Len())
+	for j := range list {
+		list[j] = rv.Index(j).Interface()
+	}
+	return list, true
+}
+
+func in(v interface{}, list []interface{}) (bool, error) {
+	for _, item := range list {
+		c, err := compare(v, item)
+		if err == errNull {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if c == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func compareOp(a, b interface{}, op string) (bool, error) {
+	c, err := compare(a, b)
+	if err == errNull {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "=":
+		return c == 0, nil
+	case "<>", "!=":
+		return c != 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	}
+	return false, fmt.Errorf("dbtest: unsupported operator %q", op)
+}
+
+// compare compares two values like postgres would. Integers and numeric strings are compared as numbers when either
+// side is an integer, errNull is returned if either side is NULL.
+func compare(a, b interface{}) (int, error) {
+	a, b = norm(a), norm(b)
+	if a == nil || b == nil {
+		return 0, errNull
+	}
+
+	_, aInt := a.(*big.Int)
+	_, bInt := b.(*big.Int)
+	if aInt || bInt {
+		x, xok := toInt(a)
+		y, yok := toInt(b)
+		if xok && yok {
+			return x.Cmp(y), nil
+		}
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y), nil
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, nil
+			case x.After(y):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			if x == y {
+				return 0, nil
+			}
+			if !x {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("dbtest: can't compare %T with %T", a, b)
+}
+
+// norm normalizes v for comparisons: driver values are resolved, pointers dereferenced, integers converted to
+// *big.Int and floats to float64. NULL values are returned as nil.
+func norm(v interface{}) interface{} {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil
+		}
+		dv, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		v = dv
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		if _, ok := v.(*big.Int); ok {
+			return v
+		}
+		rv = rv.Elem()
+		v = rv.Interface()
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+	return v
+}
+
+// toInt returns v as an integer, if it's an integer or a string holding one.
+func toInt(v interface{}) (*big.Int, bool) {
+	switch x := norm(v).(type) {
+	case *big.Int:
+		return x, true
+	case string:
+		return new(big.Int).SetString(x, 10)
+	}
+	return nil, false
+}
@@ -2,6 +2,7 @@ package indexdebug
 
 import (
 	"context"
+	"encoding/json"
 	"net"
 	"net/http"
 	"net/http/pprof"
@@ -9,11 +10,18 @@ import (
 	"go.uber.org/zap"
 )
 
+// Route is an additional endpoint to be served by the debug server.
+type Route struct {
+	Pattern string
+	Handler http.Handler
+}
+
 // StartDebugServer starts a debug server in a background goroutine,
 // accepting connections on the given listener.
 // Any HTTP logging will be written at info level to the given logger.
 // The server will be forcefully shut down when ctx finishes.
-func StartDebugServer(ctx context.Context, log *zap.Logger, ln net.Listener) {
+// Any routes passed in are registered alongside the pprof endpoints.
+func StartDebugServer(ctx context.Context, log *zap.Logger, ln net.Listener, routes ...Route) {
 	// Although we could just import net/http/pprof and rely on the default global server,
 	// we may want many instances of this in test,
 	// and we will probably want more endpoints as time goes on,
@@ -27,6 +35,10 @@ func StartDebugServer(ctx context.Context, log *zap.Logger, ln net.Listener) {
 	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 
+	for _, r := range routes {
+		mux.Handle(r.Pattern, r.Handler)
+	}
+
 	// And redirect the browser to the /debug/pprof root,
 	// so operators don't see a mysterious 404 page.
 	mux.Handle("/", http.RedirectHandler("/debug/pprof", http.StatusSeeOther))
@@ -46,3 +58,13 @@ func StartDebugServer(ctx context.Context, log *zap.Logger, ln net.Listener) {
 		srv.Close()
 	}()
 }
+
+// JSONHandler returns an http.Handler that responds with the JSON encoding of the value returned by fn.
+func JSONHandler(log *zap.Logger, fn func() interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(fn()); err != nil {
+			log.Warn("Failed to encode debug response", zap.String("path", r.URL.Path), zap.Error(err))
+		}
+	})
+}
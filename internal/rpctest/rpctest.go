@@ -0,0 +1,239 @@
+// Package rpctest provides a tendermint RPC client for tests that serves blocks added by the test instead of
+// querying a node. The client can also be served over JSON-RPC for tests building their own client.
+package rpctest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/bytes"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// Node is an RPC client serving the blocks added to it and answering the ABCI queries handled with HandleQuery,
+// calling any other method of the client panics.
+type Node struct {
+	rpcclient.Client
+
+	mu      sync.Mutex
+	chainID string
+	blocks  map[int64]*coretypes.ResultBlock
+	results map[int64]*coretypes.ResultBlockResults
+	queries map[string]QueryHandler
+	queried map[string]int
+
+	validators map[int64][]*tmtypes.Validator
+}
+
+// QueryHandler returns the response of an ABCI query, e.g. a gRPC query, for the request data.
+type QueryHandler func(data []byte) (codec.ProtoMarshaler, error)
+
+// New returns a Node of the chain with chainID, without any blocks.
+func New(chainID string) *Node {
+	return &Node{
+		chainID: chainID,
+		blocks:  make(map[int64]*coretypes.ResultBlock),
+		results: make(map[int64]*coretypes.ResultBlockResults),
+		queries: make(map[string]QueryHandler),
+		queried: make(map[string]int),
+
+		validators: make(map[int64][]*tmtypes.Validator),
+	}
+}
+
+// SetValidators sets the validator set of the node at height.
+func (n *Node) SetValidators(height int64, validators []*tmtypes.Validator) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.validators[height] = validators
+}
+
+// Validators serves the validator set set at height, paginated like a node would.
+func (n *Node) Validators(ctx context.Context, height *int64, page, perPage *int) (*coretypes.ResultValidators, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	validators, ok := n.validators[*height]
+	if !ok {
+		return nil, fmt.Errorf("validator set for height %d is not available", *height)
+	}
+
+	start := (*page - 1) * *perPage
+	if start > len(validators) {
+		start = len(validators)
+	}
+	end := start + *perPage
+	if end > len(validators) {
+		end = len(validators)
+	}
+	return &coretypes.ResultValidators{
+		BlockHeight: *height,
+		Validators:  validators[start:end],
+		Count:       end - start,
+		Total:       len(validators),
+	}, nil
+}
+
+// HandleQuery answers the ABCI queries for path, e.g. "/ibc.core.channel.v1.Query/ChannelClientState", with handle.
+// Queries for paths without a handler fail.
+func (n *Node) HandleQuery(path string, handle QueryHandler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.queries[path] = handle
+}
+
+// Queried returns the number of ABCI queries made for path.
+func (n *Node) Queried(path string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.queried[path]
+}
+
+func (n *Node) ABCIQueryWithOptions(ctx context.Context, path string, data bytes.HexBytes, opts rpcclient.ABCIQueryOptions) (*coretypes.ResultABCIQuery, error) {
+	n.mu.Lock()
+	n.queried[path]++
+	handle, ok := n.queries[path]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("query %s is not supported", path)
+	}
+
+	res, err := handle(data)
+	if err != nil {
+		return nil, err
+	}
+	bz, err := res.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &coretypes.ResultABCIQuery{Response: abcitypes.ResponseQuery{Value: bz, Height: opts.Height}}, nil
+}
+
+// AddBlock adds the block at height made at blockTime, containing txs with the specified results, and returns it.
+// results must contain one entry per tx.
+func (n *Node) AddBlock(height int64, blockTime time.Time, txs [][]byte, results []*abcitypes.ResponseDeliverTx) *coretypes.ResultBlock {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	data := make(tmtypes.Txs, len(txs))
+	for j, tx := range txs {
+		data[j] = tx
+	}
+	block := &coretypes.ResultBlock{Block: &tmtypes.Block{
+		Header: tmtypes.Header{ChainID: n.chainID, Height: height, Time: blockTime},
+		Data:   tmtypes.Data{Txs: data},
+	}}
+	n.blocks[height] = block
+	n.results[height] = &coretypes.ResultBlockResults{Height: height, TxsResults: results}
+	return block
+}
+
+// Status reports the highest block added to the node as its latest block.
+func (n *Node) Status(ctx context.Context) (*coretypes.ResultStatus, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := &coretypes.ResultStatus{}
+	for height := range n.blocks {
+		if height > status.SyncInfo.LatestBlockHeight {
+			status.SyncInfo.LatestBlockHeight = height
+		}
+	}
+	return status, nil
+}
+
+func (n *Node) Block(ctx context.Context, height *int64) (*coretypes.ResultBlock, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	block, ok := n.blocks[*height]
+	if !ok {
+		return nil, fmt.Errorf("height %d is not available", *height)
+	}
+	return block, nil
+}
+
+func (n *Node) BlockResults(ctx context.Context, height *int64) (*coretypes.ResultBlockResults, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	results, ok := n.results[*height]
+	if !ok {
+		return nil, fmt.Errorf("block results for height %d are not available", *height)
+	}
+	return results, nil
+}
+
+func (n *Node) Tx(ctx context.Context, hash []byte, prove bool) (*coretypes.ResultTx, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for height, block := range n.blocks {
+		for j, tx := range block.Block.Data.Txs {
+			if string(tx.Hash()) == string(hash) {
+				return &coretypes.ResultTx{
+					Hash:     hash,
+					Height:   height,
+					Index:    uint32(j),
+					TxResult: *n.results[height].TxsResults[j],
+					Tx:       tx,
+				}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("tx %X not found", hash)
+}
+
+// ChainID returns the chain id of the node's blocks.
+func (n *Node) ChainID() string {
+	return n.chainID
+}
+
+// ServeHTTP serves the status, block, block_results and tx methods of the node over JSON-RPC.
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req rpctypes.RPCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var params struct {
+		Height string `json:"height"`
+		Hash   []byte `json:"hash"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	height, _ := strconv.ParseInt(params.Height, 10, 64)
+
+	var (
+		result interface{}
+		err    error
+	)
+	switch req.Method {
+	case "status":
+		result, err = n.Status(r.Context())
+	case "block":
+		result, err = n.Block(r.Context(), &height)
+	case "block_results":
+		result, err = n.BlockResults(r.Context(), &height)
+	case "tx":
+		result, err = n.Tx(r.Context(), params.Hash, false)
+	default:
+		err = fmt.Errorf("method %s is not supported", req.Method)
+	}
+
+	res := rpctypes.NewRPCSuccessResponse(req.ID, result)
+	if err != nil {
+		res = rpctypes.RPCInternalError(req.ID, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}